@@ -32,6 +32,8 @@ func printUsage() {
 	fmt.Println("        Show version")
 	fmt.Println("  -test-config")
 	fmt.Println("        Test config file")
+	fmt.Println("  -dump-graph [dot|mermaid]")
+	fmt.Println("        Print the graph of the pipelines (default format \"dot\")")
 }
 
 func InitLogger(logger *logger.Logger, config *pkgconfig.Config) {
@@ -88,6 +90,7 @@ func main() {
 	verFlag := false
 	configPath := "./config.yml"
 	testFlag := false
+	graphFormat := ""
 
 	// Server for pprof
 	// go func() {
@@ -113,6 +116,12 @@ func main() {
 			os.Exit(0)
 		case "-test-config":
 			testFlag = true
+		case "-dump-graph":
+			graphFormat = pkginit.GraphFormatDOT
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				graphFormat = args[i+1]
+				i++ // Skip the next argument
+			}
 		default:
 			if strings.HasPrefix(args[i], "-") {
 				printUsage()
@@ -138,6 +147,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	// print the graph of the pipelines without starting the workers
+	if len(graphFormat) > 0 {
+		graph, err := pkginit.GetPipelinesGraph(config, graphFormat)
+		if err != nil {
+			fmt.Printf("main - graph error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(graph)
+		os.Exit(0)
+	}
+
 	// If PID file is specified in the config, create it
 	if config.Global.PidFile != "" {
 		pid, err := createPIDFile(config.Global.PidFile)
@@ -181,6 +201,23 @@ func main() {
 		}
 	}
 
+	// admin api, the config and the workers are locked by the reload
+	adminServer := pkginit.NewAdminServer(config, logger, mapLoggers, mapCollectors, metrics)
+	applyConfig := func(previousPipelines []pkgconfig.ConfigPipelines) error {
+		// reload logger and multiplexer
+		InitLogger(logger, config)
+		if pkginit.IsMuxEnabled(config) {
+			pkginit.ReloadMultiplexer(mapLoggers, mapCollectors, config, logger)
+		}
+		if pkginit.IsPipelinesEnabled(config) {
+			if err := pkginit.ReloadPipelines(mapLoggers, mapCollectors, previousPipelines, config, logger, metrics); err != nil {
+				config.Pipelines = previousPipelines
+				return fmt.Errorf("reload pipelines error: %w", err)
+			}
+		}
+		return nil
+	}
+
 	// Handle Ctrl-C with SIG TERM and SIGHUP
 	sigTerm := make(chan os.Signal, 1)
 	sigHUP := make(chan os.Signal, 1)
@@ -196,10 +233,35 @@ func main() {
 				removePIDFile(config)
 				os.Exit(1)
 
+			case err := <-adminServer.OnError():
+				logger.Error("main - unable to start admin api: %v", err)
+				removePIDFile(config)
+				os.Exit(1)
+
+			case reply := <-adminServer.OnReload():
+				logger.Warning("main - reload requested from the admin api")
+
+				adminServer.Lock()
+				previousPipelines := append([]pkgconfig.ConfigPipelines{}, config.Pipelines...)
+				err := pkgconfig.ReloadConfig(configPath, config)
+				if err != nil {
+					err = fmt.Errorf("reload config error: %w", err)
+				} else {
+					err = applyConfig(previousPipelines)
+				}
+				adminServer.Unlock()
+
+				if err != nil {
+					logger.Error("main - %v", err)
+				}
+				reply <- err
+
 			case <-sigHUP:
 				logger.Warning("main - SIGHUP received")
 
-				// read config
+				// read config, the previous pipelines are kept to apply the differences
+				adminServer.Lock()
+				previousPipelines := append([]pkgconfig.ConfigPipelines{}, config.Pipelines...)
 				err := pkgconfig.ReloadConfig(configPath, config)
 				if err != nil {
 					logger.Error("main - reload config error:  %v", err)
@@ -207,14 +269,10 @@ func main() {
 					os.Exit(1)
 				}
 
-				// reload logger and multiplexer
-				InitLogger(logger, config)
-				if pkginit.IsMuxEnabled(config) {
-					pkginit.ReloadMultiplexer(mapLoggers, mapCollectors, config, logger)
-				}
-				if pkginit.IsPipelinesEnabled(config) {
-					pkginit.ReloadPipelines(mapLoggers, mapCollectors, config, logger)
+				if err := applyConfig(previousPipelines); err != nil {
+					logger.Error("main - %v", err)
 				}
+				adminServer.Unlock()
 
 			case <-sigTerm:
 				logger.Warning("main - exiting...")
@@ -228,6 +286,10 @@ func main() {
 					l.Stop()
 				}
 
+				if err := adminServer.Stop(); err != nil {
+					logger.Error("main - admin api error shutting down http server - %s", err.Error())
+				}
+
 				// gracefully shutdown the HTTP server
 				if config.Global.Telemetry.Enabled {
 					logger.Info("main - telemetry is stopping")
@@ -262,6 +324,9 @@ func main() {
 		go c.StartCollect()
 	}
 
+	// start the admin api once the workers are running
+	adminServer.Start()
+
 	// block main
 	<-done
 
@@ -16,6 +16,9 @@ const (
 	DNSTapClientResponse = "CLIENT_RESPONSE"
 	DNSTapClientQuery    = "CLIENT_QUERY"
 
+	DNSTapForwarderResponse = "FORWARDER_RESPONSE"
+	DNSTapForwarderQuery    = "FORWARDER_QUERY"
+
 	DNSTapIdentityTest = "test_id"
 
 	MatchingModeInclude   = "include"
@@ -29,6 +32,16 @@ const (
 	ErrorUnexpectedDirective = "unexpected text format directive: "
 )
 
+const (
+	AnomalyPointerLoop    = "pointer-loop"
+	AnomalyForwardPointer = "forward-pointer"
+	AnomalyTrailingBytes  = "trailing-bytes"
+	AnomalyCountMismatch  = "count-mismatch"
+	AnomalyOversizedLabel = "oversized-label"
+	AnomalyOversizedName  = "oversized-name"
+	AnomalyNonZeroZ       = "non-zero-z"
+)
+
 const (
 	TestQName = "dnstapcollector.test."
 )
@@ -79,6 +79,7 @@ var (
 		60:    "CDNSKEY",    // Child DNSKEY
 		61:    "OPENPGPKEY", // OpenPGP key
 		62:    "CSYNC",      // Child-to-parent synchronization
+		63:    "ZONEMD",     // Message digest for DNS zone
 		64:    "SVCB",       // Service binding
 		65:    "HTTPS",      // HTTPS binding
 		99:    "SPF",        // Sender policy framework (deprecated, use TXT)
@@ -129,10 +130,13 @@ var ErrDecodeDNSLabelTooLong = errors.New("malformed pkt, label too long")
 var ErrDecodeDNSLabelInvalidData = errors.New("malformed pkt, invalid label length byte")
 var ErrDecodeDNSLabelInvalidOffset = errors.New("malformed pkt, invalid offset to decode label")
 var ErrDecodeDNSLabelInvalidPointer = errors.New("malformed pkt, label pointer not pointing to prior data")
+var ErrDecodeDNSLabelPointerLoop = fmt.Errorf("%w, pointer loop", ErrDecodeDNSLabelInvalidPointer)
+var ErrDecodeDNSLabelForwardPointer = fmt.Errorf("%w, forward pointer", ErrDecodeDNSLabelInvalidPointer)
 var ErrDecodeDNSLabelTooShort = errors.New("malformed pkt, dns payload too short to get label")
 var ErrDecodeQuestionQtypeTooShort = errors.New("malformed pkt, not enough data to decode qtype")
 var ErrDecodeDNSAnswerTooShort = errors.New("malformed pkt, not enough data to decode answer")
 var ErrDecodeDNSAnswerRdataTooShort = errors.New("malformed pkt, not enough data to decode rdata answer")
+var ErrDecodeDNSAnswerRdataInvalid = errors.New("malformed pkt, invalid rdata answer")
 var ErrDecodeQuestionQclassTooShort = errors.New("malformed pkt, not enough data to decode qclass")
 
 func RdatatypeToString(rrtype int) string {
@@ -235,6 +239,12 @@ func DecodeDNS(payload []byte) (DNSHeader, error) {
 // Error is returned if packet can not be parsed. Returned error wraps the
 // original error returned by relevant decoding operation.
 func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config) error {
+	return DecodePayloadWithRdataFields(dm, header, config, false)
+}
+
+// DecodePayloadWithRdataFields also adds the structured rdata to the resource records
+// if rdataFields is enabled by the collector or if the rdata-fields global setting is enabled
+func DecodePayloadWithRdataFields(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config, rdataFields bool) error {
 	if dm.DNS.MalformedPacket {
 		// do not continue if packet is malformed, the header can not be
 		// trusted.
@@ -279,6 +289,13 @@ func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config)
 	if header.Cd == 1 {
 		dm.DNS.Flags.CD = true
 	}
+	// the Z bit is reserved and must be zero in all queries and responses
+	if header.Z == 1 {
+		dm.DNS.Anomalies = appendAnomaly(dm.DNS.Anomalies, AnomalyNonZeroZ)
+	}
+
+	// structured rdata, enabled globally or for the collector
+	rdataFields = rdataFields || (config != nil && config.Global.RdataFields)
 
 	var payloadOffset int
 	// decode DNS question
@@ -286,6 +303,7 @@ func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config)
 		dnsQname, dnsRRtype, dnsQclass, offsetrr, err := DecodeQuestion(header.Qdcount, dm.DNS.Payload)
 		if err != nil {
 			dm.DNS.MalformedPacket = true
+			dm.DNS.Anomalies = appendAnomaly(dm.DNS.Anomalies, errorToAnomaly(err, DNSLen, dm.DNS.Payload))
 			return &decodingError{part: "query", err: err}
 		}
 
@@ -299,7 +317,7 @@ func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config)
 
 	// decode DNS answers
 	if header.Ancount > 0 {
-		answers, offset, err := DecodeAnswer(header.Ancount, payloadOffset, dm.DNS.Payload)
+		answers, offset, err := decodeAnswer(header.Ancount, payloadOffset, dm.DNS.Payload, rdataFields)
 		if err == nil { // nolint
 			dm.DNS.DNSRRs.Answers = answers
 			payloadOffset = offset
@@ -309,13 +327,14 @@ func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config)
 			payloadOffset = offset
 		} else {
 			dm.DNS.MalformedPacket = true
+			dm.DNS.Anomalies = appendAnomaly(dm.DNS.Anomalies, errorToAnomaly(err, offset, dm.DNS.Payload))
 			return &decodingError{part: "answer records", err: err}
 		}
 	}
 
 	// decode authoritative answers
 	if header.Nscount > 0 {
-		answers, offsetrr, err := DecodeAnswer(header.Nscount, payloadOffset, dm.DNS.Payload)
+		answers, offsetrr, err := decodeAnswer(header.Nscount, payloadOffset, dm.DNS.Payload, rdataFields)
 		if err == nil { // nolint
 			dm.DNS.DNSRRs.Nameservers = answers
 			payloadOffset = offsetrr
@@ -325,20 +344,24 @@ func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config)
 			payloadOffset = offsetrr
 		} else {
 			dm.DNS.MalformedPacket = true
+			dm.DNS.Anomalies = appendAnomaly(dm.DNS.Anomalies, errorToAnomaly(err, offsetrr, dm.DNS.Payload))
 			return &decodingError{part: "authority records", err: err}
 		}
 	}
 
 	// decode additional answers
+	endOffset := payloadOffset
 	if header.Arcount > 0 {
-		answers, _, err := DecodeAnswer(header.Arcount, payloadOffset, dm.DNS.Payload)
+		answers, offsetrr, err := decodeAnswer(header.Arcount, payloadOffset, dm.DNS.Payload, rdataFields)
 		if err == nil { // nolint
 			dm.DNS.DNSRRs.Records = answers
+			endOffset = offsetrr
 		} else if dm.DNS.Flags.TC && (errors.Is(err, ErrDecodeDNSAnswerTooShort) || errors.Is(err, ErrDecodeDNSAnswerRdataTooShort) || errors.Is(err, ErrDecodeDNSLabelTooShort)) {
 			dm.DNS.MalformedPacket = true
 			dm.DNS.DNSRRs.Records = answers
 		} else {
 			dm.DNS.MalformedPacket = true
+			dm.DNS.Anomalies = appendAnomaly(dm.DNS.Anomalies, errorToAnomaly(err, offsetrr, dm.DNS.Payload))
 			return &decodingError{part: "additional records", err: err}
 		}
 		// decode EDNS options, if there are any
@@ -357,9 +380,45 @@ func DecodePayload(dm *DNSMessage, header *DNSHeader, config *pkgconfig.Config)
 			return &decodingError{part: "edns options", err: err}
 		}
 	}
+
+	// bytes left after the last record announced in the header
+	if !dm.DNS.MalformedPacket && endOffset < len(dm.DNS.Payload) {
+		dm.DNS.Anomalies = appendAnomaly(dm.DNS.Anomalies, AnomalyTrailingBytes)
+	}
 	return nil
 }
 
+// errorToAnomaly returns the parse anomaly revealed by a decoding error
+// returned for the section starting at offset, or an empty string.
+func errorToAnomaly(err error, offset int, payload []byte) string {
+	switch {
+	case errors.Is(err, ErrDecodeDNSLabelPointerLoop):
+		return AnomalyPointerLoop
+	case errors.Is(err, ErrDecodeDNSLabelForwardPointer):
+		return AnomalyForwardPointer
+	case errors.Is(err, ErrDecodeDNSLabelInvalidData):
+		return AnomalyOversizedLabel
+	case errors.Is(err, ErrDecodeDNSLabelTooLong):
+		return AnomalyOversizedName
+	case errors.Is(err, ErrDecodeDNSLabelTooShort) && offset >= len(payload):
+		// the payload ends before the number of records announced in the header
+		return AnomalyCountMismatch
+	}
+	return ""
+}
+
+func appendAnomaly(anomalies []string, anomaly string) []string {
+	if anomaly == "" {
+		return anomalies
+	}
+	for _, a := range anomalies {
+		if a == anomaly {
+			return anomalies
+		}
+	}
+	return append(anomalies, anomaly)
+}
+
 /*
 DNS QUESTION
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
@@ -438,6 +497,11 @@ PTR can be used on NAME for compression
 */
 
 func DecodeAnswer(ancount int, startOffset int, payload []byte) ([]DNSAnswer, int, error) {
+	return decodeAnswer(ancount, startOffset, payload, false)
+}
+
+// decodeAnswer also adds the structured rdata to the answers if rdataFields is enabled
+func decodeAnswer(ancount int, startOffset int, payload []byte, rdataFields bool) ([]DNSAnswer, int, error) {
 	offset := startOffset
 	answers := []DNSAnswer{}
 	var rdataString string
@@ -496,6 +560,13 @@ func DecodeAnswer(ancount int, startOffset int, payload []byte) ([]DNSAnswer, in
 			TTL:       int(ttl),
 			Rdata:     rdataString,
 		}
+		if rdataFields && len(rdata) > 0 {
+			// the rdata has been decoded without error, the fields are ignored if not supported
+			fields, err := ParseRdataFields(rdatatype, rdata, payload[:offsetNext+10+int(rdlength)], offsetNext+10)
+			if err == nil && fields != nil {
+				a.RdataFields = &fields
+			}
+		}
 		answers = append(answers, a)
 
 		// compute the next offset
@@ -524,7 +595,7 @@ func ParseLabels(offset int, payload []byte) (string, int, error) {
 		if offset >= len(payload) {
 			return "", 0, ErrDecodeDNSLabelTooShort
 		} else if offset >= maxOffset {
-			return "", 0, ErrDecodeDNSLabelInvalidPointer
+			return "", 0, ErrDecodeDNSLabelPointerLoop
 		}
 
 		length := int(payload[offset])
@@ -537,13 +608,16 @@ func ParseLabels(offset int, payload []byte) (string, int, error) {
 			if offset+2 > len(payload) {
 				return "", 0, ErrDecodeDNSLabelTooShort
 			} else if offset+2 > maxOffset {
-				return "", 0, ErrDecodeDNSLabelInvalidPointer
+				return "", 0, ErrDecodeDNSLabelPointerLoop
 			}
 
 			ptr := int(binary.BigEndian.Uint16(payload[offset:offset+2]) & 16383)
-			if ptr >= startOffset {
+			if ptr > offset {
 				// Require pointers to always point to prior data (based on a reading of RFC 1035, section 4.1.4).
-				return "", 0, ErrDecodeDNSLabelInvalidPointer
+				return "", 0, ErrDecodeDNSLabelForwardPointer
+			} else if ptr >= startOffset {
+				// Pointing back inside the current decoding run would loop forever.
+				return "", 0, ErrDecodeDNSLabelPointerLoop
 			}
 
 			if endOffset == -1 {
@@ -556,7 +630,7 @@ func ParseLabels(offset int, payload []byte) (string, int, error) {
 			if offset+length+1 > len(payload) {
 				return "", 0, ErrDecodeDNSLabelTooShort
 			} else if offset+length+1 > maxOffset {
-				return "", 0, ErrDecodeDNSLabelInvalidPointer
+				return "", 0, ErrDecodeDNSLabelPointerLoop
 			}
 
 			totalLength += length + 1
@@ -599,6 +673,36 @@ func ParseRdata(rdatatype string, rdata []byte, payload []byte, rdataOffset int)
 		ret, err = ParseSOA(rdataOffset, payload)
 	case "HTTPS", "SVCB":
 		ret, err = ParseSVCB(rdata)
+	case "DS", "CDS":
+		ret, err = ParseDS(rdata)
+	case "DNSKEY", "CDNSKEY":
+		ret, err = ParseDNSKEY(rdata)
+	case "RRSIG":
+		ret, err = ParseRRSIG(rdataOffset, payload)
+	case "NSEC":
+		ret, err = ParseNSEC(rdataOffset, payload)
+	case "NSEC3":
+		ret, err = ParseNSEC3(rdata)
+	case "NSEC3PARAM":
+		ret, err = ParseNSEC3PARAM(rdata)
+	case "CAA":
+		ret, err = ParseCAA(rdata)
+	case "TLSA":
+		ret, err = ParseTLSA(rdata)
+	case "SSHFP":
+		ret, err = ParseSSHFP(rdata)
+	case "NAPTR":
+		ret, err = ParseNAPTR(rdataOffset, payload)
+	case "DNAME":
+		ret, err = ParseDNAME(rdataOffset, payload)
+	case "ZONEMD":
+		ret, err = ParseZONEMD(rdata)
+	case "URI":
+		ret, err = ParseURI(rdata)
+	case "LOC":
+		ret, err = ParseLOC(rdata)
+	case "HINFO":
+		ret, err = ParseHINFO(rdata)
 	default:
 		ret = "-"
 		err = nil
@@ -3,9 +3,11 @@ package dnsutils
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/miekg/dns"
 )
 
 func TestDecodePayload_QueryHappy(t *testing.T) {
@@ -1141,3 +1143,137 @@ func TestDecodePayload_Query_NoRcode(t *testing.T) {
 		t.Errorf("invalid rcode: %s", dm.DNS.Rcode)
 	}
 }
+
+func TestDecodePayload_RdataFields(t *testing.T) {
+	dnsmsg := new(dns.Msg)
+	dnsmsg.SetQuestion(TestQName, dns.TypeA)
+	dnsmsg.Response = true
+	for _, rr := range []string{
+		"10 MX 10 mail.example.com.",
+		"3600 SOA ns1.example.com. hostmaster.example.com. 2024101501 7200 3600 1209600 300",
+		"300 HTTPS 1 . alpn=h2,h3 port=443",
+		"3600 DNSKEY 257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==",
+		"3600 RRSIG A 13 2 3600 20241231235959 20241201000000 2371 example.com. AAAA",
+	} {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %s", TestQName, rr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dnsmsg.Answer = append(dnsmsg.Answer, rr)
+	}
+	payload, _ := dnsmsg.Pack()
+
+	decode := func(config *pkgconfig.Config, rdataFields bool) DNSMessage {
+		dm := DNSMessage{}
+		dm.DNS.Payload = payload
+		dm.DNS.Length = len(payload)
+		header, _ := DecodeDNS(payload)
+		if err := DecodePayloadWithRdataFields(&dm, &header, config, rdataFields); err != nil {
+			t.Fatalf("unexpected error while decoding payload: %v", err)
+		}
+		return dm
+	}
+
+	// disabled by default
+	dm := decode(pkgconfig.GetDefaultConfig(), false)
+	for _, an := range dm.DNS.DNSRRs.Answers {
+		if an.RdataFields != nil {
+			t.Errorf("no rdata fields expected by default: %v", an)
+		}
+	}
+
+	// the setting of another collector in the config is ignored
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Dnstap.Enable = true
+	config.Collectors.Dnstap.RdataFields = true
+	dm = decode(config, false)
+	if dm.DNS.DNSRRs.Answers[0].RdataFields != nil {
+		t.Errorf("no rdata fields expected if not enabled for the collector")
+	}
+
+	// enabled globally
+	config = pkgconfig.GetDefaultConfig()
+	config.Global.RdataFields = true
+	if dm = decode(config, false); dm.DNS.DNSRRs.Answers[0].RdataFields == nil {
+		t.Errorf("rdata fields expected if enabled globally")
+	}
+
+	// enabled on the collector
+	dm = decode(pkgconfig.GetDefaultConfig(), true)
+
+	expected := []RdataFields{
+		{"preference": 10, "exchange": "mail.example.com"},
+		{"mname": "ns1.example.com", "rname": "hostmaster.example.com", "serial": 2024101501, "refresh": 7200,
+			"retry": 3600, "expire": 1209600, "minimum": 300},
+		{"priority": 1, "target": ".", "alpn": []string{"h2", "h3"}, "port": 443},
+		{"flags": 257, "protocol": 3, "algorithm": 13, "key-tag": 2371,
+			"public-key": "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="},
+		{"type-covered": "A", "algorithm": 13, "labels": 2, "original-ttl": 3600, "expiration": 1735689599,
+			"inception": 1733011200, "key-tag": 2371, "signer-name": "example.com", "signature": "AAAA"},
+	}
+	if len(dm.DNS.DNSRRs.Answers) != len(expected) {
+		t.Fatalf("unexpected answers: %v", dm.DNS.DNSRRs.Answers)
+	}
+	for i, an := range dm.DNS.DNSRRs.Answers {
+		if an.RdataFields == nil {
+			t.Errorf("rdata fields expected for %s", an.Rdatatype)
+			continue
+		}
+		if !reflect.DeepEqual(*an.RdataFields, expected[i]) {
+			t.Errorf("invalid rdata fields for %s, want %v, got %v", an.Rdatatype, expected[i], *an.RdataFields)
+		}
+	}
+}
+
+func TestDecodePayload_Anomalies(t *testing.T) {
+	dnsmsg := new(dns.Msg)
+	dnsmsg.SetQuestion(TestQName, dns.TypeA)
+	query, _ := dnsmsg.Pack()
+
+	dnsmsg.Zero = true
+	queryZ, _ := dnsmsg.Pack()
+
+	// header with one question and no other records
+	header := []byte{0xab, 0xcd, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	longName := []byte{}
+	for i := 0; i < 5; i++ {
+		longName = append(longName, 63)
+		longName = append(longName, make([]byte, 63)...)
+	}
+
+	testcases := []struct {
+		name      string
+		payload   []byte
+		anomalies []string
+		malformed bool
+	}{
+		{"clean query", query, nil, false},
+		{"non zero z", queryZ, []string{AnomalyNonZeroZ}, false},
+		{"trailing bytes", append(append([]byte{}, query...), 0xde, 0xad), []string{AnomalyTrailingBytes}, false},
+		{"count mismatch", append(append([]byte{}, query[:7]...), append([]byte{0x01}, query[8:]...)...), []string{AnomalyCountMismatch}, true},
+		{"pointer loop", append(append([]byte{}, header...), 0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01), []string{AnomalyPointerLoop}, true},
+		{"forward pointer", append(append([]byte{}, header...), 0xc0, 0x10, 0x00, 0x01, 0x00, 0x01), []string{AnomalyForwardPointer}, true},
+		{"oversized label", append(append([]byte{}, header...), 0x40, 0x61, 0x00, 0x00, 0x01, 0x00, 0x01), []string{AnomalyOversizedLabel}, true},
+		{"oversized name", append(append(append([]byte{}, header...), longName...), 0x00, 0x00, 0x01, 0x00, 0x01), []string{AnomalyOversizedName}, true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := DNSMessage{}
+			dm.DNS.Payload = tc.payload
+			dm.DNS.Length = len(tc.payload)
+
+			header, err := DecodeDNS(tc.payload)
+			if err != nil {
+				t.Fatalf("unexpected error when decoding header: %v", err)
+			}
+			err = DecodePayload(&dm, &header, pkgconfig.GetDefaultConfig())
+			if tc.malformed != (err != nil) || dm.DNS.MalformedPacket != tc.malformed {
+				t.Errorf("unexpected decoding result: %v", err)
+			}
+			if !reflect.DeepEqual(dm.DNS.Anomalies, tc.anomalies) {
+				t.Errorf("want anomalies %v, got %v", tc.anomalies, dm.DNS.Anomalies)
+			}
+		})
+	}
+}
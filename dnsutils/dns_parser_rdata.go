@@ -0,0 +1,484 @@
+package dnsutils
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The following functions decode the rdata to the presentation format of RFC 1035 and
+// the RFC defining each record type, the rdata must be at the end of the payload
+
+/*
+DS, CDS
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|           Key Tag     |  Algorithm  |  Digest Type  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                     DIGEST                    /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseDS(rdata []byte) (string, error) {
+	if len(rdata) < 4 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	keyTag := binary.BigEndian.Uint16(rdata[0:2])
+	algorithm := rdata[2]
+	digestType := rdata[3]
+	digest := strings.ToUpper(hex.EncodeToString(rdata[4:]))
+	return fmt.Sprintf("%d %d %d %s", keyTag, algorithm, digestType, digest), nil
+}
+
+/*
+DNSKEY, CDNSKEY
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|     Flags     |  Protocol   |   Algorithm   |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  PUBLIC KEY                   /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseDNSKEY(rdata []byte) (string, error) {
+	if len(rdata) < 4 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	flags := binary.BigEndian.Uint16(rdata[0:2])
+	protocol := rdata[2]
+	algorithm := rdata[3]
+	publicKey := base64.StdEncoding.EncodeToString(rdata[4:])
+	return fmt.Sprintf("%d %d %d %s", flags, protocol, algorithm, publicKey), nil
+}
+
+/*
+RRSIG
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|        Type Covered   |  Algorithm  |  Labels   |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                 Original TTL                  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|             Signature Expiration              |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|             Signature Inception               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|            Key Tag                            |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                Signer's Name                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                   Signature                   /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseRRSIG(rdataOffset int, payload []byte) (string, error) {
+	// fixed fields and at least one byte for the signer name
+	if rdataOffset < 0 || len(payload) < rdataOffset+19 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	rdata := payload[rdataOffset : rdataOffset+18]
+	typeCovered := int(binary.BigEndian.Uint16(rdata[0:2]))
+	algorithm := rdata[2]
+	labels := rdata[3]
+	originalTTL := binary.BigEndian.Uint32(rdata[4:8])
+	expiration := binary.BigEndian.Uint32(rdata[8:12])
+	inception := binary.BigEndian.Uint32(rdata[12:16])
+	keyTag := binary.BigEndian.Uint16(rdata[16:18])
+
+	signer, offset, err := ParseLabels(rdataOffset+18, payload)
+	if err != nil {
+		return "", err
+	}
+	signature := base64.StdEncoding.EncodeToString(payload[offset:])
+
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s", rdatatypeToPresentation(typeCovered), algorithm, labels, originalTTL,
+		dnssecTimeToString(expiration), dnssecTimeToString(inception), keyTag, nameToPresentation(signer), signature), nil
+}
+
+/*
+NSEC
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/              Next Domain Name                 /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/              Type Bit Maps                    /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNSEC(rdataOffset int, payload []byte) (string, error) {
+	nextDomain, offset, err := ParseLabels(rdataOffset, payload)
+	if err != nil {
+		return "", err
+	}
+	types, err := parseTypeBitMaps(payload[offset:])
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append([]string{nameToPresentation(nextDomain)}, types...), " "), nil
+}
+
+/*
+NSEC3
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|   Hash Alg.   |     Flags     |   Iterations  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|  Salt Length  |                     Salt      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|  Hash Length  |             Next Hashed Owner Name
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                Type Bit Maps                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNSEC3(rdata []byte) (string, error) {
+	params, offset, err := parseNSEC3Params(rdata)
+	if err != nil {
+		return "", err
+	}
+	if len(rdata) < offset+1 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	hashLength := int(rdata[offset])
+	offset++
+	if len(rdata) < offset+hashLength {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	nextHashed := base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(rdata[offset : offset+hashLength])
+	offset += hashLength
+
+	types, err := parseTypeBitMaps(rdata[offset:])
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append([]string{params, nextHashed}, types...), " "), nil
+}
+
+/*
+NSEC3PARAM
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|   Hash Alg.   |     Flags     |   Iterations  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|  Salt Length  |                     Salt      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNSEC3PARAM(rdata []byte) (string, error) {
+	params, _, err := parseNSEC3Params(rdata)
+	return params, err
+}
+
+func parseNSEC3Params(rdata []byte) (string, int, error) {
+	if len(rdata) < 5 {
+		return "", 0, ErrDecodeDNSAnswerRdataTooShort
+	}
+	hashAlgorithm := rdata[0]
+	flags := rdata[1]
+	iterations := binary.BigEndian.Uint16(rdata[2:4])
+	saltLength := int(rdata[4])
+	if len(rdata) < 5+saltLength {
+		return "", 0, ErrDecodeDNSAnswerRdataTooShort
+	}
+	salt := "-"
+	if saltLength > 0 {
+		salt = strings.ToUpper(hex.EncodeToString(rdata[5 : 5+saltLength]))
+	}
+	return fmt.Sprintf("%d %d %d %s", hashAlgorithm, flags, iterations, salt), 5 + saltLength, nil
+}
+
+/*
+CAA
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|     Flags     |  Tag Length   |     Tag       /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                     Value                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseCAA(rdata []byte) (string, error) {
+	if len(rdata) < 2 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	flags := rdata[0]
+	tagLength := int(rdata[1])
+	if len(rdata) < 2+tagLength {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	tag := string(rdata[2 : 2+tagLength])
+	return fmt.Sprintf("%d %s %s", flags, tag, txtToQuotedString(rdata[2+tagLength:])), nil
+}
+
+/*
+TLSA
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|  Cert. Usage  |   Selector    | Matching Type |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/       Certificate Association Data            /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseTLSA(rdata []byte) (string, error) {
+	if len(rdata) < 3 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	return fmt.Sprintf("%d %d %d %s", rdata[0], rdata[1], rdata[2], hex.EncodeToString(rdata[3:])), nil
+}
+
+/*
+SSHFP
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|   Algorithm   |    FP Type    |               /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  Fingerprint                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseSSHFP(rdata []byte) (string, error) {
+	if len(rdata) < 2 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	return fmt.Sprintf("%d %d %s", rdata[0], rdata[1], strings.ToUpper(hex.EncodeToString(rdata[2:]))), nil
+}
+
+/*
+NAPTR
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                     ORDER                     |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   PREFERENCE                  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                     FLAGS                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                   SERVICES                    /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    REGEXP                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  REPLACEMENT                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNAPTR(rdataOffset int, payload []byte) (string, error) {
+	if rdataOffset < 0 || len(payload) < rdataOffset+4 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	order := binary.BigEndian.Uint16(payload[rdataOffset : rdataOffset+2])
+	preference := binary.BigEndian.Uint16(payload[rdataOffset+2 : rdataOffset+4])
+
+	offset := rdataOffset + 4
+	var fields []string
+	for i := 0; i < 3; i++ {
+		field, next, err := parseCharacterString(offset, payload)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, txtToQuotedString(field))
+		offset = next
+	}
+
+	replacement, _, err := ParseLabels(offset, payload)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d %d %s %s", order, preference, strings.Join(fields, " "), nameToPresentation(replacement)), nil
+}
+
+/*
+DNAME
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    TARGET                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseDNAME(rdataOffset int, payload []byte) (string, error) {
+	target, _, err := ParseLabels(rdataOffset, payload)
+	if err != nil {
+		return "", err
+	}
+	return target, err
+}
+
+/*
+ZONEMD
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                     Serial                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|    Scheme     |Hash Algorithm |     Digest    /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseZONEMD(rdata []byte) (string, error) {
+	if len(rdata) < 6 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	serial := binary.BigEndian.Uint32(rdata[0:4])
+	return fmt.Sprintf("%d %d %d %s", serial, rdata[4], rdata[5], hex.EncodeToString(rdata[6:])), nil
+}
+
+/*
+URI
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|          Priority             |    Weight     |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    Target                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseURI(rdata []byte) (string, error) {
+	if len(rdata) < 4 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	priority := binary.BigEndian.Uint16(rdata[0:2])
+	weight := binary.BigEndian.Uint16(rdata[2:4])
+	return fmt.Sprintf("%d %d %s", priority, weight, txtToQuotedString(rdata[4:])), nil
+}
+
+/*
+LOC
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|        VERSION        |         SIZE          |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|       HORIZ PRE       |       VERT PRE        |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   LATITUDE                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   LONGITUDE                   |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   ALTITUDE                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseLOC(rdata []byte) (string, error) {
+	if len(rdata) < 16 {
+		return "", ErrDecodeDNSAnswerRdataTooShort
+	}
+	// only the version 0 is defined
+	if rdata[0] != 0 {
+		return "", ErrDecodeDNSAnswerRdataInvalid
+	}
+	latitude := binary.BigEndian.Uint32(rdata[4:8])
+	longitude := binary.BigEndian.Uint32(rdata[8:12])
+	altitude := binary.BigEndian.Uint32(rdata[12:16])
+
+	// the coordinates are in thousandths of a second of arc, from the equator and the prime meridian
+	const equator = 1 << 31
+	const minutes = 60 * 1000
+	const degrees = 60 * minutes
+	coordinate := func(v uint32, positive, negative string) string {
+		hemisphere := positive
+		if v > equator {
+			v -= equator
+		} else {
+			hemisphere = negative
+			v = equator - v
+		}
+		return fmt.Sprintf("%02d %02d %0.3f %s", v/degrees, v%degrees/minutes, float64(v%minutes)/1000, hemisphere)
+	}
+
+	// the altitude is in centimeters from a base of 100000m below the reference spheroid
+	alt := fmt.Sprintf("%.0fm", float64(altitude)/100-100000)
+	if altitude%100 != 0 {
+		alt = fmt.Sprintf("%.2fm", float64(altitude)/100-100000)
+	}
+
+	return fmt.Sprintf("%s %s %s %sm %sm %sm", coordinate(latitude, "N", "S"), coordinate(longitude, "E", "W"), alt,
+		locPrecisionToString(rdata[1]), locPrecisionToString(rdata[2]), locPrecisionToString(rdata[3])), nil
+}
+
+// locPrecisionToString converts the size and precisions of the LOC record,
+// encoded as a base and a power of ten in centimeters, to meters
+func locPrecisionToString(x uint8) string {
+	base := x & 0xf0 >> 4
+	exponent := x & 0x0f
+	if exponent < 2 {
+		if exponent == 1 {
+			base *= 10
+		}
+		return fmt.Sprintf("0.%02d", base)
+	}
+	return fmt.Sprintf("%d", base) + strings.Repeat("0", int(exponent)-2)
+}
+
+/*
+HINFO
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                      CPU                      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                       OS                      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseHINFO(rdata []byte) (string, error) {
+	cpu, offset, err := parseCharacterString(0, rdata)
+	if err != nil {
+		return "", err
+	}
+	os, _, err := parseCharacterString(offset, rdata)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s", txtToQuotedString(cpu), txtToQuotedString(os)), nil
+}
+
+// parseCharacterString returns the <character-string> at the offset and the offset after it
+func parseCharacterString(offset int, data []byte) ([]byte, int, error) {
+	if offset < 0 || len(data) < offset+1 {
+		return nil, 0, ErrDecodeDNSAnswerRdataTooShort
+	}
+	length := int(data[offset])
+	if len(data) < offset+1+length {
+		return nil, 0, ErrDecodeDNSAnswerRdataTooShort
+	}
+	return data[offset+1 : offset+1+length], offset + 1 + length, nil
+}
+
+// parseTypeBitMaps decodes the list of types of the NSEC and NSEC3 records, RFC 4034 section 4.1.2
+func parseTypeBitMaps(data []byte) ([]string, error) {
+	var types []string
+	for offset := 0; offset < len(data); {
+		if len(data) < offset+2 {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		window := int(data[offset])
+		length := int(data[offset+1])
+		offset += 2
+		if length == 0 || length > 32 {
+			return nil, ErrDecodeDNSAnswerRdataInvalid
+		}
+		if len(data) < offset+length {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		for i, b := range data[offset : offset+length] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, rdatatypeToPresentation(window*256+i*8+bit))
+				}
+			}
+		}
+		offset += length
+	}
+	return types, nil
+}
+
+// rdatatypeToPresentation uses the generic TYPEnnn notation of RFC 3597 for the unknown types
+func rdatatypeToPresentation(rrtype int) string {
+	if value, ok := Rdatatypes[rrtype]; ok {
+		return value
+	}
+	return fmt.Sprintf("TYPE%d", rrtype)
+}
+
+// dnssecTimeToString converts the signature times to the YYYYMMDDHHmmSS format in UTC
+func dnssecTimeToString(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+func nameToPresentation(name string) string {
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// txtToQuotedString returns the quoted string with the special and non-printable characters escaped
+func txtToQuotedString(s []byte) string {
+	var str strings.Builder
+	str.Grow(2 + len(s))
+	str.WriteByte('"')
+	for _, e := range s {
+		switch {
+		case e == '"' || e == '\\':
+			str.WriteByte('\\')
+			str.WriteByte(e)
+		case ' ' <= e && e <= '~':
+			str.WriteByte(e)
+		default:
+			str.WriteString(escapeByte(e))
+		}
+	}
+	str.WriteByte('"')
+	return str.String()
+}
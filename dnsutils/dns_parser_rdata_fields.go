@@ -0,0 +1,364 @@
+package dnsutils
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strings"
+)
+
+// ParseRdataFields returns the structured representation of the rdata, the keys depend on the record type.
+// The numbers are integers and the DNSSEC times are in unix seconds, nil is returned for the unsupported types.
+func ParseRdataFields(rdatatype string, rdata []byte, payload []byte, rdataOffset int) (RdataFields, error) {
+	switch rdatatype {
+	case "A":
+		address, err := ParseA(rdata)
+		return RdataFields{"address": address}, err
+	case "AAAA":
+		address, err := ParseAAAA(rdata)
+		return RdataFields{"address": address}, err
+	case "CNAME", "NS", "PTR", "DNAME":
+		target, _, err := ParseLabels(rdataOffset, payload)
+		return RdataFields{"target": target}, err
+	case "MX":
+		return parseMXFields(rdataOffset, payload)
+	case "SRV":
+		return parseSRVFields(rdataOffset, payload)
+	case "SOA":
+		return parseSOAFields(rdataOffset, payload)
+	case "TXT":
+		text, err := ParseTXT(rdata)
+		return RdataFields{"text": text}, err
+	case "HTTPS", "SVCB":
+		return parseSVCBFields(rdata)
+	case "CAA":
+		return parseCAAFields(rdata)
+	case "DS", "CDS":
+		return parseDSFields(rdata)
+	case "DNSKEY", "CDNSKEY":
+		return parseDNSKEYFields(rdata)
+	case "RRSIG":
+		return parseRRSIGFields(rdataOffset, payload)
+	case "NSEC":
+		return parseNSECFields(rdataOffset, payload)
+	case "NSEC3", "NSEC3PARAM":
+		return parseNSEC3Fields(rdatatype, rdata)
+	case "TLSA":
+		if len(rdata) < 3 {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		return RdataFields{"usage": int(rdata[0]), "selector": int(rdata[1]), "matching-type": int(rdata[2]),
+			"certificate": hex.EncodeToString(rdata[3:])}, nil
+	case "SSHFP":
+		if len(rdata) < 2 {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		return RdataFields{"algorithm": int(rdata[0]), "type": int(rdata[1]),
+			"fingerprint": strings.ToUpper(hex.EncodeToString(rdata[2:]))}, nil
+	case "NAPTR":
+		return parseNAPTRFields(rdataOffset, payload)
+	case "ZONEMD":
+		if len(rdata) < 6 {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		return RdataFields{"serial": int(binary.BigEndian.Uint32(rdata[0:4])), "scheme": int(rdata[4]),
+			"hash-algorithm": int(rdata[5]), "digest": hex.EncodeToString(rdata[6:])}, nil
+	case "URI":
+		if len(rdata) < 4 {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		return RdataFields{"priority": int(binary.BigEndian.Uint16(rdata[0:2])), "weight": int(binary.BigEndian.Uint16(rdata[2:4])),
+			"target": string(rdata[4:])}, nil
+	case "LOC":
+		return parseLOCFields(rdata)
+	case "HINFO":
+		cpu, offset, err := parseCharacterString(0, rdata)
+		if err != nil {
+			return nil, err
+		}
+		os, _, err := parseCharacterString(offset, rdata)
+		if err != nil {
+			return nil, err
+		}
+		return RdataFields{"cpu": string(cpu), "os": string(os)}, nil
+	}
+	return nil, nil
+}
+
+func parseMXFields(rdataOffset int, payload []byte) (RdataFields, error) {
+	if rdataOffset < 0 || len(payload) < rdataOffset+3 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	exchange, _, err := ParseLabels(rdataOffset+2, payload)
+	if err != nil {
+		return nil, err
+	}
+	return RdataFields{"preference": int(binary.BigEndian.Uint16(payload[rdataOffset : rdataOffset+2])), "exchange": exchange}, nil
+}
+
+func parseSRVFields(rdataOffset int, payload []byte) (RdataFields, error) {
+	if rdataOffset < 0 || len(payload) < rdataOffset+7 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	target, _, err := ParseLabels(rdataOffset+6, payload)
+	if err != nil {
+		return nil, err
+	}
+	return RdataFields{
+		"priority": int(binary.BigEndian.Uint16(payload[rdataOffset : rdataOffset+2])),
+		"weight":   int(binary.BigEndian.Uint16(payload[rdataOffset+2 : rdataOffset+4])),
+		"port":     int(binary.BigEndian.Uint16(payload[rdataOffset+4 : rdataOffset+6])),
+		"target":   target,
+	}, nil
+}
+
+func parseSOAFields(rdataOffset int, payload []byte) (RdataFields, error) {
+	mname, offset, err := ParseLabels(rdataOffset, payload)
+	if err != nil {
+		return nil, err
+	}
+	rname, offset, err := ParseLabels(offset, payload)
+	if err != nil {
+		return nil, err
+	}
+	if offset+20 > len(payload) {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	rdata := payload[offset : offset+20]
+	return RdataFields{
+		"mname":   mname,
+		"rname":   rname,
+		"serial":  int(binary.BigEndian.Uint32(rdata[0:4])),
+		"refresh": int(int32(binary.BigEndian.Uint32(rdata[4:8]))),
+		"retry":   int(int32(binary.BigEndian.Uint32(rdata[8:12]))),
+		"expire":  int(int32(binary.BigEndian.Uint32(rdata[12:16]))),
+		"minimum": int(binary.BigEndian.Uint32(rdata[16:20])),
+	}, nil
+}
+
+// parseSVCBFields returns the priority, the target and one key per service parameter
+func parseSVCBFields(rdata []byte) (RdataFields, error) {
+	if len(rdata) < 3 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	target, offset, err := ParseLabels(2, rdata)
+	if err != nil {
+		return nil, err
+	}
+	fields := RdataFields{"priority": int(binary.BigEndian.Uint16(rdata[0:2])), "target": nameToPresentation(target)}
+	for offset < len(rdata) {
+		if len(rdata) < offset+4 {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		paramKey := binary.BigEndian.Uint16(rdata[offset : offset+2])
+		paramLen := int(binary.BigEndian.Uint16(rdata[offset+2 : offset+4]))
+		offset += 4
+		if len(rdata) < offset+paramLen {
+			return nil, ErrDecodeDNSAnswerRdataTooShort
+		}
+		param, err := parseSVCParamField(paramKey, rdata[offset:offset+paramLen])
+		if err != nil {
+			return nil, err
+		}
+		fields[SVCParamKeyToString(paramKey)] = param
+		offset += paramLen
+	}
+	return fields, nil
+}
+
+// parseSVCParamField returns the port as integer, the lists of keys, alpn and addresses as lists,
+// no-default-alpn as boolean and the presentation string of the opaque keys
+func parseSVCParamField(paramKey uint16, paramData []byte) (interface{}, error) {
+	param, err := ParseSVCParam(paramKey, paramData)
+	if err != nil {
+		return nil, err
+	}
+	switch paramKey {
+	case 0, 4, 6:
+		// mandatory, ipv4hint and ipv6hint, without comma in the values
+		if len(param) == 0 {
+			return []string{}, nil
+		}
+		return strings.Split(param, ","), nil
+	case 1:
+		// alpn, the values are split on the wire format as they can contain commas
+		alpns := []string{}
+		for offset := 0; offset < len(paramData); offset += 1 + int(paramData[offset]) {
+			alpns = append(alpns, svcbParamToStr(paramData[offset+1:offset+1+int(paramData[offset])]))
+		}
+		return alpns, nil
+	case 2:
+		// no-default-alpn
+		return true, nil
+	case 3:
+		// port
+		return int(binary.BigEndian.Uint16(paramData)), nil
+	}
+	return param, nil
+}
+
+func parseCAAFields(rdata []byte) (RdataFields, error) {
+	if len(rdata) < 2 || len(rdata) < 2+int(rdata[1]) {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	tagLength := int(rdata[1])
+	return RdataFields{"flags": int(rdata[0]), "tag": string(rdata[2 : 2+tagLength]), "value": string(rdata[2+tagLength:])}, nil
+}
+
+func parseDSFields(rdata []byte) (RdataFields, error) {
+	if len(rdata) < 4 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	return RdataFields{
+		"key-tag":     int(binary.BigEndian.Uint16(rdata[0:2])),
+		"algorithm":   int(rdata[2]),
+		"digest-type": int(rdata[3]),
+		"digest":      strings.ToUpper(hex.EncodeToString(rdata[4:])),
+	}, nil
+}
+
+// parseDNSKEYFields also returns the key tag of the key, to match with the DS and RRSIG records
+func parseDNSKEYFields(rdata []byte) (RdataFields, error) {
+	if len(rdata) < 4 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	return RdataFields{
+		"flags":      int(binary.BigEndian.Uint16(rdata[0:2])),
+		"protocol":   int(rdata[2]),
+		"algorithm":  int(rdata[3]),
+		"key-tag":    dnskeyKeyTag(rdata),
+		"public-key": base64.StdEncoding.EncodeToString(rdata[4:]),
+	}, nil
+}
+
+// dnskeyKeyTag computes the key tag of the DNSKEY rdata, RFC 4034 appendix B
+func dnskeyKeyTag(rdata []byte) int {
+	// the obsolete RSA/MD5 algorithm uses the most significant bits of the modulus
+	if rdata[3] == 1 {
+		if len(rdata) < 7 {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(rdata[len(rdata)-3 : len(rdata)-1]))
+	}
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return int(ac & 0xffff)
+}
+
+func parseRRSIGFields(rdataOffset int, payload []byte) (RdataFields, error) {
+	if rdataOffset < 0 || len(payload) < rdataOffset+19 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	rdata := payload[rdataOffset : rdataOffset+18]
+	signer, offset, err := ParseLabels(rdataOffset+18, payload)
+	if err != nil {
+		return nil, err
+	}
+	return RdataFields{
+		"type-covered": rdatatypeToPresentation(int(binary.BigEndian.Uint16(rdata[0:2]))),
+		"algorithm":    int(rdata[2]),
+		"labels":       int(rdata[3]),
+		"original-ttl": int(binary.BigEndian.Uint32(rdata[4:8])),
+		"expiration":   int(binary.BigEndian.Uint32(rdata[8:12])),
+		"inception":    int(binary.BigEndian.Uint32(rdata[12:16])),
+		"key-tag":      int(binary.BigEndian.Uint16(rdata[16:18])),
+		"signer-name":  nameToPresentation(signer),
+		"signature":    base64.StdEncoding.EncodeToString(payload[offset:]),
+	}, nil
+}
+
+func parseNSECFields(rdataOffset int, payload []byte) (RdataFields, error) {
+	nextDomain, offset, err := ParseLabels(rdataOffset, payload)
+	if err != nil {
+		return nil, err
+	}
+	types, err := parseTypeBitMaps(payload[offset:])
+	if err != nil {
+		return nil, err
+	}
+	return RdataFields{"next-domain": nameToPresentation(nextDomain), "types": append([]string{}, types...)}, nil
+}
+
+func parseNSEC3Fields(rdatatype string, rdata []byte) (RdataFields, error) {
+	if len(rdata) < 5 || len(rdata) < 5+int(rdata[4]) {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	saltLength := int(rdata[4])
+	fields := RdataFields{
+		"hash-algorithm": int(rdata[0]),
+		"flags":          int(rdata[1]),
+		"iterations":     int(binary.BigEndian.Uint16(rdata[2:4])),
+		"salt":           strings.ToUpper(hex.EncodeToString(rdata[5 : 5+saltLength])),
+	}
+	if rdatatype == "NSEC3PARAM" {
+		return fields, nil
+	}
+
+	offset := 5 + saltLength
+	if len(rdata) < offset+1 || len(rdata) < offset+1+int(rdata[offset]) {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	hashLength := int(rdata[offset])
+	fields["next-hashed-owner"] = base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(rdata[offset+1 : offset+1+hashLength])
+	types, err := parseTypeBitMaps(rdata[offset+1+hashLength:])
+	if err != nil {
+		return nil, err
+	}
+	fields["types"] = append([]string{}, types...)
+	return fields, nil
+}
+
+func parseNAPTRFields(rdataOffset int, payload []byte) (RdataFields, error) {
+	if rdataOffset < 0 || len(payload) < rdataOffset+4 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	fields := RdataFields{
+		"order":      int(binary.BigEndian.Uint16(payload[rdataOffset : rdataOffset+2])),
+		"preference": int(binary.BigEndian.Uint16(payload[rdataOffset+2 : rdataOffset+4])),
+	}
+	offset := rdataOffset + 4
+	for _, key := range []string{"flags", "service", "regexp"} {
+		value, next, err := parseCharacterString(offset, payload)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = string(value)
+		offset = next
+	}
+	replacement, _, err := ParseLabels(offset, payload)
+	if err != nil {
+		return nil, err
+	}
+	fields["replacement"] = nameToPresentation(replacement)
+	return fields, nil
+}
+
+// parseLOCFields returns the coordinates in decimal degrees and the altitude, size and precisions in meters
+func parseLOCFields(rdata []byte) (RdataFields, error) {
+	if len(rdata) < 16 {
+		return nil, ErrDecodeDNSAnswerRdataTooShort
+	}
+	if rdata[0] != 0 {
+		return nil, ErrDecodeDNSAnswerRdataInvalid
+	}
+	meters := func(x uint8) float64 {
+		return float64(x>>4) * math.Pow10(int(x&0x0f)) / 100
+	}
+	return RdataFields{
+		"latitude":  float64(int64(binary.BigEndian.Uint32(rdata[4:8]))-1<<31) / 3600000,
+		"longitude": float64(int64(binary.BigEndian.Uint32(rdata[8:12]))-1<<31) / 3600000,
+		"altitude":  float64(binary.BigEndian.Uint32(rdata[12:16]))/100 - 100000,
+		"size":      meters(rdata[1]),
+		"horiz-pre": meters(rdata[2]),
+		"vert-pre":  meters(rdata[3]),
+	}, nil
+}
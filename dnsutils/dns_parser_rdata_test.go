@@ -3,6 +3,7 @@ package dnsutils
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/miekg/dns"
@@ -659,3 +660,152 @@ func TestDecodeRdataSVCB_params(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeRdataSVCB_fields(t *testing.T) {
+	fqdn := TestQName
+
+	dm := new(dns.Msg)
+	dm.SetQuestion(fqdn, dns.TypeSVCB)
+	rr1, _ := dns.NewRR(fmt.Sprintf("%s SVCB %s", fqdn, `16 foo.example.org mandatory=alpn,ipv4hint alpn=h2,h3-19 no-default-alpn port=8443 `+
+		`ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:db8::1 key667=hello`))
+	dm.Answer = append(dm.Answer, rr1)
+	payload, _ := dm.Pack()
+	_, _, _, offsetRR, _ := DecodeQuestion(1, payload)
+	answer, _, err := decodeAnswer(len(dm.Answer), offsetRR, payload, true)
+	if err != nil || answer[0].RdataFields == nil {
+		t.Fatalf("rdata fields expected: %v", err)
+	}
+
+	// the port is an integer, the lists are decoded as lists and the opaque keys as strings
+	want := RdataFields{
+		"priority":        16,
+		"target":          "foo.example.org",
+		"mandatory":       []string{"alpn", "ipv4hint"},
+		"alpn":            []string{"h2", "h3-19"},
+		"no-default-alpn": true,
+		"port":            8443,
+		"ipv4hint":        []string{"192.0.2.1", "192.0.2.2"},
+		"ipv6hint":        []string{"2001:db8::1"},
+		"key667":          "hello",
+	}
+	if !reflect.DeepEqual(*answer[0].RdataFields, want) {
+		t.Errorf("invalid rdata fields, want %v, got %v", want, *answer[0].RdataFields)
+	}
+}
+
+func TestDecodeRdata_DNSSECAndModernTypes(t *testing.T) {
+	fqdn := TestQName
+
+	vectors := []struct {
+		rrtype string
+		rdata  string
+		want   string
+	}{
+		{"DS", "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118", ""},
+		{"CDS", "60485 13 2 2bb183af5f22588179a53b0a98631fad1a292118", "60485 13 2 2BB183AF5F22588179A53B0A98631FAD1A292118"},
+		{"DNSKEY", "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==", ""},
+		{"CDNSKEY", "0 3 0 AA==", ""},
+		{"RRSIG", "A 13 2 3600 20241231235959 20241201000000 12345 example.com. oJB1W6WNGv+ldvQ3WDG0MQkg5IEhjRip8WTrPYGv07h108dUKGMeDPKijVCHX3DDKdfb+v6oB9wfuh3DTJXUAfI=",
+			"A 13 2 3600 20241231235959 20241201000000 12345 example.com oJB1W6WNGv+ldvQ3WDG0MQkg5IEhjRip8WTrPYGv07h108dUKGMeDPKijVCHX3DDKdfb+v6oB9wfuh3DTJXUAfI="},
+		{"RRSIG", "NSEC 8 0 86400 20241231235959 20241201000000 20326 . AAAA", "NSEC 8 0 86400 20241231235959 20241201000000 20326 . AAAA"},
+		{"NSEC", "host.example.com. A MX RRSIG NSEC TYPE1234", "host.example.com A MX RRSIG NSEC TYPE1234"},
+		{"NSEC", "example.com.", "example.com"},
+		{"NSEC3", "1 1 12 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG", ""},
+		{"NSEC3", "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR", ""},
+		{"NSEC3PARAM", "1 0 12 AABBCCDD", ""},
+		{"NSEC3PARAM", "1 0 0 -", ""},
+		{"CAA", `0 issue "letsencrypt.org"`, ""},
+		{"CAA", `128 tbs "Unknown \"quoted\""`, ""},
+		{"TLSA", "3 1 1 0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6", ""},
+		{"SSHFP", "4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789", ""},
+		{"NAPTR", `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`, `100 10 "S" "SIP+D2U" "" _sip._udp.example.com`},
+		{"NAPTR", `100 50 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`, ""},
+		{"DNAME", "example.net.", "example.net"},
+		{"ZONEMD", "2018031500 1 1 d752c2c51fba0e29aa190570a9d4253e44077a058d3297fa3a5630d5bd012622f97c28acaed313b5c83bb990caa7da85", ""},
+		{"URI", `10 1 "ftp://ftp1.example.com/public"`, ""},
+		{"LOC", "52 22 23.000 N 04 53 32.000 E -2m 0.00m 10000m 10m", ""},
+		{"LOC", "42 21 54.000 S 71 06 18.000 W -24m 30m 10000m 10m", ""},
+		{"HINFO", `"INTEL-386" "Windows"`, ""},
+	}
+
+	for _, vector := range vectors {
+		want := vector.want
+		if want == "" {
+			want = vector.rdata
+		}
+
+		rr1, err := dns.NewRR(fmt.Sprintf("%s %s %s", fqdn, vector.rrtype, vector.rdata))
+		if err != nil {
+			t.Fatalf("invalid vector %s %s: %v", vector.rrtype, vector.rdata, err)
+		}
+		dm := new(dns.Msg)
+		dm.SetQuestion(fqdn, rr1.Header().Rrtype)
+		dm.Answer = append(dm.Answer, rr1)
+		payload, _ := dm.Pack()
+
+		_, _, _, offsetRR, _ := DecodeQuestion(1, payload)
+		answer, _, err := DecodeAnswer(len(dm.Answer), offsetRR, payload)
+		if err != nil {
+			t.Errorf("unexpected error for rdata %s: %v", vector.rrtype, err)
+			continue
+		}
+		if answer[0].Rdatatype != vector.rrtype {
+			t.Errorf("invalid rdatatype, want %s, got: %s", vector.rrtype, answer[0].Rdatatype)
+		}
+		if answer[0].Rdata != want {
+			t.Errorf("invalid decode for rdata %s, want %s, got: %s", vector.rrtype, want, answer[0].Rdata)
+		}
+	}
+}
+
+func TestDecodeRdata_DNSSECAndModernTypes_Short(t *testing.T) {
+	vectors := []struct {
+		rrtype string
+		rdata  []byte
+		err    error
+	}{
+		{"DS", []byte{0xec, 0x45, 0x05}, ErrDecodeDNSAnswerRdataTooShort},
+		{"DNSKEY", []byte{0x01, 0x01, 0x03}, ErrDecodeDNSAnswerRdataTooShort},
+		{"RRSIG", make([]byte, 18), ErrDecodeDNSAnswerRdataTooShort},
+		{"NSEC", []byte{0x00, 0x00}, ErrDecodeDNSAnswerRdataTooShort},
+		{"NSEC", []byte{0x00, 0x00, 0x00}, ErrDecodeDNSAnswerRdataInvalid},
+		{"NSEC", []byte{0x00, 0x00, 0x21}, ErrDecodeDNSAnswerRdataInvalid},
+		{"NSEC3", []byte{0x01, 0x00, 0x00, 0x0c, 0x04, 0xaa}, ErrDecodeDNSAnswerRdataTooShort},
+		{"NSEC3", []byte{0x01, 0x00, 0x00, 0x0c, 0x00, 0x14, 0xaa}, ErrDecodeDNSAnswerRdataTooShort},
+		{"NSEC3PARAM", []byte{0x01, 0x00, 0x00, 0x0c}, ErrDecodeDNSAnswerRdataTooShort},
+		{"CAA", []byte{0x00, 0x05, 'i', 's'}, ErrDecodeDNSAnswerRdataTooShort},
+		{"TLSA", []byte{0x03, 0x01}, ErrDecodeDNSAnswerRdataTooShort},
+		{"SSHFP", []byte{0x04}, ErrDecodeDNSAnswerRdataTooShort},
+		{"NAPTR", []byte{0x00, 0x64, 0x00, 0x0a, 0x01, 'S', 0x05, 'S', 'I', 'P'}, ErrDecodeDNSAnswerRdataTooShort},
+		{"DNAME", []byte{0x07, 'e', 'x'}, ErrDecodeDNSLabelTooShort},
+		{"ZONEMD", []byte{0x78, 0x49, 0x1e, 0x4c, 0x01}, ErrDecodeDNSAnswerRdataTooShort},
+		{"URI", []byte{0x00, 0x0a, 0x00}, ErrDecodeDNSAnswerRdataTooShort},
+		{"LOC", make([]byte, 15), ErrDecodeDNSAnswerRdataTooShort},
+		{"LOC", append([]byte{0x01}, make([]byte, 15)...), ErrDecodeDNSAnswerRdataInvalid},
+		{"HINFO", []byte{0x03, 'x', '8', '6'}, ErrDecodeDNSAnswerRdataTooShort},
+	}
+
+	for _, vector := range vectors {
+		_, err := ParseRdata(vector.rrtype, vector.rdata, vector.rdata, 0)
+		if !errors.Is(err, vector.err) {
+			t.Errorf("rdata %s %v, bad error returned: %v", vector.rrtype, vector.rdata, err)
+		}
+	}
+}
+
+func FuzzParseRdata(f *testing.F) {
+	rrtypes := []string{"A", "AAAA", "CNAME", "MX", "SRV", "NS", "TXT", "PTR", "SOA", "SVCB", "DS", "DNSKEY",
+		"RRSIG", "NSEC", "NSEC3", "NSEC3PARAM", "CAA", "TLSA", "SSHFP", "NAPTR", "DNAME", "ZONEMD", "URI", "LOC", "HINFO"}
+
+	f.Add([]byte{0x00, 0x64, 0x00, 0x0a, 0x01, 'S', 0x00, 0x00, 0x00})
+	f.Add([]byte{0x00, 0x2e, 0x0d, 0x02, 0x00, 0x00, 0x0e, 0x10, 0x67, 0x74, 0x84, 0x7f, 0x67, 0x4b, 0xa6, 0x00, 0x30, 0x39, 0xc0, 0x00})
+	f.Add([]byte{0x01, 0x00, 0x00, 0x0c, 0x01, 0xaa, 0x02, 0xbb, 0xcc, 0x00, 0x01, 0x40})
+	f.Add(append([]byte{0x00, 0x12, 0x16, 0x13}, make([]byte, 12)...))
+
+	f.Fuzz(func(t *testing.T, rdata []byte) {
+		// the decoders must never panic, whatever the rdata
+		for _, rrtype := range rrtypes {
+			ParseRdata(rrtype, rdata, rdata, 0)
+		}
+	})
+}
@@ -11,12 +11,16 @@ var (
 	DNSReplyQuiet = "R"
 )
 
+// RdataFields is the structured representation of the rdata, the keys depend on the record type
+type RdataFields map[string]interface{}
+
 type DNSAnswer struct {
-	Name      string `json:"name"`
-	Rdatatype string `json:"rdatatype"`
-	Class     string `json:"class"`
-	TTL       int    `json:"ttl"`
-	Rdata     string `json:"rdata"`
+	Name        string       `json:"name"`
+	Rdatatype   string       `json:"rdatatype"`
+	Class       string       `json:"class"`
+	TTL         int          `json:"ttl"`
+	Rdata       string       `json:"rdata"`
+	RdataFields *RdataFields `json:"rdata-fields,omitempty"`
 }
 
 type DNSFlags struct {
@@ -38,6 +42,7 @@ type DNSNetInfo struct {
 	ResponsePort   string `json:"response-port"`
 	IPDefragmented bool   `json:"ip-defragmented"`
 	TCPReassembled bool   `json:"tcp-reassembled"`
+	PortLabel      string `json:"port-label"`
 }
 
 type DNSRRs struct {
@@ -65,12 +70,16 @@ type DNS struct {
 	Flags           DNSFlags `json:"flags"`
 	DNSRRs          DNSRRs   `json:"resource-records"`
 	MalformedPacket bool     `json:"malformed-packet"`
+	Anomalies       []string `json:"anomalies,omitempty"`
 }
 
 type DNSOption struct {
-	Code int    `json:"code"`
-	Name string `json:"name"`
-	Data string `json:"data"`
+	Code         int    `json:"code"`
+	Name         string `json:"name"`
+	Data         string `json:"data"`
+	NSID         string `json:"nsid,omitempty"`
+	ClientCookie string `json:"client-cookie,omitempty"`
+	ServerCookie string `json:"server-cookie,omitempty"`
 }
 
 type DNSExtended struct {
@@ -188,6 +197,51 @@ type TransformATags struct {
 	Tags []string `json:"tags"`
 }
 
+type TransformAnswerChain struct {
+	CnameChainLength int    `json:"cname-chain-length"`
+	FinalTarget      string `json:"final-target"`
+	BrokenChain      bool   `json:"broken-chain"`
+	Signed           bool   `json:"signed"`
+	Referral         bool   `json:"referral"`
+	NegativeAnswer   string `json:"negative-answer"`
+	MinTTL           int    `json:"min-ttl"`
+}
+
+type TransformClientStats struct {
+	Queries             int     `json:"queries"`
+	QueriesPerSecond    float64 `json:"qps"`
+	DistinctQnames      int     `json:"distinct-qnames"`
+	DistinctETLDPlusOne int     `json:"distinct-etld+1"`
+	NXDomainRatio       float64 `json:"nxdomain-ratio"`
+}
+
+type TransformTunneling struct {
+	Score       float64  `json:"score"`
+	Reasons     []string `json:"reasons"`
+	Domain      string   `json:"domain"`
+	UniqueBytes int      `json:"unique-bytes"`
+	Entropy     float64  `json:"entropy"`
+}
+
+type ThreatIntelMatch struct {
+	Feed      string `json:"feed"`
+	Indicator string `json:"indicator"`
+	Severity  string `json:"severity"`
+	Field     string `json:"field"`
+}
+
+type TransformThreatIntel struct {
+	Matches []ThreatIntelMatch `json:"matches"`
+}
+
+type TransformTransaction struct {
+	QueryTime   string   `json:"query-time"`
+	ReplyTime   string   `json:"reply-time"`
+	QueryFlags  DNSFlags `json:"query-flags"`
+	QueryLength int      `json:"query-length"`
+	Answered    bool     `json:"answered"`
+}
+
 type RelabelingRule struct {
 	Regex       *regexp.Regexp
 	Replacement string
@@ -213,6 +267,11 @@ type DNSMessage struct {
 	MachineLearning *TransformML           `json:"ml,omitempty"`
 	Filtering       *TransformFiltering    `json:"filtering,omitempty"`
 	ATags           *TransformATags        `json:"atags,omitempty"`
+	AnswerChain     *TransformAnswerChain  `json:"answer-chain,omitempty"`
+	Transaction     *TransformTransaction  `json:"transaction,omitempty"`
+	ClientStats     *TransformClientStats  `json:"client-stats,omitempty"`
+	Tunneling       *TransformTunneling    `json:"tunneling,omitempty"`
+	ThreatIntel     *TransformThreatIntel  `json:"threat-intel,omitempty"`
 	Relabeling      *TransformRelabeling   `json:"-"`
 }
 
@@ -226,6 +285,7 @@ func (dm *DNSMessage) Init() {
 		ResponsePort:   "-",
 		IPDefragmented: false,
 		TCPReassembled: false,
+		PortLabel:      "-",
 	}
 
 	dm.DNSTap = DNSTap{
@@ -268,6 +328,11 @@ func (dm *DNSMessage) InitTransforms() {
 	dm.PublicSuffix = &TransformPublicSuffix{}
 	dm.Suspicious = &TransformSuspicious{}
 	dm.Geo = &TransformDNSGeo{}
+	dm.AnswerChain = &TransformAnswerChain{}
+	dm.Transaction = &TransformTransaction{}
+	dm.ClientStats = &TransformClientStats{}
+	dm.Tunneling = &TransformTunneling{}
+	dm.ThreatIntel = &TransformThreatIntel{}
 	dm.Relabeling = &TransformRelabeling{}
 	// init collectors & loggers
 	dm.PowerDNS = &CollectorPowerDNS{}
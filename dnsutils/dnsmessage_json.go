@@ -3,9 +3,17 @@ package dnsutils
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+var ErrFlatKeyIndex = errors.New("index not following the previous items")
+
 func (dm *DNSMessage) ToJSON() string {
 	buffer := new(bytes.Buffer)
 	json.NewEncoder(buffer).Encode(dm)
@@ -22,6 +30,153 @@ func (dm *DNSMessage) ToFlatJSON() (string, error) {
 	return buffer.String(), nil
 }
 
+// FromJSON decodes a DNS message encoded with ToJSON
+func (dm *DNSMessage) FromJSON(data []byte) error {
+	dm.Init()
+	if err := json.Unmarshal(data, dm); err != nil {
+		return err
+	}
+	dm.restoreFields()
+	return nil
+}
+
+// FromFlatJSON decodes a DNS message encoded with ToFlatJSON,
+// the keys are the json tags of the fields joined with a dot
+func (dm *DNSMessage) FromFlatJSON(data []byte) error {
+	flat := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&flat); err != nil {
+		return err
+	}
+	return dm.Unflatten(flat)
+}
+
+// Unflatten sets the fields of the DNS message from the flat keys returned by Flatten,
+// the unknown keys are ignored
+func (dm *DNSMessage) Unflatten(flat map[string]interface{}) error {
+	dm.Init()
+
+	// the keys are sorted to set the items of the slices in the order of the indexes
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessFlatKey(keys[i], keys[j]) })
+
+	value := reflect.ValueOf(dm).Elem()
+	for _, key := range keys {
+		if err := setFieldByFlatKey(value, key, flat[key]); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	dm.restoreFields()
+	return nil
+}
+
+// lessFlatKey compares the flat keys part by part, the numeric parts as numbers
+func lessFlatKey(a, b string) bool {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if partsA[i] == partsB[i] {
+			continue
+		}
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		if errA == nil && errB == nil {
+			return numA < numB
+		}
+		return partsA[i] < partsB[i]
+	}
+	return len(partsA) < len(partsB)
+}
+
+// restoreFields restores the fields not encoded in json
+func (dm *DNSMessage) restoreFields() {
+	if dm.DNS.Flags.QR {
+		dm.DNS.Type = DNSReply
+	} else {
+		dm.DNS.Type = DNSQuery
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, dm.DNSTap.TimestampRFC3339); err == nil {
+		dm.DNSTap.Timestamp = ts.UnixNano()
+		dm.DNSTap.TimeSec = int(ts.Unix())
+		dm.DNSTap.TimeNsec = ts.Nanosecond()
+	}
+}
+
+// setFieldByFlatKey walks the structs according to the json tags, the numeric keys
+// are the indexes of the slices and "-" is the value of the empty slices.
+// A slice is only extended by one item, the indexes must follow each other.
+func setFieldByFlatKey(value reflect.Value, key string, data interface{}) error {
+	head, rest, _ := strings.Cut(key, ".")
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return setFieldByFlatKey(value.Elem(), key, data)
+
+	case reflect.Struct:
+		if len(key) == 0 {
+			break
+		}
+		for i := 0; i < value.NumField(); i++ {
+			tag := strings.TrimSuffix(value.Type().Field(i).Tag.Get("json"), ",omitempty")
+			if tag == head && tag != "-" {
+				return setFieldByFlatKey(value.Field(i), rest, data)
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		if len(key) == 0 {
+			if str, ok := data.(string); ok && str == "-" {
+				value.Set(reflect.MakeSlice(value.Type(), 0, 0))
+				return nil
+			}
+			break
+		}
+		index, err := strconv.Atoi(head)
+		if err != nil || index < 0 {
+			return nil
+		}
+		if index > value.Len() {
+			return fmt.Errorf("%w: index %d", ErrFlatKeyIndex, index)
+		}
+		if index == value.Len() {
+			value.Set(reflect.Append(value, reflect.Zero(value.Type().Elem())))
+		}
+		return setFieldByFlatKey(value.Index(index), rest, data)
+
+	case reflect.Map:
+		if len(key) == 0 || value.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		elem := reflect.New(value.Type().Elem()).Elem()
+		if err := setFieldByFlatKey(elem, "", data); err != nil {
+			return err
+		}
+		value.SetMapIndex(reflect.ValueOf(key).Convert(value.Type().Key()), elem)
+		return nil
+	}
+
+	if len(key) > 0 {
+		return nil
+	}
+
+	// convert the value to the type of the field
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, value.Addr().Interface())
+}
+
 func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 	dnsFields := map[string]interface{}{
 		"dns.flags.aa":               dm.DNS.Flags.AA,
@@ -68,6 +223,7 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		"network.response-ip":        dm.NetworkInfo.ResponseIP,
 		"network.response-port":      dm.NetworkInfo.ResponsePort,
 		"network.tcp-reassembled":    dm.NetworkInfo.TCPReassembled,
+		"network.port-label":         dm.NetworkInfo.PortLabel,
 	}
 
 	// Add empty slices
@@ -84,6 +240,11 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields["edns.options"] = "-"
 	}
 
+	// Add parse anomalies: "dns.anomalies.0": "pointer-loop"
+	for i, anomaly := range dm.DNS.Anomalies {
+		dnsFields["dns.anomalies."+strconv.Itoa(i)] = anomaly
+	}
+
 	// Add DNSAnswer fields: "dns.resource-records.an.0.name": "google.nl"
 	// nolint: goconst
 	for i, an := range dm.DNS.DNSRRs.Answers {
@@ -93,6 +254,11 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields[prefixAn+".rdatatype"] = an.Rdatatype
 		dnsFields[prefixAn+".ttl"] = an.TTL
 		dnsFields[prefixAn+".class"] = an.Class
+		if an.RdataFields != nil {
+			for k, v := range *an.RdataFields {
+				dnsFields[prefixAn+".rdata-fields."+k] = v
+			}
+		}
 	}
 	for i, ns := range dm.DNS.DNSRRs.Nameservers {
 		prefixNs := "dns.resource-records.ns." + strconv.Itoa(i)
@@ -101,6 +267,11 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields[prefixNs+".rdatatype"] = ns.Rdatatype
 		dnsFields[prefixNs+".ttl"] = ns.TTL
 		dnsFields[prefixNs+".class"] = ns.Class
+		if ns.RdataFields != nil {
+			for k, v := range *ns.RdataFields {
+				dnsFields[prefixNs+".rdata-fields."+k] = v
+			}
+		}
 	}
 	for i, ar := range dm.DNS.DNSRRs.Records {
 		prefixAr := "dns.resource-records.ar." + strconv.Itoa(i)
@@ -109,6 +280,11 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields[prefixAr+".rdatatype"] = ar.Rdatatype
 		dnsFields[prefixAr+".ttl"] = ar.TTL
 		dnsFields[prefixAr+".class"] = ar.Class
+		if ar.RdataFields != nil {
+			for k, v := range *ar.RdataFields {
+				dnsFields[prefixAr+".rdata-fields."+k] = v
+			}
+		}
 	}
 
 	// Add EDNSoptions fields: "edns.options.0.code": 10,
@@ -117,6 +293,15 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields[prefixOpt+".code"] = opt.Code
 		dnsFields[prefixOpt+".data"] = opt.Data
 		dnsFields[prefixOpt+".name"] = opt.Name
+		if opt.NSID != "" {
+			dnsFields[prefixOpt+".nsid"] = opt.NSID
+		}
+		if opt.ClientCookie != "" {
+			dnsFields[prefixOpt+".client-cookie"] = opt.ClientCookie
+		}
+		if opt.ServerCookie != "" {
+			dnsFields[prefixOpt+".server-cookie"] = opt.ServerCookie
+		}
 	}
 
 	// Add TransformDNSGeo fields
@@ -159,6 +344,65 @@ func (dm *DNSMessage) Flatten() (map[string]interface{}, error) {
 		dnsFields["reducer.cumulative-length"] = dm.Reducer.CumulativeLength
 	}
 
+	// Add TransformAnswerChain fields
+	if dm.AnswerChain != nil {
+		dnsFields["answer-chain.cname-chain-length"] = dm.AnswerChain.CnameChainLength
+		dnsFields["answer-chain.final-target"] = dm.AnswerChain.FinalTarget
+		dnsFields["answer-chain.broken-chain"] = dm.AnswerChain.BrokenChain
+		dnsFields["answer-chain.signed"] = dm.AnswerChain.Signed
+		dnsFields["answer-chain.referral"] = dm.AnswerChain.Referral
+		dnsFields["answer-chain.negative-answer"] = dm.AnswerChain.NegativeAnswer
+		dnsFields["answer-chain.min-ttl"] = dm.AnswerChain.MinTTL
+	}
+
+	// Add TransformTransaction fields
+	if dm.Transaction != nil {
+		dnsFields["transaction.query-time"] = dm.Transaction.QueryTime
+		dnsFields["transaction.reply-time"] = dm.Transaction.ReplyTime
+		dnsFields["transaction.query-length"] = dm.Transaction.QueryLength
+		dnsFields["transaction.answered"] = dm.Transaction.Answered
+		dnsFields["transaction.query-flags.rd"] = dm.Transaction.QueryFlags.RD
+		dnsFields["transaction.query-flags.cd"] = dm.Transaction.QueryFlags.CD
+		dnsFields["transaction.query-flags.ad"] = dm.Transaction.QueryFlags.AD
+	}
+
+	// Add TransformClientStats fields
+	if dm.ClientStats != nil {
+		dnsFields["client-stats.queries"] = dm.ClientStats.Queries
+		dnsFields["client-stats.qps"] = dm.ClientStats.QueriesPerSecond
+		dnsFields["client-stats.distinct-qnames"] = dm.ClientStats.DistinctQnames
+		dnsFields["client-stats.distinct-etld+1"] = dm.ClientStats.DistinctETLDPlusOne
+		dnsFields["client-stats.nxdomain-ratio"] = dm.ClientStats.NXDomainRatio
+	}
+
+	// Add TransformTunneling fields
+	if dm.Tunneling != nil {
+		dnsFields["tunneling.score"] = dm.Tunneling.Score
+		dnsFields["tunneling.domain"] = dm.Tunneling.Domain
+		dnsFields["tunneling.unique-bytes"] = dm.Tunneling.UniqueBytes
+		dnsFields["tunneling.entropy"] = dm.Tunneling.Entropy
+		if len(dm.Tunneling.Reasons) == 0 {
+			dnsFields["tunneling.reasons"] = "-"
+		}
+		for i, reason := range dm.Tunneling.Reasons {
+			dnsFields["tunneling.reasons."+strconv.Itoa(i)] = reason
+		}
+	}
+
+	// Add TransformThreatIntel fields
+	if dm.ThreatIntel != nil {
+		if len(dm.ThreatIntel.Matches) == 0 {
+			dnsFields["threat-intel.matches"] = "-"
+		}
+		for i, match := range dm.ThreatIntel.Matches {
+			prefix := "threat-intel.matches." + strconv.Itoa(i)
+			dnsFields[prefix+".feed"] = match.Feed
+			dnsFields[prefix+".indicator"] = match.Indicator
+			dnsFields[prefix+".severity"] = match.Severity
+			dnsFields[prefix+".field"] = match.Field
+		}
+	}
+
 	// Add TransformFiltering fields
 	if dm.Filtering != nil {
 		dnsFields["filtering.sample-rate"] = dm.Filtering.SampleRate
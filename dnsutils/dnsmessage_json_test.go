@@ -2,7 +2,10 @@ package dnsutils
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -21,7 +24,8 @@ func TestDnsMessage_Json_Reference(t *testing.T) {
 				  "response-ip": "-",
 				  "response-port": "-",
 				  "ip-defragmented": false,
-				  "tcp-reassembled": false
+				  "tcp-reassembled": false,
+				  "port-label": "-"
 				},
 				"dns": {
 				  "id": 0,
@@ -323,8 +327,9 @@ func TestDnsMessage_JsonFlatten_Reference(t *testing.T) {
 	dm.Init()
 
 	// add some items in slices field
-	dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, DNSAnswer{Name: "google.nl", Rdata: "142.251.39.99", Rdatatype: "A", TTL: 300, Class: "IN"})
-	dm.EDNS.Options = append(dm.EDNS.Options, DNSOption{Code: 10, Data: "aaaabbbbcccc", Name: "COOKIE"})
+	dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, DNSAnswer{Name: "google.nl", Rdata: "142.251.39.99", Rdatatype: "A", TTL: 300, Class: "IN",
+		RdataFields: &RdataFields{"address": "142.251.39.99"}})
+	dm.EDNS.Options = append(dm.EDNS.Options, DNSOption{Code: 10, Data: "aaaabbbb cccc", Name: "COOKIE", ClientCookie: "aaaabbbb", ServerCookie: "cccc"})
 
 	refJSON := `
 				{
@@ -349,6 +354,7 @@ func TestDnsMessage_JsonFlatten_Reference(t *testing.T) {
 					"dns.nscount": 0,
 					"dns.resource-records.an.0.name": "google.nl",
 					"dns.resource-records.an.0.rdata": "142.251.39.99",
+					"dns.resource-records.an.0.rdata-fields.address": "142.251.39.99",
 					"dns.resource-records.an.0.rdatatype": "A",
 					"dns.resource-records.an.0.ttl": 300,
 					"dns.resource-records.an.0.class": "IN",
@@ -369,8 +375,10 @@ func TestDnsMessage_JsonFlatten_Reference(t *testing.T) {
 					"dnstap.query-zone": "-",
 					"edns.dnssec-ok": 0,
 					"edns.options.0.code": 10,
-					"edns.options.0.data": "aaaabbbbcccc",
+					"edns.options.0.data": "aaaabbbb cccc",
 					"edns.options.0.name": "COOKIE",
+					"edns.options.0.client-cookie": "aaaabbbb",
+					"edns.options.0.server-cookie": "cccc",
 					"edns.rcode": 0,
 					"edns.udp-size": 0,
 					"edns.version": 0,
@@ -381,7 +389,8 @@ func TestDnsMessage_JsonFlatten_Reference(t *testing.T) {
 					"network.query-port": "-",
 					"network.response-ip": "-",
 					"network.response-port": "-",
-					"network.tcp-reassembled": false
+					"network.tcp-reassembled": false,
+					"network.port-label": "-"
 				}
 			`
 
@@ -673,3 +682,94 @@ func BenchmarkDnsMessage_ToFlatJSON(b *testing.B) {
 		}
 	}
 }
+
+func TestDnsMessage_Json_Decode(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.DNS.Flags.QR = true
+	dm.DNS.Type = DNSReply
+	dm.DNSTap.TimestampRFC3339 = "2024-01-05T20:34:01.227961611Z"
+	dm.DNS.DNSRRs.Answers = []DNSAnswer{{Name: "dns.collector", Rdatatype: "A", Class: "IN", TTL: 300, Rdata: "192.0.2.1"}}
+	dm.ATags = &TransformATags{Tags: []string{"tag1", "tag2"}}
+
+	decoded := DNSMessage{}
+	if err := decoded.FromJSON([]byte(dm.ToJSON())); err != nil {
+		t.Fatalf("unable to decode json: %v", err)
+	}
+	if decoded.ToJSON() != dm.ToJSON() {
+		t.Errorf("json mismatch\n got: %s\nwant: %s", decoded.ToJSON(), dm.ToJSON())
+	}
+	if decoded.DNS.Type != DNSReply || decoded.DNSTap.Timestamp != 1704486841227961611 {
+		t.Errorf("fields not restored: type=%s timestamp=%d", decoded.DNS.Type, decoded.DNSTap.Timestamp)
+	}
+}
+
+func TestDnsMessage_JsonFlatten_Decode(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	dm.InitTransforms()
+	dm.DNSTap.TimestampRFC3339 = "2024-01-05T20:34:01.227961611Z"
+	dm.DNS.DNSRRs.Answers = []DNSAnswer{
+		{Name: "dns.collector", Rdatatype: "CNAME", Class: "IN", TTL: 300, Rdata: "www.dns.collector"},
+		{Name: "www.dns.collector", Rdatatype: "A", Class: "IN", TTL: 300, Rdata: "192.0.2.1"},
+	}
+	dm.EDNS.Options = []DNSOption{{Code: 10, Name: "COOKIE", Data: "-"}}
+	dm.ATags.Tags = []string{"tag1"}
+	dm.Tunneling.Reasons = []string{"unique-bytes"}
+	dm.PowerDNS.Metadata = map[string]string{"agent": "dnscollector"}
+
+	flat, err := dm.ToFlatJSON()
+	if err != nil {
+		t.Fatalf("unable to flatten: %v", err)
+	}
+
+	decoded := DNSMessage{}
+	if err := decoded.FromFlatJSON([]byte(flat)); err != nil {
+		t.Fatalf("unable to decode flat json: %v", err)
+	}
+	flatDecoded, err := decoded.ToFlatJSON()
+	if err != nil {
+		t.Fatalf("unable to flatten: %v", err)
+	}
+	if flatDecoded != flat {
+		t.Errorf("flat json mismatch\n got: %s\nwant: %s", flatDecoded, flat)
+	}
+	if decoded.DNS.Type != DNSQuery || decoded.DNSTap.TimeSec != 1704486841 {
+		t.Errorf("fields not restored: type=%s timesec=%d", decoded.DNS.Type, decoded.DNSTap.TimeSec)
+	}
+
+	// invalid type
+	if err := decoded.FromFlatJSON([]byte(`{"dns.id": "abc"}`)); err == nil {
+		t.Errorf("invalid value should fail")
+	}
+}
+
+func TestDnsMessage_JsonFlatten_Decode_Indexes(t *testing.T) {
+	// the indexes are applied in the numeric order
+	data := `{"dns.anomalies.10": "k", "dns.anomalies.2": "c"`
+	for i, anomaly := range []string{"a", "b", "d", "e", "f", "g", "h", "i", "j"} {
+		index := i
+		if i >= 2 {
+			index++
+		}
+		data += fmt.Sprintf(`, "dns.anomalies.%d": "%s"`, index, anomaly)
+	}
+	data += "}"
+
+	decoded := DNSMessage{}
+	if err := decoded.FromFlatJSON([]byte(data)); err != nil {
+		t.Fatalf("unable to decode flat json: %v", err)
+	}
+	if got := strings.Join(decoded.DNS.Anomalies, ""); got != "abcdefghijk" {
+		t.Errorf("unexpected anomalies: %s", got)
+	}
+
+	// an index not following the previous items must be rejected, without growing the slice
+	for _, data := range []string{
+		`{"dns.resource-records.an.2000000000.name": "x"}`,
+		`{"dns.resource-records.an.0.name": "x", "dns.resource-records.an.2.name": "y"}`,
+	} {
+		err := decoded.FromFlatJSON([]byte(data))
+		if !errors.Is(err, ErrFlatKeyIndex) {
+			t.Errorf("want index error for %s, got %v", data, err)
+		}
+	}
+}
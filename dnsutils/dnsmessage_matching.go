@@ -465,6 +465,16 @@ func GetFieldByJSONTag(value reflect.Value, nestedKeys string) (reflect.Value, b
 			switch fieldValue.Kind() {
 			case reflect.Struct:
 				return GetFieldByJSONTag(fieldValue, remainingKeys)
+			case reflect.Map:
+				// the values of the maps are interfaces, like the structured rdata
+				if fieldValue.Type().Key().Kind() != reflect.String {
+					return reflect.Value{}, false
+				}
+				mapValue := fieldValue.MapIndex(reflect.ValueOf(remainingKeys).Convert(fieldValue.Type().Key()))
+				if !mapValue.IsValid() {
+					return reflect.Value{}, false
+				}
+				return reflect.ValueOf(mapValue.Interface()), true
 			case reflect.Slice:
 				if sliceElem, leftKey, found := getSliceElement(fieldValue, remainingKeys); found {
 					// Handle the slice element based on its kind
@@ -475,7 +485,15 @@ func GetFieldByJSONTag(value reflect.Value, nestedKeys string) (reflect.Value, b
 						var result []interface{}
 						for i := 0; i < sliceElem.Len(); i++ {
 							if subElem := sliceElem.Index(i); subElem.Kind() == reflect.Struct {
-								if nestedValue, found := GetFieldByJSONTag(subElem, leftKey); found {
+								nestedValue, found := GetFieldByJSONTag(subElem, leftKey)
+								switch {
+								case !found:
+								case nestedValue.Kind() == reflect.Slice:
+									// the lists of the elements are merged, like the lists of the structured rdata
+									for j := 0; j < nestedValue.Len(); j++ {
+										result = append(result, nestedValue.Index(j).Interface())
+									}
+								default:
 									result = append(result, nestedValue.Interface())
 								}
 							} else {
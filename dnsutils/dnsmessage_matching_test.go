@@ -207,6 +207,32 @@ func TestDNSMessage_Matching_Arrays(t *testing.T) {
 		wantError bool
 		wantMatch bool
 	}{
+		{
+			name: "Test rdata fields match",
+			dm: &DNSMessage{DNS: DNS{DNSRRs: DNSRRs{Answers: []DNSAnswer{
+				{Rdatatype: "CNAME"},
+				{Rdatatype: "HTTPS", RdataFields: &RdataFields{"priority": 1, "alpn": []string{"h2", "h3"}}},
+			}}}},
+			matching: map[string]interface{}{
+				"dns.resource-records.an.*.rdata-fields.alpn":     "h3",
+				"dns.resource-records.an.*.rdata-fields.priority": 1,
+			},
+			wantError: false,
+			wantMatch: true,
+		},
+		{
+			name: "Test rdata fields no match",
+			dm: &DNSMessage{DNS: DNS{DNSRRs: DNSRRs{Answers: []DNSAnswer{
+				{Rdatatype: "SOA", RdataFields: &RdataFields{"serial": 2024101501}},
+			}}}},
+			matching: map[string]interface{}{
+				"dns.resource-records.an.0.rdata-fields.serial": map[string]interface{}{
+					"greater-than": 2024110100,
+				},
+			},
+			wantError: false,
+			wantMatch: false,
+		},
 		{
 			name: "Test wilcard match with operator",
 			dm:   &DNSMessage{DNS: DNS{DNSRRs: DNSRRs{Answers: []DNSAnswer{{TTL: 300}}}}},
@@ -0,0 +1,229 @@
+package dnsutils
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// indexed keys of the flat format: "dns.resource-records.an.0.name" or "atags.tags.0"
+var flatIndexedKey = regexp.MustCompile(`^(.+)\.(\d+)(?:\.(.+))?$`)
+
+// flat keys with dynamic names, stored as a JSON object
+var flatDynamicPrefixes = []string{"powerdns.metadata."}
+
+// FlattenColumns returns the flat format with a stable set of keys, usable as columns.
+// The lists (answers, edns options, tags...) and the dynamic keys are encoded as a JSON
+// string in a single column.
+func (dm *DNSMessage) FlattenColumns() (map[string]interface{}, error) {
+	flat, err := dm.Flatten()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]interface{}, len(flat))
+	lists := make(map[string]map[int]interface{})
+	objects := make(map[string]map[string]interface{})
+
+	for key, value := range flat {
+		if prefix := flatDynamicPrefix(key); prefix != "" {
+			if objects[prefix] == nil {
+				objects[prefix] = make(map[string]interface{})
+			}
+			objects[prefix][strings.TrimPrefix(key, prefix+".")] = value
+			continue
+		}
+
+		match := flatIndexedKey.FindStringSubmatch(key)
+		if match == nil {
+			columns[key] = value
+			continue
+		}
+		index, err := strconv.Atoi(match[2])
+		if err != nil {
+			columns[key] = value
+			continue
+		}
+		if lists[match[1]] == nil {
+			lists[match[1]] = make(map[int]interface{})
+		}
+		if match[3] == "" {
+			lists[match[1]][index] = value
+			continue
+		}
+		item, ok := lists[match[1]][index].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			lists[match[1]][index] = item
+		}
+		item[match[3]] = value
+	}
+
+	for key, items := range lists {
+		list := make([]interface{}, len(items))
+		for i := range list {
+			list[i] = items[i]
+		}
+		encoded, err := json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+		columns[key] = string(encoded)
+	}
+	for key, object := range objects {
+		encoded, err := json.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		columns[key] = string(encoded)
+	}
+	return columns, nil
+}
+
+func flatDynamicPrefix(key string) string {
+	for _, prefix := range flatDynamicPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return strings.TrimSuffix(prefix, ".")
+		}
+	}
+	return ""
+}
+
+// ParquetSchema returns a schema with one optional column per key of the flat columns.
+// The keys are taken from a dns message with all the optional parts set, the schema does
+// not depend on the messages written and the keys present only in some messages are kept.
+func ParquetSchema(relabeling *TransformRelabeling) (*parquet.Schema, error) {
+	dm := DNSMessage{}
+	dm.Init()
+	dm.InitTransforms()
+	dm.Relabeling = relabeling
+
+	// one item in each list to get the list columns
+	dm.DNS.Anomalies = []string{"-"}
+	dm.DNS.DNSRRs.Answers = []DNSAnswer{{}}
+	dm.DNS.DNSRRs.Nameservers = []DNSAnswer{{}}
+	dm.DNS.DNSRRs.Records = []DNSAnswer{{}}
+	dm.EDNS.Options = []DNSOption{{}}
+	dm.ATags.Tags = []string{"-"}
+	dm.Tunneling.Reasons = []string{"-"}
+	dm.ThreatIntel.Matches = []ThreatIntelMatch{{}}
+	dm.PowerDNS.Tags = []string{"-"}
+	dm.PowerDNS.Metadata = map[string]string{"-": "-"}
+
+	columns, err := dm.FlattenColumns()
+	if err != nil {
+		return nil, err
+	}
+	return parquetSchema(columns), nil
+}
+
+func parquetSchema(columns map[string]interface{}) *parquet.Schema {
+	group := parquet.Group{}
+	for key, value := range columns {
+		switch value.(type) {
+		case bool:
+			group[key] = parquet.Optional(parquet.Leaf(parquet.BooleanType))
+		case int, int8, int16, int32, int64, uint8, uint16, uint32:
+			group[key] = parquet.Optional(parquet.Int(64))
+		case float32, float64:
+			group[key] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		default:
+			group[key] = parquet.Optional(parquet.String())
+		}
+	}
+	return parquet.NewSchema("dnsmessage", group)
+}
+
+// ParquetRow converts the flat columns to a row of the schema, missing keys are null
+// and keys unknown in the schema are ignored
+func ParquetRow(schema *parquet.Schema, columns map[string]interface{}) parquet.Row {
+	names := schema.Columns()
+	row := make(parquet.Row, len(names))
+	for i, path := range names {
+		value, ok := columns[path[0]]
+		if !ok {
+			row[i] = parquet.NullValue().Level(0, 0, i)
+			continue
+		}
+
+		leaf, _ := schema.Lookup(path...)
+		var pv parquet.Value
+		switch leaf.Node.Type().Kind() {
+		case parquet.Boolean:
+			b, ok := value.(bool)
+			if !ok {
+				row[i] = parquet.NullValue().Level(0, 0, i)
+				continue
+			}
+			pv = parquet.BooleanValue(b)
+		case parquet.Int64:
+			n, ok := parquetInt(value)
+			if !ok {
+				row[i] = parquet.NullValue().Level(0, 0, i)
+				continue
+			}
+			pv = parquet.Int64Value(n)
+		case parquet.Double:
+			f, ok := parquetFloat(value)
+			if !ok {
+				row[i] = parquet.NullValue().Level(0, 0, i)
+				continue
+			}
+			pv = parquet.DoubleValue(f)
+		default:
+			pv = parquet.ByteArrayValue([]byte(parquetString(value)))
+		}
+		row[i] = pv.Level(0, 1, i)
+	}
+	return row
+}
+
+func parquetInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func parquetFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	n, ok := parquetInt(value)
+	return float64(n), ok
+}
+
+func parquetString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
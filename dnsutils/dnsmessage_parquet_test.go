@@ -0,0 +1,97 @@
+package dnsutils
+
+import (
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestDnsMessage_FlattenColumns(t *testing.T) {
+	dm := GetFakeDNSMessageWithPayload()
+	dm.DNS.DNSRRs.Answers = []DNSAnswer{
+		{Name: "dns.collector", Rdatatype: "A", Class: "IN", TTL: 300, Rdata: "127.0.0.1"},
+		{Name: "dns.collector", Rdatatype: "A", Class: "IN", TTL: 300, Rdata: "127.0.0.2"},
+	}
+	dm.PowerDNS = &CollectorPowerDNS{Tags: []string{"tag1"}, Metadata: map[string]string{"agent": "dnsdist"}}
+
+	columns, err := dm.FlattenColumns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"dns.qname":               dm.DNS.Qname,
+		"dns.resource-records.an": `[{"class":"IN","name":"dns.collector","rdata":"127.0.0.1","rdatatype":"A","ttl":300},{"class":"IN","name":"dns.collector","rdata":"127.0.0.2","rdatatype":"A","ttl":300}]`,
+		"dns.resource-records.ns": "-",
+		"powerdns.tags":           `["tag1"]`,
+		"powerdns.metadata":       `{"agent":"dnsdist"}`,
+	}
+	for key, value := range expected {
+		if columns[key] != value {
+			t.Errorf("column %s: expected %v, got %v", key, value, columns[key])
+		}
+	}
+	if _, ok := columns["dns.resource-records.an.0.name"]; ok {
+		t.Errorf("indexed keys should be removed")
+	}
+}
+
+func TestDnsMessage_ParquetRow(t *testing.T) {
+	dm := GetFakeDNSMessage()
+	columns, err := dm.FlattenColumns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := ParquetSchema(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown key ignored, missing key is null
+	delete(columns, "dns.qtype")
+	columns["unknown"] = "value"
+	row := ParquetRow(schema, columns)
+
+	if len(row) != len(schema.Columns()) {
+		t.Fatalf("invalid row length: %d", len(row))
+	}
+	qname, _ := schema.Lookup("dns.qname")
+	if row[qname.ColumnIndex].String() != dm.DNS.Qname {
+		t.Errorf("invalid qname: %s", row[qname.ColumnIndex])
+	}
+	qtype, _ := schema.Lookup("dns.qtype")
+	if !row[qtype.ColumnIndex].IsNull() {
+		t.Errorf("null value expected for missing key")
+	}
+	id, _ := schema.Lookup("dns.id")
+	if row[id.ColumnIndex].Int64() != int64(dm.DNS.ID) {
+		t.Errorf("invalid id: %s", row[id.ColumnIndex])
+	}
+}
+
+func TestDnsMessage_ParquetSchema(t *testing.T) {
+	schema, err := ParquetSchema(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the optional keys are in the schema, even if absent from the messages
+	for _, key := range []string{"dns.qname", "dns.anomalies", "answer-chain.final-target", "threat-intel.matches", "geoip.city", "powerdns.metadata"} {
+		if _, ok := schema.Lookup(key); !ok {
+			t.Errorf("column %s expected in the schema", key)
+		}
+	}
+
+	// the type of the columns
+	for key, kind := range map[string]parquet.Kind{
+		"dns.id":               parquet.Int64,
+		"client-stats.qps":     parquet.Double,
+		"answer-chain.signed":  parquet.Boolean,
+		"threat-intel.matches": parquet.ByteArray,
+	} {
+		leaf, _ := schema.Lookup(key)
+		if got := leaf.Node.Type().Kind(); got != kind {
+			t.Errorf("column %s: expected %s, got %s", key, kind, got)
+		}
+	}
+}
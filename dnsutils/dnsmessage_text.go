@@ -23,8 +23,42 @@ var (
 	FilteringDirectives       = regexp.MustCompile(`^filtering-*`)
 	RawTextDirective          = regexp.MustCompile(`^ *\{.*\}`)
 	ATagsDirectives           = regexp.MustCompile(`^atags*`)
+	RdataFieldsDirectives     = regexp.MustCompile(`^rdata-fields*`)
+	AnswerChainDirectives     = regexp.MustCompile(`^answer-chain-*`)
+	TransactionDirectives     = regexp.MustCompile(`^transaction-*`)
+	ClientStatsDirectives     = regexp.MustCompile(`^client-stats-*`)
+	TunnelingDirectives       = regexp.MustCompile(`^tunneling-*`)
+	ThreatIntelDirectives     = regexp.MustCompile(`^threat-intel-*`)
 )
 
+// handleRdataFieldsDirectives writes the structured rdata value of the first record, in the answer then
+// authority sections, with the key provided in the directive (rdata-fields:serial)
+func (dm *DNSMessage) handleRdataFieldsDirectives(directive string, s *strings.Builder) error {
+	i := strings.IndexByte(directive, ':')
+	if i == -1 {
+		return errors.New(ErrorUnexpectedDirective + directive)
+	}
+	key := directive[i+1:]
+
+	records := append(append([]DNSAnswer{}, dm.DNS.DNSRRs.Answers...), dm.DNS.DNSRRs.Nameservers...)
+	for _, rr := range records {
+		if rr.RdataFields == nil {
+			continue
+		}
+		if value, ok := (*rr.RdataFields)[key]; ok {
+			switch v := value.(type) {
+			case []string:
+				s.WriteString(strings.Join(v, ","))
+			default:
+				s.WriteString(fmt.Sprint(v))
+			}
+			return nil
+		}
+	}
+	s.WriteString("-")
+	return nil
+}
+
 func (dm *DNSMessage) handleOpenTelemetryDirectives(directive string, s *strings.Builder) error {
 	if dm.OpenTelemetry == nil {
 		s.WriteString("-")
@@ -327,6 +361,163 @@ func (dm *DNSMessage) handleReducerDirectives(directive string, s *strings.Build
 	return nil
 }
 
+func (dm *DNSMessage) handleAnswerChainDirectives(directive string, s *strings.Builder) error {
+	if dm.AnswerChain == nil {
+		s.WriteString("-")
+	} else {
+		switch {
+		case directive == "answer-chain-length":
+			s.WriteString(strconv.Itoa(dm.AnswerChain.CnameChainLength))
+		case directive == "answer-chain-final-target":
+			s.WriteString(dm.AnswerChain.FinalTarget)
+		case directive == "answer-chain-broken":
+			if dm.AnswerChain.BrokenChain {
+				s.WriteString("BROKEN")
+			} else {
+				s.WriteString("-")
+			}
+		case directive == "answer-chain-signed":
+			if dm.AnswerChain.Signed {
+				s.WriteString("signed")
+			} else {
+				s.WriteString("unsigned")
+			}
+		case directive == "answer-chain-referral":
+			if dm.AnswerChain.Referral {
+				s.WriteString("REFERRAL")
+			} else {
+				s.WriteString("-")
+			}
+		case directive == "answer-chain-negative":
+			s.WriteString(dm.AnswerChain.NegativeAnswer)
+		case directive == "answer-chain-min-ttl":
+			s.WriteString(strconv.Itoa(dm.AnswerChain.MinTTL))
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleTransactionDirectives(directive string, s *strings.Builder) error {
+	if dm.Transaction == nil {
+		s.WriteString("-")
+	} else {
+		switch {
+		case directive == "transaction-query-time":
+			s.WriteString(dm.Transaction.QueryTime)
+		case directive == "transaction-reply-time":
+			s.WriteString(dm.Transaction.ReplyTime)
+		case directive == "transaction-query-length":
+			s.WriteString(strconv.Itoa(dm.Transaction.QueryLength))
+		case directive == "transaction-query-flags":
+			flags := []string{}
+			for _, flag := range []struct {
+				name string
+				set  bool
+			}{{"RD", dm.Transaction.QueryFlags.RD}, {"CD", dm.Transaction.QueryFlags.CD}, {"AD", dm.Transaction.QueryFlags.AD}} {
+				if flag.set {
+					flags = append(flags, flag.name)
+				}
+			}
+			if len(flags) > 0 {
+				s.WriteString(strings.Join(flags, ","))
+			} else {
+				s.WriteString("-")
+			}
+		case directive == "transaction-answered":
+			if dm.Transaction.Answered {
+				s.WriteString("answered")
+			} else {
+				s.WriteString("unanswered")
+			}
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleClientStatsDirectives(directive string, s *strings.Builder) error {
+	if dm.ClientStats == nil {
+		s.WriteString("-")
+	} else {
+		switch {
+		case directive == "client-stats-queries":
+			s.WriteString(strconv.Itoa(dm.ClientStats.Queries))
+		case directive == "client-stats-qps":
+			s.WriteString(strconv.FormatFloat(dm.ClientStats.QueriesPerSecond, 'f', -1, 64))
+		case directive == "client-stats-distinct-qnames":
+			s.WriteString(strconv.Itoa(dm.ClientStats.DistinctQnames))
+		case directive == "client-stats-distinct-etld+1":
+			s.WriteString(strconv.Itoa(dm.ClientStats.DistinctETLDPlusOne))
+		case directive == "client-stats-nxdomain-ratio":
+			s.WriteString(strconv.FormatFloat(dm.ClientStats.NXDomainRatio, 'f', -1, 64))
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleTunnelingDirectives(directive string, s *strings.Builder) error {
+	if dm.Tunneling == nil {
+		s.WriteString("-")
+	} else {
+		switch {
+		case directive == "tunneling-score":
+			s.WriteString(strconv.Itoa(int(dm.Tunneling.Score)))
+		case directive == "tunneling-reasons":
+			if len(dm.Tunneling.Reasons) > 0 {
+				s.WriteString(strings.Join(dm.Tunneling.Reasons, ","))
+			} else {
+				s.WriteString("-")
+			}
+		case directive == "tunneling-domain":
+			s.WriteString(dm.Tunneling.Domain)
+		case directive == "tunneling-unique-bytes":
+			s.WriteString(strconv.Itoa(dm.Tunneling.UniqueBytes))
+		case directive == "tunneling-entropy":
+			s.WriteString(strconv.FormatFloat(dm.Tunneling.Entropy, 'f', -1, 64))
+		default:
+			return errors.New(ErrorUnexpectedDirective + directive)
+		}
+	}
+	return nil
+}
+
+func (dm *DNSMessage) handleThreatIntelDirectives(directive string, s *strings.Builder) error {
+	if dm.ThreatIntel == nil || len(dm.ThreatIntel.Matches) == 0 {
+		s.WriteString("-")
+		return nil
+	}
+	values := []string{}
+	switch {
+	case directive == "threat-intel-feeds":
+		for _, match := range dm.ThreatIntel.Matches {
+			values = append(values, match.Feed)
+		}
+	case directive == "threat-intel-indicators":
+		for _, match := range dm.ThreatIntel.Matches {
+			values = append(values, match.Indicator)
+		}
+	case directive == "threat-intel-severity":
+		// highest severity of the matches
+		levels := map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+		severity := dm.ThreatIntel.Matches[0].Severity
+		for _, match := range dm.ThreatIntel.Matches[1:] {
+			if levels[match.Severity] > levels[severity] {
+				severity = match.Severity
+			}
+		}
+		values = append(values, severity)
+	default:
+		return errors.New(ErrorUnexpectedDirective + directive)
+	}
+	s.WriteString(strings.Join(values, ","))
+	return nil
+}
+
 func (dm *DNSMessage) handleMachineLearningDirectives(directive string, s *strings.Builder) error {
 	if dm.MachineLearning == nil {
 		s.WriteString("-")
@@ -461,6 +652,8 @@ func (dm *DNSMessage) ToTextLine(format []string, fieldDelimiter string, fieldBo
 			s.WriteString(dm.NetworkInfo.ResponseIP)
 		case directive == "responseport":
 			s.WriteString(dm.NetworkInfo.ResponsePort)
+		case directive == "port-label":
+			s.WriteString(dm.NetworkInfo.PortLabel)
 		case directive == "family":
 			s.WriteString(dm.NetworkInfo.Family)
 		case directive == "protocol":
@@ -481,6 +674,12 @@ func (dm *DNSMessage) ToTextLine(format []string, fieldDelimiter string, fieldBo
 			} else {
 				s.WriteByte('-')
 			}
+		case directive == "anomalies":
+			if len(dm.DNS.Anomalies) > 0 {
+				s.WriteString(strings.Join(dm.DNS.Anomalies, ","))
+			} else {
+				s.WriteByte('-')
+			}
 		case directive == "qr":
 			s.WriteString(dm.DNS.Type)
 		case directive == "opcode":
@@ -616,6 +815,36 @@ func (dm *DNSMessage) ToTextLine(format []string, fieldDelimiter string, fieldBo
 			if err != nil {
 				return nil, err
 			}
+		case RdataFieldsDirectives.MatchString(directive):
+			err := dm.handleRdataFieldsDirectives(directive, &s)
+			if err != nil {
+				return nil, err
+			}
+		case AnswerChainDirectives.MatchString(directive):
+			err := dm.handleAnswerChainDirectives(directive, &s)
+			if err != nil {
+				return nil, err
+			}
+		case TransactionDirectives.MatchString(directive):
+			err := dm.handleTransactionDirectives(directive, &s)
+			if err != nil {
+				return nil, err
+			}
+		case ClientStatsDirectives.MatchString(directive):
+			err := dm.handleClientStatsDirectives(directive, &s)
+			if err != nil {
+				return nil, err
+			}
+		case TunnelingDirectives.MatchString(directive):
+			err := dm.handleTunnelingDirectives(directive, &s)
+			if err != nil {
+				return nil, err
+			}
+		case ThreatIntelDirectives.MatchString(directive):
+			err := dm.handleThreatIntelDirectives(directive, &s)
+			if err != nil {
+				return nil, err
+			}
 		case RawTextDirective.MatchString(directive):
 			directive = strings.ReplaceAll(directive, "{", "")
 			directive = strings.ReplaceAll(directive, "}", "")
@@ -187,6 +187,41 @@ func TestDnsMessage_TextFormat_DefaultDirectives(t *testing.T) {
 			dm:       DNSMessage{DNS: DNS{MalformedPacket: true}},
 			expected: "PKTERR",
 		},
+		{
+			format:   "answer-chain-length answer-chain-final-target answer-chain-broken answer-chain-signed answer-chain-referral answer-chain-negative answer-chain-min-ttl",
+			dm:       DNSMessage{AnswerChain: &TransformAnswerChain{CnameChainLength: 1, FinalTarget: "cdn.example.net", BrokenChain: true, NegativeAnswer: "NODATA", MinTTL: 300}},
+			expected: "1 cdn.example.net BROKEN unsigned - NODATA 300",
+		},
+		{
+			format:   "transaction-query-time transaction-reply-time transaction-query-length transaction-query-flags transaction-answered",
+			dm:       DNSMessage{Transaction: &TransformTransaction{QueryTime: "-", ReplyTime: "2024-01-05T20:34:01.227961611Z", QueryFlags: DNSFlags{RD: true, CD: true}, QueryLength: 42, Answered: true}},
+			expected: "- 2024-01-05T20:34:01.227961611Z 42 RD,CD answered",
+		},
+		{
+			format:   "client-stats-queries client-stats-qps client-stats-distinct-qnames client-stats-distinct-etld+1 client-stats-nxdomain-ratio",
+			dm:       DNSMessage{ClientStats: &TransformClientStats{Queries: 12, QueriesPerSecond: 0.2, DistinctQnames: 12, DistinctETLDPlusOne: 3, NXDomainRatio: 0.25}},
+			expected: "12 0.2 12 3 0.25",
+		},
+		{
+			format:   "tunneling-score tunneling-reasons tunneling-domain tunneling-unique-bytes tunneling-entropy",
+			dm:       DNSMessage{Tunneling: &TransformTunneling{Score: 2, Reasons: []string{"unique-bytes", "high-entropy"}, Domain: "example.com", UniqueBytes: 5000, Entropy: 4.5}},
+			expected: "2 unique-bytes,high-entropy example.com 5000 4.5",
+		},
+		{
+			format:   "threat-intel-feeds threat-intel-indicators threat-intel-severity",
+			dm:       DNSMessage{ThreatIntel: &TransformThreatIntel{Matches: []ThreatIntelMatch{{Feed: "blocklist", Indicator: "example.com", Severity: "medium", Field: "qname"}, {Feed: "c2", Indicator: "192.0.2.1", Severity: "high", Field: "answer-ip"}}}},
+			expected: "blocklist,c2 example.com,192.0.2.1 high",
+		},
+		{
+			format:   "threat-intel-feeds threat-intel-severity",
+			dm:       DNSMessage{ThreatIntel: &TransformThreatIntel{Matches: []ThreatIntelMatch{}}},
+			expected: "- -",
+		},
+		{
+			format:   "anomalies",
+			dm:       DNSMessage{DNS: DNS{Anomalies: []string{AnomalyNonZeroZ, AnomalyPointerLoop}}},
+			expected: "non-zero-z,pointer-loop",
+		},
 		{
 			format:   "tc aa ra ad",
 			dm:       DNSMessage{DNS: DNS{Flags: DNSFlags{TC: true, AA: true, RA: true, AD: true}}},
@@ -395,6 +430,46 @@ func TestDnsMessage_TextFormat_Directives_Geo(t *testing.T) {
 	}
 }
 
+func TestDnsMessage_TextFormat_Directives_RdataFields(t *testing.T) {
+	config := pkgconfig.GetDefaultConfig()
+
+	testcases := []struct {
+		name     string
+		format   string
+		dm       DNSMessage
+		expected string
+	}{
+		{
+			name:     "undefined",
+			format:   "rdata-fields:serial",
+			dm:       DNSMessage{},
+			expected: "-",
+		},
+		{
+			name:   "default",
+			format: "rdata-fields:serial rdata-fields:types rdata-fields:unknown",
+			dm: DNSMessage{DNS: DNS{DNSRRs: DNSRRs{
+				Answers:     []DNSAnswer{{Rdatatype: "NSEC", RdataFields: &RdataFields{"types": []string{"A", "RRSIG"}}}},
+				Nameservers: []DNSAnswer{{Rdatatype: "SOA", RdataFields: &RdataFields{"serial": 2024101501}}},
+			}}},
+			expected: "2024101501 A,RRSIG -",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			line := tc.dm.String(
+				strings.Fields(tc.format),
+				config.Global.TextFormatDelimiter,
+				config.Global.TextFormatBoundary,
+			)
+			if line != tc.expected {
+				t.Errorf("Want: %s, got: %s", tc.expected, line)
+			}
+		})
+	}
+}
+
 func TestDnsMessage_TextFormat_Directives_OpenTelemetry(t *testing.T) {
 	config := pkgconfig.GetDefaultConfig()
 
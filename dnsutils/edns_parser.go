@@ -2,9 +2,12 @@ package dnsutils
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 )
@@ -14,10 +17,12 @@ var ErrDecodeEdnsDataTooShort = errors.New("edns, not enough data to decode rdat
 var ErrDecodeEdnsOptionTooShort = errors.New("edns, not enough data to decode option answer")
 var ErrDecodeEdnsOptionCsubnetBadFamily = errors.New("edns, csubnet option bad family")
 var ErrDecodeEdnsTooManyOpts = errors.New("edns, packet contained too many OPT RRs")
+var ErrDecodeEdnsOptionInvalid = errors.New("edns, invalid option data")
 
 var (
 	OptCodes = map[int]string{
-		3: "NSID", 8: "CSUBNET", 9: "EXPIRE", 10: "COOKIE", 11: "KEEPALIVE", 12: "PADDING", 15: "ERRORS",
+		3: "NSID", 5: "DAU", 6: "DHU", 7: "N3U", 8: "CSUBNET", 9: "EXPIRE", 10: "COOKIE", 11: "KEEPALIVE", 12: "PADDING",
+		13: "CHAIN", 14: "KEY-TAG", 15: "ERRORS", 18: "REPORT-CHANNEL", 19: "ZONEVERSION",
 	}
 	ErrorCodeToString = map[int]string{
 		0:  "Other",
@@ -138,17 +143,10 @@ func DecodeEDNS(arcount int, startOffset int, payload []byte) (DNSExtended, int,
 					return edns, offset, ErrDecodeEdnsDataTooShort
 				}
 
-				optName := OptCodeToString(optCode)
-				optString, err := ParseOption(optName, payload[offsetNext+4:offsetNext+4+optLength])
+				o, err := DecodeOption(optCode, payload[offsetNext+4:offsetNext+4+optLength])
 				if err != nil {
 					return edns, offset, err
 				}
-				// create option
-				o := DNSOption{
-					Code: optCode,
-					Name: optName,
-					Data: optString,
-				}
 				options = append(options, o)
 
 				// compute next offset
@@ -171,6 +169,33 @@ func DecodeEDNS(arcount int, startOffset int, payload []byte) (DNSExtended, int,
 	return edns, offset, nil
 }
 
+// DecodeOption returns the option with the data in a readable format,
+// and the structured fields for the NSID and COOKIE options
+func DecodeOption(optCode int, optData []byte) (DNSOption, error) {
+	o := DNSOption{Code: optCode, Name: OptCodeToString(optCode)}
+
+	data, err := ParseOption(o.Name, optData)
+	if err != nil {
+		// only the malformed ERRORS and CSUBNET options reject the packet,
+		// the data of the other options is kept in hex
+		if o.Name == "ERRORS" || o.Name == "CSUBNET" {
+			return o, err
+		}
+		o.Data = hex.EncodeToString(optData)
+		return o, nil
+	}
+	o.Data = data
+
+	switch o.Name {
+	case "NSID":
+		o.NSID = data
+	case "COOKIE":
+		o.ClientCookie = hex.EncodeToString(optData[:8])
+		o.ServerCookie = hex.EncodeToString(optData[8:])
+	}
+	return o, nil
+}
+
 func ParseOption(optName string, optData []byte) (string, error) {
 	var ret string
 	var err error
@@ -179,6 +204,24 @@ func ParseOption(optName string, optData []byte) (string, error) {
 		ret, err = ParseErrors(optData)
 	case "CSUBNET":
 		ret, err = ParseCsubnet(optData)
+	case "NSID":
+		ret, err = ParseNsid(optData)
+	case "COOKIE":
+		ret, err = ParseCookie(optData)
+	case "PADDING":
+		ret, err = ParsePadding(optData)
+	case "KEEPALIVE":
+		ret, err = ParseKeepalive(optData)
+	case "EXPIRE":
+		ret, err = ParseExpire(optData)
+	case "CHAIN", "REPORT-CHANNEL":
+		ret, err = ParseOptionDomain(optData)
+	case "KEY-TAG":
+		ret, err = ParseKeyTag(optData)
+	case "DAU", "DHU", "N3U":
+		ret, err = ParseAlgorithms(optData)
+	case "ZONEVERSION":
+		ret, err = ParseZoneVersion(optData)
 	default:
 		ret = "-"
 		err = nil
@@ -256,3 +299,164 @@ func ParseCsubnet(d []byte) (string, error) {
 		return "-", ErrDecodeEdnsOptionCsubnetBadFamily
 	}
 }
+
+/*
+https://datatracker.ietf.org/doc/html/rfc5001
+
+The NSID is an opaque identifier of the server, sent as text by most servers,
+the non-printable characters are escaped
+*/
+func ParseNsid(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", nil
+	}
+	var str strings.Builder
+	for _, b := range d {
+		switch {
+		case b == '\\':
+			str.WriteString(`\\`)
+		case ' ' <= b && b <= '~':
+			str.WriteByte(b)
+		default:
+			str.WriteString(escapeByte(b))
+		}
+	}
+	return str.String(), nil
+}
+
+/*
+https://datatracker.ietf.org/doc/html/rfc7873
+
+Cookie EDNS0 option format
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+/                 CLIENT COOKIE (8 bytes)                       /
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+/            SERVER COOKIE (8 to 32 bytes, optional)            /
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+*/
+func ParseCookie(d []byte) (string, error) {
+	if len(d) < 8 {
+		return "", ErrDecodeEdnsOptionTooShort
+	}
+	if len(d) > 40 || (len(d) > 8 && len(d) < 16) {
+		return "", ErrDecodeEdnsOptionInvalid
+	}
+	if len(d) == 8 {
+		return hex.EncodeToString(d), nil
+	}
+	return fmt.Sprintf("%s %s", hex.EncodeToString(d[:8]), hex.EncodeToString(d[8:])), nil
+}
+
+// ParsePadding returns the number of padding bytes, RFC 7830
+func ParsePadding(d []byte) (string, error) {
+	return strconv.Itoa(len(d)), nil
+}
+
+/*
+https://datatracker.ietf.org/doc/html/rfc7828
+
+The timeout is empty in queries, and in units of 100 milliseconds in replies
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+|                           TIMEOUT                             |
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+*/
+func ParseKeepalive(d []byte) (string, error) {
+	switch len(d) {
+	case 0:
+		return "-", nil
+	case 2:
+		timeout := binary.BigEndian.Uint16(d)
+		return fmt.Sprintf("%.1fs", float64(timeout)/10), nil
+	case 1:
+		return "", ErrDecodeEdnsOptionTooShort
+	}
+	return "", ErrDecodeEdnsOptionInvalid
+}
+
+/*
+https://datatracker.ietf.org/doc/html/rfc7314
+
+The expire timer in seconds is empty in queries
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+|                            EXPIRE                             |
+|                                                               |
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+*/
+func ParseExpire(d []byte) (string, error) {
+	switch {
+	case len(d) == 0:
+		return "-", nil
+	case len(d) < 4:
+		return "", ErrDecodeEdnsOptionTooShort
+	case len(d) > 4:
+		return "", ErrDecodeEdnsOptionInvalid
+	}
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint32(d)), 10), nil
+}
+
+// ParseOptionDomain decodes the uncompressed domain name of the CHAIN option (closest trust point, RFC 7901)
+// and of the REPORT-CHANNEL option (agent domain, RFC 9567)
+func ParseOptionDomain(d []byte) (string, error) {
+	name, _, err := ParseLabels(0, d)
+	if err != nil {
+		return "", err
+	}
+	return nameToPresentation(name), nil
+}
+
+// ParseKeyTag returns the list of the key tags, RFC 8145
+func ParseKeyTag(d []byte) (string, error) {
+	if len(d) == 0 || len(d)%2 != 0 {
+		return "", ErrDecodeEdnsOptionTooShort
+	}
+	var tags []string
+	for i := 0; i < len(d); i += 2 {
+		tags = append(tags, strconv.Itoa(int(binary.BigEndian.Uint16(d[i:i+2]))))
+	}
+	return strings.Join(tags, " "), nil
+}
+
+// ParseAlgorithms returns the list of the DNSSEC algorithms understood by the client,
+// for the DAU, DHU and N3U options, RFC 6975
+func ParseAlgorithms(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", nil
+	}
+	var algs []string
+	for _, alg := range d {
+		algs = append(algs, strconv.Itoa(int(alg)))
+	}
+	return strings.Join(algs, " "), nil
+}
+
+/*
+https://datatracker.ietf.org/doc/html/rfc9660
+
+The option is empty in queries
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+|      LABELCOUNT               |            TYPE               |
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+|                           VERSION                             |
+/                                                               /
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+*/
+func ParseZoneVersion(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", nil
+	}
+	if len(d) < 2 {
+		return "", ErrDecodeEdnsOptionTooShort
+	}
+	labelCount := d[0]
+	versionType := d[1]
+	version := d[2:]
+
+	// the type 0 is the serial of the SOA
+	if versionType == 0 {
+		if len(version) != 4 {
+			return "", ErrDecodeEdnsOptionInvalid
+		}
+		return fmt.Sprintf("%d SOA-SERIAL %d", labelCount, binary.BigEndian.Uint32(version)), nil
+	}
+	return fmt.Sprintf("%d %d %s", labelCount, versionType, hex.EncodeToString(version)), nil
+}
@@ -0,0 +1,126 @@
+package dnsutils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDecodeEdns_Options(t *testing.T) {
+	dm := new(dns.Msg)
+	dm.SetQuestion(TestQName, dns.TypeA)
+	dm.SetEdns0(1232, true)
+	opt := dm.IsEdns0()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "67706e732d616d73"},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "f5a5b09ac0e0cb3d0100000067114ec7a1e0d44b5c6e4fe0"},
+		&dns.EDNS0_PADDING{Padding: make([]byte, 64)},
+		&dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE, Timeout: 125},
+		&dns.EDNS0_EXPIRE{Code: dns.EDNS0EXPIRE, Expire: 604800},
+		&dns.EDNS0_DAU{Code: dns.EDNS0DAU, AlgCode: []uint8{8, 13, 15}},
+		&dns.EDNS0_LOCAL{Code: 13, Data: []byte{0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00}},
+		&dns.EDNS0_LOCAL{Code: 14, Data: []byte{0x4f, 0x66, 0x30, 0x39}},
+		&dns.EDNS0_LOCAL{Code: 18, Data: []byte{0x05, 'a', 'g', 'e', 'n', 't', 0x00}},
+		&dns.EDNS0_LOCAL{Code: 19, Data: []byte{0x02, 0x00, 0x78, 0x83, 0x6a, 0xe5}},
+	)
+	payload, _ := dm.Pack()
+
+	_, _, _, offset, err := DecodeQuestion(1, payload)
+	if err != nil {
+		t.Fatalf("unexpected error while decoding question: %v", err)
+	}
+	edns, _, err := DecodeEDNS(1, offset, payload)
+	if err != nil {
+		t.Fatalf("unexpected error while decoding edns: %v", err)
+	}
+
+	expected := []DNSOption{
+		{Code: 3, Name: "NSID", Data: "gpns-ams", NSID: "gpns-ams"},
+		{Code: 10, Name: "COOKIE", Data: "f5a5b09ac0e0cb3d 0100000067114ec7a1e0d44b5c6e4fe0",
+			ClientCookie: "f5a5b09ac0e0cb3d", ServerCookie: "0100000067114ec7a1e0d44b5c6e4fe0"},
+		{Code: 12, Name: "PADDING", Data: "64"},
+		{Code: 11, Name: "KEEPALIVE", Data: "12.5s"},
+		{Code: 9, Name: "EXPIRE", Data: "604800"},
+		{Code: 5, Name: "DAU", Data: "8 13 15"},
+		{Code: 13, Name: "CHAIN", Data: "example.com"},
+		{Code: 14, Name: "KEY-TAG", Data: "20326 12345"},
+		{Code: 18, Name: "REPORT-CHANNEL", Data: "agent"},
+		{Code: 19, Name: "ZONEVERSION", Data: "2 SOA-SERIAL 2021878501"},
+	}
+	if len(edns.Options) != len(expected) {
+		t.Fatalf("expected %d edns options, got %d", len(expected), len(edns.Options))
+	}
+	for i := range expected {
+		if edns.Options[i] != expected[i] {
+			t.Errorf("bad edns option, expected %v, got %v", expected[i], edns.Options[i])
+		}
+	}
+}
+
+func TestDecodeEdns_OptionsQuery(t *testing.T) {
+	// the options are empty in the queries
+	vectors := map[string]string{
+		"NSID": "-", "KEEPALIVE": "-", "EXPIRE": "-", "ZONEVERSION": "-", "PADDING": "0", "N3U": "-",
+	}
+	for name, want := range vectors {
+		data, err := ParseOption(name, []byte{})
+		if err != nil {
+			t.Errorf("unexpected error for option %s: %v", name, err)
+		}
+		if data != want {
+			t.Errorf("invalid data for option %s, want %s, got %s", name, want, data)
+		}
+	}
+
+	o, err := DecodeOption(10, []byte{0xf5, 0xa5, 0xb0, 0x9a, 0xc0, 0xe0, 0xcb, 0x3d})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.Data != "f5a5b09ac0e0cb3d" || o.ClientCookie != "f5a5b09ac0e0cb3d" || o.ServerCookie != "" {
+		t.Errorf("invalid client cookie: %v", o)
+	}
+}
+
+func TestDecodeEdns_OptionsInvalid(t *testing.T) {
+	vectors := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"COOKIE", []byte{0x01, 0x02, 0x03}, ErrDecodeEdnsOptionTooShort},
+		{"COOKIE", make([]byte, 12), ErrDecodeEdnsOptionInvalid},
+		{"COOKIE", make([]byte, 41), ErrDecodeEdnsOptionInvalid},
+		{"KEEPALIVE", []byte{0x01}, ErrDecodeEdnsOptionTooShort},
+		{"KEEPALIVE", []byte{0x01, 0x02, 0x03}, ErrDecodeEdnsOptionInvalid},
+		{"EXPIRE", []byte{0x01, 0x02}, ErrDecodeEdnsOptionTooShort},
+		{"EXPIRE", make([]byte, 5), ErrDecodeEdnsOptionInvalid},
+		{"CHAIN", []byte{0x07, 'e', 'x'}, ErrDecodeDNSLabelTooShort},
+		{"KEY-TAG", []byte{0x4f, 0x66, 0x30}, ErrDecodeEdnsOptionTooShort},
+		{"ZONEVERSION", []byte{0x02}, ErrDecodeEdnsOptionTooShort},
+		{"ZONEVERSION", []byte{0x02, 0x00, 0x78}, ErrDecodeEdnsOptionInvalid},
+	}
+	for _, vector := range vectors {
+		_, err := ParseOption(vector.name, vector.data)
+		if !errors.Is(err, vector.err) {
+			t.Errorf("option %s %v, bad error returned: %v", vector.name, vector.data, err)
+		}
+	}
+}
+
+func TestDecodeEdns_OptionInvalidKeptInHex(t *testing.T) {
+	o, err := DecodeOption(10, []byte{0xaa, 0xaa})
+	if err != nil {
+		t.Fatalf("the packet must not be rejected: %v", err)
+	}
+	if o.Data != "aaaa" || o.ClientCookie != "" {
+		t.Errorf("invalid option: %v", o)
+	}
+}
+
+func TestDecodeEdns_OptionNsidEscaped(t *testing.T) {
+	data, _ := ParseNsid([]byte{'n', 's', 0x01, '\\'})
+	if data != `ns\001\\` {
+		t.Errorf("invalid nsid: %s", data)
+	}
+}
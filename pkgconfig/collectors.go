@@ -18,6 +18,7 @@ type ConfigCollectors struct {
 	Tail struct {
 		Enable            bool   `yaml:"enable" default:"false"`
 		TimeLayout        string `yaml:"time-layout" default:""`
+		Parser            string `yaml:"parser" default:""`
 		PatternQuery      string `yaml:"pattern-query" default:""`
 		PatternReply      string `yaml:"pattern-reply" default:""`
 		FilePath          string `yaml:"file-path" default:""`
@@ -27,6 +28,7 @@ type ConfigCollectors struct {
 		Enable            bool   `yaml:"enable" default:"false"`
 		ListenIP          string `yaml:"listen-ip" default:"0.0.0.0"`
 		ListenPort        int    `yaml:"listen-port" default:"6000"`
+		Transport         string `yaml:"transport" default:"tcp"`
 		SockPath          string `yaml:"sock-path" default:""`
 		TLSSupport        bool   `yaml:"tls-support" default:"false"`
 		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
@@ -35,6 +37,7 @@ type ConfigCollectors struct {
 		RcvBufSize        int    `yaml:"sock-rcvbuf" default:"0"`
 		ResetConn         bool   `yaml:"reset-conn" default:"true"`
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+		RdataFields       bool   `yaml:"rdata-fields" default:"false"`
 		DisableDNSParser  bool   `yaml:"disable-dnsparser" default:"false"`
 		ExtendedSupport   bool   `yaml:"extended-support" default:"false"`
 		Compression       string `yaml:"compression" default:"none"`
@@ -51,19 +54,27 @@ type ConfigCollectors struct {
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"dnstap-relay"`
 	AfpacketLiveCapture struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		Port              int    `yaml:"port" default:"53"`
-		Device            string `yaml:"device" default:""`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
-		FragmentSupport   bool   `yaml:"enable-defrag-ip" default:"true"`
-		GreSupport        bool   `yaml:"enable-gre" default:"false"`
-		RawIPSupport      bool   `yaml:"enable-rawip" default:"false"`
+		Enable            bool           `yaml:"enable" default:"false"`
+		Port              int            `yaml:"port" default:"53"`
+		Ports             []int          `yaml:"ports" default:"[]"`
+		PortLabels        map[int]string `yaml:"port-labels"`
+		BpfFilter         string         `yaml:"bpf-filter" default:""`
+		Device            string         `yaml:"device" default:""`
+		ChannelBufferSize int            `yaml:"chan-buffer-size" default:"0"`
+		RdataFields       bool           `yaml:"rdata-fields" default:"false"`
+		FragmentSupport   bool           `yaml:"enable-defrag-ip" default:"true"`
+		GreSupport        bool           `yaml:"enable-gre" default:"false"`
+		RawIPSupport      bool           `yaml:"enable-rawip" default:"false"`
+		TLSKeyLogFile     string         `yaml:"tls-keylog-file" default:""`
+		DoTPort           int            `yaml:"dot-port" default:"853"`
+		DoHPort           int            `yaml:"doh-port" default:"443"`
 	} `yaml:"afpacket-sniffer"`
 	XdpLiveCapture struct {
 		Enable            bool   `yaml:"enable" default:"false"`
 		Port              int    `yaml:"port" default:"53"`
 		Device            string `yaml:"device" default:""`
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+		RdataFields       bool   `yaml:"rdata-fields" default:"false"`
 	} `yaml:"xdp-sniffer"`
 	PowerDNS struct {
 		Enable            bool   `yaml:"enable" default:"false"`
@@ -79,19 +90,93 @@ type ConfigCollectors struct {
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"powerdns"`
 	FileIngestor struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		WatchDir          string `yaml:"watch-dir" default:""`
-		WatchMode         string `yaml:"watch-mode" default:"pcap"`
-		PcapDNSPort       int    `yaml:"pcap-dns-port" default:"53"`
-		DeleteAfter       bool   `yaml:"delete-after" default:"false"`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+		Enable            bool           `yaml:"enable" default:"false"`
+		WatchDir          string         `yaml:"watch-dir" default:""`
+		WatchMode         string         `yaml:"watch-mode" default:"pcap"`
+		PcapDNSPort       int            `yaml:"pcap-dns-port" default:"53"`
+		PcapDNSPorts      []int          `yaml:"pcap-dns-ports" default:"[]"`
+		PcapPortLabels    map[int]string `yaml:"pcap-port-labels"`
+		PcapBpfFilter     string         `yaml:"pcap-bpf-filter" default:""`
+		DeleteAfter       bool           `yaml:"delete-after" default:"false"`
+		ChannelBufferSize int            `yaml:"chan-buffer-size" default:"0"`
+		RdataFields       bool           `yaml:"rdata-fields" default:"false"`
 	} `yaml:"file-ingestor"`
 	Tzsp struct {
 		Enable            bool   `yaml:"enable" default:"false"`
 		ListenIP          string `yaml:"listen-ip" default:"0.0.0.0"`
 		ListenPort        int    `yaml:"listen-port" default:"10000"`
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+		RdataFields       bool   `yaml:"rdata-fields" default:"false"`
 	} `yaml:"tzsp"`
+	DNSProxy struct {
+		Enable              bool   `yaml:"enable" default:"false"`
+		ListenIP            string `yaml:"listen-ip" default:"0.0.0.0"`
+		ListenPort          int    `yaml:"listen-port" default:"53"`
+		TLSSupport          bool   `yaml:"tls-support" default:"false"`
+		TLSListenPort       int    `yaml:"tls-listen-port" default:"853"`
+		TLSMinVersion       string `yaml:"tls-min-version" default:"1.2"`
+		CertFile            string `yaml:"cert-file" default:""`
+		KeyFile             string `yaml:"key-file" default:""`
+		UpstreamAddress     string `yaml:"upstream-address" default:"127.0.0.1"`
+		UpstreamPort        int    `yaml:"upstream-port" default:"53"`
+		UpstreamTransport   string `yaml:"upstream-transport" default:"udp"`
+		UpstreamTimeout     int    `yaml:"upstream-timeout" default:"2"`
+		UpstreamTLSInsecure bool   `yaml:"upstream-tls-insecure" default:"false"`
+		UpstreamCAFile      string `yaml:"upstream-ca-file" default:""`
+		ResetConn           bool   `yaml:"reset-conn" default:"true"`
+		ChannelBufferSize   int    `yaml:"chan-buffer-size" default:"0"`
+		RdataFields         bool   `yaml:"rdata-fields" default:"false"`
+	} `yaml:"dnsproxy"`
+	KafkaConsumer struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int    `yaml:"remote-port" default:"9092"`
+		RetryInterval     int    `yaml:"retry-interval" default:"10"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string `yaml:"ca-file" default:""`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		SaslSupport       bool   `yaml:"sasl-support" default:"false"`
+		SaslUsername      string `yaml:"sasl-username" default:""`
+		SaslPassword      string `yaml:"sasl-password" default:""`
+		SaslMechanism     string `yaml:"sasl-mechanism" default:"PLAIN"`
+		Mode              string `yaml:"mode" default:"flat-json"`
+		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
+		Topic             string `yaml:"topic" default:"dnscollector"`
+		GroupID           string `yaml:"group-id" default:"dnscollector"`
+		StartOffset       string `yaml:"start-offset" default:"last"`
+		CommitInterval    int    `yaml:"commit-interval" default:"1"`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"kafkaconsumer"`
+	JSONIngestor struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		Mode              string `yaml:"mode" default:"json"`
+		Transport         string `yaml:"transport" default:"tail"`
+		FilePath          string `yaml:"file-path" default:""`
+		ListenIP          string `yaml:"listen-ip" default:"0.0.0.0"`
+		ListenPort        int    `yaml:"listen-port" default:"6002"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"json-ingestor"`
+	Webhook struct {
+		Enable            bool   `yaml:"enable" default:"false"`
+		ListenIP          string `yaml:"listen-ip" default:"0.0.0.0"`
+		ListenPort        int    `yaml:"listen-port" default:"8090"`
+		BasicAuthEnable   bool   `yaml:"basic-auth-enable" default:"false"`
+		BasicAuthLogin    string `yaml:"basic-auth-login" default:"admin"`
+		BasicAuthPwd      string `yaml:"basic-auth-pwd" default:"changeme"`
+		TLSSupport        bool   `yaml:"tls-support" default:"false"`
+		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
+		CertFile          string `yaml:"cert-file" default:""`
+		KeyFile           string `yaml:"key-file" default:""`
+		MaxBodySize       int    `yaml:"max-body-size" default:"10485760"`
+		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+	} `yaml:"webhook"`
 }
 
 func (c *ConfigCollectors) SetDefault() {
@@ -130,6 +130,32 @@ pipelines:
   - name: console
     stdout:
       mode: text
+`,
+			wantErr: false,
+		},
+		{
+			name: "Valid pipeline configuration with conditional routes",
+			content: `
+pipelines:
+  - name: dnsdist-main
+    dnstap:
+      listen-ip: 0.0.0.0
+      listen-port: 6000
+    routing-policy:
+      forward: [ console ]
+      conditional:
+        - matching:
+            include:
+              dns.rcode: "NXDOMAIN"
+          forward: [ nxdomain ]
+
+  - name: console
+    stdout:
+      mode: text
+
+  - name: nxdomain
+    stdout:
+      mode: json
 `,
 			wantErr: false,
 		},
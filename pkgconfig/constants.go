@@ -24,6 +24,7 @@ const (
 	ModeFlatJSON = "flat-json"
 	ModePCAP     = "pcap"
 	ModeDNSTap   = "dnstap"
+	ModeParquet  = "parquet"
 
 	SASLMechanismPlain = "PLAIN"
 	SASLMechanismScram = "SCRAM-SHA-512"
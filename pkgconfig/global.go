@@ -20,6 +20,7 @@ type ConfigGlobal struct {
 	} `yaml:"trace"`
 	ServerIdentity string `yaml:"server-identity" default:""`
 	PidFile        string `yaml:"pid-file" default:""`
+	RdataFields    bool   `yaml:"rdata-fields" default:"false"`
 	Worker         struct {
 		InternalMonitor   int `yaml:"interval-monitor" default:"10"`
 		ChannelBufferSize int `yaml:"buffer-size" default:"8192"`
@@ -37,6 +38,16 @@ type ConfigGlobal struct {
 		BasicAuthLogin  string `yaml:"basic-auth-login" default:"admin"`
 		BasicAuthPwd    string `yaml:"basic-auth-pwd" default:"changeme"`
 	} `yaml:"telemetry"`
+	Admin struct {
+		Enabled         bool   `yaml:"enabled" default:"false"`
+		WebListen       string `yaml:"web-listen" default:"127.0.0.1:9166"`
+		TLSSupport      bool   `yaml:"tls-support" default:"false"`
+		TLSCertFile     string `yaml:"tls-cert-file" default:""`
+		TLSKeyFile      string `yaml:"tls-key-file" default:""`
+		BasicAuthEnable bool   `yaml:"basic-auth-enable" default:"false"`
+		BasicAuthLogin  string `yaml:"basic-auth-login" default:"admin"`
+		BasicAuthPwd    string `yaml:"basic-auth-pwd" default:"changeme"`
+	} `yaml:"admin"`
 }
 
 func (c *ConfigGlobal) SetDefault() {
@@ -7,6 +7,15 @@ import (
 	"github.com/prometheus/prometheus/model/relabel"
 )
 
+// ConfigSpool is the on-disk buffer of the remote loggers, used during outages
+type ConfigSpool struct {
+	Enable      bool   `yaml:"enable" default:"false"`
+	Directory   string `yaml:"directory" default:""`
+	SegmentSize int    `yaml:"segment-size" default:"16777216"`
+	MaxSize     int    `yaml:"max-size" default:"1073741824"`
+	ReplayBatch int    `yaml:"replay-batch" default:"100"`
+}
+
 type ConfigLoggers struct {
 	DevNull struct {
 		Enable            bool `yaml:"enable" default:"false"`
@@ -85,49 +94,52 @@ type ConfigLoggers struct {
 		ChannelBufferSize    int    `yaml:"chan-buffer-size" default:"0"`
 		ExtendedSupport      bool   `yaml:"extended-support" default:"false"`
 		OverwriteDNSPortPcap bool   `yaml:"overwrite-dns-port-pcap" default:"false"`
+		ParquetRowGroupSize  int    `yaml:"parquet-row-group-size" default:"10000"`
 	} `yaml:"logfile"`
 	DNSTap struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
-		RemotePort        int    `yaml:"remote-port" default:"6000"`
-		Transport         string `yaml:"transport" default:"tcp"`
-		SockPath          string `yaml:"sock-path" default:""`
-		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
-		RetryInterval     int    `yaml:"retry-interval" default:"10"`
-		FlushInterval     int    `yaml:"flush-interval" default:"30"`
-		TLSSupport        bool   `yaml:"tls-support" default:"false"`
-		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
-		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
-		CAFile            string `yaml:"ca-file" default:""`
-		CertFile          string `yaml:"cert-file" default:""`
-		KeyFile           string `yaml:"key-file" default:""`
-		ServerID          string `yaml:"server-id" default:""`
-		OverwriteIdentity bool   `yaml:"overwrite-identity" default:"false"`
-		BufferSize        int    `yaml:"buffer-size" default:"100"`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
-		ExtendedSupport   bool   `yaml:"extended-support" default:"false"`
-		Compression       string `yaml:"compression" default:"none"`
+		Enable            bool        `yaml:"enable" default:"false"`
+		RemoteAddress     string      `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int         `yaml:"remote-port" default:"6000"`
+		Transport         string      `yaml:"transport" default:"tcp"`
+		SockPath          string      `yaml:"sock-path" default:""`
+		ConnectTimeout    int         `yaml:"connect-timeout" default:"5"`
+		RetryInterval     int         `yaml:"retry-interval" default:"10"`
+		FlushInterval     int         `yaml:"flush-interval" default:"30"`
+		TLSSupport        bool        `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool        `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string      `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string      `yaml:"ca-file" default:""`
+		CertFile          string      `yaml:"cert-file" default:""`
+		KeyFile           string      `yaml:"key-file" default:""`
+		ServerID          string      `yaml:"server-id" default:""`
+		OverwriteIdentity bool        `yaml:"overwrite-identity" default:"false"`
+		BufferSize        int         `yaml:"buffer-size" default:"100"`
+		ChannelBufferSize int         `yaml:"chan-buffer-size" default:"0"`
+		ExtendedSupport   bool        `yaml:"extended-support" default:"false"`
+		Compression       string      `yaml:"compression" default:"none"`
+		Spool             ConfigSpool `yaml:"spool"`
 	} `yaml:"dnstapclient"`
 	TCPClient struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
-		RemotePort        int    `yaml:"remote-port" default:"9999"`
-		SockPath          string `yaml:"sock-path" default:""` // deprecated
-		RetryInterval     int    `yaml:"retry-interval" default:"10"`
-		Transport         string `yaml:"transport" default:"tcp"`
-		TLSSupport        bool   `yaml:"tls-support" default:"false"` // deprecated
-		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
-		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
-		CAFile            string `yaml:"ca-file" default:""`
-		CertFile          string `yaml:"cert-file" default:""`
-		KeyFile           string `yaml:"key-file" default:""`
-		Mode              string `yaml:"mode" default:"flat-json"`
-		TextFormat        string `yaml:"text-format" default:""`
-		PayloadDelimiter  string `yaml:"delimiter" default:"\n"`
-		BufferSize        int    `yaml:"buffer-size" default:"100"`
-		FlushInterval     int    `yaml:"flush-interval" default:"30"`
-		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+		Enable            bool        `yaml:"enable" default:"false"`
+		RemoteAddress     string      `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int         `yaml:"remote-port" default:"9999"`
+		SockPath          string      `yaml:"sock-path" default:""` // deprecated
+		RetryInterval     int         `yaml:"retry-interval" default:"10"`
+		Transport         string      `yaml:"transport" default:"tcp"`
+		TLSSupport        bool        `yaml:"tls-support" default:"false"` // deprecated
+		TLSInsecure       bool        `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string      `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string      `yaml:"ca-file" default:""`
+		CertFile          string      `yaml:"cert-file" default:""`
+		KeyFile           string      `yaml:"key-file" default:""`
+		Mode              string      `yaml:"mode" default:"flat-json"`
+		TextFormat        string      `yaml:"text-format" default:""`
+		PayloadDelimiter  string      `yaml:"delimiter" default:"\n"`
+		BufferSize        int         `yaml:"buffer-size" default:"100"`
+		FlushInterval     int         `yaml:"flush-interval" default:"30"`
+		ConnectTimeout    int         `yaml:"connect-timeout" default:"5"`
+		ChannelBufferSize int         `yaml:"chan-buffer-size" default:"0"`
+		Spool             ConfigSpool `yaml:"spool"`
 	} `yaml:"tcpclient"`
 	Syslog struct {
 		Enable            bool   `yaml:"enable" default:"false"`
@@ -207,6 +219,7 @@ type ConfigLoggers struct {
 		TenantID          string            `yaml:"tenant-id" default:""`
 		RelabelConfigs    []*relabel.Config `yaml:"relabel-configs" default:"[]"`
 		ChannelBufferSize int               `yaml:"chan-buffer-size" default:"0"`
+		Spool             ConfigSpool       `yaml:"spool"`
 	} `yaml:"lokiclient"`
 	Statsd struct {
 		Enable            bool   `yaml:"enable" default:"false"`
@@ -225,17 +238,18 @@ type ConfigLoggers struct {
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"statsd"`
 	ElasticSearchClient struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		Index             string `yaml:"index" default:"dnscollector"`
-		Server            string `yaml:"server" default:"http://127.0.0.1:9200/"`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
-		BulkSize          int    `yaml:"bulk-size" default:"5242880"`
-		BulkChannelSize   int    `yaml:"bulk-channel-size" default:"10"`
-		FlushInterval     int    `yaml:"flush-interval" default:"10"`
-		Compression       string `yaml:"compression" default:"none"`
-		BasicAuthEnabled  bool   `yaml:"basic-auth-enable" default:"false"`
-		BasicAuthLogin    string `yaml:"basic-auth-login" default:""`
-		BasicAuthPwd      string `yaml:"basic-auth-pwd" default:""`
+		Enable            bool        `yaml:"enable" default:"false"`
+		Index             string      `yaml:"index" default:"dnscollector"`
+		Server            string      `yaml:"server" default:"http://127.0.0.1:9200/"`
+		ChannelBufferSize int         `yaml:"chan-buffer-size" default:"0"`
+		BulkSize          int         `yaml:"bulk-size" default:"5242880"`
+		BulkChannelSize   int         `yaml:"bulk-channel-size" default:"10"`
+		FlushInterval     int         `yaml:"flush-interval" default:"10"`
+		Compression       string      `yaml:"compression" default:"none"`
+		BasicAuthEnabled  bool        `yaml:"basic-auth-enable" default:"false"`
+		BasicAuthLogin    string      `yaml:"basic-auth-login" default:""`
+		BasicAuthPwd      string      `yaml:"basic-auth-pwd" default:""`
+		Spool             ConfigSpool `yaml:"spool"`
 	} `yaml:"elasticsearch"`
 	OpenTelemetryClient struct {
 		Enable               bool   `yaml:"enable" default:"false"`
@@ -285,29 +299,30 @@ type ConfigLoggers struct {
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"redispub"`
 	KafkaProducer struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		RemoteAddress     string `yaml:"remote-address" default:"127.0.0.1"`
-		RemotePort        int    `yaml:"remote-port" default:"9092"`
-		RetryInterval     int    `yaml:"retry-interval" default:"10"`
-		TLSSupport        bool   `yaml:"tls-support" default:"false"`
-		TLSInsecure       bool   `yaml:"tls-insecure" default:"false"`
-		TLSMinVersion     string `yaml:"tls-min-version" default:"1.2"`
-		CAFile            string `yaml:"ca-file" default:""`
-		CertFile          string `yaml:"cert-file" default:""`
-		KeyFile           string `yaml:"key-file" default:""`
-		SaslSupport       bool   `yaml:"sasl-support" default:"false"`
-		SaslUsername      string `yaml:"sasl-username" default:""`
-		SaslPassword      string `yaml:"sasl-password" default:""`
-		SaslMechanism     string `yaml:"sasl-mechanism" default:"PLAIN"`
-		Mode              string `yaml:"mode" default:"flat-json"`
-		TextFormat        string `yaml:"text-format" default:""`
-		BufferSize        int    `yaml:"buffer-size" default:"100"`
-		FlushInterval     int    `yaml:"flush-interval" default:"10"`
-		ConnectTimeout    int    `yaml:"connect-timeout" default:"5"`
-		Topic             string `yaml:"topic" default:"dnscollector"`
-		Partition         *int   `yaml:"partition" default:"nil"`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
-		Compression       string `yaml:"compression" default:"none"`
+		Enable            bool        `yaml:"enable" default:"false"`
+		RemoteAddress     string      `yaml:"remote-address" default:"127.0.0.1"`
+		RemotePort        int         `yaml:"remote-port" default:"9092"`
+		RetryInterval     int         `yaml:"retry-interval" default:"10"`
+		TLSSupport        bool        `yaml:"tls-support" default:"false"`
+		TLSInsecure       bool        `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string      `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string      `yaml:"ca-file" default:""`
+		CertFile          string      `yaml:"cert-file" default:""`
+		KeyFile           string      `yaml:"key-file" default:""`
+		SaslSupport       bool        `yaml:"sasl-support" default:"false"`
+		SaslUsername      string      `yaml:"sasl-username" default:""`
+		SaslPassword      string      `yaml:"sasl-password" default:""`
+		SaslMechanism     string      `yaml:"sasl-mechanism" default:"PLAIN"`
+		Mode              string      `yaml:"mode" default:"flat-json"`
+		TextFormat        string      `yaml:"text-format" default:""`
+		BufferSize        int         `yaml:"buffer-size" default:"100"`
+		FlushInterval     int         `yaml:"flush-interval" default:"10"`
+		ConnectTimeout    int         `yaml:"connect-timeout" default:"5"`
+		Topic             string      `yaml:"topic" default:"dnscollector"`
+		Partition         *int        `yaml:"partition" default:"nil"`
+		ChannelBufferSize int         `yaml:"chan-buffer-size" default:"0"`
+		Compression       string      `yaml:"compression" default:"none"`
+		Spool             ConfigSpool `yaml:"spool"`
 	} `yaml:"kafkaproducer"`
 	FalcoClient struct {
 		Enable            bool   `yaml:"enable" default:"false"`
@@ -315,13 +330,26 @@ type ConfigLoggers struct {
 		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"falco"`
 	ClickhouseClient struct {
-		Enable            bool   `yaml:"enable" default:"false"`
-		URL               string `yaml:"url" default:"http://localhost:8123"`
-		User              string `yaml:"user" default:"default"`
-		Password          string `yaml:"password" default:"password"`
-		Database          string `yaml:"database" default:"dnscollector"`
-		Table             string `yaml:"table" default:"records"`
-		ChannelBufferSize int    `yaml:"chan-buffer-size" default:"0"`
+		Enable            bool              `yaml:"enable" default:"false"`
+		URL               string            `yaml:"url" default:"http://localhost:8123"`
+		User              string            `yaml:"user" default:"default"`
+		Password          string            `yaml:"password" default:"password"`
+		Database          string            `yaml:"database" default:"dnscollector"`
+		Table             string            `yaml:"table" default:"records"`
+		Columns           map[string]string `yaml:"columns"`
+		CreateTable       bool              `yaml:"create-table" default:"false"`
+		TableEngine       string            `yaml:"table-engine" default:"MergeTree ORDER BY tuple()"`
+		BatchSize         int               `yaml:"batch-size" default:"1048576"`
+		BatchChannelSize  int               `yaml:"batch-channel-size" default:"10"`
+		FlushInterval     int               `yaml:"flush-interval" default:"10"`
+		MaxRetries        int               `yaml:"max-retries" default:"10"`
+		BasicAuthEnabled  bool              `yaml:"basic-auth-enable" default:"false"`
+		TLSInsecure       bool              `yaml:"tls-insecure" default:"false"`
+		TLSMinVersion     string            `yaml:"tls-min-version" default:"1.2"`
+		CAFile            string            `yaml:"ca-file" default:""`
+		CertFile          string            `yaml:"cert-file" default:""`
+		KeyFile           string            `yaml:"key-file" default:""`
+		ChannelBufferSize int               `yaml:"chan-buffer-size" default:"0"`
 	} `yaml:"clickhouse"`
 }
 
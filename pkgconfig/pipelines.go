@@ -2,6 +2,7 @@ package pkgconfig
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/pkg/errors"
 )
@@ -61,15 +62,46 @@ func (c *ConfigPipelines) IsValid(userCfg map[string]interface{}) error {
 }
 
 type PipelinesRouting struct {
+	Forward     []string                    `yaml:"forward,flow"`
+	Dropped     []string                    `yaml:"dropped,flow"`
+	Conditional []PipelinesConditionalRoute `yaml:"conditional"`
+}
+
+// PipelinesConditionalRoute sends the dns messages matching the include/exclude
+// conditions to the targets, with the syntax of the dnsmessage collector
+type PipelinesConditionalRoute struct {
+	Matching struct {
+		Include map[string]interface{} `yaml:"include"`
+		Exclude map[string]interface{} `yaml:"exclude"`
+	} `yaml:"matching"`
 	Forward []string `yaml:"forward,flow"`
-	Dropped []string `yaml:"dropped,flow"`
 }
 
 func (c *PipelinesRouting) IsValid(userCfg map[string]interface{}) error {
-	for k := range userCfg {
-		if k != "forward" && k != "dropped" {
+	for k, v := range userCfg {
+		if k != "forward" && k != "dropped" && k != "conditional" {
 			return fmt.Errorf("invalid key '%s'", k)
 		}
+		if k != "conditional" {
+			continue
+		}
+
+		routes, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("conditional - list of routes expected, got %T", v)
+		}
+		for i, route := range routes {
+			routeCfg, ok := route.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("conditional - unexpected type for route #%d, got %T", i, route)
+			}
+			if _, ok := routeCfg["forward"]; !ok {
+				return fmt.Errorf("conditional - forward key is required for route #%d", i)
+			}
+			if err := CheckConfigWithTags(reflect.ValueOf(PipelinesConditionalRoute{}), routeCfg); err != nil {
+				return fmt.Errorf("conditional - %s for route #%d", err, i)
+			}
+		}
 	}
 	return nil
 }
@@ -38,6 +38,48 @@ func TestConfigPipelines_IsValid(t *testing.T) {
 			expectErr: true,
 			errorMsg:  "routing-policy - invalid key 'invalid'",
 		},
+		{
+			name: "Valid Conditional Routing Policy",
+			config: map[string]interface{}{
+				"name": "testPipeline",
+				"routing-policy": map[string]interface{}{
+					"forward": []string{"route1"},
+					"conditional": []interface{}{
+						map[string]interface{}{
+							"matching": map[string]interface{}{"include": map[string]interface{}{"dns.rcode": "NXDOMAIN"}},
+							"forward":  []string{"route2"},
+						},
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "Invalid Conditional Routing Policy Key",
+			config: map[string]interface{}{
+				"name": "testPipeline",
+				"routing-policy": map[string]interface{}{
+					"conditional": []interface{}{
+						map[string]interface{}{"matching": map[string]interface{}{"invalid": "value"}, "forward": []string{"route2"}},
+					},
+				},
+			},
+			expectErr: true,
+			errorMsg:  "routing-policy - conditional - unknown key=`invalid` in subkey=`matching` for route #0",
+		},
+		{
+			name: "Missing Conditional Forward",
+			config: map[string]interface{}{
+				"name": "testPipeline",
+				"routing-policy": map[string]interface{}{
+					"conditional": []interface{}{
+						map[string]interface{}{"matching": map[string]interface{}{}},
+					},
+				},
+			},
+			expectErr: true,
+			errorMsg:  "routing-policy - conditional - forward key is required for route #0",
+		},
 		{
 			name: "Invalid Transforms",
 			config: map[string]interface{}{
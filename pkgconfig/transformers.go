@@ -6,6 +6,13 @@ import (
 	"github.com/creasty/defaults"
 )
 
+type ThreatIntelFeed struct {
+	Name     string `yaml:"name"`
+	Source   string `yaml:"source"`
+	Format   string `yaml:"format"`
+	Severity string `yaml:"severity"`
+}
+
 type RelabelingConfig struct {
 	Regex       string `yaml:"regex"`
 	Replacement string `yaml:"replacement"`
@@ -36,6 +43,7 @@ type ConfigTransformers struct {
 		MeasureLatency    bool `yaml:"measure-latency" default:"false"`
 		UnansweredQueries bool `yaml:"unanswered-queries" default:"false"`
 		QueriesTimeout    int  `yaml:"queries-timeout" default:"2"`
+		Merge             bool `yaml:"merge" default:"false"`
 	} `yaml:"latency"`
 	Reducer struct {
 		Enable                    bool     `yaml:"enable" default:"false"`
@@ -53,6 +61,8 @@ type ConfigTransformers struct {
 		DropQueryIPFile string   `yaml:"drop-queryip-file" default:""`
 		KeepQueryIPFile string   `yaml:"keep-queryip-file" default:""`
 		KeepRdataFile   string   `yaml:"keep-rdata-file" default:""`
+		RPZFile         string   `yaml:"rpz-file" default:""`
+		RPZMode         string   `yaml:"rpz-mode" default:"drop"`
 		DropRcodes      []string `yaml:"drop-rcodes,flow" default:"[]"`
 		LogQueries      bool     `yaml:"log-queries" default:"true"`
 		LogReplies      bool     `yaml:"log-replies" default:"true"`
@@ -103,6 +113,30 @@ type ConfigTransformers struct {
 		WhiteDomainsFile string `yaml:"white-domains-file" default:""`
 		PersistenceFile  string `yaml:"persistence-file" default:""`
 	} `yaml:"new-domain-tracker"`
+	ClientStats struct {
+		Enable    bool `yaml:"enable" default:"false"`
+		Window    int  `yaml:"window" default:"60"`
+		CacheSize int  `yaml:"cache-size" default:"10000"`
+	} `yaml:"client-stats"`
+	Tunneling struct {
+		Enable                bool     `yaml:"enable" default:"false"`
+		Window                int      `yaml:"window" default:"300"`
+		CacheSize             int      `yaml:"cache-size" default:"10000"`
+		ThresholdUniqueBytes  int      `yaml:"threshold-unique-bytes" default:"4096"`
+		ThresholdEntropy      float64  `yaml:"threshold-entropy" default:"4.0"`
+		ThresholdTxtNullRatio float64  `yaml:"threshold-txt-null-ratio" default:"0.5"`
+		MinQueries            int      `yaml:"min-queries" default:"10"`
+		WhitelistDomains      []string `yaml:"whitelist-domains,flow" default:"[\"\\\\.arpa$\"]"`
+	} `yaml:"tunneling"`
+	ThreatIntel struct {
+		Enable         bool              `yaml:"enable" default:"false"`
+		ReloadInterval int               `yaml:"reload-interval" default:"3600"`
+		AddTags        bool              `yaml:"add-tags" default:"true"`
+		Feeds          []ThreatIntelFeed `yaml:"feeds,flow"`
+	} `yaml:"threat-intel"`
+	AnswerChain struct {
+		Enable bool `yaml:"enable" default:"false"`
+	} `yaml:"answer-chain"`
 	Reordering struct {
 		Enable        bool `yaml:"enable" default:"false"`
 		FlushInterval int  `yaml:"flush-interval" default:"30"`
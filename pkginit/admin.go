@@ -0,0 +1,313 @@
+package pkginit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/telemetry"
+	"github.com/dmachard/go-dnscollector/workers"
+	"github.com/dmachard/go-logger"
+)
+
+const (
+	AdminWorkerCollector = "collector"
+	AdminWorkerLogger    = "logger"
+)
+
+type AdminChannel struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+type AdminConditionalRoute struct {
+	Forward []string `json:"forward"`
+}
+
+type AdminRoutes struct {
+	Forward     []string                `json:"forward"`
+	Dropped     []string                `json:"dropped"`
+	Conditional []AdminConditionalRoute `json:"conditional"`
+}
+
+type AdminWorker struct {
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	Kind       string       `json:"kind"`
+	Paused     bool         `json:"paused"`
+	Transforms []string     `json:"transforms"`
+	Routes     AdminRoutes  `json:"routes"`
+	Input      AdminChannel `json:"input-channel"`
+	Stats      AdminStats   `json:"stats"`
+}
+
+type AdminStats struct {
+	Ingress   int            `json:"ingress"`
+	Egress    int            `json:"egress"`
+	Forwarded int            `json:"forwarded"`
+	Dropped   int            `json:"dropped"`
+	Discarded int            `json:"discarded"`
+	Counters  map[string]int `json:"counters,omitempty"`
+}
+
+type AdminEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Policy string `json:"policy"`
+}
+
+type AdminGraph struct {
+	Nodes []AdminWorker `json:"nodes"`
+	Edges []AdminEdge   `json:"edges"`
+}
+
+// AdminServer exposes the running pipelines, the workers maps are
+// protected by the lock because they are updated on reload
+type AdminServer struct {
+	sync.RWMutex
+	config        *pkgconfig.Config
+	logger        *logger.Logger
+	metrics       *telemetry.PrometheusCollector
+	mapLoggers    map[string]workers.Worker
+	mapCollectors map[string]workers.Worker
+	reload        chan chan error
+	errChan       chan error
+	server        *http.Server
+}
+
+func NewAdminServer(config *pkgconfig.Config, logger *logger.Logger, mapLoggers map[string]workers.Worker, mapCollectors map[string]workers.Worker,
+	metrics *telemetry.PrometheusCollector) *AdminServer {
+	s := &AdminServer{
+		config:        config,
+		logger:        logger,
+		metrics:       metrics,
+		mapLoggers:    mapLoggers,
+		mapCollectors: mapCollectors,
+		reload:        make(chan chan error),
+		errChan:       make(chan error),
+	}
+	s.server = &http.Server{
+		Addr:              config.Global.Admin.WebListen,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// OnReload returns the reload requests, the error of the reload must be sent back
+func (s *AdminServer) OnReload() chan chan error { return s.reload }
+
+func (s *AdminServer) OnError() chan error { return s.errChan }
+
+func (s *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/pipelines", s.getGraph)
+	mux.HandleFunc("GET /api/v1/workers", s.getWorkers)
+	mux.HandleFunc("GET /api/v1/workers/{name}", s.getWorker)
+	mux.HandleFunc("POST /api/v1/workers/{name}/pause", s.pauseWorker)
+	mux.HandleFunc("POST /api/v1/workers/{name}/resume", s.resumeWorker)
+	mux.HandleFunc("POST /api/v1/reload", s.reloadConfig)
+
+	if s.config.Global.Admin.BasicAuthEnable {
+		return telemetry.BasicAuthMiddleware(mux, s.config.Global.Admin.BasicAuthLogin, s.config.Global.Admin.BasicAuthPwd)
+	}
+	return mux
+}
+
+func (s *AdminServer) Start() {
+	if !s.config.Global.Admin.Enabled {
+		return
+	}
+
+	s.logger.Info("main - admin api enabled on local address: %s", s.config.Global.Admin.WebListen)
+	s.server.Handler = s.Handler()
+	go func() {
+		var err error
+		if s.config.Global.Admin.TLSSupport {
+			err = s.server.ListenAndServeTLS(s.config.Global.Admin.TLSCertFile, s.config.Global.Admin.TLSKeyFile)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errChan <- err
+		}
+	}()
+}
+
+func (s *AdminServer) Stop() error {
+	if !s.config.Global.Admin.Enabled {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *AdminServer) getWorkerInfo(name string) (AdminWorker, bool) {
+	info := AdminWorker{Name: name, Transforms: []string{}}
+
+	wrk, ok := s.mapCollectors[name]
+	info.Type = AdminWorkerCollector
+	if !ok {
+		wrk, ok = s.mapLoggers[name]
+		info.Type = AdminWorkerLogger
+	}
+	if !ok {
+		return info, false
+	}
+
+	for _, stanza := range s.config.Pipelines {
+		if stanza.Name == name {
+			info.Kind = GetStanzaKind(stanza)
+			for k := range stanza.Transforms {
+				info.Transforms = append(info.Transforms, k)
+			}
+			sort.Strings(info.Transforms)
+		}
+	}
+
+	info.Paused = wrk.IsPaused()
+	info.Input = AdminChannel{Length: len(wrk.GetInputChannel()), Capacity: cap(wrk.GetInputChannel())}
+
+	// routes
+	routing := wrk.GetRouting()
+	info.Routes.Forward = workersNames(routing.GetDefaultRoutes())
+	info.Routes.Dropped = workersNames(routing.GetDroppedRoutes())
+	info.Routes.Conditional = []AdminConditionalRoute{}
+	for _, route := range routing.GetConditionalRoutes() {
+		info.Routes.Conditional = append(info.Routes.Conditional, AdminConditionalRoute{Forward: workersNames(route.Routes)})
+	}
+
+	// stats, updated by the workers every interval-monitor seconds
+	if s.metrics != nil {
+		if ws, found := s.metrics.GetWorkerStats(name); found {
+			info.Stats = AdminStats{
+				Ingress:   ws.TotalIngress,
+				Egress:    ws.TotalEgress,
+				Forwarded: ws.TotalForwardedPolicy,
+				Dropped:   ws.TotalDroppedPolicy,
+				Discarded: ws.TotalDiscarded,
+				Counters:  ws.Counters,
+			}
+		}
+	}
+	return info, true
+}
+
+func (s *AdminServer) getWorkersInfo() []AdminWorker {
+	var names []string
+	for name := range s.mapCollectors {
+		names = append(names, name)
+	}
+	for name := range s.mapLoggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []AdminWorker{}
+	for _, name := range names {
+		if info, ok := s.getWorkerInfo(name); ok {
+			list = append(list, info)
+		}
+	}
+	return list
+}
+
+func (s *AdminServer) getGraph(w http.ResponseWriter, _ *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+
+	graph := AdminGraph{Nodes: s.getWorkersInfo(), Edges: []AdminEdge{}}
+	for _, node := range graph.Nodes {
+		for _, to := range node.Routes.Forward {
+			graph.Edges = append(graph.Edges, AdminEdge{From: node.Name, To: to, Policy: "forward"})
+		}
+		for _, route := range node.Routes.Conditional {
+			for _, to := range route.Forward {
+				graph.Edges = append(graph.Edges, AdminEdge{From: node.Name, To: to, Policy: "conditional"})
+			}
+		}
+		for _, to := range node.Routes.Dropped {
+			graph.Edges = append(graph.Edges, AdminEdge{From: node.Name, To: to, Policy: "dropped"})
+		}
+	}
+	writeJSON(w, http.StatusOK, graph)
+}
+
+func (s *AdminServer) getWorkers(w http.ResponseWriter, _ *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+	writeJSON(w, http.StatusOK, s.getWorkersInfo())
+}
+
+func (s *AdminServer) getWorker(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+
+	info, ok := s.getWorkerInfo(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "worker not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *AdminServer) pauseWorker(w http.ResponseWriter, r *http.Request) {
+	s.setPaused(w, r.PathValue("name"), true)
+}
+
+func (s *AdminServer) resumeWorker(w http.ResponseWriter, r *http.Request) {
+	s.setPaused(w, r.PathValue("name"), false)
+}
+
+func (s *AdminServer) setPaused(w http.ResponseWriter, name string, paused bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	wrk, ok := s.mapCollectors[name]
+	if !ok {
+		wrk, ok = s.mapLoggers[name]
+	}
+	if !ok {
+		http.Error(w, "worker not found", http.StatusNotFound)
+		return
+	}
+
+	if paused {
+		wrk.Pause()
+	} else {
+		wrk.Resume()
+	}
+	info, _ := s.getWorkerInfo(name)
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *AdminServer) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	reply := make(chan error, 1)
+	select {
+	case s.reload <- reply:
+	case <-r.Context().Done():
+		return
+	}
+
+	if err := <-reply; err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+func workersNames(list []workers.Worker) []string {
+	names := []string{}
+	for _, wrk := range list {
+		names = append(names, wrk.GetName())
+	}
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
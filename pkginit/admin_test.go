@@ -0,0 +1,139 @@
+package pkginit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/telemetry"
+	"github.com/dmachard/go-dnscollector/workers"
+	"github.com/dmachard/go-logger"
+)
+
+func newAdminServerForTest(t *testing.T) (*AdminServer, map[string]workers.Worker) {
+	config := pkgconfig.GetDefaultConfig()
+	config.Pipelines = []pkgconfig.ConfigPipelines{
+		{
+			Name:          "collector",
+			Params:        map[string]interface{}{"dnsmessage": map[string]interface{}{}},
+			Transforms:    map[string]interface{}{"normalize": map[string]interface{}{}, "atags": map[string]interface{}{}},
+			RoutingPolicy: pkgconfig.PipelinesRouting{Forward: []string{"console"}, Dropped: []string{"trash"}},
+		},
+		{Name: "console", Params: map[string]interface{}{"devnull": map[string]interface{}{}}},
+		{Name: "trash", Params: map[string]interface{}{"devnull": map[string]interface{}{}}},
+	}
+
+	mapLoggers := make(map[string]workers.Worker)
+	mapCollectors := make(map[string]workers.Worker)
+	metrics := telemetry.NewPrometheusCollector(config)
+	if err := InitPipelines(mapLoggers, mapCollectors, config, logger.New(false), metrics); err != nil {
+		t.Fatal(err)
+	}
+	return NewAdminServer(config, logger.New(false), mapLoggers, mapCollectors, metrics), mapCollectors
+}
+
+func TestAdmin_Graph(t *testing.T) {
+	admin, _ := newAdminServerForTest(t)
+
+	rr := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/pipelines", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rr.Code)
+	}
+
+	var graph AdminGraph
+	if err := json.Unmarshal(rr.Body.Bytes(), &graph); err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != 3 {
+		t.Errorf("3 workers expected, got %d", len(graph.Nodes))
+	}
+	wantEdges := []AdminEdge{{From: "collector", To: "console", Policy: "forward"}, {From: "collector", To: "trash", Policy: "dropped"}}
+	if len(graph.Edges) != len(wantEdges) {
+		t.Fatalf("unexpected edges: %v", graph.Edges)
+	}
+	for i, edge := range wantEdges {
+		if graph.Edges[i] != edge {
+			t.Errorf("want edge %v, got %v", edge, graph.Edges[i])
+		}
+	}
+
+	collector := graph.Nodes[0]
+	if collector.Type != AdminWorkerCollector || collector.Kind != "dnsmessage" {
+		t.Errorf("unexpected worker: %v", collector)
+	}
+	if len(collector.Transforms) != 2 || collector.Transforms[0] != "atags" {
+		t.Errorf("unexpected transforms: %v", collector.Transforms)
+	}
+	if collector.Input.Capacity != pkgconfig.GetDefaultConfig().Global.Worker.ChannelBufferSize {
+		t.Errorf("unexpected channel capacity: %d", collector.Input.Capacity)
+	}
+}
+
+func TestAdmin_PauseResume(t *testing.T) {
+	admin, mapCollectors := newAdminServerForTest(t)
+
+	rr := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/workers/collector/pause", nil))
+	if rr.Code != http.StatusOK || !mapCollectors["collector"].IsPaused() {
+		t.Errorf("the worker should be paused, status code: %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/workers/collector/resume", nil))
+	if rr.Code != http.StatusOK || mapCollectors["collector"].IsPaused() {
+		t.Errorf("the worker should be resumed, status code: %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/workers/unknown/pause", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown worker, unexpected status code: %d", rr.Code)
+	}
+}
+
+func TestAdmin_Reload(t *testing.T) {
+	admin, _ := newAdminServerForTest(t)
+
+	// simulate the main loop
+	go func() {
+		reply := <-admin.OnReload()
+		reply <- nil
+		reply = <-admin.OnReload()
+		reply <- errors.New("invalid config")
+	}()
+
+	rr := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/reload", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/reload", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("reload error expected, got status code: %d", rr.Code)
+	}
+}
+
+func TestAdmin_BasicAuth(t *testing.T) {
+	admin, _ := newAdminServerForTest(t)
+	admin.config.Global.Admin.BasicAuthEnable = true
+
+	rr := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/workers", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("unexpected status code: %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/workers", nil)
+	req.SetBasicAuth("admin", "changeme")
+	rr = httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", rr.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package pkginit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/pkg/errors"
+)
+
+const (
+	GraphFormatDOT     = "dot"
+	GraphFormatMermaid = "mermaid"
+)
+
+type graphStanza struct {
+	name, kind string
+	collector  bool
+	transforms []string
+}
+
+type graphEdge struct {
+	from, to, policy string
+}
+
+// GetPipelinesGraph validates the pipelines without starting the workers
+// and returns the graph of the stanzas in the DOT or Mermaid format
+func GetPipelinesGraph(config *pkgconfig.Config, format string) (string, error) {
+	if !IsPipelinesEnabled(config) {
+		return "", errors.Errorf("no pipelines defined")
+	}
+	if err := CheckPipelines(config); err != nil {
+		return "", err
+	}
+
+	var stanzas []graphStanza
+	var edges []graphEdge
+	for _, stanza := range config.Pipelines {
+		node := graphStanza{name: stanza.Name, kind: GetStanzaKind(stanza), transforms: []string{}}
+		switch {
+		case config.Collectors.IsExists(node.kind):
+			node.collector = true
+		case config.Loggers.IsExists(node.kind):
+		default:
+			return "", errors.Errorf("stanza=[%s] invalid collector or logger=[%s]", stanza.Name, node.kind)
+		}
+		for k := range stanza.Transforms {
+			node.transforms = append(node.transforms, k)
+		}
+		sort.Strings(node.transforms)
+		stanzas = append(stanzas, node)
+
+		for _, route := range stanza.RoutingPolicy.Forward {
+			edges = append(edges, graphEdge{from: stanza.Name, to: route, policy: "forward"})
+		}
+		for i, conditional := range stanza.RoutingPolicy.Conditional {
+			for _, route := range conditional.Forward {
+				edges = append(edges, graphEdge{from: stanza.Name, to: route, policy: fmt.Sprintf("conditional#%d", i)})
+			}
+		}
+		for _, route := range stanza.RoutingPolicy.Dropped {
+			edges = append(edges, graphEdge{from: stanza.Name, to: route, policy: "dropped"})
+		}
+	}
+
+	switch format {
+	case GraphFormatDOT:
+		return graphToDOT(stanzas, edges), nil
+	case GraphFormatMermaid:
+		return graphToMermaid(stanzas, edges), nil
+	}
+	return "", errors.Errorf("graph format=[%s] not supported, use dot or mermaid", format)
+}
+
+func graphToDOT(stanzas []graphStanza, edges []graphEdge) string {
+	quote := func(s string) string { return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\"" }
+
+	var b strings.Builder
+	b.WriteString("digraph pipelines {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, s := range stanzas {
+		label := s.name + "\\n" + s.kind
+		if len(s.transforms) > 0 {
+			label += "\\n[" + strings.Join(s.transforms, ", ") + "]"
+		}
+		shape := "ellipse"
+		if s.collector {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", quote(s.name), quote(label), shape)
+	}
+	for _, e := range edges {
+		style := "solid"
+		switch {
+		case e.policy == "dropped":
+			style = "dashed"
+		case strings.HasPrefix(e.policy, "conditional"):
+			style = "dotted"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, style=%s];\n", quote(e.from), quote(e.to), quote(e.policy), style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func graphToMermaid(stanzas []graphStanza, edges []graphEdge) string {
+	// the names of the stanzas are not always valid identifiers
+	ids := make(map[string]string)
+	for i, s := range stanzas {
+		ids[s.name] = fmt.Sprintf("s%d", i)
+	}
+	escape := func(s string) string { return strings.ReplaceAll(s, "\"", "#quot;") }
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, s := range stanzas {
+		label := escape(s.name) + "<br/>" + escape(s.kind)
+		if len(s.transforms) > 0 {
+			label += "<br/>[" + strings.Join(s.transforms, ", ") + "]"
+		}
+		if s.collector {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[s.name], label)
+		} else {
+			fmt.Fprintf(&b, "  %s([\"%s\"])\n", ids[s.name], label)
+		}
+	}
+	for _, e := range edges {
+		arrow := "-->"
+		if e.policy != "forward" {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|%s| %s\n", ids[e.from], arrow, e.policy, ids[e.to])
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package pkginit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+)
+
+func getGraphConfigForTest() *pkgconfig.Config {
+	config := pkgconfig.GetDefaultConfig()
+	config.Pipelines = []pkgconfig.ConfigPipelines{
+		{
+			Name:       "tap",
+			Params:     map[string]interface{}{"dnstap": map[string]interface{}{}},
+			Transforms: map[string]interface{}{"normalize": map[string]interface{}{}},
+			RoutingPolicy: pkgconfig.PipelinesRouting{
+				Forward:     []string{"console"},
+				Dropped:     []string{"trash"},
+				Conditional: []pkgconfig.PipelinesConditionalRoute{{Forward: []string{"trash"}}},
+			},
+		},
+		{Name: "console", Params: map[string]interface{}{"stdout": map[string]interface{}{}}},
+		{Name: "trash", Params: map[string]interface{}{"devnull": map[string]interface{}{}}},
+	}
+	return config
+}
+
+func TestGraph_DOT(t *testing.T) {
+	graph, err := GetPipelinesGraph(getGraphConfigForTest(), GraphFormatDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"digraph pipelines {",
+		`"tap" [label="tap\ndnstap\n[normalize]", shape=box];`,
+		`"console" [label="console\nstdout", shape=ellipse];`,
+		`"tap" -> "console" [label="forward", style=solid];`,
+		`"tap" -> "trash" [label="conditional#0", style=dotted];`,
+		`"tap" -> "trash" [label="dropped", style=dashed];`,
+	} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("%s expected in graph:\n%s", want, graph)
+		}
+	}
+}
+
+func TestGraph_Mermaid(t *testing.T) {
+	graph, err := GetPipelinesGraph(getGraphConfigForTest(), GraphFormatMermaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `flowchart LR
+  s0["tap<br/>dnstap<br/>[normalize]"]
+  s1(["console<br/>stdout"])
+  s2(["trash<br/>devnull"])
+  s0 -->|forward| s1
+  s0 -.->|conditional#0| s2
+  s0 -.->|dropped| s2
+`
+	if graph != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, graph)
+	}
+}
+
+func TestGraph_InvalidConfig(t *testing.T) {
+	config := getGraphConfigForTest()
+	if _, err := GetPipelinesGraph(config, "svg"); err == nil {
+		t.Errorf("unsupported format should be rejected")
+	}
+
+	config.Pipelines[0].RoutingPolicy.Forward = []string{"unknown"}
+	if _, err := GetPipelinesGraph(config, GraphFormatDOT); err == nil {
+		t.Errorf("invalid routes should be rejected")
+	}
+}
@@ -185,6 +185,18 @@ func InitMultiplexer(mapLoggers map[string]workers.Worker, mapCollectors map[str
 		if subcfg.Collectors.Tzsp.Enable && IsCollectorRouted(config, input.Name) {
 			mapCollectors[input.Name] = workers.NewTZSP(nil, subcfg, logger, input.Name)
 		}
+		if subcfg.Collectors.DNSProxy.Enable && IsCollectorRouted(config, input.Name) {
+			mapCollectors[input.Name] = workers.NewDNSProxy(nil, subcfg, logger, input.Name)
+		}
+		if subcfg.Collectors.KafkaConsumer.Enable && IsCollectorRouted(config, input.Name) {
+			mapCollectors[input.Name] = workers.NewKafkaConsumer(nil, subcfg, logger, input.Name)
+		}
+		if subcfg.Collectors.JSONIngestor.Enable && IsCollectorRouted(config, input.Name) {
+			mapCollectors[input.Name] = workers.NewJSONIngestor(nil, subcfg, logger, input.Name)
+		}
+		if subcfg.Collectors.Webhook.Enable && IsCollectorRouted(config, input.Name) {
+			mapCollectors[input.Name] = workers.NewWebhook(nil, subcfg, logger, input.Name)
+		}
 	}
 
 	// here the multiplexer logic
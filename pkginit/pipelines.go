@@ -2,6 +2,7 @@ package pkginit
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-dnscollector/telemetry"
@@ -94,34 +95,59 @@ func CreateRouting(stanza pkgconfig.ConfigPipelines, mapCollectors map[string]wo
 		currentStanza = logger
 	}
 
+	// the routes are prepared apart then replaced at once,
+	// so a running stanza is never left with partial routes
+	routing := workers.NewRouting()
+
 	// forward routing
 	for _, route := range stanza.RoutingPolicy.Forward {
 		if route == stanza.Name {
 			return fmt.Errorf("main - routing error loop with stanza=%s to stanza=%s", stanza.Name, route)
 		}
 		if _, ok := mapCollectors[route]; ok {
-			currentStanza.AddDefaultRoute(mapCollectors[route])
+			routing.AddDefaultRoute(mapCollectors[route])
 			logger.Info("main - routing (policy=forward) stanza=[%s] to stanza=[%s]", stanza.Name, route)
 		} else if _, ok := mapLoggers[route]; ok {
-			currentStanza.AddDefaultRoute(mapLoggers[route])
+			routing.AddDefaultRoute(mapLoggers[route])
 			logger.Info("main - routing (policy=forward) stanza=[%s] to stanza=[%s]", stanza.Name, route)
 		} else {
 			return fmt.Errorf("main - forward routing error from stanza=%s to stanza=%s doest not exist", stanza.Name, route)
 		}
 	}
 
+	// conditional routing
+	for i, conditional := range stanza.RoutingPolicy.Conditional {
+		var routes []workers.Worker
+		for _, route := range conditional.Forward {
+			if route == stanza.Name {
+				return fmt.Errorf("main - routing error loop with stanza=%s to stanza=%s", stanza.Name, route)
+			}
+			if _, ok := mapCollectors[route]; ok {
+				routes = append(routes, mapCollectors[route])
+			} else if _, ok := mapLoggers[route]; ok {
+				routes = append(routes, mapLoggers[route])
+			} else {
+				return fmt.Errorf("main - conditional routing error from stanza=%s to stanza=%s doest not exist", stanza.Name, route)
+			}
+			logger.Info("main - routing (policy=conditional#%d) stanza=[%s] to stanza=[%s]", i, stanza.Name, route)
+		}
+		routing.AddConditionalRoute(currentStanza.NewConditionalRoute(conditional.Matching.Include, conditional.Matching.Exclude, routes))
+	}
+
 	// dropped routing
 	for _, route := range stanza.RoutingPolicy.Dropped {
 		if _, ok := mapCollectors[route]; ok {
-			currentStanza.AddDroppedRoute(mapCollectors[route])
+			routing.AddDroppedRoute(mapCollectors[route])
 			logger.Info("main - routing (policy=dropped) stanza=[%s] to stanza=[%s]", stanza.Name, route)
 		} else if _, ok := mapLoggers[route]; ok {
-			currentStanza.AddDroppedRoute(mapLoggers[route])
+			routing.AddDroppedRoute(mapLoggers[route])
 			logger.Info("main - routing (policy=dropped) stanza=[%s] to stanza=[%s]", stanza.Name, route)
 		} else {
 			return fmt.Errorf("main - routing error with dropped messages from stanza=%s to stanza=%s doest not exist", stanza.Name, route)
 		}
 	}
+
+	currentStanza.GetRouting().Replace(routing)
 	return nil
 }
 
@@ -241,16 +267,33 @@ func CreateStanza(stanzaName string, config *pkgconfig.Config, mapCollectors map
 		mapCollectors[stanzaName] = workers.NewTZSP(nil, config, logger, stanzaName)
 		mapCollectors[stanzaName].SetMetrics(metrics)
 	}
+	if config.Collectors.DNSProxy.Enable {
+		mapCollectors[stanzaName] = workers.NewDNSProxy(nil, config, logger, stanzaName)
+		mapCollectors[stanzaName].SetMetrics(metrics)
+	}
+	if config.Collectors.KafkaConsumer.Enable {
+		mapCollectors[stanzaName] = workers.NewKafkaConsumer(nil, config, logger, stanzaName)
+		mapCollectors[stanzaName].SetMetrics(metrics)
+	}
+	if config.Collectors.JSONIngestor.Enable {
+		mapCollectors[stanzaName] = workers.NewJSONIngestor(nil, config, logger, stanzaName)
+		mapCollectors[stanzaName].SetMetrics(metrics)
+	}
+	if config.Collectors.Webhook.Enable {
+		mapCollectors[stanzaName] = workers.NewWebhook(nil, config, logger, stanzaName)
+		mapCollectors[stanzaName].SetMetrics(metrics)
+	}
 }
 
-func InitPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[string]workers.Worker, config *pkgconfig.Config, logger *logger.Logger, telemetry *telemetry.PrometheusCollector) error {
+// CheckPipelines verifies the stanza names and the routes before creating the workers
+func CheckPipelines(config *pkgconfig.Config) error {
 	// check if the name of each stanza is uniq
 	routesDefined := false
 	for _, stanza := range config.Pipelines {
 		if err := StanzaNameIsUniq(stanza.Name, config); err != nil {
 			return errors.Errorf("stanza with name=[%s] is duplicated", stanza.Name)
 		}
-		if len(stanza.RoutingPolicy.Forward) > 0 || len(stanza.RoutingPolicy.Dropped) > 0 {
+		if len(stanza.RoutingPolicy.Forward) > 0 || len(stanza.RoutingPolicy.Dropped) > 0 || len(stanza.RoutingPolicy.Conditional) > 0 {
 			routesDefined = true
 		}
 	}
@@ -262,6 +305,9 @@ func InitPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[strin
 	// check if all routes exists before continue
 	for _, stanza := range config.Pipelines {
 		for _, route := range stanza.RoutingPolicy.Forward {
+			if route == stanza.Name {
+				return errors.Errorf("stanza=[%s] routing error loop with forward route=[%s]", stanza.Name, route)
+			}
 			if err := IsRouteExist(route, config); err != nil {
 				return errors.Errorf("stanza=[%s] forward route=[%s] doest not exist", stanza.Name, route)
 			}
@@ -271,6 +317,23 @@ func InitPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[strin
 				return errors.Errorf("stanza=[%s] dropped route=[%s] doest not exist", stanza.Name, route)
 			}
 		}
+		for _, conditional := range stanza.RoutingPolicy.Conditional {
+			for _, route := range conditional.Forward {
+				if route == stanza.Name {
+					return errors.Errorf("stanza=[%s] routing error loop with conditional route=[%s]", stanza.Name, route)
+				}
+				if err := IsRouteExist(route, config); err != nil {
+					return errors.Errorf("stanza=[%s] conditional route=[%s] doest not exist", stanza.Name, route)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func InitPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[string]workers.Worker, config *pkgconfig.Config, logger *logger.Logger, telemetry *telemetry.PrometheusCollector) error {
+	if err := CheckPipelines(config); err != nil {
+		return err
 	}
 
 	// read each stanza and init
@@ -294,15 +357,102 @@ func InitPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[strin
 	return nil
 }
 
-func ReloadPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[string]workers.Worker, config *pkgconfig.Config, logger *logger.Logger) {
+// GetStanzaKind returns the collector or logger enabled in the stanza
+func GetStanzaKind(stanza pkgconfig.ConfigPipelines) string {
+	for k := range stanza.Params {
+		return k
+	}
+	return ""
+}
+
+// ReloadPipelines applies the differences between the previous and the new pipelines:
+// the new stanzas are started, the removed ones are stopped, and the routes are replaced.
+// The unchanged stanzas keep running and only reload their configuration.
+func ReloadPipelines(mapLoggers map[string]workers.Worker, mapCollectors map[string]workers.Worker, previous []pkgconfig.ConfigPipelines,
+	config *pkgconfig.Config, logger *logger.Logger, telemetry *telemetry.PrometheusCollector) error {
+	if err := CheckPipelines(config); err != nil {
+		return err
+	}
 	for _, stanza := range config.Pipelines {
-		newCfg := GetStanzaConfig(config, stanza)
+		kind := GetStanzaKind(stanza)
+		if !config.Loggers.IsExists(kind) && !config.Collectors.IsExists(kind) {
+			return errors.Errorf("stanza=[%s] invalid collector or logger=[%s]", stanza.Name, kind)
+		}
+	}
+
+	previousKinds := make(map[string]string)
+	for _, stanza := range previous {
+		previousKinds[stanza.Name] = GetStanzaKind(stanza)
+	}
+
+	// find the stanzas to create, and the stanzas with another collector or logger to recreate
+	var created []string
+	removed := make(map[string]bool)
+	for name := range previousKinds {
+		removed[name] = true
+	}
+	for _, stanza := range config.Pipelines {
+		delete(removed, stanza.Name)
+		kind, ok := previousKinds[stanza.Name]
+		if ok && kind == GetStanzaKind(stanza) && (mapLoggers[stanza.Name] != nil || mapCollectors[stanza.Name] != nil) {
+			continue
+		}
+		if ok {
+			logger.Info("main - reload - stanza=[%s] replaced", stanza.Name)
+			stopStanza(stanza.Name, mapCollectors, mapLoggers)
+		} else {
+			logger.Info("main - reload - stanza=[%s] added", stanza.Name)
+		}
+		created = append(created, stanza.Name)
+	}
+
+	// init the new stanzas and reload the config of the others
+	for _, stanza := range config.Pipelines {
+		stanzaConfig := GetStanzaConfig(config, stanza)
+		if slices.Contains(created, stanza.Name) {
+			CreateStanza(stanza.Name, stanzaConfig, mapCollectors, mapLoggers, logger, telemetry)
+			continue
+		}
 		if _, ok := mapLoggers[stanza.Name]; ok {
-			mapLoggers[stanza.Name].ReloadConfig(newCfg)
+			mapLoggers[stanza.Name].ReloadConfig(stanzaConfig)
 		} else if _, ok := mapCollectors[stanza.Name]; ok {
-			mapCollectors[stanza.Name].ReloadConfig(newCfg)
-		} else {
-			logger.Info("main - reload config stanza=%v doest not exist", stanza.Name)
+			mapCollectors[stanza.Name].ReloadConfig(stanzaConfig)
 		}
 	}
+
+	// replace the routes, the removed stanzas are no longer used after that
+	for _, stanza := range config.Pipelines {
+		if err := CreateRouting(stanza, mapCollectors, mapLoggers, logger); err != nil {
+			return errors.Wrap(err, "routing")
+		}
+	}
+
+	for name := range removed {
+		logger.Info("main - reload - stanza=[%s] removed", name)
+		stopStanza(name, mapCollectors, mapLoggers)
+	}
+
+	// start the new stanzas, loggers first
+	for _, name := range created {
+		if l, ok := mapLoggers[name]; ok {
+			go l.StartCollect()
+		}
+	}
+	for _, name := range created {
+		if c, ok := mapCollectors[name]; ok {
+			go c.StartCollect()
+		}
+	}
+	return nil
+}
+
+func stopStanza(name string, mapCollectors map[string]workers.Worker, mapLoggers map[string]workers.Worker) {
+	if c, ok := mapCollectors[name]; ok {
+		c.Stop()
+		delete(mapCollectors, name)
+	}
+	if l, ok := mapLoggers[name]; ok {
+		l.Stop()
+		delete(mapLoggers, name)
+	}
 }
@@ -111,3 +111,102 @@ func TestPipelines_RoutingLoop(t *testing.T) {
 	}
 
 }
+
+func TestPipelines_ConditionalRouteNotExist(t *testing.T) {
+	config := &pkgconfig.Config{}
+	config.Pipelines = []pkgconfig.ConfigPipelines{
+		{
+			Name: "stanzaA",
+			RoutingPolicy: pkgconfig.PipelinesRouting{
+				Conditional: []pkgconfig.PipelinesConditionalRoute{{Forward: []string{"stanzaB"}}},
+			},
+		},
+	}
+
+	mapLoggers := make(map[string]workers.Worker)
+	mapCollectors := make(map[string]workers.Worker)
+
+	metrics := telemetry.NewPrometheusCollector(config)
+	err := InitPipelines(mapLoggers, mapCollectors, config, logger.New(false), metrics)
+	if err == nil {
+		t.Errorf("Want err, got nil")
+	} else if err.Error() != "stanza=[stanzaA] conditional route=[stanzaB] doest not exist" {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestPipelines_Reload(t *testing.T) {
+	stanza := func(name, kind string, forward ...string) pkgconfig.ConfigPipelines {
+		return pkgconfig.ConfigPipelines{
+			Name:          name,
+			Params:        map[string]interface{}{kind: map[string]interface{}{}},
+			RoutingPolicy: pkgconfig.PipelinesRouting{Forward: forward},
+		}
+	}
+
+	config := pkgconfig.GetDefaultConfig()
+	config.Pipelines = []pkgconfig.ConfigPipelines{
+		stanza("collector", "dnsmessage", "devnull1"),
+		stanza("devnull1", "devnull"),
+		stanza("relay", "dnsmessage", "devnull1"),
+	}
+
+	mapLoggers := make(map[string]workers.Worker)
+	mapCollectors := make(map[string]workers.Worker)
+	metrics := telemetry.NewPrometheusCollector(config)
+	if err := InitPipelines(mapLoggers, mapCollectors, config, logger.New(false), metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range mapLoggers {
+		go w.StartCollect()
+	}
+	for _, w := range mapCollectors {
+		go w.StartCollect()
+	}
+	collector := mapCollectors["collector"]
+
+	// rewire the collector to a new stanza, remove the old one
+	// and replace the relay by a logger
+	previous := config.Pipelines
+	config.Pipelines = []pkgconfig.ConfigPipelines{
+		stanza("collector", "dnsmessage", "devnull2"),
+		stanza("devnull2", "devnull"),
+		stanza("relay", "devnull"),
+	}
+	if err := ReloadPipelines(mapLoggers, mapCollectors, previous, config, logger.New(false), metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	if mapCollectors["collector"] != collector {
+		t.Errorf("the unchanged collector should not be restarted")
+	}
+	if _, ok := mapLoggers["devnull1"]; ok {
+		t.Errorf("the removed stanza should be stopped")
+	}
+	if _, ok := mapCollectors["relay"]; ok {
+		t.Errorf("the replaced stanza should be removed from the collectors")
+	}
+	if _, ok := mapLoggers["relay"]; !ok {
+		t.Errorf("the replaced stanza should be a logger")
+	}
+	routes := collector.GetRouting().GetDefaultRoutes()
+	if len(routes) != 1 || routes[0] != mapLoggers["devnull2"] {
+		t.Errorf("the collector should be routed to the new stanza, got %v", routes)
+	}
+
+	// invalid topology, nothing is changed
+	invalid := &pkgconfig.Config{Pipelines: []pkgconfig.ConfigPipelines{stanza("collector", "dnsmessage", "unknown")}}
+	if err := ReloadPipelines(mapLoggers, mapCollectors, config.Pipelines, invalid, logger.New(false), metrics); err == nil {
+		t.Errorf("invalid routes should be rejected")
+	}
+	if _, ok := mapLoggers["devnull2"]; !ok {
+		t.Errorf("the running stanzas should be kept on error")
+	}
+
+	for _, w := range mapCollectors {
+		w.Stop()
+	}
+	for _, w := range mapLoggers {
+		w.Stop()
+	}
+}
@@ -35,6 +35,7 @@ type WorkerStats struct {
 	TotalForwardedPolicy int
 	TotalDroppedPolicy   int
 	TotalDiscarded       int
+	Counters             map[string]int // counters specific to the worker
 }
 
 type PrometheusCollector struct {
@@ -74,6 +75,9 @@ func NewPrometheusCollector(config *pkgconfig.Config) *PrometheusCollector {
 		"policy_dropped_total": prometheus.NewDesc(
 			fmt.Sprintf("%s_policy_dropped_total", t.promPrefix),
 			"Total number of dropped policy", []string{"worker"}, nil),
+		"worker_counter_total": prometheus.NewDesc(
+			fmt.Sprintf("%s_worker_counter_total", t.promPrefix),
+			"Counters specific to each worker", []string{"worker", "counter"}, nil),
 	}
 	return t
 }
@@ -92,6 +96,12 @@ func (t *PrometheusCollector) UpdateStats() {
 				updatedWs.TotalIngress += ws.TotalIngress
 				updatedWs.TotalEgress += ws.TotalEgress
 				updatedWs.TotalDiscarded += ws.TotalDiscarded
+				for counter, value := range ws.Counters {
+					if updatedWs.Counters == nil {
+						updatedWs.Counters = map[string]int{}
+					}
+					updatedWs.Counters[counter] += value
+				}
 				t.data[ws.Name] = updatedWs
 			}
 			t.Unlock()
@@ -106,6 +116,13 @@ func (t *PrometheusCollector) GetWorkerStats(workerName string) (WorkerStats, bo
 	t.Lock()
 	defer t.Unlock()
 	ws, ok := t.data[workerName]
+	if ws.Counters != nil {
+		counters := make(map[string]int, len(ws.Counters))
+		for counter, value := range ws.Counters {
+			counters[counter] = value
+		}
+		ws.Counters = counters
+	}
 	return ws, ok
 }
 
@@ -145,6 +162,14 @@ func (t *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
 			float64(ws.TotalDroppedPolicy),
 			ws.Name,
 		)
+		for counter, value := range ws.Counters {
+			ch <- prometheus.MustNewConstMetric(
+				t.metrics["worker_counter_total"],
+				prometheus.CounterValue,
+				float64(value),
+				ws.Name, counter,
+			)
+		}
 	}
 }
 
@@ -174,11 +199,13 @@ func InitTelemetryServer(config *pkgconfig.Config, logger *logger.Logger) (*http
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	// the workers stats are also used by the admin api
+	if config.Global.Telemetry.Enabled || config.Global.Admin.Enabled {
+		go metrics.UpdateStats()
+	}
+
 	if config.Global.Telemetry.Enabled {
 		go func() {
-			// start metrics
-			go metrics.UpdateStats()
-
 			// register metrics
 			prometheus.MustRegister(metrics)
 			prometheus.MustRegister(version.NewCollector(config.Global.Telemetry.PromPrefix))
@@ -229,7 +256,7 @@ func InitTelemetryServer(config *pkgconfig.Config, logger *logger.Logger) (*http
 			}
 
 			if config.Global.Telemetry.BasicAuthEnable {
-				promServer.Handler = basicAuthMiddleware(http.DefaultServeMux, config.Global.Telemetry.BasicAuthLogin, config.Global.Telemetry.BasicAuthPwd)
+				promServer.Handler = BasicAuthMiddleware(http.DefaultServeMux, config.Global.Telemetry.BasicAuthLogin, config.Global.Telemetry.BasicAuthPwd)
 			} else {
 				promServer.Handler = http.DefaultServeMux
 			}
@@ -250,8 +277,8 @@ func InitTelemetryServer(config *pkgconfig.Config, logger *logger.Logger) (*http
 	return promServer, metrics, errChan
 }
 
-// BasicAuth middleware
-func basicAuthMiddleware(next http.Handler, username, password string) http.Handler {
+// BasicAuthMiddleware checks the login and password of the requests
+func BasicAuthMiddleware(next http.Handler, username, password string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		u, p, ok := r.BasicAuth()
 		if !ok || u != username || p != password {
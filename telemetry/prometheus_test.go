@@ -47,4 +47,11 @@ func TestTelemetry_PrometheusCollectorUpdateStats(t *testing.T) {
 	assert.Equal(t, ws.TotalForwardedPolicy, storedWS.TotalForwardedPolicy)
 	assert.Equal(t, ws.TotalDroppedPolicy, storedWS.TotalDroppedPolicy)
 	assert.Equal(t, ws.TotalDiscarded, storedWS.TotalDiscarded)
+
+	// the counters specific to the worker are summed
+	collector.Record <- WorkerStats{Name: "worker1", Counters: map[string]int{"udp_lost": 2}}
+	collector.Record <- WorkerStats{Name: "worker1", Counters: map[string]int{"udp_lost": 3}}
+	collector.Record <- WorkerStats{Name: "worker2"}
+	storedWS, _ = collector.GetWorkerStats("worker1")
+	assert.Equal(t, 5, storedWS.Counters["udp_lost"])
 }
@@ -0,0 +1,129 @@
+package transformers
+
+import (
+	"strings"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+const (
+	NegativeAnswerNoData   = "NODATA"
+	NegativeAnswerNXDomain = "NXDOMAIN"
+)
+
+type AnswerChainTransform struct {
+	GenericTransformer
+}
+
+func NewAnswerChainTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *AnswerChainTransform {
+	t := &AnswerChainTransform{GenericTransformer: NewTransformer(config, logger, "answer-chain", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *AnswerChainTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if t.config.AnswerChain.Enable {
+		subtransforms = append(subtransforms, Subtransform{name: "answer-chain:analyze", processFunc: t.analyzeReply})
+	}
+	return subtransforms, nil
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// analyzeReply summarizes the answer of a reply: the CNAME chain from the query name,
+// the DNSSEC signatures, the referrals and the negative answers.
+func (t *AnswerChainTransform) analyzeReply(dm *dnsutils.DNSMessage) (int, error) {
+	// only replies are analyzed
+	if !dm.DNS.Flags.QR {
+		return ReturnKeep, nil
+	}
+
+	chain := &dnsutils.TransformAnswerChain{NegativeAnswer: "-", FinalTarget: dm.DNS.Qname}
+	answers := dm.DNS.DNSRRs.Answers
+	authority := dm.DNS.DNSRRs.Nameservers
+
+	// follow the CNAME chain from the query name, a loop breaks the chain
+	visited := map[string]bool{strings.ToLower(strings.TrimSuffix(dm.DNS.Qname, ".")): true}
+	for found := true; found; {
+		found = false
+		for _, rr := range answers {
+			if rr.Rdatatype != "CNAME" || !sameName(rr.Name, chain.FinalTarget) {
+				continue
+			}
+			chain.CnameChainLength++
+			chain.FinalTarget = rr.Rdata
+			target := strings.ToLower(strings.TrimSuffix(rr.Rdata, "."))
+			if visited[target] {
+				chain.BrokenChain = true
+			} else {
+				visited[target] = true
+				found = true
+			}
+			break
+		}
+	}
+
+	// records owned by the final target, except the CNAME and the signatures
+	hasData := false
+	for _, rr := range answers {
+		if rr.Rdatatype != "CNAME" && rr.Rdatatype != "RRSIG" && sameName(rr.Name, chain.FinalTarget) {
+			hasData = true
+			break
+		}
+	}
+
+	hasSOA, hasNS := false, false
+	for _, rr := range authority {
+		switch rr.Rdatatype {
+		case "SOA":
+			hasSOA = true
+		case "NS":
+			hasNS = true
+		case "RRSIG":
+			// negative answers are signed in the authority section
+			if !hasData {
+				chain.Signed = true
+			}
+		}
+	}
+	for _, rr := range answers {
+		if rr.Rdatatype == "RRSIG" {
+			chain.Signed = true
+		}
+	}
+
+	// a referral delegates the query name to the nameservers of the authority section
+	if dm.DNS.Rcode == dnsutils.DNSRcodeNoError && len(answers) == 0 && !dm.DNS.Flags.AA && hasNS && !hasSOA {
+		chain.Referral = true
+	}
+
+	switch {
+	case dm.DNS.Rcode == dnsutils.DNSRcodeNXDomain:
+		chain.NegativeAnswer = NegativeAnswerNXDomain
+	case dm.DNS.Rcode == dnsutils.DNSRcodeNoError && !hasData && !chain.Referral:
+		chain.NegativeAnswer = NegativeAnswerNoData
+	}
+
+	// the chain is broken if the final target is not resolved in a successful reply
+	if chain.CnameChainLength > 0 && dm.DNS.Rcode == dnsutils.DNSRcodeNoError && !hasData && !hasSOA {
+		chain.BrokenChain = true
+	}
+
+	// minimum ttl of the answer and authority sections
+	first := true
+	for _, section := range [][]dnsutils.DNSAnswer{answers, authority} {
+		for _, rr := range section {
+			if first || rr.TTL < chain.MinTTL {
+				chain.MinTTL = rr.TTL
+				first = false
+			}
+		}
+	}
+
+	dm.AnswerChain = chain
+	return ReturnKeep, nil
+}
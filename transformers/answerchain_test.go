@@ -0,0 +1,132 @@
+package transformers
+
+import (
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestAnswerChain_Analyze(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.AnswerChain.Enable = true
+
+	outChans := []chan dnsutils.DNSMessage{}
+	chain := NewAnswerChainTransform(config, logger.New(false), "test", 0, outChans)
+
+	rr := func(name, rdatatype, rdata string, ttl int) dnsutils.DNSAnswer {
+		return dnsutils.DNSAnswer{Name: name, Rdatatype: rdatatype, Class: "IN", TTL: ttl, Rdata: rdata}
+	}
+
+	testcases := []struct {
+		name        string
+		rcode       string
+		aa          bool
+		answers     []dnsutils.DNSAnswer
+		nameservers []dnsutils.DNSAnswer
+		expected    dnsutils.TransformAnswerChain
+	}{
+		{
+			name:  "cname chain",
+			rcode: dnsutils.DNSRcodeNoError,
+			answers: []dnsutils.DNSAnswer{
+				rr("www.example.com", "CNAME", "cdn.example.net", 300),
+				rr("cdn.example.net", "CNAME", "edge.example.org", 60),
+				rr("edge.example.org", "A", "192.0.2.1", 20),
+			},
+			expected: dnsutils.TransformAnswerChain{CnameChainLength: 2, FinalTarget: "edge.example.org", NegativeAnswer: "-", MinTTL: 20},
+		},
+		{
+			name:  "broken cname chain",
+			rcode: dnsutils.DNSRcodeNoError,
+			answers: []dnsutils.DNSAnswer{
+				rr("www.example.com", "CNAME", "cdn.example.net", 300),
+			},
+			expected: dnsutils.TransformAnswerChain{CnameChainLength: 1, FinalTarget: "cdn.example.net", BrokenChain: true, NegativeAnswer: "NODATA", MinTTL: 300},
+		},
+		{
+			name:  "cname loop",
+			rcode: dnsutils.DNSRcodeNoError,
+			answers: []dnsutils.DNSAnswer{
+				rr("www.example.com", "CNAME", "a.example.com", 300),
+				rr("a.example.com", "CNAME", "www.example.com", 300),
+			},
+			expected: dnsutils.TransformAnswerChain{CnameChainLength: 2, FinalTarget: "www.example.com", BrokenChain: true, NegativeAnswer: "NODATA", MinTTL: 300},
+		},
+		{
+			name:  "signed answer",
+			rcode: dnsutils.DNSRcodeNoError,
+			answers: []dnsutils.DNSAnswer{
+				rr("www.example.com", "A", "192.0.2.1", 3600),
+				rr("www.example.com", "RRSIG", "A 13 3 3600 20241231235959 20241201000000 2371 example.com AAAA", 3600),
+			},
+			expected: dnsutils.TransformAnswerChain{FinalTarget: "www.example.com", Signed: true, NegativeAnswer: "-", MinTTL: 3600},
+		},
+		{
+			name:  "referral",
+			rcode: dnsutils.DNSRcodeNoError,
+			nameservers: []dnsutils.DNSAnswer{
+				rr("example.com", "NS", "ns1.example.com", 172800),
+				rr("example.com", "NS", "ns2.example.com", 86400),
+			},
+			expected: dnsutils.TransformAnswerChain{FinalTarget: "www.example.com", Referral: true, NegativeAnswer: "-", MinTTL: 86400},
+		},
+		{
+			name:  "nodata",
+			rcode: dnsutils.DNSRcodeNoError,
+			aa:    true,
+			nameservers: []dnsutils.DNSAnswer{
+				rr("example.com", "SOA", "ns1.example.com hostmaster.example.com 1 7200 3600 1209600 300", 300),
+				rr("example.com", "RRSIG", "SOA 13 2 3600 20241231235959 20241201000000 2371 example.com AAAA", 300),
+			},
+			expected: dnsutils.TransformAnswerChain{FinalTarget: "www.example.com", Signed: true, NegativeAnswer: "NODATA", MinTTL: 300},
+		},
+		{
+			name:  "nxdomain",
+			rcode: dnsutils.DNSRcodeNXDomain,
+			aa:    true,
+			nameservers: []dnsutils.DNSAnswer{
+				rr("example.com", "SOA", "ns1.example.com hostmaster.example.com 1 7200 3600 1209600 300", 900),
+			},
+			expected: dnsutils.TransformAnswerChain{FinalTarget: "www.example.com", NegativeAnswer: "NXDOMAIN", MinTTL: 900},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.DNS.Qname = "www.example.com"
+			dm.DNS.Flags.QR = true
+			dm.DNS.Flags.AA = tc.aa
+			dm.DNS.Rcode = tc.rcode
+			dm.DNS.DNSRRs.Answers = tc.answers
+			dm.DNS.DNSRRs.Nameservers = tc.nameservers
+
+			if result, _ := chain.analyzeReply(&dm); result != ReturnKeep {
+				t.Errorf("dns message should be kept")
+			}
+			if dm.AnswerChain == nil {
+				t.Fatalf("answer chain should be not nil")
+			}
+			if *dm.AnswerChain != tc.expected {
+				t.Errorf("want %+v, got %+v", tc.expected, *dm.AnswerChain)
+			}
+		})
+	}
+}
+
+func TestAnswerChain_IgnoreQueries(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.AnswerChain.Enable = true
+
+	outChans := []chan dnsutils.DNSMessage{}
+	chain := NewAnswerChainTransform(config, logger.New(false), "test", 0, outChans)
+
+	dm := dnsutils.GetFakeDNSMessage()
+	chain.analyzeReply(&dm)
+	if dm.AnswerChain != nil {
+		t.Errorf("queries should not be analyzed")
+	}
+}
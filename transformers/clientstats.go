@@ -0,0 +1,190 @@
+package transformers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	publicsuffixlist "golang.org/x/net/publicsuffix"
+)
+
+const (
+	// number of buckets of the sliding window
+	clientStatsBuckets = 6
+	// precision of the hyperloglog sketches, 2^10 registers for a standard error of 3.25%
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+)
+
+// hyperLogLog is a bounded sketch to estimate the number of distinct values
+type hyperLogLog [hllRegisters]uint8
+
+func hllHash(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	// finalizer of splitmix64 to spread the bits of the fnv hash
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *hyperLogLog) Add(value string) {
+	x := hllHash(value)
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h[idx] {
+		h[idx] = rank
+	}
+}
+
+// estimateUnion returns the number of distinct values added to the sketches
+func estimateUnion(sketches ...*hyperLogLog) int {
+	sum, zeros := 0.0, 0
+	for i := 0; i < hllRegisters; i++ {
+		var rank uint8
+		for _, h := range sketches {
+			if h[i] > rank {
+				rank = h[i]
+			}
+		}
+		if rank == 0 {
+			zeros++
+		}
+		sum += math.Ldexp(1, -int(rank))
+	}
+
+	m := float64(hllRegisters)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// linear counting for the small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+type clientBucket struct {
+	id                          int64
+	queries, replies, nxdomains int
+	qnames, etlds               hyperLogLog
+}
+
+// clientWindow is the sliding window of a client, made of buckets reused in a ring
+type clientWindow struct {
+	buckets [clientStatsBuckets]clientBucket
+}
+
+type ClientStatsTransform struct {
+	GenericTransformer
+	clients *expirable.LRU[string, *clientWindow]
+}
+
+func NewClientStatsTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *ClientStatsTransform {
+	t := &ClientStatsTransform{GenericTransformer: NewTransformer(config, logger, "client-stats", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *ClientStatsTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if t.config.ClientStats.Enable {
+		if t.config.ClientStats.Window <= 0 {
+			return nil, fmt.Errorf("invalid window value: %d", t.config.ClientStats.Window)
+		}
+		t.clients = expirable.NewLRU[string, *clientWindow](t.config.ClientStats.CacheSize, nil, time.Duration(t.config.ClientStats.Window)*time.Second)
+		subtransforms = append(subtransforms, Subtransform{name: "client-stats:add", processFunc: t.addStats})
+	}
+	return subtransforms, nil
+}
+
+func (t *ClientStatsTransform) Reset() {
+	if t.clients != nil {
+		t.clients.Purge()
+	}
+}
+
+func (t *ClientStatsTransform) addStats(dm *dnsutils.DNSMessage) (int, error) {
+	if dm.NetworkInfo.QueryIP == "-" || len(dm.NetworkInfo.QueryIP) == 0 {
+		return ReturnKeep, nil
+	}
+
+	window, ok := t.clients.Get(dm.NetworkInfo.QueryIP)
+	if !ok {
+		window = &clientWindow{}
+	}
+	// refresh the client in the cache
+	t.clients.Add(dm.NetworkInfo.QueryIP, window)
+
+	// the window is computed with the time of the messages, with a fallback on the current time
+	ts := dm.DNSTap.Timestamp
+	if ts <= 0 {
+		ts = time.Now().UnixNano()
+	}
+	bucketDuration := int64(t.config.ClientStats.Window) * int64(time.Second) / clientStatsBuckets
+	if bucketDuration <= 0 {
+		bucketDuration = int64(time.Second)
+	}
+	id := ts / bucketDuration
+
+	bucket := &window.buckets[id%clientStatsBuckets]
+	if bucket.id != id {
+		*bucket = clientBucket{id: id}
+	}
+
+	// update the current bucket
+	qname := strings.TrimSuffix(strings.ToLower(dm.DNS.Qname), ".")
+	if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
+		bucket.queries++
+	} else {
+		bucket.replies++
+		if dm.DNS.Rcode == dnsutils.DNSRcodeNXDomain {
+			bucket.nxdomains++
+		}
+	}
+	if qname != "-" && len(qname) > 0 {
+		bucket.qnames.Add(qname)
+		etld := qname
+		if dm.PublicSuffix != nil && dm.PublicSuffix.QnameEffectiveTLDPlusOne != "-" {
+			etld = dm.PublicSuffix.QnameEffectiveTLDPlusOne
+		} else if etldPlusOne, err := publicsuffixlist.EffectiveTLDPlusOne(qname); err == nil {
+			etld = etldPlusOne
+		}
+		bucket.etlds.Add(etld)
+	}
+
+	// aggregate the buckets of the window
+	stats := &dnsutils.TransformClientStats{}
+	queries, replies, nxdomains := 0, 0, 0
+	qnames := []*hyperLogLog{}
+	etlds := []*hyperLogLog{}
+	for i := range window.buckets {
+		b := &window.buckets[i]
+		if b.id <= id-clientStatsBuckets || b.id > id {
+			continue
+		}
+		queries += b.queries
+		replies += b.replies
+		nxdomains += b.nxdomains
+		qnames = append(qnames, &b.qnames)
+		etlds = append(etlds, &b.etlds)
+	}
+	stats.Queries = queries
+	stats.QueriesPerSecond = float64(queries) / float64(t.config.ClientStats.Window)
+	stats.DistinctQnames = estimateUnion(qnames...)
+	stats.DistinctETLDPlusOne = estimateUnion(etlds...)
+	if replies > 0 {
+		stats.NXDomainRatio = float64(nxdomains) / float64(replies)
+	}
+
+	dm.ClientStats = stats
+	return ReturnKeep, nil
+}
@@ -0,0 +1,97 @@
+package transformers
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestClientStats_HyperLogLog(t *testing.T) {
+	for _, n := range []int{1, 10, 100, 10000} {
+		h := hyperLogLog{}
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("host%d.example.com", i))
+			// duplicates are ignored
+			h.Add(fmt.Sprintf("host%d.example.com", i))
+		}
+		estimate := estimateUnion(&h)
+		if math.Abs(float64(estimate-n)) > 0.15*float64(n) {
+			t.Errorf("estimate too far for %d distinct values: %d", n, estimate)
+		}
+	}
+}
+
+func TestClientStats_SlidingWindow(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ClientStats.Enable = true
+	config.ClientStats.Window = 60
+
+	outChans := []chan dnsutils.DNSMessage{}
+	stats := NewClientStatsTransform(config, logger.New(false), "test", 0, outChans)
+	stats.GetTransforms()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	send := func(queryIP, qname, qtype, rcode string, offset time.Duration) dnsutils.DNSMessage {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = queryIP
+		dm.DNS.Qname = qname
+		dm.DNS.Type = qtype
+		dm.DNS.Rcode = rcode
+		dm.DNSTap.Timestamp = start + int64(offset)
+		stats.addStats(&dm)
+		return dm
+	}
+
+	// 12 queries and replies from the same client for 3 domains
+	var dm dnsutils.DNSMessage
+	for i := 0; i < 12; i++ {
+		qname := fmt.Sprintf("%d.domain%d.com", i, i%3)
+		send("192.168.1.1", qname, dnsutils.DNSQuery, "-", time.Duration(i)*time.Second)
+		rcode := dnsutils.DNSRcodeNoError
+		if i%4 == 0 {
+			rcode = dnsutils.DNSRcodeNXDomain
+		}
+		dm = send("192.168.1.1", qname, dnsutils.DNSReply, rcode, time.Duration(i)*time.Second)
+	}
+	if dm.ClientStats == nil {
+		t.Fatalf("client stats should be not nil")
+	}
+	if dm.ClientStats.Queries != 12 || dm.ClientStats.QueriesPerSecond != 0.2 {
+		t.Errorf("incorrect queries: %+v", dm.ClientStats)
+	}
+	if dm.ClientStats.DistinctQnames != 12 || dm.ClientStats.DistinctETLDPlusOne != 3 {
+		t.Errorf("incorrect distinct counters: %+v", dm.ClientStats)
+	}
+	if dm.ClientStats.NXDomainRatio != 0.25 {
+		t.Errorf("incorrect nxdomain ratio: %+v", dm.ClientStats)
+	}
+
+	// another client has its own window
+	dm = send("192.168.1.2", "www.google.com", dnsutils.DNSQuery, "-", 20*time.Second)
+	if dm.ClientStats.Queries != 1 || dm.ClientStats.DistinctQnames != 1 {
+		t.Errorf("incorrect stats for the second client: %+v", dm.ClientStats)
+	}
+
+	// the old buckets leave the window
+	dm = send("192.168.1.1", "www.google.com", dnsutils.DNSQuery, "-", 2*time.Minute)
+	if dm.ClientStats.Queries != 1 || dm.ClientStats.DistinctQnames != 1 || dm.ClientStats.NXDomainRatio != 0 {
+		t.Errorf("incorrect stats after the window: %+v", dm.ClientStats)
+	}
+}
+
+func TestClientStats_InvalidWindow(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ClientStats.Enable = true
+	config.ClientStats.Window = 0
+
+	stats := NewClientStatsTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	if _, err := stats.GetTransforms(); err == nil {
+		t.Errorf("error expected with a window of zero")
+	}
+}
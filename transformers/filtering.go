@@ -20,6 +20,7 @@ type FilteringTransform struct {
 	listFqdns, listKeepFqdns               map[string]bool
 	listDomainsRegex, listKeepDomainsRegex map[string]*regexp.Regexp
 	downsample, downsampleCount            int
+	rpz                                    *rpzZone
 }
 
 func NewFilteringTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *FilteringTransform {
@@ -50,6 +51,9 @@ func (t *FilteringTransform) GetTransforms() ([]Subtransform, error) {
 	if err := t.LoadrDataIPList(); err != nil {
 		return nil, err
 	}
+	if err := t.LoadRPZFile(); err != nil {
+		return nil, err
+	}
 
 	if !t.config.Filtering.LogQueries {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:drop-queries", processFunc: t.dropQueryFilter})
@@ -81,6 +85,9 @@ func (t *FilteringTransform) GetTransforms() ([]Subtransform, error) {
 	if len(t.listKeepDomainsRegex) > 0 {
 		subtransforms = append(subtransforms, Subtransform{name: "filtering:keep-domain", processFunc: t.keepDomainRegexFilter})
 	}
+	if t.rpz != nil {
+		subtransforms = append(subtransforms, Subtransform{name: "filtering:rpz", processFunc: t.rpzFilter})
+	}
 	if t.config.Filtering.Downsample > 0 {
 		t.downsample = t.config.Filtering.Downsample
 		t.downsampleCount = 0
@@ -132,6 +139,33 @@ func (t *FilteringTransform) LoadrDataIPList() error {
 	return nil
 }
 
+func (t *FilteringTransform) LoadRPZFile() error {
+	t.rpz = nil
+	if len(t.config.Filtering.RPZFile) == 0 {
+		return nil
+	}
+
+	switch t.config.Filtering.RPZMode {
+	case "drop", "keep", "tag":
+	default:
+		return fmt.Errorf("invalid rpz mode: %s", t.config.Filtering.RPZMode)
+	}
+
+	file, err := os.Open(t.config.Filtering.RPZFile)
+	if err != nil {
+		return fmt.Errorf("unable to open rpz file: %w", err)
+	}
+	defer file.Close()
+
+	rules, err := LoadRPZ(file)
+	if err != nil {
+		return fmt.Errorf("unable to parse rpz file: %w", err)
+	}
+	t.rpz = newRPZZone(rules)
+	t.LogInfo("loaded with %d rpz policies", len(rules))
+	return nil
+}
+
 func (t *FilteringTransform) LoadDomainsList() error {
 	// before to start, reset all maps
 	for key := range t.listFqdns {
@@ -370,6 +404,31 @@ func (t *FilteringTransform) keepDomainRegexFilter(dm *dnsutils.DNSMessage) (int
 	return ReturnDrop, nil
 }
 
+func (t *FilteringTransform) rpzFilter(dm *dnsutils.DNSMessage) (int, error) {
+	// the passthru policies are exceptions, the message is not matched
+	trigger, action, matched := t.rpz.match(dm)
+	matched = matched && action != RPZActionPassthru
+
+	switch t.config.Filtering.RPZMode {
+	case "keep":
+		if !matched {
+			return ReturnDrop, nil
+		}
+	case "tag":
+		if matched {
+			if dm.ATags == nil {
+				dm.ATags = &dnsutils.TransformATags{Tags: []string{}}
+			}
+			dm.ATags.Tags = append(dm.ATags.Tags, "rpz:"+trigger+":"+action)
+		}
+	default:
+		if matched {
+			return ReturnDrop, nil
+		}
+	}
+	return ReturnKeep, nil
+}
+
 // drop all except every nth entry
 func (t *FilteringTransform) downsampleFilter(dm *dnsutils.DNSMessage) (int, error) {
 	if dm.Filtering == nil {
@@ -419,3 +419,88 @@ func TestFilteringMultipleFilters(t *testing.T) {
 		t.Errorf("invalid number of subtransforms enabled")
 	}
 }
+
+func TestFilteringByRPZ(t *testing.T) {
+	// config
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.RPZFile = "../tests/testsdata/threatintel.rpz"
+	config.Filtering.RPZMode = "drop"
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init subproccesor
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, outChans)
+
+	// get tranforms
+	subtransforms, _ := filtering.GetTransforms()
+	if len(subtransforms) != 1 {
+		t.Errorf("invalid number of subtransforms enabled")
+	}
+
+	testcases := []struct {
+		name        string
+		queryIP     string
+		qname       string
+		answers     []dnsutils.DNSAnswer
+		nameservers []dnsutils.DNSAnswer
+		result      int
+	}{
+		{name: "no policy", queryIP: "10.0.0.1", qname: "www.example.com", result: ReturnKeep},
+		{name: "qname", queryIP: "10.0.0.1", qname: "nxdomain.example.com", result: ReturnDrop},
+		{name: "wildcard", queryIP: "10.0.0.1", qname: "a.b.nodata.example.com", result: ReturnDrop},
+		{name: "wildcard apex", queryIP: "10.0.0.1", qname: "nodata.example.com", result: ReturnKeep},
+		{name: "passthru", queryIP: "192.168.0.1", qname: "allowed.example.com", result: ReturnDrop},
+		{name: "client ip", queryIP: "192.168.0.1", qname: "www.example.com", result: ReturnDrop},
+		{name: "answer ip", queryIP: "10.0.0.1", qname: "www.example.com", answers: []dnsutils.DNSAnswer{{Rdatatype: "AAAA", Rdata: "2001:db8:0:ffff::1"}}, result: ReturnDrop},
+		{name: "nsdname", queryIP: "10.0.0.1", qname: "www.example.com", nameservers: []dnsutils.DNSAnswer{{Rdatatype: "NS", Rdata: "ns.example.com"}}, result: ReturnDrop},
+	}
+
+	for _, tc := range testcases {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = tc.queryIP
+		dm.DNS.Qname = tc.qname
+		dm.DNS.DNSRRs.Answers = tc.answers
+		dm.DNS.DNSRRs.Nameservers = tc.nameservers
+		if result, _ := filtering.rpzFilter(&dm); result != tc.result {
+			t.Errorf("%s: unexpected result %d", tc.name, result)
+		}
+	}
+
+	// the passthru policy is evaluated after the client-ip policy
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.NetworkInfo.QueryIP = "10.0.0.1"
+	dm.DNS.Qname = "allowed.example.com"
+	if result, _ := filtering.rpzFilter(&dm); result != ReturnKeep {
+		t.Errorf("passthru: dns query should not be dropped!")
+	}
+}
+
+func TestFilteringByRPZ_Tag(t *testing.T) {
+	// config
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Filtering.Enable = true
+	config.Filtering.RPZFile = "../tests/testsdata/threatintel.rpz"
+	config.Filtering.RPZMode = "tag"
+
+	outChans := []chan dnsutils.DNSMessage{}
+
+	// init subproccesor
+	filtering := NewFilteringTransform(config, logger.New(false), "test", 0, outChans)
+	filtering.GetTransforms()
+
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "nxdomain.example.com"
+	if result, _ := filtering.rpzFilter(&dm); result != ReturnKeep {
+		t.Errorf("dns query should not be dropped!")
+	}
+	if dm.ATags == nil || len(dm.ATags.Tags) != 1 || dm.ATags.Tags[0] != "rpz:qname:NXDOMAIN" {
+		t.Errorf("unexpected tags: %+v", dm.ATags)
+	}
+
+	// invalid mode
+	config.Filtering.RPZMode = "invalid"
+	if _, err := filtering.GetTransforms(); err == nil {
+		t.Errorf("invalid rpz mode should fail")
+	}
+}
@@ -32,6 +32,13 @@ func (mp *MapQueries) SetTTL(ttl time.Duration) {
 	mp.ttl = ttl
 }
 
+func (mp *MapQueries) Get(key uint64) (dm dnsutils.DNSMessage, ok bool) {
+	mp.RLock()
+	defer mp.RUnlock()
+	dm, ok = mp.kv[key]
+	return dm, ok
+}
+
 func (mp *MapQueries) Exists(key uint64) (ok bool) {
 	mp.RLock()
 	defer mp.RUnlock()
@@ -103,22 +110,30 @@ func (mp *HashQueries) Delete(key uint64) {
 // latency transformer
 type LatencyTransform struct {
 	GenericTransformer
-	hashQueries HashQueries
-	mapQueries  MapQueries
+	hashQueries  HashQueries
+	mapQueries   MapQueries
+	mergeQueries MapQueries
 }
 
 func NewLatencyTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *LatencyTransform {
 	t := &LatencyTransform{GenericTransformer: NewTransformer(config, logger, "latency", name, instance, nextWorkers)}
 	t.hashQueries = NewHashQueries(time.Duration(config.Latency.QueriesTimeout) * time.Second)
 	t.mapQueries = NewMapQueries(time.Duration(config.Latency.QueriesTimeout)*time.Second, nextWorkers)
+	t.mergeQueries = NewMapQueries(time.Duration(config.Latency.QueriesTimeout)*time.Second, nextWorkers)
 	return t
 }
 
 func (t *LatencyTransform) GetTransforms() ([]Subtransform, error) {
 	t.hashQueries.SetTTL(time.Duration(t.config.Latency.QueriesTimeout) * time.Second)
 	t.mapQueries.SetTTL(time.Duration(t.config.Latency.QueriesTimeout) * time.Second)
+	t.mergeQueries.SetTTL(time.Duration(t.config.Latency.QueriesTimeout) * time.Second)
 
 	subtransforms := []Subtransform{}
+	// the merge mode measures the latency and emits the unanswered queries by itself
+	if t.config.Latency.Merge {
+		subtransforms = append(subtransforms, Subtransform{name: "latency:merge", processFunc: t.mergeQueryReply})
+		return subtransforms, nil
+	}
 	if t.config.Latency.MeasureLatency {
 		subtransforms = append(subtransforms, Subtransform{name: "latency:add", processFunc: t.measureLatency})
 	}
@@ -128,19 +143,26 @@ func (t *LatencyTransform) GetTransforms() ([]Subtransform, error) {
 	return subtransforms, nil
 }
 
-func (t *LatencyTransform) measureLatency(dm *dnsutils.DNSMessage) (int, error) {
+// queryKey returns the hash of the transaction of the message, false if the message can not be correlated
+func queryKey(dm *dnsutils.DNSMessage) (uint64, bool) {
 	queryport, _ := strconv.Atoi(dm.NetworkInfo.QueryPort)
-	if len(dm.NetworkInfo.QueryIP) > 0 && queryport > 0 && !dm.DNS.MalformedPacket {
-		// compute the hash of the query
-		hashData := []string{dm.NetworkInfo.QueryIP, dm.NetworkInfo.QueryPort, strconv.Itoa(dm.DNS.ID)}
+	if len(dm.NetworkInfo.QueryIP) == 0 || queryport <= 0 || dm.DNS.MalformedPacket {
+		return 0, false
+	}
+
+	// compute the hash of the query
+	hashData := []string{dm.NetworkInfo.QueryIP, dm.NetworkInfo.QueryPort, strconv.Itoa(dm.DNS.ID)}
 
-		hashfnv := fnv.New64a()
-		hashfnv.Write([]byte(strings.Join(hashData, "+")))
+	hashfnv := fnv.New64a()
+	hashfnv.Write([]byte(strings.Join(hashData, "+")))
+	return hashfnv.Sum64(), true
+}
 
+func (t *LatencyTransform) measureLatency(dm *dnsutils.DNSMessage) (int, error) {
+	if key, ok := queryKey(dm); ok {
 		if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
-			t.hashQueries.Set(hashfnv.Sum64(), dm.DNSTap.Timestamp)
+			t.hashQueries.Set(key, dm.DNSTap.Timestamp)
 		} else {
-			key := hashfnv.Sum64()
 			value, ok := t.hashQueries.Get(key)
 			if ok {
 				t.hashQueries.Delete(key)
@@ -153,16 +175,7 @@ func (t *LatencyTransform) measureLatency(dm *dnsutils.DNSMessage) (int, error)
 }
 
 func (t *LatencyTransform) detectEvictedTimeout(dm *dnsutils.DNSMessage) (int, error) {
-
-	queryport, _ := strconv.Atoi(dm.NetworkInfo.QueryPort)
-	if len(dm.NetworkInfo.QueryIP) > 0 && queryport > 0 && !dm.DNS.MalformedPacket {
-		// compute the hash of the query
-		hashData := []string{dm.NetworkInfo.QueryIP, dm.NetworkInfo.QueryPort, strconv.Itoa(dm.DNS.ID)}
-
-		hashfnv := fnv.New64a()
-		hashfnv.Write([]byte(strings.Join(hashData, "+")))
-		key := hashfnv.Sum64()
-
+	if key, ok := queryKey(dm); ok {
 		if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
 			t.mapQueries.Set(key, *dm)
 		} else if t.mapQueries.Exists(key) {
@@ -171,3 +184,39 @@ func (t *LatencyTransform) detectEvictedTimeout(dm *dnsutils.DNSMessage) (int, e
 	}
 	return ReturnKeep, nil
 }
+
+// mergeQueryReply holds the queries until the reply and emits a single record per transaction,
+// the reply completed with the time and the flags of the query. The queries without reply
+// are emitted alone after the timeout.
+func (t *LatencyTransform) mergeQueryReply(dm *dnsutils.DNSMessage) (int, error) {
+	key, ok := queryKey(dm)
+	if !ok {
+		return ReturnKeep, nil
+	}
+
+	if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
+		query := *dm
+		query.Transaction = &dnsutils.TransformTransaction{
+			QueryTime:   dm.DNSTap.TimestampRFC3339,
+			ReplyTime:   "-",
+			QueryFlags:  dm.DNS.Flags,
+			QueryLength: dm.DNS.Length,
+		}
+		t.mergeQueries.Set(key, query)
+		return ReturnDrop, nil
+	}
+
+	dm.Transaction = &dnsutils.TransformTransaction{
+		QueryTime: "-",
+		ReplyTime: dm.DNSTap.TimestampRFC3339,
+		Answered:  true,
+	}
+	if query, ok := t.mergeQueries.Get(key); ok {
+		t.mergeQueries.Delete(key)
+		dm.Transaction.QueryTime = query.Transaction.QueryTime
+		dm.Transaction.QueryFlags = query.Transaction.QueryFlags
+		dm.Transaction.QueryLength = query.Transaction.QueryLength
+		dm.DNSTap.Latency = float64(dm.DNSTap.Timestamp-query.DNSTap.Timestamp) / float64(1000000000)
+	}
+	return ReturnKeep, nil
+}
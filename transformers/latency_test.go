@@ -112,6 +112,69 @@ func TestLatency_DetectEvictedTimeout(t *testing.T) {
 	}
 }
 
+func TestLatency_MergeQueryReply(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Latency.Enable = true
+	config.Latency.Merge = true
+	config.Latency.QueriesTimeout = 1
+
+	outChannels := []chan dnsutils.DNSMessage{}
+	outChannels = append(outChannels, make(chan dnsutils.DNSMessage, 1))
+
+	// init transformer
+	latency := NewLatencyTransform(config, logger.New(true), "test", 0, outChannels)
+	subtransforms, _ := latency.GetTransforms()
+	if len(subtransforms) != 1 {
+		t.Fatalf("only the merge transform expected, got %d", len(subtransforms))
+	}
+
+	// the query is hold until the reply
+	CQ := dnsutils.GetFakeDNSMessage()
+	CQ.DNS.Type = dnsutils.DNSQuery
+	CQ.DNS.Flags.RD = true
+	CQ.DNS.Length = 42
+	CQ.DNSTap.Timestamp = 1704486841216166066
+	CQ.DNSTap.TimestampRFC3339 = "2024-01-05T20:34:01.216166066Z"
+	if result, _ := latency.mergeQueryReply(&CQ); result != ReturnDrop {
+		t.Errorf("the query should be dropped")
+	}
+
+	// the reply is completed with the query
+	CR := dnsutils.GetFakeDNSMessage()
+	CR.DNS.Type = dnsutils.DNSReply
+	CR.DNSTap.Timestamp = 1704486841227961611
+	CR.DNSTap.TimestampRFC3339 = "2024-01-05T20:34:01.227961611Z"
+	if result, _ := latency.mergeQueryReply(&CR); result != ReturnKeep {
+		t.Errorf("the reply should be kept")
+	}
+	if CR.Transaction == nil {
+		t.Fatalf("transaction should be not nil")
+	}
+	if CR.Transaction.QueryTime != CQ.DNSTap.TimestampRFC3339 || CR.Transaction.ReplyTime != CR.DNSTap.TimestampRFC3339 {
+		t.Errorf("incorrect transaction times: %+v", CR.Transaction)
+	}
+	if !CR.Transaction.Answered || !CR.Transaction.QueryFlags.RD || CR.Transaction.QueryLength != 42 {
+		t.Errorf("incorrect transaction: %+v", CR.Transaction)
+	}
+	if CR.DNSTap.Latency == 0.0 {
+		t.Errorf("incorrect latency, got 0.0")
+	}
+
+	// the unanswered query is emitted alone after the timeout
+	CQ.DNS.ID = 1
+	latency.mergeQueryReply(&CQ)
+	time.Sleep(2 * time.Second)
+
+	dmTimeout := <-outChannels[0]
+	if dmTimeout.DNS.Rcode != "TIMEOUT" {
+		t.Errorf("incorrect rcode, expected=TIMEOUT, got=%s", dmTimeout.DNS.Rcode)
+	}
+	if dmTimeout.Transaction == nil || dmTimeout.Transaction.Answered || dmTimeout.Transaction.ReplyTime != "-" {
+		t.Errorf("incorrect transaction for unanswered query: %+v", dmTimeout.Transaction)
+	}
+}
+
 func Test_HashQueries(t *testing.T) {
 	// init map
 	mapttl := NewHashQueries(2 * time.Second)
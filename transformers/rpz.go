@@ -0,0 +1,253 @@
+package transformers
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/miekg/dns"
+)
+
+const (
+	RPZTriggerQname    = "qname"
+	RPZTriggerIP       = "ip"
+	RPZTriggerClientIP = "client-ip"
+	RPZTriggerNSDName  = "nsdname"
+
+	RPZActionNXDomain  = "NXDOMAIN"
+	RPZActionNoData    = "NODATA"
+	RPZActionPassthru  = "PASSTHRU"
+	RPZActionDrop      = "DROP"
+	RPZActionTCPOnly   = "TCP-ONLY"
+	RPZActionLocalData = "LOCAL-DATA"
+)
+
+// RPZRule is a policy of a response policy zone
+type RPZRule struct {
+	Trigger string
+	// name of the qname and nsdname triggers, without the wildcard label
+	Name     string
+	Wildcard bool
+	// prefix of the ip and client-ip triggers
+	Prefix netip.Prefix
+	Action string
+}
+
+// rpzAction returns the policy action according to the CNAME target of the rule
+func rpzAction(rr dns.RR) string {
+	cname, ok := rr.(*dns.CNAME)
+	if !ok {
+		return RPZActionLocalData
+	}
+	switch strings.ToLower(cname.Target) {
+	case ".":
+		return RPZActionNXDomain
+	case "*.":
+		return RPZActionNoData
+	case "rpz-passthru.":
+		return RPZActionPassthru
+	case "rpz-drop.":
+		return RPZActionDrop
+	case "rpz-tcp-only.":
+		return RPZActionTCPOnly
+	}
+	return RPZActionLocalData
+}
+
+// parseRPZPrefix decodes the prefix of the ip triggers, encoded as the prefix length
+// followed by the reversed address, with "zz" for the longest run of zeros in IPv6
+func parseRPZPrefix(name string) (netip.Prefix, error) {
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return netip.Prefix{}, fmt.Errorf("invalid rpz ip trigger: %s", name)
+	}
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid rpz prefix length: %s", name)
+	}
+
+	// reverse the address
+	parts := labels[1:]
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	var addr string
+	if len(parts) == 4 && !strings.Contains(name, "zz") {
+		addr = strings.Join(parts, ".")
+	} else {
+		addr = strings.Replace(strings.Join(parts, ":"), "zz", "", 1)
+		if len(addr) == 0 {
+			addr = "::"
+		} else if strings.HasPrefix(addr, ":") {
+			addr = ":" + addr
+		} else if strings.HasSuffix(addr, ":") {
+			addr += ":"
+		}
+	}
+
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid rpz ip trigger: %s", name)
+	}
+	return ip.Prefix(bits)
+}
+
+// LoadRPZ reads the policies of a response policy zone in the zone file format.
+// The origin of the zone is the owner of the SOA record, the owner names are relative to it.
+func LoadRPZ(r io.Reader) ([]RPZRule, error) {
+	rules := []RPZRule{}
+	seen := make(map[string]bool)
+	origin := ""
+
+	zp := dns.NewZoneParser(r, "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA:
+			origin = owner
+			continue
+		case dns.TypeNS:
+			if owner == origin {
+				continue
+			}
+		}
+
+		// the local data can be made of several records
+		if seen[owner] {
+			continue
+		}
+		seen[owner] = true
+
+		name := strings.TrimSuffix(owner, ".")
+		if len(origin) > 0 {
+			name = strings.TrimSuffix(strings.TrimSuffix(owner, origin), ".")
+		}
+
+		rule := RPZRule{Action: rpzAction(rr)}
+		switch {
+		case strings.HasSuffix(name, ".rpz-client-ip"):
+			prefix, err := parseRPZPrefix(strings.TrimSuffix(name, ".rpz-client-ip"))
+			if err != nil {
+				return nil, err
+			}
+			rule.Trigger, rule.Prefix = RPZTriggerClientIP, prefix
+		case strings.HasSuffix(name, ".rpz-ip"):
+			prefix, err := parseRPZPrefix(strings.TrimSuffix(name, ".rpz-ip"))
+			if err != nil {
+				return nil, err
+			}
+			rule.Trigger, rule.Prefix = RPZTriggerIP, prefix
+		case strings.HasSuffix(name, ".rpz-nsdname"):
+			rule.Trigger, rule.Name = RPZTriggerNSDName, strings.TrimSuffix(name, ".rpz-nsdname")
+		case strings.HasSuffix(name, ".rpz-nsip"):
+			// the addresses of the nameservers can not be evaluated from the dns messages
+			continue
+		default:
+			rule.Trigger, rule.Name = RPZTriggerQname, name
+		}
+		if strings.HasPrefix(rule.Name, "*.") {
+			rule.Name, rule.Wildcard = strings.TrimPrefix(rule.Name, "*."), true
+		}
+		rules = append(rules, rule)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// rpzNames indexes the names of the qname or nsdname triggers, the wildcards are
+// found by walking up the parent domains so the lookup does not depend on the size of the zone
+type rpzNames struct {
+	exact, wildcards map[string]string
+}
+
+func (n *rpzNames) add(rule RPZRule) {
+	if n.exact == nil {
+		n.exact, n.wildcards = make(map[string]string), make(map[string]string)
+	}
+	if rule.Wildcard {
+		n.wildcards[rule.Name] = rule.Action
+	} else {
+		n.exact[rule.Name] = rule.Action
+	}
+}
+
+// lookup returns the action of the exact name or else of the closest wildcard
+func (n *rpzNames) lookup(name string) (string, bool) {
+	if action, ok := n.exact[name]; ok {
+		return action, true
+	}
+	for parent := name; strings.Contains(parent, "."); {
+		parent = parent[strings.IndexByte(parent, '.')+1:]
+		if action, ok := n.wildcards[parent]; ok {
+			return action, true
+		}
+	}
+	return "", false
+}
+
+// rpzZone is the index of the policies of a response policy zone
+type rpzZone struct {
+	qnames, nsdnames rpzNames
+	ips, clientIPs   prefixIndex[string]
+}
+
+func newRPZZone(rules []RPZRule) *rpzZone {
+	z := &rpzZone{}
+	for _, rule := range rules {
+		switch rule.Trigger {
+		case RPZTriggerQname:
+			z.qnames.add(rule)
+		case RPZTriggerNSDName:
+			z.nsdnames.add(rule)
+		case RPZTriggerIP:
+			z.ips.add(rule.Prefix, rule.Action)
+		case RPZTriggerClientIP:
+			z.clientIPs.add(rule.Prefix, rule.Action)
+		}
+	}
+	return z
+}
+
+// match evaluates the triggers in the order of precedence of the policies:
+// client-ip, qname, ip of the answers then names of the nameservers
+func (z *rpzZone) match(dm *dnsutils.DNSMessage) (string, string, bool) {
+	if ip, err := netip.ParseAddr(dm.NetworkInfo.QueryIP); err == nil {
+		if action, ok := z.clientIPs.lookup(ip); ok {
+			return RPZTriggerClientIP, action, true
+		}
+	}
+
+	qname := strings.TrimSuffix(strings.ToLower(dm.DNS.Qname), ".")
+	if action, ok := z.qnames.lookup(qname); ok {
+		return RPZTriggerQname, action, true
+	}
+
+	for _, rr := range dm.DNS.DNSRRs.Answers {
+		if rr.Rdatatype != "A" && rr.Rdatatype != "AAAA" {
+			continue
+		}
+		if ip, err := netip.ParseAddr(rr.Rdata); err == nil {
+			if action, ok := z.ips.lookup(ip); ok {
+				return RPZTriggerIP, action, true
+			}
+		}
+	}
+
+	for _, section := range [][]dnsutils.DNSAnswer{dm.DNS.DNSRRs.Answers, dm.DNS.DNSRRs.Nameservers} {
+		for _, rr := range section {
+			if rr.Rdatatype != "NS" {
+				continue
+			}
+			if action, ok := z.nsdnames.lookup(strings.TrimSuffix(strings.ToLower(rr.Rdata), ".")); ok {
+				return RPZTriggerNSDName, action, true
+			}
+		}
+	}
+	return "", "", false
+}
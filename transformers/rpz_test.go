@@ -0,0 +1,66 @@
+package transformers
+
+import (
+	"net/netip"
+	"os"
+	"testing"
+)
+
+func TestRPZ_Load(t *testing.T) {
+	f, err := os.Open("../tests/testsdata/threatintel.rpz")
+	if err != nil {
+		t.Fatalf("unable to open the zone: %v", err)
+	}
+	defer f.Close()
+
+	rules, err := LoadRPZ(f)
+	if err != nil {
+		t.Fatalf("unable to load the zone: %v", err)
+	}
+
+	expected := []RPZRule{
+		{Trigger: RPZTriggerQname, Name: "nxdomain.example.com", Action: RPZActionNXDomain},
+		{Trigger: RPZTriggerQname, Name: "nodata.example.com", Wildcard: true, Action: RPZActionNoData},
+		{Trigger: RPZTriggerQname, Name: "allowed.example.com", Action: RPZActionPassthru},
+		{Trigger: RPZTriggerQname, Name: "local.example.com", Action: RPZActionLocalData},
+		{Trigger: RPZTriggerIP, Prefix: netip.MustParsePrefix("192.0.2.1/32"), Action: RPZActionDrop},
+		{Trigger: RPZTriggerClientIP, Prefix: netip.MustParsePrefix("192.168.0.0/24"), Action: RPZActionTCPOnly},
+		{Trigger: RPZTriggerIP, Prefix: netip.MustParsePrefix("2001:db8::/48"), Action: RPZActionNXDomain},
+		{Trigger: RPZTriggerNSDName, Name: "ns.example.com", Action: RPZActionNXDomain},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %d: %+v", len(expected), len(rules), rules)
+	}
+	for i := range expected {
+		if rules[i] != expected[i] {
+			t.Errorf("rule %d: expected %+v, got %+v", i, expected[i], rules[i])
+		}
+	}
+}
+
+func TestRPZ_ParsePrefix(t *testing.T) {
+	testcases := []struct {
+		name     string
+		expected string
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32"},
+		{"24.0.0.168.192", "192.168.0.0/24"},
+		{"128.1.zz.db8.2001", "2001:db8::1/128"},
+		{"64.zz.1.db8.2001", "2001:db8:1::/64"},
+		{"0.zz", "::/0"},
+	}
+	for _, tc := range testcases {
+		prefix, err := parseRPZPrefix(tc.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if prefix.String() != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, prefix)
+		}
+	}
+
+	if _, err := parseRPZPrefix("x.1.2.0.192"); err == nil {
+		t.Errorf("invalid prefix length should fail")
+	}
+}
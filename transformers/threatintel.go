@@ -0,0 +1,403 @@
+package transformers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	publicsuffixlist "golang.org/x/net/publicsuffix"
+)
+
+const (
+	ThreatFeedList = "list"
+	ThreatFeedRPZ  = "rpz"
+	ThreatFeedCSV  = "csv"
+	ThreatFeedSTIX = "stix"
+
+	ThreatFieldQname    = "qname"
+	ThreatFieldETLD     = "etld+1"
+	ThreatFieldAnswerIP = "answer-ip"
+	ThreatFieldQueryIP  = "query-ip"
+)
+
+var stixPatternRegex = regexp.MustCompile(`(domain-name|ipv4-addr|ipv6-addr):value\s*=\s*'([^']+)'`)
+
+type threatIndicator struct {
+	indicator, severity string
+	// exact domains of the rpz triggers, without the fallback on the registered domain
+	exact bool
+}
+
+// prefixIndex finds the value of the longest prefix matching an ip address
+type prefixIndex[T any] struct {
+	prefixes map[netip.Prefix]T
+	bits     []int
+}
+
+func (p *prefixIndex[T]) add(prefix netip.Prefix, value T) {
+	if p.prefixes == nil {
+		p.prefixes = make(map[netip.Prefix]T)
+	}
+	prefix = prefix.Masked()
+	if _, ok := p.prefixes[prefix]; ok {
+		return
+	}
+	p.prefixes[prefix] = value
+	for _, b := range p.bits {
+		if b == prefix.Bits() {
+			return
+		}
+	}
+	p.bits = append(p.bits, prefix.Bits())
+	sort.Sort(sort.Reverse(sort.IntSlice(p.bits)))
+}
+
+func (p *prefixIndex[T]) lookup(ip netip.Addr) (T, bool) {
+	var empty T
+	ip = ip.Unmap()
+	for _, bits := range p.bits {
+		if bits > ip.BitLen() {
+			continue
+		}
+		prefix, err := ip.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if value, ok := p.prefixes[prefix]; ok {
+			return value, true
+		}
+	}
+	return empty, false
+}
+
+// threatFeed is the index of the indicators of a feed
+type threatFeed struct {
+	name      string
+	domains   map[string]threatIndicator
+	wildcards map[string]threatIndicator
+	answerIPs prefixIndex[threatIndicator]
+	queryIPs  prefixIndex[threatIndicator]
+}
+
+func newThreatFeed(name string) *threatFeed {
+	return &threatFeed{name: name, domains: make(map[string]threatIndicator), wildcards: make(map[string]threatIndicator)}
+}
+
+func (f *threatFeed) size() int {
+	return len(f.domains) + len(f.wildcards) + len(f.answerIPs.prefixes) + len(f.queryIPs.prefixes)
+}
+
+// addIndicator adds a domain, a wildcard domain, an ip or a cidr to the feed,
+// the ip addresses are matched against the answers and the query ip
+func (f *threatFeed) addIndicator(value, severity string) {
+	value = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+	if len(value) == 0 {
+		return
+	}
+	indicator := threatIndicator{indicator: value, severity: severity}
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		f.answerIPs.add(prefix, indicator)
+		f.queryIPs.add(prefix, indicator)
+	} else if ip, err := netip.ParseAddr(value); err == nil {
+		f.answerIPs.add(netip.PrefixFrom(ip, ip.BitLen()), indicator)
+		f.queryIPs.add(netip.PrefixFrom(ip, ip.BitLen()), indicator)
+	} else if strings.HasPrefix(value, "*.") {
+		f.wildcards[strings.TrimPrefix(value, "*.")] = indicator
+	} else {
+		f.domains[value] = indicator
+	}
+}
+
+// openThreatSource opens a local file or downloads the feed from an http(s) url
+func openThreatSource(source string) (io.ReadCloser, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+	return os.Open(strings.TrimPrefix(source, "file://"))
+}
+
+// loadThreatFeed reads the indicators of the feed according to its format
+func loadThreatFeed(config pkgconfig.ThreatIntelFeed) (*threatFeed, error) {
+	if len(config.Name) == 0 || len(config.Source) == 0 {
+		return nil, errors.New("name and source are mandatory")
+	}
+	severity := strings.ToLower(config.Severity)
+	if len(severity) == 0 {
+		severity = "medium"
+	}
+
+	r, err := openThreatSource(config.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	feed := newThreatFeed(config.Name)
+	switch config.Format {
+	case ThreatFeedList, "":
+		// one indicator per line, the hosts files are supported
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.IndexByte(line, '#'); i != -1 {
+				line = line[:i]
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+				continue
+			case len(fields) >= 2 && (fields[0] == "0.0.0.0" || fields[0] == "127.0.0.1" || fields[0] == "::"):
+				feed.addIndicator(fields[1], severity)
+			default:
+				feed.addIndicator(fields[0], severity)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+	case ThreatFeedCSV:
+		// indicator[,severity[,description]]
+		reader := csv.NewReader(r)
+		reader.Comment = '#'
+		reader.FieldsPerRecord = -1
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(record) == 0 || strings.EqualFold(strings.TrimSpace(record[0]), "indicator") {
+				continue
+			}
+			recordSeverity := severity
+			if len(record) > 1 && len(strings.TrimSpace(record[1])) > 0 {
+				recordSeverity = strings.ToLower(strings.TrimSpace(record[1]))
+			}
+			feed.addIndicator(record[0], recordSeverity)
+		}
+
+	case ThreatFeedSTIX:
+		// bundle of indicators with domain-name, ipv4-addr and ipv6-addr patterns
+		var bundle struct {
+			Objects []struct {
+				Type    string `json:"type"`
+				Pattern string `json:"pattern"`
+			} `json:"objects"`
+		}
+		if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+			return nil, err
+		}
+		for _, object := range bundle.Objects {
+			if object.Type != "indicator" {
+				continue
+			}
+			for _, match := range stixPatternRegex.FindAllStringSubmatch(object.Pattern, -1) {
+				feed.addIndicator(match[2], severity)
+			}
+		}
+
+	case ThreatFeedRPZ:
+		rules, err := LoadRPZ(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			// the passthru rules are exceptions of the zone
+			if rule.Action == RPZActionPassthru {
+				continue
+			}
+			switch {
+			case rule.Trigger == RPZTriggerQname && rule.Wildcard:
+				feed.wildcards[rule.Name] = threatIndicator{indicator: "*." + rule.Name, severity: severity}
+			case rule.Trigger == RPZTriggerQname:
+				feed.domains[rule.Name] = threatIndicator{indicator: rule.Name, severity: severity, exact: true}
+			case rule.Trigger == RPZTriggerIP:
+				feed.answerIPs.add(rule.Prefix, threatIndicator{indicator: rule.Prefix.String(), severity: severity})
+			case rule.Trigger == RPZTriggerClientIP:
+				feed.queryIPs.add(rule.Prefix, threatIndicator{indicator: rule.Prefix.String(), severity: severity})
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", config.Format)
+	}
+	return feed, nil
+}
+
+type ThreatIntelTransform struct {
+	GenericTransformer
+	sync.RWMutex
+	feeds    []*threatFeed
+	loadedAt time.Time
+	loading  atomic.Bool
+}
+
+func NewThreatIntelTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *ThreatIntelTransform {
+	t := &ThreatIntelTransform{GenericTransformer: NewTransformer(config, logger, "threat-intel", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *ThreatIntelTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if t.config.ThreatIntel.Enable {
+		t.LoadFeeds()
+		subtransforms = append(subtransforms, Subtransform{name: "threat-intel:match", processFunc: t.matchIndicators})
+	}
+	return subtransforms, nil
+}
+
+// LoadFeeds (re)loads all the feeds, the previous version of a feed is kept on error
+func (t *ThreatIntelTransform) LoadFeeds() {
+	t.RLock()
+	previous := make(map[string]*threatFeed)
+	for _, feed := range t.feeds {
+		previous[feed.name] = feed
+	}
+	t.RUnlock()
+
+	feeds := []*threatFeed{}
+	for _, feedConfig := range t.config.ThreatIntel.Feeds {
+		feed, err := loadThreatFeed(feedConfig)
+		if err != nil {
+			t.LogError("unable to load the feed %s: %v", feedConfig.Name, err)
+			if feed, ok := previous[feedConfig.Name]; ok {
+				feeds = append(feeds, feed)
+			}
+			continue
+		}
+		t.LogInfo("feed %s loaded with %d indicators", feed.name, feed.size())
+		feeds = append(feeds, feed)
+	}
+
+	t.Lock()
+	t.feeds = feeds
+	t.loadedAt = time.Now()
+	t.Unlock()
+}
+
+// reloadFeeds triggers the reload of the feeds in background when the interval is elapsed
+func (t *ThreatIntelTransform) reloadFeeds() {
+	if t.config.ThreatIntel.ReloadInterval <= 0 {
+		return
+	}
+	t.RLock()
+	elapsed := time.Since(t.loadedAt)
+	t.RUnlock()
+	if elapsed < time.Duration(t.config.ThreatIntel.ReloadInterval)*time.Second {
+		return
+	}
+	if t.loading.CompareAndSwap(false, true) {
+		go func() {
+			defer t.loading.Store(false)
+			t.LoadFeeds()
+		}()
+	}
+}
+
+func (t *ThreatIntelTransform) matchIndicators(dm *dnsutils.DNSMessage) (int, error) {
+	t.reloadFeeds()
+
+	if dm.ThreatIntel == nil {
+		dm.ThreatIntel = &dnsutils.TransformThreatIntel{Matches: []dnsutils.ThreatIntelMatch{}}
+	}
+
+	qname := strings.TrimSuffix(strings.ToLower(dm.DNS.Qname), ".")
+	etld := ""
+	if dm.PublicSuffix != nil && dm.PublicSuffix.QnameEffectiveTLDPlusOne != "-" {
+		etld = dm.PublicSuffix.QnameEffectiveTLDPlusOne
+	} else if etldPlusOne, err := publicsuffixlist.EffectiveTLDPlusOne(qname); err == nil {
+		etld = etldPlusOne
+	}
+
+	answerIPs := []netip.Addr{}
+	for _, rr := range dm.DNS.DNSRRs.Answers {
+		if rr.Rdatatype == "A" || rr.Rdatatype == "AAAA" {
+			if ip, err := netip.ParseAddr(rr.Rdata); err == nil {
+				answerIPs = append(answerIPs, ip)
+			}
+		}
+	}
+	queryIP, queryIPErr := netip.ParseAddr(dm.NetworkInfo.QueryIP)
+
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, feed := range t.feeds {
+		add := func(indicator threatIndicator, field string) {
+			dm.ThreatIntel.Matches = append(dm.ThreatIntel.Matches, dnsutils.ThreatIntelMatch{
+				Feed: feed.name, Indicator: indicator.indicator, Severity: indicator.severity, Field: field,
+			})
+		}
+
+		// query name, exact match then the parent domains for the wildcards
+		if indicator, ok := feed.domains[qname]; ok {
+			add(indicator, ThreatFieldQname)
+		} else if indicator, ok := feed.domains[etld]; ok && len(etld) > 0 && !indicator.exact {
+			add(indicator, ThreatFieldETLD)
+		} else {
+			for parent := qname; strings.Contains(parent, "."); {
+				parent = parent[strings.IndexByte(parent, '.')+1:]
+				if indicator, ok := feed.wildcards[parent]; ok {
+					add(indicator, ThreatFieldQname)
+					break
+				}
+			}
+		}
+
+		for _, ip := range answerIPs {
+			if indicator, ok := feed.answerIPs.lookup(ip); ok {
+				add(indicator, ThreatFieldAnswerIP)
+				break
+			}
+		}
+
+		if queryIPErr == nil {
+			if indicator, ok := feed.queryIPs.lookup(queryIP); ok {
+				add(indicator, ThreatFieldQueryIP)
+			}
+		}
+	}
+
+	// tag the dns message with the feeds matched
+	if t.config.ThreatIntel.AddTags && len(dm.ThreatIntel.Matches) > 0 {
+		if dm.ATags == nil {
+			dm.ATags = &dnsutils.TransformATags{Tags: []string{}}
+		}
+		tagged := make(map[string]bool)
+		for _, match := range dm.ThreatIntel.Matches {
+			tag := match.Feed + ":" + match.Severity
+			if !tagged[tag] {
+				tagged[tag] = true
+				dm.ATags.Tags = append(dm.ATags.Tags, tag)
+			}
+		}
+	}
+	return ReturnKeep, nil
+}
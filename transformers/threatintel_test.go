@@ -0,0 +1,142 @@
+package transformers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestThreatIntel_Match(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ThreatIntel.Enable = true
+	config.ThreatIntel.AddTags = true
+	config.ThreatIntel.Feeds = []pkgconfig.ThreatIntelFeed{
+		{Name: "blocklist", Source: "../tests/testsdata/threatintel_list.txt", Format: "list"},
+		{Name: "c2", Source: "file://../tests/testsdata/threatintel.csv", Format: "csv", Severity: "low"},
+		{Name: "stix", Source: "../tests/testsdata/threatintel_stix.json", Format: "stix", Severity: "high"},
+		{Name: "rpz", Source: "../tests/testsdata/threatintel.rpz", Format: "rpz"},
+		{Name: "missing", Source: "../tests/testsdata/notfound.txt"},
+	}
+
+	outChans := []chan dnsutils.DNSMessage{}
+	threatintel := NewThreatIntelTransform(config, logger.New(false), "test", 0, outChans)
+	threatintel.GetTransforms()
+
+	testcases := []struct {
+		name    string
+		queryIP string
+		qname   string
+		answers []string
+		matches []dnsutils.ThreatIntelMatch
+		tags    []string
+	}{
+		{
+			name: "no match", queryIP: "10.0.0.1", qname: "www.example.com",
+			matches: []dnsutils.ThreatIntelMatch{},
+		},
+		{
+			name: "qname", queryIP: "10.0.0.1", qname: "malware.example.com",
+			matches: []dnsutils.ThreatIntelMatch{{Feed: "blocklist", Indicator: "malware.example.com", Severity: "medium", Field: ThreatFieldQname}},
+			tags:    []string{"blocklist:medium"},
+		},
+		{
+			name: "etld+1", queryIP: "10.0.0.1", qname: "www.evil.example",
+			matches: []dnsutils.ThreatIntelMatch{{Feed: "c2", Indicator: "evil.example", Severity: "high", Field: ThreatFieldETLD}},
+			tags:    []string{"c2:high"},
+		},
+		{
+			name: "wildcard", queryIP: "10.0.0.1", qname: "a.b.botnet.example.org",
+			matches: []dnsutils.ThreatIntelMatch{{Feed: "blocklist", Indicator: "*.botnet.example.org", Severity: "medium", Field: ThreatFieldQname}},
+		},
+		{
+			name: "answer ip", queryIP: "10.0.0.1", qname: "www.example.com", answers: []string{"198.51.100.7", "2001:db8::1"},
+			matches: []dnsutils.ThreatIntelMatch{
+				{Feed: "blocklist", Indicator: "198.51.100.0/24", Severity: "medium", Field: ThreatFieldAnswerIP},
+				{Feed: "stix", Indicator: "2001:db8::/32", Severity: "high", Field: ThreatFieldAnswerIP},
+				{Feed: "rpz", Indicator: "2001:db8::/48", Severity: "medium", Field: ThreatFieldAnswerIP},
+			},
+		},
+		{
+			name: "query ip", queryIP: "203.0.113.10", qname: "www.example.com",
+			matches: []dnsutils.ThreatIntelMatch{{Feed: "c2", Indicator: "203.0.113.10", Severity: "critical", Field: ThreatFieldQueryIP}},
+		},
+		{
+			name: "rpz", queryIP: "192.168.0.4", qname: "x.nodata.example.com",
+			matches: []dnsutils.ThreatIntelMatch{
+				{Feed: "rpz", Indicator: "*.nodata.example.com", Severity: "medium", Field: ThreatFieldQname},
+				{Feed: "rpz", Indicator: "192.168.0.0/24", Severity: "medium", Field: ThreatFieldQueryIP},
+			},
+		},
+		{
+			name: "rpz passthru", queryIP: "10.0.0.1", qname: "allowed.example.com",
+			matches: []dnsutils.ThreatIntelMatch{},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := dnsutils.GetFakeDNSMessage()
+			dm.NetworkInfo.QueryIP = tc.queryIP
+			dm.DNS.Qname = tc.qname
+			for _, ip := range tc.answers {
+				rdatatype := "A"
+				if strings.Contains(ip, ":") {
+					rdatatype = "AAAA"
+				}
+				dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, dnsutils.DNSAnswer{Name: tc.qname, Rdatatype: rdatatype, Class: "IN", Rdata: ip})
+			}
+
+			threatintel.matchIndicators(&dm)
+
+			if len(dm.ThreatIntel.Matches) != len(tc.matches) {
+				t.Fatalf("expected %+v, got %+v", tc.matches, dm.ThreatIntel.Matches)
+			}
+			for i := range tc.matches {
+				if dm.ThreatIntel.Matches[i] != tc.matches[i] {
+					t.Errorf("expected %+v, got %+v", tc.matches[i], dm.ThreatIntel.Matches[i])
+				}
+			}
+			if tc.tags != nil && (dm.ATags == nil || len(dm.ATags.Tags) != len(tc.tags) || dm.ATags.Tags[0] != tc.tags[0]) {
+				t.Errorf("expected tags %v, got %+v", tc.tags, dm.ATags)
+			}
+		})
+	}
+}
+
+func TestThreatIntel_RPZExactTrigger(t *testing.T) {
+	// a qname trigger on a registered domain
+	zone := filepath.Join(t.TempDir(), "db.rpz")
+	if err := os.WriteFile(zone, []byte("$TTL 300\n"+
+		"rpz.local. IN SOA localhost. root.localhost. 1 3600 600 86400 300\n"+
+		"evil.example.rpz.local. IN CNAME .\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.ThreatIntel.Enable = true
+	config.ThreatIntel.Feeds = []pkgconfig.ThreatIntelFeed{{Name: "rpz", Source: zone, Format: "rpz"}}
+
+	threatintel := NewThreatIntelTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+	threatintel.GetTransforms()
+
+	for _, tc := range []struct {
+		qname   string
+		matched bool
+	}{
+		{qname: "evil.example", matched: true},
+		{qname: "www.evil.example", matched: false},
+	} {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = tc.qname
+		threatintel.matchIndicators(&dm)
+		if matched := len(dm.ThreatIntel.Matches) > 0; matched != tc.matched {
+			t.Errorf("%s: want matched=%v, got %+v", tc.qname, tc.matched, dm.ThreatIntel.Matches)
+		}
+	}
+}
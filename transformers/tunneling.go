@@ -0,0 +1,183 @@
+package transformers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	publicsuffixlist "golang.org/x/net/publicsuffix"
+)
+
+const (
+	// maximum number of subdomains remembered per client and domain, the next ones are
+	// considered as unique
+	tunnelingMaxSubdomains = 1024
+	// minimum length of the subdomain to compute the entropy
+	tunnelingMinEntropyLen = 16
+
+	TunnelingReasonUniqueBytes = "unique-bytes"
+	TunnelingReasonEntropy     = "high-entropy"
+	TunnelingReasonTxtNull     = "txt-null"
+)
+
+// tunnelingState tracks the queries of a client for a registered domain during the window
+type tunnelingState struct {
+	start            int64
+	queries, txtNull int
+	uniqueBytes      int
+	subdomains       map[uint64]struct{}
+}
+
+type TunnelingTransform struct {
+	GenericTransformer
+	whitelistDomainsRegex []*regexp.Regexp
+	states                *expirable.LRU[string, *tunnelingState]
+}
+
+func NewTunnelingTransform(config *pkgconfig.ConfigTransformers, logger *logger.Logger, name string, instance int, nextWorkers []chan dnsutils.DNSMessage) *TunnelingTransform {
+	t := &TunnelingTransform{GenericTransformer: NewTransformer(config, logger, "tunneling", name, instance, nextWorkers)}
+	return t
+}
+
+func (t *TunnelingTransform) GetTransforms() ([]Subtransform, error) {
+	subtransforms := []Subtransform{}
+	if !t.config.Tunneling.Enable {
+		return subtransforms, nil
+	}
+	if t.config.Tunneling.Window <= 0 {
+		return nil, fmt.Errorf("invalid window value: %d", t.config.Tunneling.Window)
+	}
+	if t.config.Tunneling.CacheSize <= 0 {
+		return nil, fmt.Errorf("invalid cache-size value: %d", t.config.Tunneling.CacheSize)
+	}
+
+	t.whitelistDomainsRegex = t.whitelistDomainsRegex[:0]
+	for _, v := range t.config.Tunneling.WhitelistDomains {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid whitelist domain regex %q: %w", v, err)
+		}
+		t.whitelistDomainsRegex = append(t.whitelistDomainsRegex, re)
+	}
+	t.states = expirable.NewLRU[string, *tunnelingState](t.config.Tunneling.CacheSize, nil, time.Duration(t.config.Tunneling.Window)*time.Second)
+
+	subtransforms = append(subtransforms, Subtransform{name: "tunneling:detect", processFunc: t.detectTunneling})
+	return subtransforms, nil
+}
+
+func (t *TunnelingTransform) Reset() {
+	if t.states != nil {
+		t.states.Purge()
+	}
+}
+
+// labelsEntropy returns the shannon entropy of the characters of the subdomain, dots excluded
+func labelsEntropy(subdomain string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, c := range subdomain {
+		if c == '.' {
+			continue
+		}
+		counts[c]++
+		n++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func (t *TunnelingTransform) detectTunneling(dm *dnsutils.DNSMessage) (int, error) {
+	qname := strings.TrimSuffix(strings.ToLower(dm.DNS.Qname), ".")
+	if qname == "-" || len(qname) == 0 {
+		return ReturnKeep, nil
+	}
+
+	// ignore some domains ?
+	for _, d := range t.whitelistDomainsRegex {
+		if d.MatchString(qname) {
+			return ReturnKeep, nil
+		}
+	}
+
+	// split the query name between the registered domain and the subdomain
+	domain := qname
+	if dm.PublicSuffix != nil && dm.PublicSuffix.QnameEffectiveTLDPlusOne != "-" {
+		domain = dm.PublicSuffix.QnameEffectiveTLDPlusOne
+	} else if etldPlusOne, err := publicsuffixlist.EffectiveTLDPlusOne(qname); err == nil {
+		domain = etldPlusOne
+	}
+	subdomain := strings.TrimSuffix(strings.TrimSuffix(qname, domain), ".")
+
+	// the state is tracked per client and per registered domain
+	key := dm.NetworkInfo.QueryIP + "|" + domain
+	ts := dm.DNSTap.Timestamp
+	if ts <= 0 {
+		ts = time.Now().UnixNano()
+	}
+	state, ok := t.states.Get(key)
+	if !ok || ts-state.start >= int64(t.config.Tunneling.Window)*int64(time.Second) {
+		state = &tunnelingState{start: ts, subdomains: make(map[uint64]struct{})}
+	}
+	t.states.Add(key, state)
+
+	// the replies are not counted, a resolved query is seen twice
+	if dm.DNS.Type == dnsutils.DNSQuery || dm.DNS.Type == dnsutils.DNSQueryQuiet {
+		state.queries++
+		if dm.DNS.Qtype == "TXT" || dm.DNS.Qtype == "NULL" {
+			state.txtNull++
+		}
+	}
+	if len(subdomain) > 0 {
+		h := fnv.New64a()
+		h.Write([]byte(subdomain))
+		hash := h.Sum64()
+		if _, seen := state.subdomains[hash]; !seen {
+			state.uniqueBytes += len(subdomain)
+			if len(state.subdomains) < tunnelingMaxSubdomains {
+				state.subdomains[hash] = struct{}{}
+			}
+		}
+	}
+
+	tunneling := &dnsutils.TransformTunneling{
+		Domain:      domain,
+		UniqueBytes: state.uniqueBytes,
+		Reasons:     []string{},
+	}
+	if len(subdomain) >= tunnelingMinEntropyLen {
+		tunneling.Entropy = labelsEntropy(subdomain)
+	}
+
+	// volume of data encoded in the subdomains
+	if state.uniqueBytes > t.config.Tunneling.ThresholdUniqueBytes {
+		tunneling.Score += 1.0
+		tunneling.Reasons = append(tunneling.Reasons, TunnelingReasonUniqueBytes)
+	}
+
+	// random looking subdomain
+	if tunneling.Entropy > t.config.Tunneling.ThresholdEntropy {
+		tunneling.Score += 1.0
+		tunneling.Reasons = append(tunneling.Reasons, TunnelingReasonEntropy)
+	}
+
+	// TXT and NULL records carry the data of the replies
+	if state.queries >= t.config.Tunneling.MinQueries &&
+		float64(state.txtNull)/float64(state.queries) > t.config.Tunneling.ThresholdTxtNullRatio {
+		tunneling.Score += 1.0
+		tunneling.Reasons = append(tunneling.Reasons, TunnelingReasonTxtNull)
+	}
+
+	dm.Tunneling = tunneling
+	return ReturnKeep, nil
+}
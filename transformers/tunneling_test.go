@@ -0,0 +1,131 @@
+package transformers
+
+import (
+	"encoding/base32"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func TestTunneling_Detect(t *testing.T) {
+	// enable feature
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Tunneling.Enable = true
+	config.Tunneling.ThresholdUniqueBytes = 1000
+
+	outChans := []chan dnsutils.DNSMessage{}
+	tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, outChans)
+	tunneling.GetTransforms()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	send := func(queryIP, qname, qtype string, offset time.Duration) dnsutils.DNSMessage {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.NetworkInfo.QueryIP = queryIP
+		dm.DNS.Qname = qname
+		dm.DNS.Qtype = qtype
+		dm.DNSTap.Timestamp = start + int64(offset)
+		tunneling.detectTunneling(&dm)
+		return dm
+	}
+
+	// normal traffic
+	var dm dnsutils.DNSMessage
+	for i := 0; i < 20; i++ {
+		dm = send("192.168.1.1", "www.google.com", "A", time.Duration(i)*time.Second)
+	}
+	if dm.Tunneling == nil {
+		t.Fatalf("tunneling should be not nil")
+	}
+	if dm.Tunneling.Score != 0 || dm.Tunneling.Domain != "google.com" || dm.Tunneling.UniqueBytes != 3 {
+		t.Errorf("unexpected tunneling detection: %+v", dm.Tunneling)
+	}
+
+	// data encoded in TXT queries
+	for i := 0; i < 40; i++ {
+		data := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(fmt.Sprintf("secret-document-chunk-%04d", i)))
+		dm = send("192.168.1.2", data+".t.example.com", "TXT", time.Duration(i)*time.Second)
+	}
+	if dm.Tunneling.Domain != "example.com" || dm.Tunneling.UniqueBytes <= 1000 {
+		t.Errorf("incorrect unique bytes: %+v", dm.Tunneling)
+	}
+	if dm.Tunneling.Score != 3 || len(dm.Tunneling.Reasons) != 3 {
+		t.Errorf("expected all reasons: %+v", dm.Tunneling)
+	}
+
+	// the window is reset
+	dm = send("192.168.1.2", "www.example.com", "A", time.Hour)
+	if dm.Tunneling.Score != 0 || dm.Tunneling.UniqueBytes != 3 {
+		t.Errorf("unexpected tunneling detection after the window: %+v", dm.Tunneling)
+	}
+
+	// whitelisted domains are ignored
+	dm = send("192.168.1.2", "1.0.168.192.in-addr.arpa", "PTR", time.Hour)
+	if dm.Tunneling != nil {
+		t.Errorf("whitelisted domain should be ignored: %+v", dm.Tunneling)
+	}
+}
+
+func TestTunneling_Entropy(t *testing.T) {
+	if e := labelsEntropy("aaaa.aaaa"); e != 0 {
+		t.Errorf("unexpected entropy: %f", e)
+	}
+	if e := labelsEntropy("abcdefgh"); e != 3 {
+		t.Errorf("unexpected entropy: %f", e)
+	}
+}
+
+func TestTunneling_RepliesNotCounted(t *testing.T) {
+	config := pkgconfig.GetFakeConfigTransformers()
+	config.Tunneling.Enable = true
+	config.Tunneling.MinQueries = 2
+	config.Tunneling.ThresholdTxtNullRatio = 0.5
+
+	outChans := []chan dnsutils.DNSMessage{}
+	tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, outChans)
+	if _, err := tunneling.GetTransforms(); err != nil {
+		t.Fatal(err)
+	}
+
+	// one TXT query and its reply count as one query
+	var dm dnsutils.DNSMessage
+	for _, msgType := range []string{dnsutils.DNSQuery, dnsutils.DNSReply} {
+		dm = dnsutils.GetFakeDNSMessage()
+		dm.DNS.Type = msgType
+		dm.DNS.Qname = "www.example.com"
+		dm.DNS.Qtype = "TXT"
+		tunneling.detectTunneling(&dm)
+	}
+	state, _ := tunneling.states.Get(dm.NetworkInfo.QueryIP + "|example.com")
+	if state.queries != 1 || state.txtNull != 1 {
+		t.Errorf("want 1 query, got queries=%d txt-null=%d", state.queries, state.txtNull)
+	}
+	if dm.Tunneling.Score != 0 {
+		t.Errorf("min-queries not reached: %+v", dm.Tunneling)
+	}
+}
+
+func TestTunneling_InvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		window, cacheSize int
+	}{
+		{name: "window", window: 0, cacheSize: 10},
+		{name: "cache-size", window: 10, cacheSize: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := pkgconfig.GetFakeConfigTransformers()
+			config.Tunneling.Enable = true
+			config.Tunneling.Window = tc.window
+			config.Tunneling.CacheSize = tc.cacheSize
+
+			tunneling := NewTunnelingTransform(config, logger.New(false), "test", 0, []chan dnsutils.DNSMessage{})
+			if _, err := tunneling.GetTransforms(); err == nil {
+				t.Errorf("invalid %s should be rejected", tc.name)
+			}
+		})
+	}
+}
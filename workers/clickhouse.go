@@ -1,34 +1,67 @@
 package workers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-dnscollector/transformers"
 	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/grafana/dskit/backoff"
+)
+
+const (
+	// computed paths, the unix time in seconds and in nanoseconds sent as strings
+	ClickhouseTimestampUnix   = "dnstap.timestamp-unix"
+	ClickhouseTimestampUnixNs = "dnstap.timestamp-unixns"
 )
 
 var (
-	separator = "','"
+	// default columns, mapped to the json path of the dns message,
+	// the columns and values are the same as the previous versions
+	clickhouseDefaultColumns = map[string]string{
+		"identity":  "dnstap.identity",
+		"queryip":   "network.query-ip",
+		"qname":     "dns.qname",
+		"operation": "dnstap.operation",
+		"family":    "network.family",
+		"protocol":  "network.protocol",
+		"qtype":     "dns.qtype",
+		"rcode":     "dns.rcode",
+		"timensec":  ClickhouseTimestampUnixNs,
+		"timestamp": ClickhouseTimestampUnix,
+	}
+	clickhouseIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 )
 
-type ClickhouseData struct {
-	Identity  string `json:"identity"`
-	QueryIP   string `json:"query_ip"`
-	QName     string `json:"q_name"`
-	Operation string `json:"operation"`
-	Family    string `json:"family"`
-	Protocol  string `json:"protocol"`
-	QType     string `json:"q_type"`
-	RCode     string `json:"r_code"`
-	TimeNSec  string `json:"timensec"`
-	TimeStamp string `json:"timestamp"`
+// clickhouseBatch is sent with the url and the client used when the batch was encoded
+type clickhouseBatch struct {
+	url    string
+	client *http.Client
+	data   []byte
 }
 
 type ClickhouseClient struct {
 	*GenericWorker
+	columns       []string
+	paths         map[string]string
+	insertURL     string
+	httpClient    *http.Client
+	reloadLogging chan bool
 }
 
 func NewClickhouseClient(config *pkgconfig.Config, console *logger.Logger, name string) *ClickhouseClient {
@@ -37,18 +70,187 @@ func NewClickhouseClient(config *pkgconfig.Config, console *logger.Logger, name
 		bufSize = config.Loggers.ClickhouseClient.ChannelBufferSize
 	}
 	w := &ClickhouseClient{GenericWorker: NewGenericWorker(config, console, name, "clickhouse", bufSize, pkgconfig.DefaultMonitor)}
+	w.reloadLogging = make(chan bool)
 	w.ReadConfig()
 	return w
 }
 
+func (w *ClickhouseClient) ReadConfig() {
+	cfg := w.GetConfig().Loggers.ClickhouseClient
+
+	// columns mapping, sorted to get a stable insert statement
+	w.paths = cfg.Columns
+	if len(w.paths) == 0 {
+		w.paths = clickhouseDefaultColumns
+	}
+	w.columns = make([]string, 0, len(w.paths))
+	for column, path := range w.paths {
+		if !clickhouseIdentifier.MatchString(column) {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] clickhouse - invalid column name: ", column)
+		}
+		if len(path) == 0 {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] clickhouse - empty json path for column: ", column)
+		}
+		w.columns = append(w.columns, column)
+	}
+	sort.Strings(w.columns)
+
+	for _, name := range []string{cfg.Database, cfg.Table} {
+		if !clickhouseIdentifier.MatchString(name) {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] clickhouse - invalid database or table name: ", name)
+		}
+	}
+
+	// prepare the insert url, values are provided in the body
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] clickhouse - invalid url: ", err)
+	}
+	query := u.Query()
+	query.Set("query", fmt.Sprintf("INSERT INTO %s (%s) FORMAT JSONEachRow", w.tableName(), strings.Join(w.columns, ",")))
+	query.Set("date_time_input_format", "best_effort")
+	u.RawQuery = query.Encode()
+	w.insertURL = u.String()
+
+	// tls client config
+	tlsOptions := netutils.TLSOptions{
+		InsecureSkipVerify: cfg.TLSInsecure,
+		MinVersion:         cfg.TLSMinVersion,
+		CAFile:             cfg.CAFile,
+		CertFile:           cfg.CertFile,
+		KeyFile:            cfg.KeyFile,
+	}
+
+	tlsConfig, err := netutils.TLSClientConfig(tlsOptions)
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] clickhouse - tls config failed:", err)
+	}
+
+	// prepare http client
+	tr := &http.Transport{
+		MaxIdleConns:    10,
+		IdleConnTimeout: 30 * time.Second,
+		TLSClientConfig: tlsConfig,
+	}
+	w.httpClient = &http.Client{Transport: tr, Timeout: 30 * time.Second}
+}
+
+func (w *ClickhouseClient) tableName() string {
+	return w.GetConfig().Loggers.ClickhouseClient.Database + "." + w.GetConfig().Loggers.ClickhouseClient.Table
+}
+
+// CreateTableQuery returns the statement to create the table, the type of each column
+// is deduced from the json path in the dns message
+func (w *ClickhouseClient) CreateTableQuery() string {
+	dmType := reflect.TypeOf(dnsutils.DNSMessage{})
+
+	var columns []string
+	for _, column := range w.columns {
+		columns = append(columns, column+" "+clickhouseColumnType(dmType, w.paths[column]))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s) ENGINE = %s",
+		w.tableName(), strings.Join(columns, ", "), w.GetConfig().Loggers.ClickhouseClient.TableEngine)
+}
+
+// EncodeRow returns the values of the columns for the dns message, nested
+// structures, lists and maps are encoded as json strings
+func (w *ClickhouseClient) EncodeRow(dm *dnsutils.DNSMessage) map[string]interface{} {
+	dmValue := reflect.ValueOf(dm).Elem()
+
+	row := make(map[string]interface{}, len(w.columns))
+	for _, column := range w.columns {
+		switch w.paths[column] {
+		case ClickhouseTimestampUnix:
+			row[column] = strconv.Itoa(dm.DNSTap.TimeSec)
+			continue
+		case ClickhouseTimestampUnixNs:
+			row[column] = ""
+			if t, err := time.Parse(time.RFC3339, dm.DNSTap.TimestampRFC3339); err == nil {
+				row[column] = strconv.FormatInt(t.UnixNano(), 10)
+			}
+			continue
+		}
+
+		value, found := dnsutils.GetFieldByJSONTag(dmValue, w.paths[column])
+		if !found {
+			row[column] = nil
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			row[column] = value.Interface()
+		default:
+			data, err := json.Marshal(value.Interface())
+			if err != nil {
+				row[column] = nil
+				continue
+			}
+			row[column] = string(data)
+		}
+	}
+	return row
+}
+
+// clickhouseColumnType walks the struct type with the json path to find the clickhouse type
+func clickhouseColumnType(t reflect.Type, path string) string {
+	if path == "dnstap.timestamp-rfc3339ns" {
+		return "DateTime64(9, 'UTC')"
+	}
+
+	keys := strings.Split(path, ".")
+	for i := 0; i < len(keys); i++ {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			found := false
+			for f := 0; f < t.NumField(); f++ {
+				if strings.TrimSuffix(t.Field(f).Tag.Get("json"), ",omitempty") == keys[i] {
+					t = t.Field(f).Type
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "String"
+			}
+		case reflect.Slice:
+			// only an element selected by its index keeps its own type
+			if _, err := strconv.Atoi(keys[i]); err != nil {
+				return "String"
+			}
+			t = t.Elem()
+		default:
+			return "String"
+		}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "Bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "Int64"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "UInt64"
+	case reflect.Float32, reflect.Float64:
+		return "Float64"
+	default:
+		return "String"
+	}
+}
+
 func (w *ClickhouseClient) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -66,7 +268,8 @@ func (w *ClickhouseClient) StartCollect() {
 			// new config provided?
 		case cfg := <-w.NewConfig():
 			w.SetConfig(cfg)
-			w.ReadConfig()
+			// the columns and the url are used by the logging goroutine
+			w.reloadLogging <- true
 			subprocessors.ReloadConfig(&cfg.OutgoingTransformers)
 
 		case dm, opened := <-w.GetInputChannel():
@@ -83,7 +286,7 @@ func (w *ClickhouseClient) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -92,7 +295,7 @@ func (w *ClickhouseClient) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 
 		}
 	}
@@ -102,49 +305,144 @@ func (w *ClickhouseClient) StartLogging() {
 	w.LogInfo("logging has started")
 	defer w.LoggingDone()
 
+	// rows are encoded in the JSONEachRow format
+	buffer := bytes.NewBuffer(make([]byte, 0, w.GetConfig().Loggers.ClickhouseClient.BatchSize))
+	encoder := json.NewEncoder(buffer)
+
+	flushInterval := time.Duration(w.GetConfig().Loggers.ClickhouseClient.FlushInterval) * time.Second
+	flushTimer := time.NewTimer(flushInterval)
+
+	dataBuffer := make(chan clickhouseBatch, w.GetConfig().Loggers.ClickhouseClient.BatchChannelSize)
+	var createTable *clickhouseBatch
+	if w.GetConfig().Loggers.ClickhouseClient.CreateTable {
+		createTable = &clickhouseBatch{url: w.GetConfig().Loggers.ClickhouseClient.URL, client: w.httpClient, data: []byte(w.CreateTableQuery())}
+	}
+	go func() {
+		if createTable != nil {
+			if err := w.SendQuery(createTable.client, createTable.url, createTable.data); err != nil {
+				w.LogError("unable to create table: %v", err)
+			}
+		}
+
+		for batch := range dataBuffer {
+			if err := w.SendQuery(batch.client, batch.url, batch.data); err != nil {
+				w.LogError("error sending batch: %v", err)
+			}
+		}
+	}()
+
+	flushBatch := func(reason string) {
+		if buffer.Len() == 0 {
+			return
+		}
+		bufCopy := make([]byte, buffer.Len())
+		buffer.Read(bufCopy)
+		buffer.Reset()
+
+		select {
+		case dataBuffer <- clickhouseBatch{url: w.insertURL, client: w.httpClient, data: bufCopy}:
+		default:
+			w.LogWarning("%s, send buffer is full, batch dropped", reason)
+		}
+	}
+
 	for {
 		select {
 		case <-w.OnLoggerStopped():
+			flushBatch("logger stopped")
+			close(dataBuffer)
 			return
 
+			// the pending rows are sent with the previous columns before to apply the new config
+		case <-w.reloadLogging:
+			flushBatch("config reloaded")
+			w.ReadConfig()
+			flushInterval = time.Duration(w.GetConfig().Loggers.ClickhouseClient.FlushInterval) * time.Second
+
 			// incoming dns message to process
 		case dm, opened := <-w.GetOutputChannel():
 			if !opened {
 				w.LogInfo("output channel closed!")
 				return
 			}
-			t, err := time.Parse(time.RFC3339, dm.DNSTap.TimestampRFC3339)
-			timensec := ""
-			if err == nil {
-				timensec = strconv.Itoa(int(t.UnixNano()))
-			}
-			data := ClickhouseData{
-				Identity:  dm.DNSTap.Identity,
-				QueryIP:   dm.NetworkInfo.QueryIP,
-				QName:     dm.DNS.Qname,
-				Operation: dm.DNSTap.Operation,
-				Family:    dm.NetworkInfo.Family,
-				Protocol:  dm.NetworkInfo.Protocol,
-				QType:     dm.DNS.Qtype,
-				RCode:     dm.DNS.Rcode,
-				TimeNSec:  timensec,
-				TimeStamp: strconv.Itoa(int(int64(dm.DNSTap.TimeSec))),
+
+			// append the row to the batch
+			if err := encoder.Encode(w.EncodeRow(&dm)); err != nil {
+				w.LogError("encoding row failed: %v", err)
+				continue
 			}
-			url := w.GetConfig().Loggers.ClickhouseClient.URL + "?query=INSERT%20INTO%20"
-			url += w.GetConfig().Loggers.ClickhouseClient.Database + "." + w.GetConfig().Loggers.ClickhouseClient.Table
-			url += "(identity,queryip,qname,operation,family,protocol,qtype,rcode,timensec,timestamp)%20VALUES%20('" + data.Identity + separator
-			url += data.QueryIP + separator + data.QName + separator + data.Operation + separator + data.Family + separator + data.Protocol
-			url += separator + data.QType + separator + data.RCode + separator + data.TimeNSec + separator + data.TimeStamp + "')"
-			req, _ := http.NewRequest("POST", url, nil)
-
-			req.Header.Add("Accept", "*/*")
-			req.Header.Add("X-ClickHouse-User", w.GetConfig().Loggers.ClickhouseClient.User)
-			req.Header.Add("X-ClickHouse-Key", w.GetConfig().Loggers.ClickhouseClient.Password)
-
-			_, errReq := http.DefaultClient.Do(req)
-			if errReq != nil {
-				w.LogError(errReq.Error())
+
+			// send data and reset buffer
+			if buffer.Len() >= w.GetConfig().Loggers.ClickhouseClient.BatchSize {
+				flushBatch("batch size reached")
 			}
+
+		// flush the buffer every ?
+		case <-flushTimer.C:
+			flushBatch("automatic flush")
+
+			// restart timer
+			flushTimer.Reset(flushInterval)
+		}
+	}
+}
+
+// SendQuery posts the body to the server and retries with a backoff
+// on network errors, 429 and 5xx responses
+func (w *ClickhouseClient) SendQuery(client *http.Client, reqURL string, body []byte) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backoff := backoff.New(ctx, backoff.Config{
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 5 * time.Minute,
+	})
+
+	for attempt := 0; ; attempt++ {
+		retry, err := w.postQuery(ctx, client, reqURL, body)
+		if err == nil {
+			return nil
 		}
+		if !retry || attempt >= w.GetConfig().Loggers.ClickhouseClient.MaxRetries {
+			return err
+		}
+		w.LogWarning("%v, retry %d/%d", err, attempt+1, w.GetConfig().Loggers.ClickhouseClient.MaxRetries)
+
+		// wait before retry
+		backoff.Wait()
+	}
+}
+
+func (w *ClickhouseClient) postQuery(ctx context.Context, client *http.Client, reqURL string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", w.GetConfig().GetServerIdentity())
+	if w.GetConfig().Loggers.ClickhouseClient.BasicAuthEnabled {
+		req.SetBasicAuth(w.GetConfig().Loggers.ClickhouseClient.User, w.GetConfig().Loggers.ClickhouseClient.Password)
+	} else {
+		req.Header.Set("X-ClickHouse-User", w.GetConfig().Loggers.ClickhouseClient.User)
+		req.Header.Set("X-ClickHouse-Key", w.GetConfig().Loggers.ClickhouseClient.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	// read the first line of the exception returned by the server
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1024))
+	line := ""
+	if scanner.Scan() {
+		line = scanner.Text()
 	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	return retry, fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
 }
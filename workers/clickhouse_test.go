@@ -1,67 +1,210 @@
 package workers
 
 import (
-	"bufio"
-	"net"
+	"encoding/json"
+	"io"
 	"net/http"
-	"regexp"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
 )
 
-func Test_ClickhouseClient(t *testing.T) {
+type clickhouseRequest struct {
+	query string
+	body  string
+	user  string
+}
+
+func newFakeClickhouse(t *testing.T, statusCodes ...int) (*httptest.Server, chan clickhouseRequest) {
+	requests := make(chan clickhouseRequest, 10)
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		user, _, _ := r.BasicAuth()
+		if user == "" {
+			user = r.Header.Get("X-ClickHouse-User")
+		}
+
+		mu.Lock()
+		status := http.StatusOK
+		if len(statusCodes) > 0 {
+			status, statusCodes = statusCodes[0], statusCodes[1:]
+		}
+		mu.Unlock()
 
-	testcases := []struct {
-		mode    string
-		pattern string
-	}{
-		{
-			mode:    pkgconfig.ModeJSON,
-			pattern: pkgconfig.ProgQname,
-		},
+		rw.WriteHeader(status)
+		requests <- clickhouseRequest{query: r.URL.Query().Get("query"), body: string(body), user: user}
+	}))
+	return server, requests
+}
+
+func waitClickhouseRequest(t *testing.T, requests chan clickhouseRequest) clickhouseRequest {
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received by clickhouse")
 	}
+	return clickhouseRequest{}
+}
+
+func Test_ClickhouseClient(t *testing.T) {
+	server, requests := newFakeClickhouse(t)
+	defer server.Close()
+
 	cfg := pkgconfig.GetDefaultConfig()
-	cfg.Loggers.ClickhouseClient.URL = "http://127.0.0.1:8123"
+	cfg.Loggers.ClickhouseClient.URL = server.URL
 	cfg.Loggers.ClickhouseClient.User = "default"
 	cfg.Loggers.ClickhouseClient.Password = "password"
 	cfg.Loggers.ClickhouseClient.Database = "database"
 	cfg.Loggers.ClickhouseClient.Table = "table"
-	fakeRcvr, err := net.Listen("tcp", "127.0.0.1:8123")
-	if err != nil {
+	cfg.Loggers.ClickhouseClient.FlushInterval = 1
+
+	g := NewClickhouseClient(cfg, logger.New(false), "test")
+	go g.StartCollect()
+
+	// qname with quotes must be escaped
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "dns.'collector\""
+	dm.DNSTap.TimeSec = 1700000000
+	dm.DNSTap.TimestampRFC3339 = "2023-11-14T22:13:20.000000123Z"
+	g.GetInputChannel() <- dm
+	g.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+
+	req := waitClickhouseRequest(t, requests)
+	if req.user != "default" {
+		t.Errorf("invalid user, got: %s", req.user)
+	}
+	wantQuery := "INSERT INTO database.table (family,identity,operation,protocol,qname,qtype,queryip,rcode,timensec,timestamp) FORMAT JSONEachRow"
+	if req.query != wantQuery {
+		t.Errorf("invalid query, want %s, got: %s", wantQuery, req.query)
+	}
+
+	// one row per message in the same batch
+	lines := strings.Split(strings.TrimSpace(req.body), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("two rows expected, got: %d", len(lines))
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row["qname"] != dm.DNS.Qname {
+		t.Errorf("invalid qname, want %s, got: %v", dm.DNS.Qname, row["qname"])
+	}
+
+	// the times are sent as strings like the previous versions
+	if row["timestamp"] != "1700000000" || row["timensec"] != "1700000000000000123" {
+		t.Errorf("invalid times, got: %v / %v", row["timestamp"], row["timensec"])
+	}
+}
+
+func Test_ClickhouseClient_ReloadConfig(t *testing.T) {
+	server, requests := newFakeClickhouse(t)
+	defer server.Close()
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.ClickhouseClient.URL = server.URL
+	cfg.Loggers.ClickhouseClient.FlushInterval = 3600
+	cfg.Loggers.ClickhouseClient.BatchSize = 1
+
+	g := NewClickhouseClient(cfg, logger.New(false), "test")
+	go g.StartCollect()
+
+	// the new columns are applied by the logging goroutine
+	newCfg := pkgconfig.GetDefaultConfig()
+	newCfg.Loggers.ClickhouseClient.URL = server.URL
+	newCfg.Loggers.ClickhouseClient.FlushInterval = 3600
+	newCfg.Loggers.ClickhouseClient.BatchSize = 1
+	newCfg.Loggers.ClickhouseClient.Columns = map[string]string{"qname": "dns.qname"}
+	g.SetConfig(newCfg)
+	g.reloadLogging <- true
+
+	g.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+
+	req := waitClickhouseRequest(t, requests)
+	wantQuery := "INSERT INTO dnscollector.records (qname) FORMAT JSONEachRow"
+	if req.query != wantQuery {
+		t.Errorf("invalid query, want %s, got: %s", wantQuery, req.query)
+	}
+}
+
+func Test_ClickhouseClient_BatchSize(t *testing.T) {
+	server, requests := newFakeClickhouse(t)
+	defer server.Close()
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.ClickhouseClient.URL = server.URL
+	cfg.Loggers.ClickhouseClient.FlushInterval = 3600
+	cfg.Loggers.ClickhouseClient.BatchSize = 1
+	cfg.Loggers.ClickhouseClient.Columns = map[string]string{"qname": "dns.qname"}
+
+	g := NewClickhouseClient(cfg, logger.New(false), "test")
+	go g.StartCollect()
+
+	g.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+
+	req := waitClickhouseRequest(t, requests)
+	if req.body != "{\"qname\":\""+pkgconfig.ProgQname+"\"}\n" {
+		t.Errorf("invalid row, got: %s", req.body)
+	}
+}
+
+func Test_ClickhouseClient_CreateTableAndRetry(t *testing.T) {
+	// the first insert fails with a server error
+	server, requests := newFakeClickhouse(t, http.StatusOK, http.StatusServiceUnavailable, http.StatusOK)
+	defer server.Close()
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.ClickhouseClient.URL = server.URL
+	cfg.Loggers.ClickhouseClient.FlushInterval = 1
+	cfg.Loggers.ClickhouseClient.CreateTable = true
+	cfg.Loggers.ClickhouseClient.BasicAuthEnabled = true
+	cfg.Loggers.ClickhouseClient.User = "admin"
+	cfg.Loggers.ClickhouseClient.Columns = map[string]string{
+		"qname":   "dns.qname",
+		"length":  "dns.length",
+		"latency": "dnstap.latency",
+		"ts":      "dnstap.timestamp-rfc3339ns",
+		"answers": "dns.resource-records.an",
+	}
+
+	g := NewClickhouseClient(cfg, logger.New(false), "test")
+	go g.StartCollect()
+
+	// table creation
+	req := waitClickhouseRequest(t, requests)
+	wantCreate := "CREATE TABLE IF NOT EXISTS dnscollector.records (answers String, latency Float64, length Int64, qname String, ts DateTime64(9, 'UTC')) ENGINE = MergeTree ORDER BY tuple()"
+	if req.body != wantCreate {
+		t.Errorf("invalid create statement, want %s, got: %s", wantCreate, req.body)
+	}
+	if req.user != "admin" {
+		t.Errorf("basic auth expected, got user: %s", req.user)
+	}
+
+	g.GetInputChannel() <- dnsutils.GetFakeDNSMessage()
+
+	// failed insert, then retried
+	first := waitClickhouseRequest(t, requests)
+	second := waitClickhouseRequest(t, requests)
+	if first.body != second.body || !strings.HasPrefix(second.query, "INSERT INTO dnscollector.records") {
+		t.Errorf("the same batch should be retried, got: %s / %s", first.body, second.body)
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(second.body), &row); err != nil {
 		t.Fatal(err)
 	}
-	defer fakeRcvr.Close()
-
-	for _, tc := range testcases {
-		t.Run(tc.mode, func(t *testing.T) {
-			g := NewClickhouseClient(cfg, logger.New(false), "test")
-
-			go g.StartCollect()
-
-			dm := dnsutils.GetFakeDNSMessage()
-			g.GetInputChannel() <- dm
-			// accept conn
-			conn, err := fakeRcvr.Accept()
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer conn.Close()
-
-			// read and parse http request on server side
-			request, err := http.ReadRequest(bufio.NewReader(conn))
-			if err != nil {
-				t.Fatal(err)
-			}
-			query := request.URL.Query().Get("query")
-			conn.Write([]byte(pkgconfig.HTTPOK))
-
-			pattern := regexp.MustCompile(tc.pattern)
-			if !pattern.MatchString(query) {
-				t.Errorf("clickhouse test error want %s, got: %s", tc.pattern, query)
-			}
-		})
+	if _, ok := row["answers"].(string); !ok {
+		t.Errorf("answers should be encoded as a json string, got: %v", row["answers"])
 	}
 }
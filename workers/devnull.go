@@ -29,6 +29,11 @@ func (w *DevNull) StartCollect() {
 		case <-w.OnStop():
 			return
 
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.ReadConfig()
+
 		case _, opened := <-w.GetInputChannel():
 			if !opened {
 				w.LogInfo("run: input channel closed!")
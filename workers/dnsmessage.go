@@ -43,7 +43,7 @@ func NewDNSMessage(next []Worker, config *pkgconfig.Config, logger *logger.Logge
 	return s
 }
 
-func (w *DNSMessage) ReadConfigMatching(value interface{}) {
+func (w *GenericWorker) ReadConfigMatching(value interface{}) {
 	reflectedValue := reflect.ValueOf(value)
 	if reflectedValue.Kind() == reflect.Map {
 		keys := reflectedValue.MapKeys()
@@ -64,10 +64,10 @@ func (w *DNSMessage) ReadConfigMatching(value interface{}) {
 				w.LogFatal(err)
 			}
 			if len(sourceData.regexList) > 0 {
-				value.(map[interface{}]interface{})[srcKind] = sourceData.regexList
+				reflectedValue.SetMapIndex(reflect.ValueOf(srcKind), reflect.ValueOf(sourceData.regexList))
 			}
 			if len(sourceData.stringList) > 0 {
-				value.(map[interface{}]interface{})[srcKind] = sourceData.stringList
+				reflectedValue.SetMapIndex(reflect.ValueOf(srcKind), reflect.ValueOf(sourceData.stringList))
 			}
 		}
 	}
@@ -88,7 +88,7 @@ func (w *DNSMessage) ReadConfig() {
 	}
 }
 
-func (w *DNSMessage) LoadData(matchSource string, srcKind string) (MatchSource, error) {
+func (w *GenericWorker) LoadData(matchSource string, srcKind string) (MatchSource, error) {
 	if isFileSource(matchSource) {
 		dataSource, err := w.LoadFromFile(matchSource, srcKind)
 		if err != nil {
@@ -105,7 +105,7 @@ func (w *DNSMessage) LoadData(matchSource string, srcKind string) (MatchSource,
 	return MatchSource{}, fmt.Errorf("match source not supported %s", matchSource)
 }
 
-func (w *DNSMessage) LoadFromURL(matchSource string, srcKind string) (MatchSource, error) {
+func (w *GenericWorker) LoadFromURL(matchSource string, srcKind string) (MatchSource, error) {
 	w.LogInfo("loading matching source from url=%s", matchSource)
 	resp, err := http.Get(matchSource)
 	if err != nil {
@@ -136,7 +136,7 @@ func (w *DNSMessage) LoadFromURL(matchSource string, srcKind string) (MatchSourc
 	return matchSources, nil
 }
 
-func (w *DNSMessage) LoadFromFile(filePath string, srcKind string) (MatchSource, error) {
+func (w *GenericWorker) LoadFromFile(filePath string, srcKind string) (MatchSource, error) {
 	localFile := strings.TrimPrefix(filePath, "file://")
 
 	w.LogInfo("loading matching source from file=%s", localFile)
@@ -164,15 +164,35 @@ func (w *DNSMessage) LoadFromFile(filePath string, srcKind string) (MatchSource,
 	return matchSources, nil
 }
 
+// MatchDNSMessage returns true when the dns message matches all the include conditions
+// and none of the exclude conditions, empty conditions are ignored
+func MatchDNSMessage(dm *dnsutils.DNSMessage, include, exclude map[string]interface{}) (bool, error) {
+	matched := true
+
+	if len(include) > 0 {
+		err, matchedInclude := dm.Matching(include)
+		if err != nil {
+			return false, err
+		}
+		matched = matchedInclude
+	}
+
+	if matched && len(exclude) > 0 {
+		err, matchedExclude := dm.Matching(exclude)
+		if err != nil {
+			return matched, err
+		}
+		matched = !matchedExclude
+	}
+	return matched, nil
+}
+
 func (w *DNSMessage) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	var err error
-
 	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
 
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
@@ -199,32 +219,9 @@ func (w *DNSMessage) StartCollect() {
 			w.CountIngressTraffic()
 
 			// matching enabled, filtering DNS messages ?
-			matched := true
-			matchedInclude := false
-			matchedExclude := false
-
-			if len(w.GetConfig().Collectors.DNSMessage.Matching.Include) > 0 {
-				err, matchedInclude = dm.Matching(w.GetConfig().Collectors.DNSMessage.Matching.Include)
-				if err != nil {
-					w.LogError(err.Error())
-				}
-				if matched && matchedInclude {
-					matched = true
-				} else {
-					matched = false
-				}
-			}
-
-			if len(w.GetConfig().Collectors.DNSMessage.Matching.Exclude) > 0 {
-				err, matchedExclude = dm.Matching(w.GetConfig().Collectors.DNSMessage.Matching.Exclude)
-				if err != nil {
-					w.LogError(err.Error())
-				}
-				if matched && !matchedExclude {
-					matched = true
-				} else {
-					matched = false
-				}
+			matched, err := MatchDNSMessage(&dm, w.GetConfig().Collectors.DNSMessage.Matching.Include, w.GetConfig().Collectors.DNSMessage.Matching.Exclude)
+			if err != nil {
+				w.LogError(err.Error())
 			}
 
 			// count output packets
@@ -238,19 +235,19 @@ func (w *DNSMessage) StartCollect() {
 					w.LogError(err.Error())
 				}
 				if transformResult == transformers.ReturnDrop {
-					w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+					w.SendDroppedTo(dm)
 					continue
 				}
 			}
 
 			// drop packet ?
 			if !matched {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
 			// send to next
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -53,6 +53,58 @@ func TestDnsMessage_RoutingPolicy(t *testing.T) {
 
 }
 
+func TestDnsMessage_ConditionalRouting(t *testing.T) {
+	// simulate next workers
+	nxdomain := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	suspicious := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	other := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+
+	config := pkgconfig.GetDefaultConfig()
+	c := NewDNSMessage(nil, config, logger.New(false), "test")
+	c.SetDefaultRoutes([]Worker{other})
+	c.AddConditionalRoute(map[string]interface{}{"dns.rcode": "NXDOMAIN"}, nil, []Worker{nxdomain})
+	c.AddConditionalRoute(
+		map[string]interface{}{"dns.qname": "^evil"},
+		map[string]interface{}{"dns.qtype": "MX"},
+		[]Worker{suspicious},
+	)
+
+	go c.StartCollect()
+
+	for _, tc := range []struct{ qname, rcode, qtype string }{
+		{"dns.collector", "NXDOMAIN", "A"},
+		{"evil.collector", "NOERROR", "A"},
+		{"evil.collector", "NOERROR", "MX"},
+		{"evil.collector", "NXDOMAIN", "A"},
+	} {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname, dm.DNS.Rcode, dm.DNS.Qtype = tc.qname, tc.rcode, tc.qtype
+		c.GetInputChannel() <- dm
+	}
+
+	// a message matching several routes is sent to each of them
+	for _, want := range []string{"dns.collector", "evil.collector"} {
+		if dm := <-nxdomain.GetInputChannel(); dm.DNS.Qname != want {
+			t.Errorf("nxdomain route: want %s, got %s", want, dm.DNS.Qname)
+		}
+	}
+	for _, want := range []string{"A", "A"} {
+		if dm := <-suspicious.GetInputChannel(); dm.DNS.Qtype != want {
+			t.Errorf("suspicious route: want %s, got %s", want, dm.DNS.Qtype)
+		}
+	}
+
+	// the default route receives the messages not matched
+	if dm := <-other.GetInputChannel(); dm.DNS.Qtype != "MX" {
+		t.Errorf("default route: want the MX message, got %s", dm.DNS.Qtype)
+	}
+	select {
+	case dm := <-other.GetInputChannel():
+		t.Errorf("unexpected message on the default route: %v", dm.DNS.Qname)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 func TestDnsMessage_BufferLoggerIsFull(t *testing.T) {
 	// redirect stdout output to bytes buffer
 	logsChan := make(chan logger.LogEntry, 50)
@@ -11,6 +11,7 @@ import (
 
 type DNSProcessor struct {
 	*GenericWorker
+	rdataFields bool
 }
 
 func NewDNSProcessor(config *pkgconfig.Config, logger *logger.Logger, name string, size int) DNSProcessor {
@@ -18,13 +19,17 @@ func NewDNSProcessor(config *pkgconfig.Config, logger *logger.Logger, name strin
 	return w
 }
 
+// SetRdataFields enables the structured rdata, must be called before StartCollect
+func (w *DNSProcessor) SetRdataFields(enable bool) {
+	w.rdataFields = enable
+}
+
 func (w *DNSProcessor) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
 	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
 
 	// prepare enabled transformers
 	transforms := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
@@ -81,7 +86,7 @@ func (w *DNSProcessor) StartCollect() {
 				dm.DNSTap.Operation = dnsutils.DNSTapClientQuery
 			}
 
-			if err = dnsutils.DecodePayload(&dm, &dnsHeader, w.GetConfig()); err != nil {
+			if err = dnsutils.DecodePayloadWithRdataFields(&dm, &dnsHeader, w.GetConfig(), w.rdataFields); err != nil {
 				w.LogError("%v - %v", err, dm)
 			}
 
@@ -100,12 +105,12 @@ func (w *DNSProcessor) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
 			// dispatch dns message to all generators
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
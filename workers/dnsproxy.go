@@ -0,0 +1,345 @@
+package workers
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/miekg/dns"
+)
+
+type DNSProxy struct {
+	*GenericWorker
+	dnsProcessor DNSProcessor
+}
+
+func NewDNSProxy(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *DNSProxy {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Collectors.DNSProxy.ChannelBufferSize > 0 {
+		bufSize = config.Collectors.DNSProxy.ChannelBufferSize
+	}
+	w := &DNSProxy{GenericWorker: NewGenericWorker(config, logger, name, "dnsproxy", bufSize, pkgconfig.DefaultMonitor)}
+	w.SetDefaultRoutes(next)
+	w.CheckConfig()
+	return w
+}
+
+func (w *DNSProxy) CheckConfig() {
+	cfg := w.GetConfig().Collectors.DNSProxy
+	if !netutils.IsValidTLS(cfg.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] invalid tls min version")
+	}
+	switch cfg.UpstreamTransport {
+	case netutils.SocketUDP, netutils.SocketTCP, netutils.SocketTLS:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] invalid upstream transport: " + cfg.UpstreamTransport)
+	}
+}
+
+// Exchange forwards the raw DNS query to the upstream resolver and returns the raw reply.
+func (w *DNSProxy) Exchange(query []byte) ([]byte, error) {
+	cfg := w.GetConfig().Collectors.DNSProxy
+	address := net.JoinHostPort(cfg.UpstreamAddress, strconv.Itoa(cfg.UpstreamPort))
+	timeout := time.Duration(cfg.UpstreamTimeout) * time.Second
+
+	var conn net.Conn
+	var err error
+	switch cfg.UpstreamTransport {
+	case netutils.SocketTLS:
+		var tlsConfig *tls.Config
+		tlsConfig, err = netutils.TLSClientConfig(netutils.TLSOptions{
+			InsecureSkipVerify: cfg.UpstreamTLSInsecure,
+			MinVersion:         cfg.TLSMinVersion,
+			CAFile:             cfg.UpstreamCAFile,
+		})
+		if err == nil {
+			dialer := &net.Dialer{Timeout: timeout}
+			conn, err = tls.DialWithDialer(dialer, netutils.SocketTCP, address, tlsConfig)
+		}
+	default:
+		conn, err = net.DialTimeout(cfg.UpstreamTransport, address, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// udp, one datagram in each direction
+	if cfg.UpstreamTransport == netutils.SocketUDP {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, dns.MaxMsgSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	// stream based, messages are prefixed with a two bytes length field
+	if err := writeStreamMessage(conn, query); err != nil {
+		return nil, err
+	}
+	return readStreamMessage(conn)
+}
+
+func (w *DNSProxy) HandlePacket(conn net.PacketConn, query []byte, peer net.Addr) {
+	reply := w.Forward(query, peer, conn.LocalAddr(), netutils.ProtoUDP)
+	if reply == nil {
+		return
+	}
+	if _, err := conn.WriteTo(reply, peer); err != nil {
+		w.LogError("udp - unable to send reply to %s: %s", peer, err)
+	}
+}
+
+func (w *DNSProxy) HandleConn(conn net.Conn, protocol string, forceClose chan bool, wg *sync.WaitGroup) {
+	// close connection on function exit
+	defer func() {
+		netutils.Close(conn, w.GetConfig().Collectors.DNSProxy.ResetConn)
+		wg.Done()
+	}()
+
+	cleanup := make(chan struct{})
+	defer close(cleanup)
+
+	// goroutine to close the connection properly
+	go func() {
+		select {
+		case <-forceClose:
+			netutils.Close(conn, w.GetConfig().Collectors.DNSProxy.ResetConn)
+		case <-cleanup:
+		}
+	}()
+
+	for {
+		query, err := readStreamMessage(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				w.LogError("%s - read error with peer %s: %s", protocol, conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		reply := w.Forward(query, conn.RemoteAddr(), conn.LocalAddr(), protocol)
+		if reply == nil {
+			return
+		}
+		if err := writeStreamMessage(conn, reply); err != nil {
+			w.LogError("%s - unable to send reply to %s: %s", protocol, conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Forward logs the query, relays it to the upstream resolver and logs the reply.
+// A SERVFAIL is built and returned to the client when the upstream does not answer.
+func (w *DNSProxy) Forward(query []byte, client net.Addr, local net.Addr, protocol string) []byte {
+	tsQuery := time.Now()
+	w.dnsProcessor.GetInputChannel() <- w.NewDNSMessage(query, client, local, protocol, tsQuery)
+
+	reply, err := w.Exchange(query)
+	if err != nil {
+		w.LogError("upstream exchange failed: %s", err)
+		reply = NewServfailReply(query)
+		if reply == nil {
+			return nil
+		}
+	}
+	tsReply := time.Now()
+
+	// the dns processor swaps the addresses of replies, as for sniffed packets
+	dm := w.NewDNSMessage(reply, local, client, protocol, tsReply)
+	dm.DNSTap.Latency = tsReply.Sub(tsQuery).Seconds()
+	w.dnsProcessor.GetInputChannel() <- dm
+
+	return reply
+}
+
+func (w *DNSProxy) NewDNSMessage(payload []byte, src net.Addr, dst net.Addr, protocol string, ts time.Time) dnsutils.DNSMessage {
+	dm := dnsutils.DNSMessage{}
+	dm.Init()
+
+	srcIP, srcPort, _ := net.SplitHostPort(src.String())
+	dstIP, dstPort, _ := net.SplitHostPort(dst.String())
+
+	dm.NetworkInfo.Family = netutils.ProtoIPv4
+	if ip := net.ParseIP(srcIP); ip != nil && ip.To4() == nil {
+		dm.NetworkInfo.Family = netutils.ProtoIPv6
+	}
+	dm.NetworkInfo.Protocol = protocol
+	dm.NetworkInfo.QueryIP = srcIP
+	dm.NetworkInfo.QueryPort = srcPort
+	dm.NetworkInfo.ResponseIP = dstIP
+	dm.NetworkInfo.ResponsePort = dstPort
+
+	dm.DNS.Payload = payload
+	dm.DNS.Length = len(payload)
+
+	dm.DNSTap.Identity = w.GetConfig().GetServerIdentity()
+	dm.DNSTap.TimeSec = int(ts.Unix())
+	dm.DNSTap.TimeNsec = ts.Nanosecond()
+	return dm
+}
+
+func (w *DNSProxy) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	cfg := w.GetConfig().Collectors.DNSProxy
+
+	// init dns processor
+	bufSize := w.GetConfig().Global.Worker.ChannelBufferSize
+	if cfg.ChannelBufferSize > 0 {
+		bufSize = cfg.ChannelBufferSize
+	}
+	w.dnsProcessor = NewDNSProcessor(w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
+	w.dnsProcessor.ShareRouting(w.GenericWorker)
+	w.dnsProcessor.SetRdataFields(cfg.RdataFields)
+	go w.dnsProcessor.StartCollect()
+
+	var connWG sync.WaitGroup
+	connCleanup := make(chan bool)
+
+	// start to listen on udp
+	udpConn, err := net.ListenPacket(netutils.SocketUDP, net.JoinHostPort(cfg.ListenIP, strconv.Itoa(cfg.ListenPort)))
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] udp listening failed: ", err)
+	}
+	w.LogInfo("listening on udp/%s", udpConn.LocalAddr())
+
+	// and tcp
+	tcpListener, err := netutils.StartToListen(cfg.ListenIP, cfg.ListenPort, "", false, 0, "", "")
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] tcp listening failed: ", err)
+	}
+	w.LogInfo("listening on tcp/%s", tcpListener.Addr())
+	tcpChan := make(chan net.Conn)
+	netutils.AcceptConnections(tcpListener, tcpChan)
+
+	// and tls if enabled
+	var tlsListener net.Listener
+	tlsChan := make(chan net.Conn)
+	if cfg.TLSSupport {
+		tlsListener, err = netutils.StartToListen(
+			cfg.ListenIP, cfg.TLSListenPort, "",
+			true, netutils.TLSVersion[cfg.TLSMinVersion],
+			cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] tls listening failed: ", err)
+		}
+		w.LogInfo("listening on tls/%s", tlsListener.Addr())
+		netutils.AcceptConnections(tlsListener, tlsChan)
+	}
+
+	// goroutine to read udp datagrams
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, peer, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					w.LogError("udp - read error: %s", err)
+				}
+				return
+			}
+
+			// copy packet data from buffer
+			query := make([]byte, n)
+			copy(query, buf[:n])
+
+			connWG.Add(1)
+			go func() {
+				defer connWG.Done()
+				w.HandlePacket(udpConn, query, peer)
+			}()
+		}
+	}()
+
+	// main loop
+	for {
+		select {
+		case <-w.OnStop():
+			w.LogInfo("stop to listen...")
+			udpConn.Close()
+			tcpListener.Close()
+			if tlsListener != nil {
+				tlsListener.Close()
+			}
+
+			w.LogInfo("closing connected peers...")
+			close(connCleanup)
+			connWG.Wait()
+
+			w.dnsProcessor.Stop()
+			return
+
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.CheckConfig()
+			w.dnsProcessor.NewConfig() <- cfg
+
+		case conn, opened := <-tcpChan:
+			if !opened {
+				return
+			}
+			connWG.Add(1)
+			go w.HandleConn(conn, netutils.ProtoTCP, connCleanup, &connWG)
+
+		case conn, opened := <-tlsChan:
+			if !opened {
+				return
+			}
+			connWG.Add(1)
+			go w.HandleConn(conn, dnsutils.ProtoDoT, connCleanup, &connWG)
+		}
+	}
+}
+
+// NewServfailReply builds a SERVFAIL answer to the provided raw query, nil is returned
+// if the query can not be decoded.
+func NewServfailReply(query []byte) []byte {
+	req := new(dns.Msg)
+	if err := req.Unpack(query); err != nil {
+		return nil
+	}
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeServerFailure)
+	reply, err := m.Pack()
+	if err != nil {
+		return nil
+	}
+	return reply
+}
+
+func readStreamMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeStreamMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
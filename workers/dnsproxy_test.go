@@ -0,0 +1,125 @@
+package workers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/miekg/dns"
+)
+
+func Test_DNSProxy_Forward(t *testing.T) {
+	testcases := []struct {
+		name      string
+		transport string
+		listen    int
+		upstream  int
+	}{
+		{name: "udp", transport: netutils.SocketUDP, listen: 15300, upstream: 15301},
+		{name: "tcp", transport: netutils.SocketTCP, listen: 15302, upstream: 15303},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// fake upstream resolver
+			upstream := &dns.Server{Addr: "127.0.0.1:" + strconv.Itoa(tc.upstream), Net: tc.transport}
+			upstream.Handler = dns.HandlerFunc(func(rw dns.ResponseWriter, r *dns.Msg) {
+				m := new(dns.Msg)
+				m.SetReply(r)
+				rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN A 127.0.0.1")
+				m.Answer = append(m.Answer, rr)
+				rw.WriteMsg(m)
+			})
+			go upstream.ListenAndServe()
+			defer upstream.Shutdown()
+
+			// init the proxy
+			g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+			config := pkgconfig.GetDefaultConfig()
+			config.Collectors.DNSProxy.ListenIP = "127.0.0.1"
+			config.Collectors.DNSProxy.ListenPort = tc.listen
+			config.Collectors.DNSProxy.UpstreamPort = tc.upstream
+			config.Collectors.DNSProxy.UpstreamTransport = tc.transport
+
+			c := NewDNSProxy([]Worker{g}, config, logger.New(false), "test")
+			go c.StartCollect()
+			time.Sleep(1 * time.Second)
+
+			// send query to the proxy
+			m := new(dns.Msg)
+			m.SetQuestion(pkgconfig.ValidDomain, dns.TypeA)
+			client := &dns.Client{Net: tc.transport, Timeout: 2 * time.Second}
+			r, _, err := client.Exchange(m, "127.0.0.1:"+strconv.Itoa(tc.listen))
+			if err != nil {
+				t.Fatalf("exchange error: %s", err)
+			}
+			if len(r.Answer) != 1 {
+				t.Errorf("invalid number of answers: %d", len(r.Answer))
+			}
+
+			// read the query and the reply
+			query := <-g.GetInputChannel()
+			if query.DNS.Type != dnsutils.DNSQuery {
+				t.Errorf("dns query expected, got %s", query.DNS.Type)
+			}
+			if query.DNS.Qname != pkgconfig.ExpectedQname {
+				t.Errorf("invalid qname: %s", query.DNS.Qname)
+			}
+			if query.NetworkInfo.ResponsePort != strconv.Itoa(tc.listen) {
+				t.Errorf("invalid response port: %s", query.NetworkInfo.ResponsePort)
+			}
+
+			reply := <-g.GetInputChannel()
+			if reply.DNS.Type != dnsutils.DNSReply {
+				t.Errorf("dns reply expected, got %s", reply.DNS.Type)
+			}
+			if reply.NetworkInfo.QueryIP != query.NetworkInfo.QueryIP || reply.NetworkInfo.QueryPort != query.NetworkInfo.QueryPort {
+				t.Errorf("client address mismatch between query and reply")
+			}
+			if len(reply.DNS.DNSRRs.Answers) != 1 {
+				t.Errorf("invalid number of decoded answers: %d", len(reply.DNS.DNSRRs.Answers))
+			}
+			if reply.DNSTap.Latency <= 0 {
+				t.Errorf("latency should be measured")
+			}
+
+			c.Stop()
+		})
+	}
+}
+
+func Test_DNSProxy_UpstreamServfail(t *testing.T) {
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.DNSProxy.ListenIP = "127.0.0.1"
+	config.Collectors.DNSProxy.ListenPort = 15304
+	config.Collectors.DNSProxy.UpstreamPort = 15305
+	config.Collectors.DNSProxy.UpstreamTransport = netutils.SocketTCP
+
+	c := NewDNSProxy([]Worker{g}, config, logger.New(false), "test")
+	go c.StartCollect()
+	time.Sleep(1 * time.Second)
+
+	m := new(dns.Msg)
+	m.SetQuestion(pkgconfig.ValidDomain, dns.TypeA)
+	client := &dns.Client{Net: netutils.SocketUDP, Timeout: 5 * time.Second}
+	r, _, err := client.Exchange(m, "127.0.0.1:15304")
+	if err != nil {
+		t.Fatalf("exchange error: %s", err)
+	}
+	if r.Rcode != dns.RcodeServerFailure {
+		t.Errorf("servfail expected, got %s", dns.RcodeToString[r.Rcode])
+	}
+
+	<-g.GetInputChannel()
+	reply := <-g.GetInputChannel()
+	if reply.DNS.Rcode != dnsutils.DNSRcodeServFail {
+		t.Errorf("servfail expected in dns message, got %s", reply.DNS.Rcode)
+	}
+
+	c.Stop()
+}
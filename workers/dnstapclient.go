@@ -3,7 +3,11 @@ package workers
 import (
 	"bufio"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"strconv"
 	"time"
 
@@ -14,6 +18,7 @@ import (
 	"github.com/dmachard/go-logger"
 	"github.com/dmachard/go-netutils"
 	"github.com/segmentio/kafka-go/compress"
+	"golang.org/x/net/http2"
 )
 
 type DnstapSender struct {
@@ -22,7 +27,10 @@ type DnstapSender struct {
 	fsReady                            bool
 	transport                          string
 	transportConn                      net.Conn
+	transportWriter                    io.WriteCloser
 	transportReady, transportReconnect chan bool
+	spool                              *DiskSpool
+	udpSent, udpLost, udpLostReported  uint64
 }
 
 func NewDnstapSender(config *pkgconfig.Config, logger *logger.Logger, name string) *DnstapSender {
@@ -34,6 +42,7 @@ func NewDnstapSender(config *pkgconfig.Config, logger *logger.Logger, name strin
 	w.transportReady = make(chan bool)
 	w.transportReconnect = make(chan bool)
 	w.ReadConfig()
+	w.spool = NewWorkerSpool(w.GenericWorker, config.Loggers.DNSTap.Spool)
 	return w
 }
 
@@ -41,11 +50,13 @@ func (w *DnstapSender) ReadConfig() {
 	w.transport = w.GetConfig().Loggers.DNSTap.Transport
 
 	// begin backward compatibility
-	if w.GetConfig().Loggers.DNSTap.TLSSupport {
-		w.transport = netutils.SocketTLS
-	}
-	if len(w.GetConfig().Loggers.DNSTap.SockPath) > 0 {
-		w.transport = netutils.SocketUnix
+	if w.UseFramestream() {
+		if w.GetConfig().Loggers.DNSTap.TLSSupport {
+			w.transport = netutils.SocketTLS
+		}
+		if len(w.GetConfig().Loggers.DNSTap.SockPath) > 0 {
+			w.transport = netutils.SocketUnix
+		}
 	}
 	// end
 
@@ -59,7 +70,79 @@ func (w *DnstapSender) ReadConfig() {
 	}
 }
 
+// UseFramestream returns false for the udp and http2 transports, without control frames
+func (w *DnstapSender) UseFramestream() bool {
+	switch w.transport {
+	case DnstapTransportUDP, DnstapTransportHTTP2, DnstapTransportHTTP2TLS:
+		return false
+	}
+	return true
+}
+
+// OpenHTTP2Stream connects to the remote and returns the writer of the request body,
+// the writer fails once the stream is closed
+func (w *DnstapSender) OpenHTTP2Stream(address string, connTimeout time.Duration) (io.WriteCloser, error) {
+	dialer := &net.Dialer{Timeout: connTimeout}
+	scheme := "http"
+
+	var conn net.Conn
+	var err error
+	if w.transport == DnstapTransportHTTP2TLS {
+		scheme = "https"
+		tlsOptions := netutils.TLSOptions{
+			InsecureSkipVerify: w.GetConfig().Loggers.DNSTap.TLSInsecure, MinVersion: w.GetConfig().Loggers.DNSTap.TLSMinVersion,
+			CAFile: w.GetConfig().Loggers.DNSTap.CAFile, CertFile: w.GetConfig().Loggers.DNSTap.CertFile, KeyFile: w.GetConfig().Loggers.DNSTap.KeyFile,
+		}
+		var tlsConfig *tls.Config
+		tlsConfig, err = netutils.TLSClientConfig(tlsOptions)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+		conn, err = tls.DialWithDialer(dialer, netutils.SocketTCP, address, tlsConfig)
+	} else {
+		// http2 without tls, with prior knowledge
+		conn, err = dialer.Dial(netutils.SocketTCP, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clientConn, err := (&http2.Transport{AllowHTTP: true}).NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, scheme+"://"+address+DnstapHTTP2Path, reader)
+	if err != nil {
+		clientConn.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", DnstapContentType)
+
+	go func() {
+		resp, err := clientConn.RoundTrip(req)
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("stream closed by the remote: %s", resp.Status)
+		}
+		reader.CloseWithError(err)
+		clientConn.Close()
+	}()
+	return writer, nil
+}
+
 func (w *DnstapSender) Disconnect() {
+	if w.transportWriter != nil {
+		w.LogInfo("closing %s transport", w.transport)
+		w.transportWriter.Close()
+		w.LogInfo("closed")
+		return
+	}
+
 	if w.transportConn != nil {
 		// reset framestream and ignore errors
 		w.LogInfo("closing framestream")
@@ -78,6 +161,10 @@ func (w *DnstapSender) ConnectToRemote() {
 			w.transportConn.Close()
 			w.transportConn = nil
 		}
+		if w.transportWriter != nil {
+			w.transportWriter.Close()
+			w.transportWriter = nil
+		}
 
 		address := net.JoinHostPort(
 			w.GetConfig().Loggers.DNSTap.RemoteAddress,
@@ -87,6 +174,7 @@ func (w *DnstapSender) ConnectToRemote() {
 
 		// make the connection
 		var conn net.Conn
+		var stream io.WriteCloser
 		var err error
 
 		switch w.transport {
@@ -98,10 +186,14 @@ func (w *DnstapSender) ConnectToRemote() {
 			w.LogInfo("connecting to %s://%s", w.transport, address)
 			conn, err = net.DialTimeout(w.transport, address, connTimeout)
 
-		case netutils.SocketTCP:
+		case netutils.SocketTCP, DnstapTransportUDP:
 			w.LogInfo("connecting to %s://%s", w.transport, address)
 			conn, err = net.DialTimeout(w.transport, address, connTimeout)
 
+		case DnstapTransportHTTP2, DnstapTransportHTTP2TLS:
+			w.LogInfo("connecting to %s://%s", w.transport, address)
+			stream, err = w.OpenHTTP2Stream(address, connTimeout)
+
 		case netutils.SocketTLS:
 			w.LogInfo("connecting to %s://%s", w.transport, address)
 
@@ -129,7 +221,14 @@ func (w *DnstapSender) ConnectToRemote() {
 			continue
 		}
 
-		w.transportConn = conn
+		switch w.transport {
+		case DnstapTransportUDP:
+			w.transportWriter = conn
+		case DnstapTransportHTTP2, DnstapTransportHTTP2TLS:
+			w.transportWriter = stream
+		default:
+			w.transportConn = conn
+		}
 
 		// block until framestream is ready
 		w.transportReady <- true
@@ -139,26 +238,58 @@ func (w *DnstapSender) ConnectToRemote() {
 	}
 }
 
-func (w *DnstapSender) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+func (w *DnstapSender) EncodeMessage(dm *dnsutils.DNSMessage) ([]byte, error) {
+	// update identity ?
+	if w.GetConfig().Loggers.DNSTap.OverwriteIdentity {
+		dm.DNSTap.Identity = w.GetConfig().Loggers.DNSTap.ServerID
+	}
 
-	var data []byte
-	var err error
-	bulkFrame := &framestream.Frame{}
-	subFrame := &framestream.Frame{}
+	// encode dns message to dnstap protobuf binary
+	return dm.ToDNSTap(w.GetConfig().Loggers.DNSTap.ExtendedSupport)
+}
 
-	for _, dm := range *buf {
-		// update identity ?
-		if w.GetConfig().Loggers.DNSTap.OverwriteIdentity {
-			dm.DNSTap.Identity = w.GetConfig().Loggers.DNSTap.ServerID
+// WriteFrames sends one frame per datagram with the udp transport, the frames are lost on error,
+// or writes the frames in the http2 stream and the connection is restarted on error
+func (w *DnstapSender) WriteFrames(payloads [][]byte) (int, error) {
+	for i, data := range payloads {
+		frame := EncodeDnstapFrame(data)
+		if w.transport == DnstapTransportUDP {
+			if len(frame) > dnstapMaxDatagramSize {
+				w.udpLost++
+				w.CountTraffic(DnstapCounterUDPLost)
+				continue
+			}
+			if _, err := w.transportWriter.Write(frame); err != nil {
+				w.udpLost++
+				w.CountTraffic(DnstapCounterUDPLost)
+				continue
+			}
+			w.udpSent++
+			w.CountTraffic(DnstapCounterUDPSent)
+			continue
 		}
 
-		// encode dns message to dnstap protobuf binary
-		data, err = dm.ToDNSTap(w.GetConfig().Loggers.DNSTap.ExtendedSupport)
-		if err != nil {
-			w.LogError("failed to encode to DNStap protobuf: %s", err)
-			continue
+		if _, err := w.transportWriter.Write(frame); err != nil {
+			w.LogError("send frame error %s", err)
+			w.fsReady = false
+			<-w.transportReconnect
+			return i, err
 		}
+	}
+	return len(payloads), nil
+}
 
+// SendFrames sends the dnstap payloads and returns the number of payloads sent,
+// the connection is restarted on error
+func (w *DnstapSender) SendFrames(payloads [][]byte) (int, error) {
+	if !w.UseFramestream() {
+		return w.WriteFrames(payloads)
+	}
+
+	bulkFrame := &framestream.Frame{}
+	subFrame := &framestream.Frame{}
+
+	for i, data := range payloads {
 		if w.GetConfig().Loggers.DNSTap.Compression == pkgconfig.CompressNone {
 			// send the frame
 			bulkFrame.Write(data)
@@ -166,7 +297,7 @@ func (w *DnstapSender) FlushBuffer(buf *[]dnsutils.DNSMessage) {
 				w.LogError("send frame error %s", err)
 				w.fsReady = false
 				<-w.transportReconnect
-				break
+				return i, err
 			}
 		} else {
 			subFrame.Write(data)
@@ -180,21 +311,77 @@ func (w *DnstapSender) FlushBuffer(buf *[]dnsutils.DNSMessage) {
 			w.LogError("send bulk frame error %s", err)
 			w.fsReady = false
 			<-w.transportReconnect
+			return 0, err
+		}
+	}
+	return len(payloads), nil
+}
+
+func (w *DnstapSender) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+	var payloads [][]byte
+	for i := range *buf {
+		data, err := w.EncodeMessage(&(*buf)[i])
+		if err != nil {
+			w.LogError("failed to encode to DNStap protobuf: %s", err)
+			continue
 		}
+		payloads = append(payloads, data)
+	}
+
+	// keep the payloads not sent in the spool
+	if sent, err := w.SendFrames(payloads); err != nil {
+		w.SpoolPayloads(payloads[sent:])
 	}
 
 	// reset buffer
 	*buf = nil
 }
 
+// SpoolPayloads saves the dnstap payloads on disk until the connection is back
+func (w *DnstapSender) SpoolPayloads(payloads [][]byte) {
+	if w.spool == nil {
+		return
+	}
+	for _, payload := range payloads {
+		if err := w.spool.Write(payload); err != nil && !errors.Is(err, ErrSpoolFull) {
+			w.LogError("spool - %s", err)
+		}
+	}
+}
+
+// SpoolMessages encodes and saves the buffer in the spool, the buffer is reset
+func (w *DnstapSender) SpoolMessages(buf *[]dnsutils.DNSMessage) {
+	if w.spool != nil {
+		for i := range *buf {
+			data, err := w.EncodeMessage(&(*buf)[i])
+			if err != nil {
+				w.LogError("failed to encode to DNStap protobuf: %s", err)
+				continue
+			}
+			w.SpoolPayloads([][]byte{data})
+		}
+	}
+	*buf = nil
+}
+
+// ReplaySpool sends the dnstap payloads saved during the outage
+func (w *DnstapSender) ReplaySpool(maxBatches int) {
+	if w.spool == nil || !w.fsReady || !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.GetConfig().Loggers.DNSTap.Spool.ReplayBatch, maxBatches, func(records [][]byte) error {
+		_, err := w.SendFrames(records)
+		return err
+	})
+	if err != nil {
+		w.LogError("spool - replay failed: %s", err)
+	}
+}
+
 func (w *DnstapSender) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -232,7 +419,7 @@ func (w *DnstapSender) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -241,7 +428,7 @@ func (w *DnstapSender) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -261,13 +448,22 @@ func (w *DnstapSender) StartLogging() {
 	for {
 		select {
 		case <-w.OnLoggerStopped():
-			// closing remote connection if exist
+			// keep the buffer in the spool and closing remote connection if exist
+			w.SpoolMessages(&bufferDm)
+			if w.spool != nil {
+				w.spool.Close()
+			}
 			w.Disconnect()
 			return
 
 		// init framestream
 		case <-w.transportReady:
 			w.LogInfo("transport connected with success")
+			if !w.UseFramestream() {
+				w.fsReady = true
+				continue
+			}
+
 			// frame stream library
 			fsReader := bufio.NewReader(w.transportConn)
 			fsWriter := bufio.NewWriter(w.transportConn)
@@ -290,8 +486,15 @@ func (w *DnstapSender) StartLogging() {
 				return
 			}
 
-			// drop dns message if the connection is not ready to avoid memory leak or
-			// to block the channel
+			// save the message on disk while the connection is not ready or the spool
+			// is not fully replayed to keep the order, otherwise drop the dns message
+			// to avoid memory leak or to block the channel
+			if w.spool != nil && (!w.fsReady || w.spool.Pending()) {
+				bufferDm = append(bufferDm, dm)
+				w.SpoolMessages(&bufferDm)
+				w.ReplaySpool(1)
+				continue
+			}
 			if !w.fsReady {
 				continue
 			}
@@ -306,11 +509,29 @@ func (w *DnstapSender) StartLogging() {
 
 		// flush the buffer
 		case <-flushTimer.C:
+			if !w.fsReady {
+				w.SpoolMessages(&bufferDm)
+			}
+
 			// force to flush the buffer
 			if len(bufferDm) > 0 {
 				w.FlushBuffer(&bufferDm)
 			}
 
+			// the datagrams are not retransmitted
+			if w.udpLost > w.udpLostReported {
+				w.LogWarning("udp - %d frames sent, %d lost", w.udpSent, w.udpLost)
+				w.udpLostReported = w.udpLost
+			}
+
+			// replay dnstap payloads saved during the outage
+			w.ReplaySpool(0)
+			if w.spool != nil {
+				if dropped := w.spool.Dropped(); dropped > 0 {
+					w.LogWarning("spool is full, %d messages dropped", dropped)
+				}
+			}
+
 			// restart timer
 			flushTimer.Reset(flushInterval)
 		}
@@ -133,3 +133,75 @@ func Test_DnstapClient(t *testing.T) {
 		})
 	}
 }
+
+func Test_DnstapClient_UDP_HTTP2(t *testing.T) {
+	testcases := []struct {
+		name            string
+		serverTransport string
+		clientTransport string
+		port            int
+	}{
+		{
+			name:            "dnstap_udp",
+			serverTransport: DnstapTransportUDP,
+			clientTransport: DnstapTransportUDP,
+			port:            16014,
+		},
+		{
+			name:            "dnstap_http2",
+			serverTransport: DnstapTransportHTTP2,
+			clientTransport: DnstapTransportHTTP2,
+			port:            16015,
+		},
+		{
+			name:            "dnstap_http2_tls",
+			serverTransport: DnstapTransportHTTP2TLS,
+			clientTransport: DnstapTransportHTTP2TLS,
+			port:            16017,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			// start the collector
+			next := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+			cfgCollector := pkgconfig.GetDefaultConfig()
+			cfgCollector.Collectors.Dnstap.Transport = tc.serverTransport
+			cfgCollector.Collectors.Dnstap.ListenIP = "127.0.0.1"
+			cfgCollector.Collectors.Dnstap.ListenPort = tc.port
+			cfgCollector.Collectors.Dnstap.CertFile = "../tests/testsdata/certs/server.crt"
+			cfgCollector.Collectors.Dnstap.KeyFile = "../tests/testsdata/certs/server.key"
+			c := NewDnstapServer([]Worker{next}, cfgCollector, logger.New(false), "collector")
+			go c.StartCollect()
+			defer c.Stop()
+			time.Sleep(time.Second)
+
+			// start the logger
+			cfg := pkgconfig.GetDefaultConfig()
+			cfg.Loggers.DNSTap.Transport = tc.clientTransport
+			cfg.Loggers.DNSTap.RemoteAddress = "127.0.0.1"
+			cfg.Loggers.DNSTap.RemotePort = tc.port
+			cfg.Loggers.DNSTap.TLSInsecure = true
+			cfg.Loggers.DNSTap.FlushInterval = 1
+			cfg.Loggers.DNSTap.BufferSize = 0
+			g := NewDnstapSender(cfg, logger.New(false), "test")
+			go g.StartCollect()
+			defer g.Stop()
+			time.Sleep(time.Second)
+
+			// send fake dns message to logger
+			dm := dnsutils.GetFakeDNSMessage()
+			g.GetInputChannel() <- dm
+
+			// decoded by the collector ?
+			select {
+			case msg := <-next.GetInputChannel():
+				if msg.DNSTap.Identity != dm.DNSTap.Identity {
+					t.Errorf("want %s, got %s", dm.DNSTap.Identity, msg.DNSTap.Identity)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no message received by the collector")
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package workers
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"io"
 	"net"
+	"net/http"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -19,12 +21,16 @@ import (
 	"github.com/dmachard/go-logger"
 	"github.com/dmachard/go-netutils"
 	"github.com/segmentio/kafka-go/compress"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/protobuf/proto"
 )
 
 type DnstapServer struct {
 	*GenericWorker
-	connCounter uint64
+	connCounter                         uint64
+	udpReceived, udpInvalid, udpDropped uint64
+	http2Dropped                        uint64
 }
 
 func NewDnstapServer(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *DnstapServer {
@@ -42,6 +48,41 @@ func (w *DnstapServer) CheckConfig() {
 	if !netutils.IsValidTLS(w.GetConfig().Collectors.Dnstap.TLSMinVersion) {
 		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] dnstap - invalid tls min version")
 	}
+	switch w.GetConfig().Collectors.Dnstap.Transport {
+	case netutils.SocketTCP, DnstapTransportUDP, DnstapTransportHTTP2, DnstapTransportHTTP2TLS:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] dnstap - invalid transport: " + w.GetConfig().Collectors.Dnstap.Transport)
+	}
+	// tls is selected with the transport, like the dnstap logger
+	if w.GetConfig().Collectors.Dnstap.Transport == DnstapTransportHTTP2 && w.GetConfig().Collectors.Dnstap.TLSSupport {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] dnstap - tls-support not supported with http2, use the http2+tls transport")
+	}
+}
+
+// GetUDPCounters returns the number of datagrams received, invalid and dropped
+// because the dnstap processor is busy
+func (w *DnstapServer) GetUDPCounters() (uint64, uint64, uint64) {
+	return atomic.LoadUint64(&w.udpReceived), atomic.LoadUint64(&w.udpInvalid), atomic.LoadUint64(&w.udpDropped)
+}
+
+// GetHTTP2Dropped returns the number of frames of the http2 streams dropped
+// because the dnstap processor is busy
+func (w *DnstapServer) GetHTTP2Dropped() uint64 {
+	return atomic.LoadUint64(&w.http2Dropped)
+}
+
+// NewProcessor starts a dnstap processor for the connection
+func (w *DnstapServer) NewProcessor(connID uint64, peerName string) *DNSTapProcessor {
+	bufSize := w.GetConfig().Global.Worker.ChannelBufferSize
+	if w.GetConfig().Collectors.Dnstap.ChannelBufferSize > 0 {
+		bufSize = w.GetConfig().Collectors.Dnstap.ChannelBufferSize
+	}
+	dnstapProcessor := NewDNSTapProcessor(int(connID), peerName, w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
+	dnstapProcessor.SetMetrics(w.metrics)
+	dnstapProcessor.ShareRouting(w.GenericWorker)
+	dnstapProcessor.SetRdataFields(w.GetConfig().Collectors.Dnstap.RdataFields)
+	go dnstapProcessor.StartCollect()
+	return &dnstapProcessor
 }
 
 func (w *DnstapServer) HandleConn(conn net.Conn, connID uint64, forceClose chan bool, wg *sync.WaitGroup) {
@@ -58,15 +99,7 @@ func (w *DnstapServer) HandleConn(conn net.Conn, connID uint64, forceClose chan
 	w.LogInfo("conn #%d - new connection from %s (%s)", connID, peer, peerName)
 
 	// start dnstap processor and run it
-	bufSize := w.GetConfig().Global.Worker.ChannelBufferSize
-	if w.GetConfig().Collectors.Dnstap.ChannelBufferSize > 0 {
-		bufSize = w.GetConfig().Collectors.Dnstap.ChannelBufferSize
-	}
-	dnstapProcessor := NewDNSTapProcessor(int(connID), peerName, w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
-	dnstapProcessor.SetMetrics(w.metrics)
-	dnstapProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	dnstapProcessor.SetDefaultDropped(w.GetDroppedRoutes())
-	go dnstapProcessor.StartCollect()
+	dnstapProcessor := w.NewProcessor(connID, peerName)
 
 	// init frame stream library
 	fsReader := bufio.NewReader(conn)
@@ -193,9 +226,18 @@ func (w *DnstapServer) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
+	cfg := w.GetConfig().Collectors.Dnstap
+	switch cfg.Transport {
+	case DnstapTransportUDP:
+		w.CollectUDP()
+		return
+	case DnstapTransportHTTP2, DnstapTransportHTTP2TLS:
+		w.CollectHTTP2()
+		return
+	}
+
 	var connWG sync.WaitGroup
 	connCleanup := make(chan bool)
-	cfg := w.GetConfig().Collectors.Dnstap
 
 	// start to listen
 	listener, err := netutils.StartToListen(
@@ -251,6 +293,180 @@ func (w *DnstapServer) StartCollect() {
 	}
 }
 
+// ReadDatagrams decodes one frame per datagram until the socket is closed,
+// the datagrams of all the peers are decoded by the same dnstap processor
+func (w *DnstapServer) ReadDatagrams(conn net.PacketConn, done chan bool) {
+	defer close(done)
+
+	connID := atomic.AddUint64(&w.connCounter, 1)
+	dnstapProcessor := w.NewProcessor(connID, "")
+	defer dnstapProcessor.Stop()
+
+	buf := make([]byte, dnstapMaxDatagramSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				w.LogError("udp reader error: %s", err)
+			}
+			return
+		}
+		atomic.AddUint64(&w.udpReceived, 1)
+		w.CountTraffic(DnstapCounterUDPReceived)
+
+		payload, err := DecodeDnstapDatagram(buf[:n])
+		if err != nil {
+			atomic.AddUint64(&w.udpInvalid, 1)
+			w.CountTraffic(DnstapCounterUDPInvalid)
+			continue
+		}
+
+		// the buffer is reused for the next datagram
+		data := make([]byte, len(payload))
+		copy(data, payload)
+		select {
+		case dnstapProcessor.GetDataChannel() <- data: // Successful send to channel
+		default:
+			atomic.AddUint64(&w.udpDropped, 1)
+			w.CountTraffic(DnstapCounterUDPDropped)
+			w.WorkerIsBusy("dnstap-processor")
+		}
+	}
+}
+
+func (w *DnstapServer) CollectUDP() {
+	cfg := w.GetConfig().Collectors.Dnstap
+
+	conn, err := net.ListenPacket(netutils.SocketUDP, net.JoinHostPort(cfg.ListenIP, strconv.Itoa(cfg.ListenPort)))
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] listen error: ", err)
+	}
+	w.LogInfo("listening on udp/%s", conn.LocalAddr())
+
+	if cfg.RcvBufSize > 0 {
+		if err := conn.(*net.UDPConn).SetReadBuffer(cfg.RcvBufSize); err != nil {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] unable to set SO_RCVBUF: ", err)
+		}
+		w.LogInfo("set SO_RCVBUF option, desired: %d", cfg.RcvBufSize)
+	}
+
+	done := make(chan bool)
+	go w.ReadDatagrams(conn, done)
+
+	// the datagrams are lost without retransmission, report the counters
+	var lastInvalid, lastDropped uint64
+	lossTicker := time.NewTicker(30 * time.Second)
+	defer lossTicker.Stop()
+
+	for {
+		select {
+		case <-w.OnStop():
+			w.LogInfo("stop to listen...")
+			conn.Close()
+			<-done
+			received, invalid, dropped := w.GetUDPCounters()
+			w.LogInfo("udp - %d datagrams received, %d invalid, %d dropped", received, invalid, dropped)
+			return
+
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.CheckConfig()
+
+		case <-done:
+			return
+
+		case <-lossTicker.C:
+			received, invalid, dropped := w.GetUDPCounters()
+			if invalid > lastInvalid || dropped > lastDropped {
+				w.LogWarning("udp - %d datagrams received, %d invalid, %d dropped", received, invalid, dropped)
+			}
+			lastInvalid, lastDropped = invalid, dropped
+		}
+	}
+}
+
+// HandleStream decodes the frames streamed in the body of the request
+func (w *DnstapServer) HandleStream(httpWriter http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(httpWriter, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	connID := atomic.AddUint64(&w.connCounter, 1)
+	peerName := netutils.GetPeerName(r.RemoteAddr)
+	w.LogInfo("conn #%d - new %s stream from %s (%s)", connID, r.Proto, r.RemoteAddr, peerName)
+
+	dnstapProcessor := w.NewProcessor(connID, peerName)
+	defer dnstapProcessor.Stop()
+
+	var dropped uint64
+	err := ReadDnstapFrames(r.Body, func(payload []byte) {
+		select {
+		case dnstapProcessor.GetDataChannel() <- payload: // Successful send to channel
+		default:
+			dropped++
+			atomic.AddUint64(&w.http2Dropped, 1)
+			w.CountTraffic(DnstapCounterHTTP2Dropped)
+			w.WorkerIsBusy("dnstap-processor")
+		}
+	})
+	if dropped > 0 {
+		w.LogWarning("conn #%d - %d frames dropped", connID, dropped)
+	}
+	if err != nil {
+		w.LogError("conn #%d - stream reader error: %s", connID, err)
+		http.Error(httpWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.LogInfo("conn #%d - stream closed with peer %s", connID, r.RemoteAddr)
+	httpWriter.WriteHeader(http.StatusOK)
+}
+
+func (w *DnstapServer) CollectHTTP2() {
+	cfg := w.GetConfig().Collectors.Dnstap
+
+	listener, err := net.Listen(netutils.SocketTCP, net.JoinHostPort(cfg.ListenIP, strconv.Itoa(cfg.ListenPort)))
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] listen error: ", err)
+	}
+	w.LogInfo("listening on %s/%s", cfg.Transport, listener.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DnstapHTTP2Path, w.HandleStream)
+	httpServer := &http.Server{Handler: mux, ErrorLog: w.GetLogger().ErrorLogger()}
+
+	go func() {
+		var err error
+		if cfg.Transport == DnstapTransportHTTP2TLS {
+			w.LogInfo("tls support enabled")
+			httpServer.TLSConfig = &tls.Config{MinVersion: netutils.TLSVersion[cfg.TLSMinVersion]}
+			err = httpServer.ServeTLS(listener, cfg.CertFile, cfg.KeyFile)
+		} else {
+			// http2 without tls, with prior knowledge
+			httpServer.Handler = h2c.NewHandler(mux, &http2.Server{})
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.LogError("http server - %s", err)
+		}
+	}()
+
+	for {
+		select {
+		case <-w.OnStop():
+			w.LogInfo("stop to listen...")
+			httpServer.Close()
+			return
+
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			w.CheckConfig()
+		}
+	}
+}
+
 func GetFakeDNSTap(dnsquery []byte) *dnstap.Dnstap {
 	dtQuery := &dnstap.Dnstap{}
 
@@ -291,6 +507,7 @@ type DNSTapProcessor struct {
 	ConnID      int
 	PeerName    string
 	dataChannel chan []byte
+	rdataFields bool
 }
 
 func NewDNSTapProcessor(connID int, peerName string, config *pkgconfig.Config, logger *logger.Logger, name string, size int) DNSTapProcessor {
@@ -305,6 +522,11 @@ func (w *DNSTapProcessor) GetDataChannel() chan []byte {
 	return w.dataChannel
 }
 
+// SetRdataFields enables the structured rdata, must be called before StartCollect
+func (w *DNSTapProcessor) SetRdataFields(enable bool) {
+	w.rdataFields = enable
+}
+
 func (w *DNSTapProcessor) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
@@ -313,8 +535,7 @@ func (w *DNSTapProcessor) StartCollect() {
 	edt := &dnsutils.ExtendedDnstap{}
 
 	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
 
 	// prepare enabled transformers
 	transforms := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, w.ConnID)
@@ -514,7 +735,7 @@ func (w *DNSTapProcessor) StartCollect() {
 				dm.DNS.ArCount = dnsHeader.Arcount
 				dm.DNS.NsCount = dnsHeader.Nscount
 
-				if err = dnsutils.DecodePayload(&dm, &dnsHeader, w.GetConfig()); err != nil {
+				if err = dnsutils.DecodePayloadWithRdataFields(&dm, &dnsHeader, w.GetConfig(), w.rdataFields); err != nil {
 					dm.DNS.MalformedPacket = true
 					if w.GetConfig().Global.Trace.LogMalformed {
 						w.LogWarning("dns payload parser stopped: %s", err)
@@ -533,12 +754,12 @@ func (w *DNSTapProcessor) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
 			// dispatch dns message to connected routes
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"testing"
 	"time"
@@ -144,6 +146,69 @@ func Test_DnstapCollector(t *testing.T) {
 	}
 }
 
+func Test_DnstapCollector_ConditionalRoute(t *testing.T) {
+	matched := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	other := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Dnstap.ListenIP = "127.0.0.1"
+	config.Collectors.Dnstap.ListenPort = 16016
+
+	// the conditional routes are evaluated by the dnstap processors of the connections
+	c := NewDnstapServer([]Worker{other}, config, logger.New(false), "test")
+	c.AddConditionalRoute(map[string]interface{}{"dnstap.identity": "^resolver-1$"}, nil, []Worker{matched})
+	go c.StartCollect()
+	defer c.Stop()
+
+	// wait before to connect
+	time.Sleep(1 * time.Second)
+	conn, err := net.Dial(netutils.SocketTCP, "127.0.0.1:16016")
+	if err != nil {
+		t.Fatal("could not connect: ", err)
+	}
+	defer conn.Close()
+
+	fs := framestream.NewFstrm(bufio.NewReader(conn), bufio.NewWriter(conn), conn, 5*time.Second, []byte("protobuf:dnstap.Dnstap"), true)
+	if err := fs.InitSender(); err != nil {
+		t.Fatalf("framestream init error: %s", err)
+	}
+
+	dnsquery, err := dnsutils.GetFakeDNS()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+	for _, identity := range []string{"resolver-1", "resolver-2"} {
+		dtQuery := GetFakeDNSTap(dnsquery)
+		dtQuery.Identity = []byte(identity)
+		data, err := proto.Marshal(dtQuery)
+		if err != nil {
+			t.Fatalf("dnstap proto marshal error %s", err)
+		}
+		frame := &framestream.Frame{}
+		frame.Write(data)
+		if err := fs.SendFrame(frame); err != nil {
+			t.Fatalf("send frame error %s", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		route    *GenericWorker
+		identity string
+	}{
+		{matched, "resolver-1"},
+		{other, "resolver-2"},
+	} {
+		select {
+		case msg := <-tc.route.GetInputChannel():
+			if msg.DNSTap.Identity != tc.identity {
+				t.Errorf("want %s, got %s", tc.identity, msg.DNSTap.Identity)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no message received for %s", tc.identity)
+		}
+	}
+}
+
 // Testcase for https://github.com/dmachard/go-dnscollector/issues/461
 // Support Bind9 with dnstap closing.
 func Test_DnstapCollector_CloseFrameStream(t *testing.T) {
@@ -674,3 +739,114 @@ func Test_DnstapProcessor_TelemetryCounters(t *testing.T) {
 		t.Errorf("invalid total egress counter: got %d expect 1", r.TotalEgress)
 	}
 }
+
+func Test_DnstapCollector_UDP(t *testing.T) {
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Dnstap.Transport = DnstapTransportUDP
+	config.Collectors.Dnstap.ListenIP = "127.0.0.1"
+	config.Collectors.Dnstap.ListenPort = 16013
+	config.Global.Telemetry.Enabled = true
+	config.Global.Worker.InternalMonitor = 1
+
+	metrics := telemetry.NewPrometheusCollector(&pkgconfig.Config{})
+	go metrics.UpdateStats()
+	defer metrics.Stop()
+
+	// start the collector
+	c := NewDnstapServer([]Worker{g}, config, logger.New(false), "test")
+	c.SetMetrics(metrics)
+	go c.StartCollect()
+	time.Sleep(1 * time.Second)
+
+	conn, err := net.Dial(netutils.SocketUDP, "127.0.0.1:16013")
+	if err != nil {
+		t.Fatal("could not connect: ", err)
+	}
+	defer conn.Close()
+
+	// get fake dnstap message
+	dnsquery, err := dnsutils.GetFakeDNS()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+	data, err := proto.Marshal(GetFakeDNSTap(dnsquery))
+	if err != nil {
+		t.Fatalf("dnstap proto marshal error %s", err)
+	}
+
+	// send a truncated frame then a valid one
+	frame := EncodeDnstapFrame(data)
+	if _, err := conn.Write(frame[:len(frame)-1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	// waiting message in channel
+	select {
+	case msg := <-g.GetInputChannel():
+		if msg.DNSTap.Operation != "CLIENT_QUERY" {
+			t.Errorf("want CLIENT_QUERY, got %s", msg.DNSTap.Operation)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	received, invalid, dropped := c.GetUDPCounters()
+	if received != 2 || invalid != 1 || dropped != 0 {
+		t.Errorf("unexpected counters, received=%d invalid=%d dropped=%d", received, invalid, dropped)
+	}
+
+	// the counters are exported with the telemetry
+	var counters map[string]int
+	for i := 0; i < 50; i++ {
+		if ws, found := metrics.GetWorkerStats("test"); found && ws.Counters[DnstapCounterUDPReceived] == 2 {
+			counters = ws.Counters
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if counters[DnstapCounterUDPReceived] != 2 || counters[DnstapCounterUDPInvalid] != 1 {
+		t.Errorf("unexpected telemetry counters: %v", counters)
+	}
+	c.Stop()
+}
+
+func Test_DnstapCollector_HTTP2Dropped(t *testing.T) {
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Dnstap.Transport = DnstapTransportHTTP2
+	config.Collectors.Dnstap.ChannelBufferSize = 1
+	c := NewDnstapServer([]Worker{g}, config, logger.New(false), "test")
+
+	// get fake dnstap message
+	dnsquery, err := dnsutils.GetFakeDNS()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+	data, err := proto.Marshal(GetFakeDNSTap(dnsquery))
+	if err != nil {
+		t.Fatalf("dnstap proto marshal error %s", err)
+	}
+
+	// stream more frames than the processor can buffer
+	var body bytes.Buffer
+	frame := EncodeDnstapFrame(data)
+	for i := 0; i < 10000; i++ {
+		body.Write(frame)
+	}
+	req := httptest.NewRequest(http.MethodPost, DnstapHTTP2Path, &body)
+	rec := httptest.NewRecorder()
+	c.HandleStream(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("want status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	if c.GetHTTP2Dropped() == 0 {
+		t.Errorf("want dropped frames")
+	}
+}
@@ -0,0 +1,90 @@
+package workers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dmachard/go-netutils"
+)
+
+// The udp and http2 transports are unidirectional, without the control frames of the
+// framestream protocol. Each frame is the dnstap payload prefixed by its size
+// on 4 bytes in big-endian, one frame per datagram with udp, and the frames are
+// streamed in the body of a POST request with http2.
+const (
+	DnstapTransportUDP      = netutils.SocketUDP
+	DnstapTransportHTTP2    = "http2"
+	DnstapTransportHTTP2TLS = "http2+tls"
+
+	DnstapHTTP2Path   = "/dnstap"
+	DnstapContentType = "application/vnd.dnstap"
+
+	// maximum size of a udp datagram
+	dnstapMaxDatagramSize = 65507
+	// maximum size of a frame in the http2 stream
+	dnstapMaxFrameSize = 1024 * 1024
+)
+
+// counters of the udp transport, exported with the telemetry of the worker
+const (
+	DnstapCounterUDPReceived = "udp_received"
+	DnstapCounterUDPInvalid  = "udp_invalid"
+	DnstapCounterUDPDropped  = "udp_dropped"
+	DnstapCounterUDPSent     = "udp_sent"
+	DnstapCounterUDPLost     = "udp_lost"
+)
+
+// counters of the http2 transport, exported with the telemetry of the worker
+const (
+	DnstapCounterHTTP2Dropped = "http2_dropped"
+)
+
+var ErrDnstapInvalidFrame = errors.New("invalid dnstap frame")
+
+// EncodeDnstapFrame prefixes the dnstap payload by its size
+func EncodeDnstapFrame(payload []byte) []byte {
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+	return frame
+}
+
+// DecodeDnstapDatagram returns the dnstap payload of the datagram,
+// the frame is invalid if truncated or empty
+func DecodeDnstapDatagram(datagram []byte) ([]byte, error) {
+	if len(datagram) <= 4 {
+		return nil, ErrDnstapInvalidFrame
+	}
+	size := binary.BigEndian.Uint32(datagram[:4])
+	if int(size) != len(datagram)-4 {
+		return nil, ErrDnstapInvalidFrame
+	}
+	return datagram[4:], nil
+}
+
+// ReadDnstapFrames reads the frames of the stream until the end and
+// calls the handler with each dnstap payload
+func ReadDnstapFrames(r io.Reader, handler func(payload []byte)) error {
+	reader := bufio.NewReader(r)
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size == 0 || size > dnstapMaxFrameSize {
+			return fmt.Errorf("%w: size %d", ErrDnstapInvalidFrame, size)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return err
+		}
+		handler(payload)
+	}
+}
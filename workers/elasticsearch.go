@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
 	"time"
@@ -16,10 +17,28 @@ import (
 	"net/url"
 )
 
+type bulkStatusError struct {
+	code int
+}
+
+func (e bulkStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// retryableBulkError returns false when the bulk is rejected by the server
+func retryableBulkError(err error) bool {
+	var statusErr bulkStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code/100 == 5
+	}
+	return true
+}
+
 type ElasticSearchClient struct {
 	*GenericWorker
 	server, index, bulkURL string
 	httpClient             *http.Client
+	spool                  *DiskSpool
 }
 
 func NewElasticSearchClient(config *pkgconfig.Config, console *logger.Logger, name string) *ElasticSearchClient {
@@ -30,6 +49,7 @@ func NewElasticSearchClient(config *pkgconfig.Config, console *logger.Logger, na
 	w := &ElasticSearchClient{GenericWorker: NewGenericWorker(config, console, name, "elasticsearch", bufSize, pkgconfig.DefaultMonitor)}
 	w.ReadConfig()
 	w.httpClient = &http.Client{Timeout: 5 * time.Second}
+	w.spool = NewWorkerSpool(w.GenericWorker, config.Loggers.ElasticSearchClient.Spool)
 	return w
 }
 
@@ -60,10 +80,6 @@ func (w *ElasticSearchClient) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -97,7 +113,7 @@ func (w *ElasticSearchClient) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -106,7 +122,7 @@ func (w *ElasticSearchClient) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -124,15 +140,41 @@ func (w *ElasticSearchClient) StartLogging() {
 
 	dataBuffer := make(chan []byte, w.GetConfig().Loggers.ElasticSearchClient.BulkChannelSize)
 	go func() {
-		for data := range dataBuffer {
-			var err error
-			if w.GetConfig().Loggers.ElasticSearchClient.Compression == pkgconfig.CompressGzip {
-				err = w.sendCompressedBulk(data)
-			} else {
-				err = w.sendBulk(data)
-			}
-			if err != nil {
-				w.LogError("error sending bulk data: %v", err)
+		// replay bulks saved during the outage
+		replayTimer := time.NewTicker(flushInterval)
+		defer replayTimer.Stop()
+
+		for {
+			select {
+			case data, opened := <-dataBuffer:
+				if !opened {
+					if w.spool != nil {
+						w.spool.Close()
+					}
+					return
+				}
+
+				// keep the order while the spool is replayed
+				if w.spool != nil && w.spool.Pending() {
+					w.spoolBulk(data)
+					w.replaySpool(1)
+					continue
+				}
+
+				if err := w.postBulk(data); err != nil {
+					w.LogError("error sending bulk data: %v", err)
+					if retryableBulkError(err) {
+						w.spoolBulk(data)
+					}
+				}
+
+			case <-replayTimer.C:
+				w.replaySpool(0)
+				if w.spool != nil {
+					if dropped := w.spool.Dropped(); dropped > 0 {
+						w.LogWarning("spool is full, %d bulks dropped", dropped)
+					}
+				}
 			}
 		}
 	}()
@@ -193,6 +235,42 @@ func (w *ElasticSearchClient) StartLogging() {
 	}
 }
 
+func (w *ElasticSearchClient) postBulk(bulk []byte) error {
+	if w.GetConfig().Loggers.ElasticSearchClient.Compression == pkgconfig.CompressGzip {
+		return w.sendCompressedBulk(bulk)
+	}
+	return w.sendBulk(bulk)
+}
+
+func (w *ElasticSearchClient) spoolBulk(bulk []byte) {
+	if w.spool == nil {
+		return
+	}
+	if err := w.spool.Write(bulk); err != nil && !errors.Is(err, ErrSpoolFull) {
+		w.LogError("spool - %s", err)
+	}
+}
+
+func (w *ElasticSearchClient) replaySpool(maxBatches int) {
+	if w.spool == nil || !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.GetConfig().Loggers.ElasticSearchClient.Spool.ReplayBatch, maxBatches, func(records [][]byte) error {
+		for _, bulk := range records {
+			if err := w.postBulk(bulk); err != nil {
+				if retryableBulkError(err) {
+					return err
+				}
+				w.LogError("bulk rejected, dropped from spool: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.LogError("spool - replay failed: %s", err)
+	}
+}
+
 func (w *ElasticSearchClient) sendBulk(bulk []byte) error {
 	// Create a new HTTP request
 	req, err := http.NewRequest("POST", w.bulkURL, bytes.NewReader(bulk))
@@ -213,7 +291,7 @@ func (w *ElasticSearchClient) sendBulk(bulk []byte) error {
 
 	// Check the response status code
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return bulkStatusError{code: resp.StatusCode}
 	}
 
 	return nil
@@ -255,7 +333,7 @@ func (w *ElasticSearchClient) sendCompressedBulk(bulk []byte) error {
 
 	// Check the response status code
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return bulkStatusError{code: resp.StatusCode}
 	}
 
 	return nil
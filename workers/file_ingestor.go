@@ -38,6 +38,7 @@ type FileIngestor struct {
 	watcherTimers   map[string]*time.Timer
 	dnsProcessor    DNSProcessor
 	dnstapProcessor DNSTapProcessor
+	bpfMatcher      *BpfMatcher
 	mu              sync.Mutex
 }
 
@@ -59,6 +60,14 @@ func (w *FileIngestor) CheckConfig() {
 		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] - invalid mode: ", w.GetConfig().Collectors.FileIngestor.WatchMode)
 	}
 
+	if expr := w.GetConfig().Collectors.FileIngestor.PcapBpfFilter; expr != "" {
+		matcher, err := NewBpfMatcher(expr)
+		if err != nil {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] - invalid bpf filter: ", err)
+		}
+		w.bpfMatcher = matcher
+	}
+
 	w.LogInfo("watching directory [%s] to find [%s] files",
 		w.GetConfig().Collectors.FileIngestor.WatchDir,
 		w.GetConfig().Collectors.FileIngestor.WatchMode)
@@ -115,14 +124,19 @@ func (w *FileIngestor) ProcessPcap(filePath string) {
 	packetSource.DecodeOptions.Lazy = true
 	packetSource.NoCopy = true
 
+	// packets are filtered on the dns ports before the processing
+	ports := NewCapturePorts(w.GetConfig().Collectors.FileIngestor.PcapDNSPort,
+		w.GetConfig().Collectors.FileIngestor.PcapDNSPorts,
+		w.GetConfig().Collectors.FileIngestor.PcapPortLabels)
+
 	// defrag ipv4
-	go netutils.IPDefragger(fragIP4Chan, udpChan, tcpChan, w.GetConfig().Collectors.FileIngestor.PcapDNSPort)
+	go CaptureIPDefragger(fragIP4Chan, udpChan, tcpChan, ports)
 	// defrag ipv6
-	go netutils.IPDefragger(fragIP6Chan, udpChan, tcpChan, w.GetConfig().Collectors.FileIngestor.PcapDNSPort)
+	go CaptureIPDefragger(fragIP6Chan, udpChan, tcpChan, ports)
 	// tcp assembly
-	go netutils.TCPAssembler(tcpChan, dnsChan, w.GetConfig().Collectors.FileIngestor.PcapDNSPort)
+	go netutils.TCPAssembler(tcpChan, dnsChan, 0)
 	// udp processor
-	go netutils.UDPProcessor(udpChan, dnsChan, w.GetConfig().Collectors.FileIngestor.PcapDNSPort)
+	go netutils.UDPProcessor(udpChan, dnsChan, 0)
 
 	go func() {
 		nbPackets := 0
@@ -147,6 +161,7 @@ func (w *FileIngestor) ProcessPcap(filePath string) {
 				dm.NetworkInfo.Protocol = dnsPacket.TransportLayer.EndpointType().String()
 				dm.NetworkInfo.IPDefragmented = dnsPacket.IPDefragmented
 				dm.NetworkInfo.TCPReassembled = dnsPacket.TCPReassembled
+				dm.NetworkInfo.PortLabel = ports.FlowLabel(dnsPacket.TransportLayer)
 
 				dm.DNS.Payload = dnsPacket.Payload
 				dm.DNS.Length = len(dnsPacket.Payload)
@@ -185,6 +200,11 @@ func (w *FileIngestor) ProcessPcap(filePath string) {
 
 		nbPackets++
 
+		// apply the bpf filter as the kernel would do for a live capture
+		if w.bpfMatcher != nil && !w.bpfMatcher.Match(packet.Data()) {
+			continue
+		}
+
 		// some security checks
 		if packet.NetworkLayer() == nil {
 			continue
@@ -212,6 +232,9 @@ func (w *FileIngestor) ProcessPcap(filePath string) {
 		}
 
 		// tcp or udp packets ?
+		if !ports.Match(packet) {
+			continue
+		}
 		if packet.TransportLayer().LayerType() == layers.LayerTypeUDP {
 			udpChan <- packet
 		}
@@ -319,14 +342,14 @@ func (w *FileIngestor) StartCollect() {
 	}
 
 	dnsProcessor := NewDNSProcessor(w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
-	dnsProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	dnsProcessor.SetDefaultDropped(w.GetDroppedRoutes())
+	dnsProcessor.ShareRouting(w.GenericWorker)
+	dnsProcessor.SetRdataFields(w.GetConfig().Collectors.FileIngestor.RdataFields)
 	go dnsProcessor.StartCollect()
 
 	// start dnstap subprocessor
 	dnstapProcessor := NewDNSTapProcessor(0, "", w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
-	dnstapProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	dnstapProcessor.SetDefaultDropped(w.GetDroppedRoutes())
+	dnstapProcessor.ShareRouting(w.GenericWorker)
+	dnstapProcessor.SetRdataFields(w.GetConfig().Collectors.FileIngestor.RdataFields)
 	go dnstapProcessor.StartCollect()
 
 	w.dnstapProcessor = dnstapProcessor
@@ -52,3 +52,21 @@ func Test_FileIngestor(t *testing.T) {
 		})
 	}
 }
+
+func Test_FileIngestor_PcapPortLabels(t *testing.T) {
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	config := pkgconfig.GetDefaultConfig()
+
+	config.Collectors.FileIngestor.WatchMode = "pcap"
+	config.Collectors.FileIngestor.WatchDir = "./../tests/testsdata/pcap/"
+	config.Collectors.FileIngestor.PcapDNSPorts = []int{53, 5353}
+	config.Collectors.FileIngestor.PcapPortLabels = map[int]string{53: "resolver"}
+
+	c := NewFileIngestor([]Worker{g}, config, logger.New(false), "test")
+	go c.StartCollect()
+
+	msg := <-g.GetInputChannel()
+	if msg.NetworkInfo.PortLabel != "resolver" {
+		t.Errorf("invalid port label: %s", msg.NetworkInfo.PortLabel)
+	}
+}
@@ -17,9 +17,16 @@ import (
 	"github.com/miekg/dns"
 )
 
+// delay before sending the last decoded message, waiting for the next lines of the same event
+const tailMergeTimeout = time.Second
+
 type Tail struct {
 	*GenericWorker
-	tailf *tail.Tail
+	tailf  *tail.Tail
+	parser LogParser
+	merger LogMerger
+	// delay before sending the message held for merging
+	mergeTimeout time.Duration
 }
 
 func NewTail(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *Tail {
@@ -28,10 +35,25 @@ func NewTail(next []Worker, config *pkgconfig.Config, logger *logger.Logger, nam
 		bufSize = config.Collectors.Tail.ChannelBufferSize
 	}
 	w := &Tail{GenericWorker: NewGenericWorker(config, logger, name, "tail", bufSize, pkgconfig.DefaultMonitor)}
+	w.mergeTimeout = tailMergeTimeout
 	w.SetDefaultRoutes(next)
+	w.CheckConfig()
 	return w
 }
 
+func (w *Tail) CheckConfig() {
+	profile := w.GetConfig().Collectors.Tail.Parser
+	if len(profile) == 0 {
+		return
+	}
+	parser, found := LogParsers[profile]
+	if !found {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] tail - invalid parser: " + profile)
+	}
+	w.parser = parser
+	w.merger = LogMergers[profile]
+}
+
 func (w *Tail) Follow() error {
 	var err error
 	location := tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
@@ -53,8 +75,7 @@ func (w *Tail) StartCollect() {
 	}
 
 	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
 	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
 
 	// init dns message
@@ -69,6 +90,11 @@ func (w *Tail) StartCollect() {
 		dm.DNSTap.Identity = "undefined"
 	}
 
+	// message decoded by the parser, held until the next event when the lines can be merged
+	var pending *dnsutils.DNSMessage
+	flushTimer := time.NewTimer(w.mergeTimeout)
+	flushTimer.Stop()
+
 	for {
 		select {
 		// save the new config
@@ -78,10 +104,42 @@ func (w *Tail) StartCollect() {
 
 		case <-w.OnStop():
 			w.LogInfo("stopping...")
+			if pending != nil {
+				w.SendMessage(&subprocessors, *pending)
+			}
 			subprocessors.Reset()
 			return
 
+		case <-flushTimer.C:
+			if pending != nil {
+				w.SendMessage(&subprocessors, *pending)
+				pending = nil
+			}
+
 		case line := <-w.tailf.Lines:
+			// decode the line with the parser profile
+			if w.parser != nil {
+				pdm := dnsutils.DNSMessage{}
+				pdm.Init()
+				pdm.DNSTap.Identity = dm.DNSTap.Identity
+				if !w.parser(line.Text, &pdm) {
+					continue
+				}
+				if w.merger == nil {
+					w.SendMessage(&subprocessors, pdm)
+					continue
+				}
+				if pending != nil {
+					if w.merger(pending, &pdm) {
+						continue
+					}
+					w.SendMessage(&subprocessors, *pending)
+				}
+				pending = &pdm
+				flushTimer.Reset(w.mergeTimeout)
+				continue
+			}
+
 			var matches []string
 			var re *regexp.Regexp
 
@@ -217,21 +275,25 @@ func (w *Tail) StartCollect() {
 			dm.DNS.Payload, _ = dnspkt.Pack()
 			dm.DNS.Length = len(dm.DNS.Payload)
 
-			// count output packets
-			w.CountEgressTraffic()
+			w.SendMessage(&subprocessors, dm)
+		}
+	}
+}
 
-			// apply all enabled transformers
-			transformResult, err := subprocessors.ProcessMessage(&dm)
-			if err != nil {
-				w.LogError(err.Error())
-			}
-			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
-				continue
-			}
+func (w *Tail) SendMessage(subprocessors *transformers.Transforms, dm dnsutils.DNSMessage) {
+	// count output packets
+	w.CountEgressTraffic()
 
-			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
-		}
+	// apply all enabled transformers
+	transformResult, err := subprocessors.ProcessMessage(&dm)
+	if err != nil {
+		w.LogError(err.Error())
+	}
+	if transformResult == transformers.ReturnDrop {
+		w.SendDroppedTo(dm)
+		return
 	}
+
+	// send to next ?
+	w.SendForwardedTo(dm)
 }
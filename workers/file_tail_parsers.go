@@ -0,0 +1,509 @@
+package workers
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-netutils"
+	"github.com/miekg/dns"
+)
+
+const (
+	TailParserBind       = "bind"
+	TailParserUnbound    = "unbound"
+	TailParserDnsmasq    = "dnsmasq"
+	TailParserWindowsDNS = "windows-dns"
+	TailParserCoreDNS    = "coredns"
+)
+
+// LogParser decodes a line of a DNS server log into the message,
+// returns false when the line is not a DNS event
+type LogParser func(line string, dm *dnsutils.DNSMessage) bool
+
+var LogParsers = map[string]LogParser{
+	TailParserBind:       ParseBindLog,
+	TailParserUnbound:    ParseUnboundLog,
+	TailParserDnsmasq:    ParseDnsmasqLog,
+	TailParserWindowsDNS: ParseWindowsDNSLog,
+	TailParserCoreDNS:    ParseCoreDNSLog,
+}
+
+// LogMerger merges the next decoded message into the previous one,
+// returns false when the next message is another DNS event
+type LogMerger func(dm *dnsutils.DNSMessage, next *dnsutils.DNSMessage) bool
+
+// parsers of the logs with one event written over several lines
+var LogMergers = map[string]LogMerger{
+	TailParserDnsmasq: MergeDnsmasqReply,
+}
+
+var (
+	// named querylog, written in a file or through syslog
+	// 17-Oct-2026 10:15:01.123 queries: info: client @0x7f1c2c0a8d68 192.168.1.10#54321 (www.example.com): query: www.example.com IN A +E(0)K (192.168.1.1)
+	bindRegex = regexp.MustCompile(`^(?:(?P<timestamp>\d{2}-\w{3}-\d{4} \d{2}:\d{2}:\d{2}\.\d{3})|(?P<syslog>\w{3} [ \d]\d \d{2}:\d{2}:\d{2}) (?P<identity>\S+) named\[\d+\]:) ` +
+		`(?:\w+: \w+: )?client (?:@0x[0-9a-fA-F]+ )?(?P<queryip>[^\s#]+)#(?P<queryport>\d+)(?: \([^)]*\))?: (?:view [^:]+: )?` +
+		`query: (?P<qname>\S+) (?P<qclass>\S+) (?P<qtype>\S+) (?P<flags>\S+) \((?P<responseip>[^)]+)\)`)
+
+	// log-queries and log-replies, with or without log-time-ascii
+	// [1792232101] unbound[1234:0] reply: 192.168.1.10 www.example.com. A IN NOERROR 0.012500 0 49
+	unboundRegex = regexp.MustCompile(`^(?:\[(?P<epoch>\d+)\]|(?P<syslog>\w{3} [ \d]\d \d{2}:\d{2}:\d{2})(?: (?P<identity>\S+))?) unbound\[\d+:\d+\] (?:info|query|reply): ` +
+		`(?P<queryip>[0-9a-fA-F:.]+)(?:@(?P<queryport>\d+))? (?P<qname>\S+\.) (?P<qtype>\S+) (?P<qclass>\S+)` +
+		`(?: (?P<rcode>[A-Z]+) (?P<latency>[\d.]+) (?P<cached>[01]) (?P<length>\d+))?$`)
+
+	// log-queries, the client address and port are only present with log-queries=extra
+	// Oct 17 10:15:01 dnsmasq[1234]: query[A] www.example.com from 192.168.1.10
+	dnsmasqRegex = regexp.MustCompile(`^(?P<syslog>\w{3} [ \d]\d \d{2}:\d{2}:\d{2})(?: (?P<identity>\S+))? dnsmasq\[\d+\]: ` +
+		`(?:\d+ (?P<queryip>[0-9a-fA-F:.]+)/(?P<queryport>\d+) )?` +
+		`(?:query\[(?P<qtype>\w+)\] (?P<qname>\S+) from (?P<from>\S+)|(?:reply|cached|cached-stale|config|/\S+) (?P<rname>\S+) is (?P<rdata>\S+))$`)
+
+	// debug log of the packets, without the details
+	// 10/17/2026 10:15:01 AM 0A2C PACKET  000001D5E3A2B1C0 UDP Rcv 192.168.1.10    3f4a   Q [0001   D   NOERROR] A      (3)www(7)example(3)com(0)
+	windowsDNSRegex = regexp.MustCompile(`^(?P<timestamp>\d{1,2}/\d{1,2}/\d{4} \d{1,2}:\d{2}:\d{2}(?: [AP]M)?) [0-9a-fA-F]+ PACKET\s+[0-9a-fA-F]+ ` +
+		`(?P<protocol>UDP|TCP) (?P<direction>Snd|Rcv) (?P<ip>[0-9a-fA-F:.]+)\s+(?P<id>[0-9a-fA-F]{4}) (?P<qr>[ R]) (?P<opcode>\S) ` +
+		`\[[0-9a-fA-F]{4}\s+(?P<flags>[ATDR ]*?)\s*(?P<rcode>[A-Z]+)\]\s+(?P<qtype>\S+)\s+(?P<qname>\S+)$`)
+	windowsDNSLabelRegex = regexp.MustCompile(`\(\d+\)`)
+
+	// common log format of the log plugin
+	// [INFO] 192.168.1.10:54321 - 16202 "A IN www.example.com. udp 44 false 512" NOERROR qr,rd,ra 97 0.000123456s
+	coreDNSRegex = regexp.MustCompile(`^(?:(?P<timestamp>\S+) )?\[INFO\] (?:\[(?P<ip6>[0-9a-fA-F:.]+)\]|(?P<ip4>[0-9.]+)):(?P<queryport>\d+) - (?P<id>\d+) ` +
+		`"(?P<qtype>\S+) (?P<qclass>\S+) (?P<qname>\S+) (?P<protocol>\S+) \d+ (?:true|false) \d+" ` +
+		`(?P<rcode>\S+) (?P<rflags>\S+) (?P<length>\d+) (?P<duration>[\d.]+)s$`)
+)
+
+// matchLogLine returns the named groups of the regex, or nil without match
+func matchLogLine(re *regexp.Regexp, line string) map[string]string {
+	matches := re.FindStringSubmatch(line)
+	if matches == nil {
+		return nil
+	}
+	groups := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if i > 0 && name != "" {
+			groups[name] = matches[i]
+		}
+	}
+	return groups
+}
+
+// parseSyslogTime parses the timestamp of a syslog line, the year is not provided
+func parseSyslogTime(value string) (time.Time, error) {
+	t, err := time.ParseInLocation(time.Stamp, value, time.Local)
+	if err != nil {
+		return t, err
+	}
+	now := time.Now()
+	t = t.AddDate(now.Year(), 0, 0)
+	// the event is from the previous year
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// logName removes the trailing dot of the name, as done by the dns decoder
+func logName(name string) string {
+	if name == "." {
+		return name
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// logFamily returns the family of the ip address
+func logFamily(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err == nil && addr.Is6() && !addr.Is4In6() {
+		return netutils.ProtoIPv6
+	}
+	return netutils.ProtoIPv4
+}
+
+// logRdatatype returns the type of the answer according to the address
+func logRdatatype(rdata string) string {
+	addr, err := netip.ParseAddr(rdata)
+	if err != nil {
+		return ""
+	}
+	if addr.Is4() {
+		return "A"
+	}
+	return "AAAA"
+}
+
+// setLogQuery sets the network and operation fields of the message
+func setLogQuery(dm *dnsutils.DNSMessage, operation, queryIP, queryPort, responseIP string) {
+	if strings.HasSuffix(operation, "_QUERY") {
+		dm.DNS.Type = dnsutils.DNSQuery
+	} else {
+		dm.DNS.Type = dnsutils.DNSReply
+		dm.DNS.Flags.QR = true
+	}
+	dm.DNSTap.Operation = operation
+
+	if len(queryIP) > 0 {
+		dm.NetworkInfo.QueryIP = queryIP
+		dm.NetworkInfo.Family = logFamily(queryIP)
+	} else {
+		dm.NetworkInfo.Family = netutils.ProtoIPv4
+	}
+	if len(queryPort) > 0 {
+		dm.NetworkInfo.QueryPort = queryPort
+	}
+	if len(responseIP) > 0 {
+		dm.NetworkInfo.ResponseIP = responseIP
+	}
+	dm.NetworkInfo.Protocol = netutils.ProtoUDP
+}
+
+// finalizeLogMessage computes the timestamp and the dns payload of the message
+func finalizeLogMessage(dm *dnsutils.DNSMessage, t time.Time) {
+	dm.DNSTap.TimeSec = int(t.Unix())
+	dm.DNSTap.TimeNsec = t.Nanosecond()
+	dm.DNSTap.Timestamp = t.UnixNano()
+	dm.DNSTap.TimestampRFC3339 = t.UTC().Format(time.RFC3339Nano)
+
+	if dm.DNS.Qclass == "-" {
+		dm.DNS.Qclass = "IN"
+	}
+	if dm.DNS.Rcode == "-" {
+		dm.DNS.Rcode = dnsutils.DNSRcodeNoError
+	}
+
+	// rebuild the dns packet from the parsed fields
+	dnspkt := new(dns.Msg)
+	dnspkt.Id = uint16(dm.DNS.ID)
+	dnspkt.Response = dm.DNS.Flags.QR
+	dnspkt.Authoritative = dm.DNS.Flags.AA
+	dnspkt.Truncated = dm.DNS.Flags.TC
+	dnspkt.RecursionDesired = dm.DNS.Flags.RD
+	dnspkt.RecursionAvailable = dm.DNS.Flags.RA
+	dnspkt.AuthenticatedData = dm.DNS.Flags.AD
+	dnspkt.CheckingDisabled = dm.DNS.Flags.CD
+	dnspkt.Rcode = dns.StringToRcode[dm.DNS.Rcode]
+	dnspkt.Question = []dns.Question{{
+		Name:   dns.Fqdn(dm.DNS.Qname),
+		Qtype:  dns.StringToType[dm.DNS.Qtype],
+		Qclass: dns.StringToClass[dm.DNS.Qclass],
+	}}
+	for _, answer := range dm.DNS.DNSRRs.Answers {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d %s %s %s", dns.Fqdn(answer.Name), answer.TTL, answer.Class, answer.Rdatatype, answer.Rdata))
+		if err == nil {
+			dnspkt.Answer = append(dnspkt.Answer, rr)
+		}
+	}
+	dm.DNS.QdCount = 1
+	dm.DNS.AnCount = len(dm.DNS.DNSRRs.Answers)
+
+	payload, err := dnspkt.Pack()
+	if err != nil {
+		dm.DNS.MalformedPacket = true
+		return
+	}
+	dm.DNS.Payload = payload
+	if dm.DNS.Length == 0 {
+		dm.DNS.Length = len(payload)
+	}
+}
+
+// ParseBindLog decodes the queries logged by BIND, the replies are not logged
+func ParseBindLog(line string, dm *dnsutils.DNSMessage) bool {
+	m := matchLogLine(bindRegex, line)
+	if m == nil {
+		return false
+	}
+
+	var t time.Time
+	var err error
+	if len(m["timestamp"]) > 0 {
+		t, err = time.ParseInLocation("02-Jan-2006 15:04:05.000", m["timestamp"], time.Local)
+	} else {
+		t, err = parseSyslogTime(m["syslog"])
+		dm.DNSTap.Identity = m["identity"]
+	}
+	if err != nil {
+		return false
+	}
+
+	setLogQuery(dm, dnsutils.DNSTapClientQuery, m["queryip"], m["queryport"], m["responseip"])
+	dm.DNS.Qname = logName(m["qname"])
+	dm.DNS.Qclass = m["qclass"]
+	dm.DNS.Qtype = m["qtype"]
+
+	// +/- for the recursion desired flag, followed by E(version) for edns, T for tcp,
+	// S for signed, D for the DO bit, C for checking disabled
+	flags := m["flags"]
+	dm.DNS.Flags.RD = strings.HasPrefix(flags, "+")
+	dm.DNS.Flags.CD = strings.Contains(flags, "C")
+	dm.EDNS.Do = 0
+	if strings.Contains(flags, "D") {
+		dm.EDNS.Do = 1
+	}
+	if strings.Contains(flags, "T") {
+		dm.NetworkInfo.Protocol = netutils.ProtoTCP
+	}
+
+	finalizeLogMessage(dm, t)
+	return true
+}
+
+// ParseUnboundLog decodes the queries and the replies logged by Unbound
+func ParseUnboundLog(line string, dm *dnsutils.DNSMessage) bool {
+	m := matchLogLine(unboundRegex, line)
+	if m == nil {
+		return false
+	}
+
+	var t time.Time
+	if len(m["epoch"]) > 0 {
+		epoch, err := strconv.ParseInt(m["epoch"], 10, 64)
+		if err != nil {
+			return false
+		}
+		t = time.Unix(epoch, 0)
+	} else {
+		var err error
+		if t, err = parseSyslogTime(m["syslog"]); err != nil {
+			return false
+		}
+		if len(m["identity"]) > 0 {
+			dm.DNSTap.Identity = m["identity"]
+		}
+	}
+
+	operation := dnsutils.DNSTapClientQuery
+	if len(m["rcode"]) > 0 {
+		operation = dnsutils.DNSTapClientResponse
+	}
+	setLogQuery(dm, operation, m["queryip"], m["queryport"], "")
+	dm.DNS.Qname = logName(m["qname"])
+	dm.DNS.Qtype = m["qtype"]
+	dm.DNS.Qclass = m["qclass"]
+
+	if len(m["rcode"]) > 0 {
+		dm.DNS.Rcode = m["rcode"]
+		dm.DNS.Flags.RA = true
+		if latency, err := strconv.ParseFloat(m["latency"], 64); err == nil {
+			dm.DNSTap.Latency = latency
+		}
+		if length, err := strconv.Atoi(m["length"]); err == nil {
+			dm.DNS.Length = length
+		}
+	}
+
+	finalizeLogMessage(dm, t)
+	return true
+}
+
+// ParseDnsmasqLog decodes the queries and the replies logged by dnsmasq,
+// each reply line provides one answer of the reply
+func ParseDnsmasqLog(line string, dm *dnsutils.DNSMessage) bool {
+	m := matchLogLine(dnsmasqRegex, line)
+	if m == nil {
+		return false
+	}
+
+	t, err := parseSyslogTime(m["syslog"])
+	if err != nil {
+		return false
+	}
+	if len(m["identity"]) > 0 {
+		dm.DNSTap.Identity = m["identity"]
+	}
+
+	// query[A] www.example.com from 192.168.1.10
+	if len(m["qname"]) > 0 {
+		queryIP := m["queryip"]
+		if len(queryIP) == 0 {
+			queryIP = m["from"]
+		}
+		setLogQuery(dm, dnsutils.DNSTapClientQuery, queryIP, m["queryport"], "")
+		dm.DNS.Qname = logName(m["qname"])
+		dm.DNS.Qtype = m["qtype"]
+		dm.DNS.Flags.RD = true
+		finalizeLogMessage(dm, t)
+		return true
+	}
+
+	// reply www.example.com is 93.184.216.34
+	setLogQuery(dm, dnsutils.DNSTapClientResponse, m["queryip"], m["queryport"], "")
+	dm.DNS.Qname = logName(m["rname"])
+	dm.DNS.Flags.RD = true
+	dm.DNS.Flags.RA = true
+
+	rdata := m["rdata"]
+	switch {
+	case rdata == dnsutils.DNSRcodeNXDomain || rdata == dnsutils.DNSRcodeServFail || rdata == "REFUSED":
+		dm.DNS.Rcode = rdata
+	case rdata == "NODATA":
+		dm.DNS.Rcode = dnsutils.DNSRcodeNoError
+	case rdata == "NODATA-IPv4":
+		dm.DNS.Rcode = dnsutils.DNSRcodeNoError
+		dm.DNS.Qtype = "A"
+	case rdata == "NODATA-IPv6":
+		dm.DNS.Rcode = dnsutils.DNSRcodeNoError
+		dm.DNS.Qtype = "AAAA"
+	case strings.HasPrefix(rdata, "<") && strings.HasSuffix(rdata, ">"):
+		// the record data is not logged, only its type
+		dm.DNS.Qtype = strings.Trim(rdata, "<>")
+	default:
+		rdatatype := logRdatatype(rdata)
+		if len(rdatatype) == 0 {
+			// name of the reverse lookup
+			rdatatype = "PTR"
+			rdata = dns.Fqdn(rdata)
+		}
+		dm.DNS.Qtype = rdatatype
+		dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, dnsutils.DNSAnswer{
+			Name:      dm.DNS.Qname,
+			Rdatatype: rdatatype,
+			Class:     "IN",
+			Rdata:     rdata,
+		})
+	}
+
+	finalizeLogMessage(dm, t)
+	return true
+}
+
+// MergeDnsmasqReply merges the consecutive answers logged for the same name,
+// dnsmasq writes one line per answer of the reply
+func MergeDnsmasqReply(dm *dnsutils.DNSMessage, next *dnsutils.DNSMessage) bool {
+	if dm.DNSTap.Operation != dnsutils.DNSTapClientResponse || next.DNSTap.Operation != dnsutils.DNSTapClientResponse {
+		return false
+	}
+	if len(dm.DNS.DNSRRs.Answers) == 0 || len(next.DNS.DNSRRs.Answers) == 0 {
+		return false
+	}
+	if dm.DNS.Qname != next.DNS.Qname || dm.DNS.Qtype != next.DNS.Qtype || dm.DNSTap.Identity != next.DNSTap.Identity ||
+		dm.NetworkInfo.QueryIP != next.NetworkInfo.QueryIP || dm.NetworkInfo.QueryPort != next.NetworkInfo.QueryPort ||
+		dm.DNSTap.TimeSec != next.DNSTap.TimeSec {
+		return false
+	}
+
+	dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, next.DNS.DNSRRs.Answers...)
+	dm.DNS.Length = 0
+	finalizeLogMessage(dm, time.Unix(int64(dm.DNSTap.TimeSec), int64(dm.DNSTap.TimeNsec)))
+	return true
+}
+
+// ParseWindowsDNSLog decodes the packets of the Windows DNS debug log
+func ParseWindowsDNSLog(line string, dm *dnsutils.DNSMessage) bool {
+	m := matchLogLine(windowsDNSRegex, line)
+	if m == nil {
+		return false
+	}
+
+	// the layout depends on the locale of the server
+	t, err := time.ParseInLocation("1/2/2006 3:04:05 PM", m["timestamp"], time.Local)
+	if err != nil {
+		if t, err = time.ParseInLocation("1/2/2006 15:04:05", m["timestamp"], time.Local); err != nil {
+			return false
+		}
+	}
+
+	// received queries and sent replies are exchanged with the clients,
+	// the others with the forwarders
+	reply := m["qr"] == "R"
+	received := m["direction"] == "Rcv"
+	switch {
+	case !reply && received:
+		setLogQuery(dm, dnsutils.DNSTapClientQuery, m["ip"], "", "")
+	case reply && !received:
+		setLogQuery(dm, dnsutils.DNSTapClientResponse, m["ip"], "", "")
+	case !reply:
+		setLogQuery(dm, dnsutils.DNSTapForwarderQuery, "", "", m["ip"])
+		dm.NetworkInfo.Family = logFamily(m["ip"])
+	default:
+		setLogQuery(dm, dnsutils.DNSTapForwarderResponse, "", "", m["ip"])
+		dm.NetworkInfo.Family = logFamily(m["ip"])
+	}
+	if m["protocol"] == "TCP" {
+		dm.NetworkInfo.Protocol = netutils.ProtoTCP
+	}
+
+	id, err := strconv.ParseUint(m["id"], 16, 16)
+	if err == nil {
+		dm.DNS.ID = int(id)
+	}
+	dm.DNS.Rcode = m["rcode"]
+	dm.DNS.Qtype = m["qtype"]
+
+	// (3)www(7)example(3)com(0)
+	dm.DNS.Qname = logName(strings.TrimPrefix(windowsDNSLabelRegex.ReplaceAllString(m["qname"], "."), "."))
+	if len(dm.DNS.Qname) == 0 {
+		dm.DNS.Qname = "."
+	}
+
+	// A for authoritative, T for truncated, D for recursion desired, R for recursion available
+	flags := m["flags"]
+	dm.DNS.Flags.AA = strings.Contains(flags, "A")
+	dm.DNS.Flags.TC = strings.Contains(flags, "T")
+	dm.DNS.Flags.RD = strings.Contains(flags, "D")
+	dm.DNS.Flags.RA = strings.Contains(flags, "R")
+
+	finalizeLogMessage(dm, t)
+	return true
+}
+
+// ParseCoreDNSLog decodes the replies logged by the log plugin of CoreDNS
+func ParseCoreDNSLog(line string, dm *dnsutils.DNSMessage) bool {
+	m := matchLogLine(coreDNSRegex, line)
+	if m == nil {
+		return false
+	}
+
+	t := time.Now()
+	if len(m["timestamp"]) > 0 {
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, m["timestamp"]); err != nil {
+			return false
+		}
+	}
+
+	queryIP := m["ip4"]
+	if len(queryIP) == 0 {
+		queryIP = m["ip6"]
+	}
+	setLogQuery(dm, dnsutils.DNSTapClientResponse, queryIP, m["queryport"], "")
+	if m["protocol"] == "tcp" {
+		dm.NetworkInfo.Protocol = netutils.ProtoTCP
+	}
+
+	if id, err := strconv.Atoi(m["id"]); err == nil {
+		dm.DNS.ID = id
+	}
+	dm.DNS.Qname = logName(m["qname"])
+	dm.DNS.Qtype = m["qtype"]
+	dm.DNS.Qclass = m["qclass"]
+	dm.DNS.Rcode = m["rcode"]
+	if length, err := strconv.Atoi(m["length"]); err == nil {
+		dm.DNS.Length = length
+	}
+	if latency, err := strconv.ParseFloat(m["duration"], 64); err == nil {
+		dm.DNSTap.Latency = latency
+	}
+
+	for _, flag := range strings.Split(m["rflags"], ",") {
+		switch flag {
+		case "aa":
+			dm.DNS.Flags.AA = true
+		case "tc":
+			dm.DNS.Flags.TC = true
+		case "rd":
+			dm.DNS.Flags.RD = true
+		case "ra":
+			dm.DNS.Flags.RA = true
+		case "ad":
+			dm.DNS.Flags.AD = true
+		case "cd":
+			dm.DNS.Flags.CD = true
+		}
+	}
+
+	finalizeLogMessage(dm, t)
+	return true
+}
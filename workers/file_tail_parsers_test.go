@@ -0,0 +1,251 @@
+package workers
+
+import (
+	"bufio"
+	"os"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-netutils"
+	"github.com/miekg/dns"
+)
+
+func parseLogFixture(t *testing.T, parser LogParser, path string) []dnsutils.DNSMessage {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unable to open fixture: %s", err)
+	}
+	defer f.Close()
+
+	var msgs []dnsutils.DNSMessage
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		dm := dnsutils.DNSMessage{}
+		dm.Init()
+		if parser(scanner.Text(), &dm) {
+			msgs = append(msgs, dm)
+		}
+	}
+	return msgs
+}
+
+func Test_TailParsers(t *testing.T) {
+	testcases := []struct {
+		name    string
+		parser  string
+		fixture string
+		count   int
+		index   int
+		want    dnsutils.DNSMessage
+		answers []string
+	}{
+		{
+			name:    TailParserBind,
+			parser:  TailParserBind,
+			fixture: "../tests/testsdata/bind/querylog.log",
+			count:   3,
+			index:   0,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientQuery, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "192.168.1.10", QueryPort: "54321", ResponseIP: "192.168.1.1", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSQuery, Qname: "www.example.com", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError, Flags: dnsutils.DNSFlags{RD: true}},
+			},
+		},
+		{
+			name:    TailParserBind + "_syslog",
+			parser:  TailParserBind,
+			fixture: "../tests/testsdata/bind/querylog.log",
+			count:   3,
+			index:   2,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientQuery, Identity: "ns1"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "10.0.0.5", QueryPort: "5353", ResponseIP: "10.0.0.1", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSQuery, Qname: "mail.example.com", Qtype: "MX", Rcode: dnsutils.DNSRcodeNoError, Flags: dnsutils.DNSFlags{RD: true, CD: true}},
+			},
+		},
+		{
+			name:    TailParserUnbound,
+			parser:  TailParserUnbound,
+			fixture: "../tests/testsdata/unbound/unbound_queries.log",
+			count:   3,
+			index:   1,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "192.168.1.10", QueryPort: "-", ResponseIP: "-", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, Qname: "www.example.com", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError, Length: 49, Flags: dnsutils.DNSFlags{QR: true, RA: true}},
+			},
+		},
+		{
+			name:    TailParserUnbound + "_syslog",
+			parser:  TailParserUnbound,
+			fixture: "../tests/testsdata/unbound/unbound_queries.log",
+			count:   3,
+			index:   2,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "resolver1"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "2001:db8::10", QueryPort: "-", ResponseIP: "-", Family: netutils.ProtoIPv6, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, Qname: "nx.example.org", Qtype: "AAAA", Rcode: dnsutils.DNSRcodeNXDomain, Length: 100, Flags: dnsutils.DNSFlags{QR: true, RA: true}},
+			},
+		},
+		{
+			name:    TailParserDnsmasq,
+			parser:  TailParserDnsmasq,
+			fixture: "../tests/testsdata/dnsmasq/dnsmasq.log",
+			count:   7,
+			index:   1,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "-", QueryPort: "-", ResponseIP: "-", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, Qname: "www.example.com", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError, Flags: dnsutils.DNSFlags{QR: true, RD: true, RA: true}},
+			},
+			answers: []string{"93.184.216.34"},
+		},
+		{
+			name:    TailParserDnsmasq + "_extra",
+			parser:  TailParserDnsmasq,
+			fixture: "../tests/testsdata/dnsmasq/dnsmasq.log",
+			count:   7,
+			index:   3,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "gw"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "192.168.1.11", QueryPort: "40123", ResponseIP: "-", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, Qname: "nx.example.org", Qtype: "-", Rcode: dnsutils.DNSRcodeNXDomain, Flags: dnsutils.DNSFlags{QR: true, RD: true, RA: true}},
+			},
+		},
+		{
+			name:    TailParserDnsmasq + "_hosts",
+			parser:  TailParserDnsmasq,
+			fixture: "../tests/testsdata/dnsmasq/dnsmasq.log",
+			count:   7,
+			index:   5,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "-", QueryPort: "-", ResponseIP: "-", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, Qname: "router.lan", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError, Flags: dnsutils.DNSFlags{QR: true, RD: true, RA: true}},
+			},
+			answers: []string{"192.168.1.1"},
+		},
+		{
+			name:    TailParserWindowsDNS,
+			parser:  TailParserWindowsDNS,
+			fixture: "../tests/testsdata/windowsdns/dns_debug.log",
+			count:   4,
+			index:   1,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "192.168.1.10", QueryPort: "-", ResponseIP: "-", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoUDP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, ID: 0x3f4a, Qname: "www.example.com", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError, Flags: dnsutils.DNSFlags{QR: true, RD: true, RA: true}},
+			},
+		},
+		{
+			name:    TailParserWindowsDNS + "_forwarder",
+			parser:  TailParserWindowsDNS,
+			fixture: "../tests/testsdata/windowsdns/dns_debug.log",
+			count:   4,
+			index:   3,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapForwarderResponse, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "-", QueryPort: "-", ResponseIP: "8.8.8.8", Family: netutils.ProtoIPv4, Protocol: netutils.ProtoTCP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, ID: 0x91b2, Qname: "nx.example.org", Qtype: "AAAA", Rcode: dnsutils.DNSRcodeNXDomain, Flags: dnsutils.DNSFlags{QR: true, RD: true, RA: true}},
+			},
+		},
+		{
+			name:    TailParserCoreDNS,
+			parser:  TailParserCoreDNS,
+			fixture: "../tests/testsdata/coredns/coredns_log.log",
+			count:   2,
+			index:   1,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Operation: dnsutils.DNSTapClientResponse, Identity: "-"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "2001:db8::10", QueryPort: "40000", ResponseIP: "-", Family: netutils.ProtoIPv6, Protocol: netutils.ProtoTCP},
+				DNS:         dnsutils.DNS{Type: dnsutils.DNSReply, ID: 37282, Qname: "nx.example.org", Qtype: "AAAA", Rcode: dnsutils.DNSRcodeNXDomain, Length: 120, Flags: dnsutils.DNSFlags{QR: true, AA: true, RD: true}},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgs := parseLogFixture(t, LogParsers[tc.parser], tc.fixture)
+			if len(msgs) != tc.count {
+				t.Fatalf("want %d messages, got %d", tc.count, len(msgs))
+			}
+			dm := msgs[tc.index]
+
+			if dm.DNSTap.Operation != tc.want.DNSTap.Operation || dm.DNSTap.Identity != tc.want.DNSTap.Identity {
+				t.Errorf("unexpected dnstap: %+v", dm.DNSTap)
+			}
+			ni := dm.NetworkInfo
+			if ni.QueryIP != tc.want.NetworkInfo.QueryIP || ni.QueryPort != tc.want.NetworkInfo.QueryPort ||
+				ni.ResponseIP != tc.want.NetworkInfo.ResponseIP || ni.Family != tc.want.NetworkInfo.Family ||
+				ni.Protocol != tc.want.NetworkInfo.Protocol {
+				t.Errorf("unexpected network info: %+v", ni)
+			}
+			if dm.DNS.Type != tc.want.DNS.Type || dm.DNS.ID != tc.want.DNS.ID || dm.DNS.Qname != tc.want.DNS.Qname ||
+				dm.DNS.Qtype != tc.want.DNS.Qtype || dm.DNS.Rcode != tc.want.DNS.Rcode || dm.DNS.Flags != tc.want.DNS.Flags {
+				t.Errorf("unexpected dns: %+v", dm.DNS)
+			}
+			if tc.want.DNS.Length > 0 && dm.DNS.Length != tc.want.DNS.Length {
+				t.Errorf("want length %d, got %d", tc.want.DNS.Length, dm.DNS.Length)
+			}
+			if dm.DNSTap.TimeSec == 0 {
+				t.Errorf("timestamp not set")
+			}
+
+			// the payload is rebuilt with the answers
+			pkt := new(dns.Msg)
+			if err := pkt.Unpack(dm.DNS.Payload); err != nil {
+				t.Fatalf("invalid payload: %s", err)
+			}
+			if dns.RcodeToString[pkt.Rcode] != tc.want.DNS.Rcode {
+				t.Errorf("want payload rcode %s, got %s", tc.want.DNS.Rcode, dns.RcodeToString[pkt.Rcode])
+			}
+			if len(pkt.Answer) != len(tc.answers) || len(dm.DNS.DNSRRs.Answers) != len(tc.answers) {
+				t.Fatalf("want %d answers, got %d", len(tc.answers), len(pkt.Answer))
+			}
+			for i, rdata := range tc.answers {
+				if dm.DNS.DNSRRs.Answers[i].Rdata != rdata {
+					t.Errorf("want answer %s, got %s", rdata, dm.DNS.DNSRRs.Answers[i].Rdata)
+				}
+			}
+		})
+	}
+}
+
+func Test_TailParsers_DnsmasqMerge(t *testing.T) {
+	lines := []string{
+		"Oct 17 10:15:01 dnsmasq[1234]: 3 192.168.1.10/53412 reply www.example.com is 93.184.216.34",
+		"Oct 17 10:15:01 dnsmasq[1234]: 3 192.168.1.10/53412 reply www.example.com is 93.184.216.35",
+		"Oct 17 10:15:01 dnsmasq[1234]: 4 192.168.1.11/40123 reply www.example.com is 93.184.216.34",
+		"Oct 17 10:15:01 dnsmasq[1234]: 4 192.168.1.11/40123 reply nx.example.org is NXDOMAIN",
+	}
+
+	var msgs []dnsutils.DNSMessage
+	for _, line := range lines {
+		dm := dnsutils.DNSMessage{}
+		dm.Init()
+		if !ParseDnsmasqLog(line, &dm) {
+			t.Fatalf("line not decoded: %s", line)
+		}
+		if len(msgs) > 0 && MergeDnsmasqReply(&msgs[len(msgs)-1], &dm) {
+			continue
+		}
+		msgs = append(msgs, dm)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatalf("want 3 messages, got %d", len(msgs))
+	}
+	if len(msgs[0].DNS.DNSRRs.Answers) != 2 || msgs[0].DNS.AnCount != 2 {
+		t.Errorf("want 2 answers, got %+v", msgs[0].DNS.DNSRRs.Answers)
+	}
+	pkt := new(dns.Msg)
+	if err := pkt.Unpack(msgs[0].DNS.Payload); err != nil || len(pkt.Answer) != 2 {
+		t.Errorf("want 2 answers in the payload, got %v (%v)", pkt.Answer, err)
+	}
+	if msgs[0].DNS.Length != len(msgs[0].DNS.Payload) {
+		t.Errorf("want length %d, got %d", len(msgs[0].DNS.Payload), msgs[0].DNS.Length)
+	}
+	if msgs[1].NetworkInfo.QueryIP != "192.168.1.11" || len(msgs[1].DNS.DNSRRs.Answers) != 1 {
+		t.Errorf("the replies of another client must not be merged: %+v", msgs[1])
+	}
+}
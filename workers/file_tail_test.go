@@ -48,3 +48,43 @@ func TestTailRun(t *testing.T) {
 		t.Errorf("want www.google.org, got %s", msg.DNS.Qname)
 	}
 }
+
+func TestTailRun_FlushPendingOnStop(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "temp_tailffile")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Tail.FilePath = tmpFile.Name()
+	config.Collectors.Tail.Parser = TailParserDnsmasq
+
+	// the reply is held until the collector is stopped
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	c := NewTail([]Worker{g}, config, logger.New(false), "test")
+	c.mergeTimeout = time.Hour
+	go c.StartCollect()
+
+	time.Sleep(2 * time.Second)
+	if _, err := tmpFile.WriteString("Oct 17 10:15:01 dnsmasq[1234]: reply www.example.com is 93.184.216.34\n"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+
+	select {
+	case dm := <-g.GetInputChannel():
+		t.Fatalf("reply sent before the stop: %s", dm.DNS.Qname)
+	default:
+	}
+
+	c.Stop()
+	select {
+	case dm := <-g.GetInputChannel():
+		if dm.DNS.Qname != "www.example.com" {
+			t.Errorf("want www.example.com, got %s", dm.DNS.Qname)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending reply not sent on stop")
+	}
+}
@@ -0,0 +1,296 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/hpcloud/tail"
+)
+
+const (
+	JSONTransportTail = "tail"
+	JSONTransportTCP  = "tcp"
+	JSONTransportHTTP = "http"
+
+	// maximum size of a json line
+	jsonMaxLineSize = 1024 * 1024
+)
+
+// DecodeJSONMessage decodes a DNS message encoded in json or flat-json
+func DecodeJSONMessage(mode string, data []byte) (dnsutils.DNSMessage, error) {
+	dm := dnsutils.DNSMessage{}
+	var err error
+	switch mode {
+	case pkgconfig.ModeJSON:
+		err = dm.FromJSON(data)
+	case pkgconfig.ModeFlatJSON:
+		err = dm.FromFlatJSON(data)
+	default:
+		err = errors.New("unsupported mode: " + mode)
+	}
+	return dm, err
+}
+
+type JSONIngestor struct {
+	*GenericWorker
+	msgs chan dnsutils.DNSMessage
+}
+
+func NewJSONIngestor(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *JSONIngestor {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Collectors.JSONIngestor.ChannelBufferSize > 0 {
+		bufSize = config.Collectors.JSONIngestor.ChannelBufferSize
+	}
+	w := &JSONIngestor{GenericWorker: NewGenericWorker(config, logger, name, "json ingestor", bufSize, pkgconfig.DefaultMonitor)}
+	w.msgs = make(chan dnsutils.DNSMessage, bufSize)
+	w.SetDefaultRoutes(next)
+	w.CheckConfig()
+	return w
+}
+
+func (w *JSONIngestor) CheckConfig() {
+	cfg := w.GetConfig().Collectors.JSONIngestor
+	switch cfg.Mode {
+	case pkgconfig.ModeJSON, pkgconfig.ModeFlatJSON:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] json ingestor - invalid mode: " + cfg.Mode)
+	}
+	switch cfg.Transport {
+	case JSONTransportTail:
+		if len(cfg.FilePath) == 0 {
+			w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] json ingestor - file path is mandatory")
+		}
+	case JSONTransportTCP, JSONTransportHTTP:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] json ingestor - invalid transport: " + cfg.Transport)
+	}
+	if !netutils.IsValidTLS(cfg.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] json ingestor - invalid tls min version")
+	}
+}
+
+// ReadLines decodes each line as a DNS message, returns the number of invalid lines
+func (w *JSONIngestor) ReadLines(r io.Reader, stop <-chan bool) (int, error) {
+	return w.DecodeLines(r, func(dm dnsutils.DNSMessage) bool {
+		select {
+		case w.msgs <- dm:
+			return true
+		case <-stop:
+			return false
+		}
+	})
+}
+
+// DecodeLines calls the handler with the decoded messages until it returns false,
+// returns the number of invalid lines
+func (w *JSONIngestor) DecodeLines(r io.Reader, handler func(dm dnsutils.DNSMessage) bool) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), jsonMaxLineSize)
+
+	invalid := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		dm, err := DecodeJSONMessage(w.GetConfig().Collectors.JSONIngestor.Mode, line)
+		if err != nil {
+			w.LogError("unable to decode line: %s", err)
+			invalid++
+			continue
+		}
+		if !handler(dm) {
+			return invalid, nil
+		}
+	}
+	return invalid, scanner.Err()
+}
+
+// Follow decodes the lines appended to the file
+func (w *JSONIngestor) Follow(stop <-chan bool) (*tail.Tail, error) {
+	location := tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
+	config := tail.Config{Location: &location, ReOpen: true, Follow: true, Logger: tail.DiscardingLogger, Poll: true, MustExist: true}
+	tailf, err := tail.TailFile(w.GetConfig().Collectors.JSONIngestor.FilePath, config)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for line := range tailf.Lines {
+			if line.Err != nil {
+				continue
+			}
+			if _, err := w.ReadLines(bytes.NewReader([]byte(line.Text)), stop); err != nil {
+				w.LogError("tail - %s", err)
+			}
+		}
+	}()
+	return tailf, nil
+}
+
+// HandleHTTP accepts the POST requests with newline-delimited json in the body
+func (w *JSONIngestor) HandleHTTP(rw http.ResponseWriter, r *http.Request, stop <-chan bool) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	// the whole body is decoded before forwarding the messages, nothing is sent
+	// when the request is rejected so the client can retry without duplicates
+	msgs := []dnsutils.DNSMessage{}
+	invalid, err := w.DecodeLines(r.Body, func(dm dnsutils.DNSMessage) bool {
+		msgs = append(msgs, dm)
+		return true
+	})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if invalid > 0 {
+		http.Error(rw, fmt.Sprintf("%d invalid line(s)", invalid), http.StatusBadRequest)
+		return
+	}
+	for _, dm := range msgs {
+		select {
+		case w.msgs <- dm:
+		case <-stop:
+			http.Error(rw, "collector stopped", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// HandleConn decodes the lines received on the tcp connection
+func (w *JSONIngestor) HandleConn(conn net.Conn, stop <-chan bool, connWG *sync.WaitGroup) {
+	defer connWG.Done()
+	peer := conn.RemoteAddr().String()
+	w.LogInfo("new connection from %s", peer)
+
+	// close the connection on stop to unblock the reader
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if _, err := w.ReadLines(conn, stop); err != nil && !errors.Is(err, net.ErrClosed) {
+		w.LogError("%s - %s", peer, err)
+	}
+	conn.Close()
+	w.LogInfo("%s - connection closed", peer)
+}
+
+func (w *JSONIngestor) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	cfg := w.GetConfig().Collectors.JSONIngestor
+	stop := make(chan bool)
+	var connWG sync.WaitGroup
+
+	var tailf *tail.Tail
+	var listener net.Listener
+	var httpServer *http.Server
+	connChan := make(chan net.Conn)
+
+	switch cfg.Transport {
+	case JSONTransportTail:
+		var err error
+		tailf, err = w.Follow(stop)
+		if err != nil {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] json ingestor - unable to follow file: ", err)
+		}
+		w.LogInfo("following file %s", cfg.FilePath)
+
+	case JSONTransportTCP, JSONTransportHTTP:
+		var err error
+		listener, err = netutils.StartToListen(cfg.ListenIP, cfg.ListenPort, "",
+			cfg.TLSSupport, netutils.TLSVersion[cfg.TLSMinVersion], cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] json ingestor - listening failed: ", err)
+		}
+		w.LogInfo("listening on %s/%s", cfg.Transport, listener.Addr())
+
+		if cfg.Transport == JSONTransportHTTP {
+			httpServer = &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				w.HandleHTTP(rw, r, stop)
+			})}
+			go func() {
+				if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					w.LogError("http server - %s", err)
+				}
+			}()
+		} else {
+			netutils.AcceptConnections(listener, connChan)
+		}
+	}
+
+	// prepare next channels
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
+	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
+
+	for {
+		select {
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			subprocessors.ReloadConfig(&cfg.IngoingTransformers)
+
+		case <-w.OnStop():
+			w.LogInfo("stopping...")
+			close(stop)
+			if tailf != nil {
+				tailf.Stop()
+			}
+			if httpServer != nil {
+				httpServer.Close()
+			} else if listener != nil {
+				listener.Close()
+			}
+			connWG.Wait()
+			subprocessors.Reset()
+			return
+
+		case conn, opened := <-connChan:
+			if !opened {
+				connChan = nil
+				continue
+			}
+			connWG.Add(1)
+			go w.HandleConn(conn, stop, &connWG)
+
+		case dm := <-w.msgs:
+			w.CountIngressTraffic()
+			w.CountEgressTraffic()
+
+			// apply all enabled transformers
+			transformResult, err := subprocessors.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
+			}
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(dm)
+				continue
+			}
+
+			// send to next ?
+			w.SendForwardedTo(dm)
+		}
+	}
+}
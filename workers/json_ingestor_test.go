@@ -0,0 +1,106 @@
+package workers
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func Test_JSONIngestor(t *testing.T) {
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{{Name: "dns.collector", Rdatatype: "A", Class: "IN", TTL: 300, Rdata: "192.0.2.1"}}
+	flat, _ := dm.ToFlatJSON()
+	logFile := filepath.Join(t.TempDir(), "dnscollector.json")
+
+	testcases := []struct {
+		name      string
+		transport string
+		mode      string
+		port      int
+		payload   string
+	}{
+		{name: "tail_json", transport: JSONTransportTail, mode: pkgconfig.ModeJSON, payload: dm.ToJSON()},
+		{name: "tcp_flatjson", transport: JSONTransportTCP, mode: pkgconfig.ModeFlatJSON, port: 16010, payload: flat},
+		{name: "http_json", transport: JSONTransportHTTP, mode: pkgconfig.ModeJSON, port: 16011, payload: dm.ToJSON()},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+			config := pkgconfig.GetDefaultConfig()
+			config.Collectors.JSONIngestor.Transport = tc.transport
+			config.Collectors.JSONIngestor.Mode = tc.mode
+			config.Collectors.JSONIngestor.ListenIP = "127.0.0.1"
+			config.Collectors.JSONIngestor.ListenPort = tc.port
+			config.Collectors.JSONIngestor.FilePath = logFile
+			if err := os.WriteFile(logFile, []byte{}, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewJSONIngestor([]Worker{g}, config, logger.New(false), "test")
+			go c.StartCollect()
+			time.Sleep(time.Second)
+
+			// send the dns message
+			switch tc.transport {
+			case JSONTransportTail:
+				f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString(tc.payload)
+				f.Close()
+			case JSONTransportTCP:
+				conn, err := net.Dial("tcp", "127.0.0.1:16010")
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Write([]byte(tc.payload))
+				defer conn.Close()
+			case JSONTransportHTTP:
+				resp, err := http.Post("http://127.0.0.1:16011", "application/x-ndjson", strings.NewReader(tc.payload+"invalid\n"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusBadRequest {
+					t.Errorf("invalid line should be reported, got status %d", resp.StatusCode)
+				}
+
+				// nothing is forwarded from a rejected body
+				select {
+				case msg := <-g.GetInputChannel():
+					t.Fatalf("message forwarded from a rejected body: %s", msg.DNS.Qname)
+				case <-time.After(time.Second):
+				}
+
+				resp, err = http.Post("http://127.0.0.1:16011", "application/x-ndjson", strings.NewReader(tc.payload))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusNoContent {
+					t.Errorf("want status %d, got %d", http.StatusNoContent, resp.StatusCode)
+				}
+			}
+
+			select {
+			case msg := <-g.GetInputChannel():
+				if msg.DNS.Qname != dm.DNS.Qname || len(msg.DNS.DNSRRs.Answers) != 1 {
+					t.Errorf("unexpected dns message: %+v", msg.DNS)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("dns message not received")
+			}
+			c.Stop()
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+type KafkaConsumer struct {
+	*GenericWorker
+}
+
+func NewKafkaConsumer(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *KafkaConsumer {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Collectors.KafkaConsumer.ChannelBufferSize > 0 {
+		bufSize = config.Collectors.KafkaConsumer.ChannelBufferSize
+	}
+	w := &KafkaConsumer{GenericWorker: NewGenericWorker(config, logger, name, "kafka consumer", bufSize, pkgconfig.DefaultMonitor)}
+	w.SetDefaultRoutes(next)
+	w.CheckConfig()
+	return w
+}
+
+func (w *KafkaConsumer) CheckConfig() {
+	cfg := w.GetConfig().Collectors.KafkaConsumer
+	switch cfg.Mode {
+	case pkgconfig.ModeJSON, pkgconfig.ModeFlatJSON, pkgconfig.ModeDNSTap:
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] kafka consumer - invalid mode: " + cfg.Mode)
+	}
+	switch cfg.StartOffset {
+	case "first", "last":
+	default:
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] kafka consumer - invalid start offset: " + cfg.StartOffset)
+	}
+	if !netutils.IsValidTLS(cfg.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] kafka consumer - invalid tls min version")
+	}
+}
+
+// NewReader creates the reader of the consumer group, the offsets are committed
+// in background every commit interval once the messages are handed off
+func (w *KafkaConsumer) NewReader() (*kafka.Reader, error) {
+	cfg := w.GetConfig().Collectors.KafkaConsumer
+
+	dialer := &kafka.Dialer{
+		Timeout:   time.Duration(cfg.ConnectTimeout) * time.Second,
+		DualStack: true,
+	}
+
+	// enable TLS
+	if cfg.TLSSupport {
+		tlsOptions := netutils.TLSOptions{
+			InsecureSkipVerify: cfg.TLSInsecure,
+			MinVersion:         cfg.TLSMinVersion,
+			CAFile:             cfg.CAFile,
+			CertFile:           cfg.CertFile,
+			KeyFile:            cfg.KeyFile,
+		}
+		tlsConfig, err := netutils.TLSClientConfig(tlsOptions)
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLS = tlsConfig
+	}
+
+	// SASL Support
+	if cfg.SaslSupport {
+		switch cfg.SaslMechanism {
+		case pkgconfig.SASLMechanismPlain:
+			dialer.SASLMechanism = plain.Mechanism{Username: cfg.SaslUsername, Password: cfg.SaslPassword}
+		case pkgconfig.SASLMechanismScram:
+			mechanism, err := scram.Mechanism(scram.SHA512, cfg.SaslUsername, cfg.SaslPassword)
+			if err != nil {
+				return nil, err
+			}
+			dialer.SASLMechanism = mechanism
+		default:
+			return nil, errors.New("invalid sasl mechanism: " + cfg.SaslMechanism)
+		}
+	}
+
+	startOffset := kafka.LastOffset
+	if cfg.StartOffset == "first" {
+		startOffset = kafka.FirstOffset
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        []string{cfg.RemoteAddress + ":" + strconv.Itoa(cfg.RemotePort)},
+		GroupID:        cfg.GroupID,
+		Topic:          cfg.Topic,
+		Dialer:         dialer,
+		StartOffset:    startOffset,
+		CommitInterval: time.Duration(cfg.CommitInterval) * time.Second,
+	}), nil
+}
+
+// DecodeMessage decodes the json or flat-json payload of a kafka message
+func (w *KafkaConsumer) DecodeMessage(value []byte) (dnsutils.DNSMessage, error) {
+	return DecodeJSONMessage(w.GetConfig().Collectors.KafkaConsumer.Mode, value)
+}
+
+// Fetch reads the messages of the topic until the context is cancelled
+func (w *KafkaConsumer) Fetch(ctx context.Context, reader *kafka.Reader, msgs chan<- kafka.Message) {
+	defer close(msgs)
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			// stopped by the collector
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				return
+			}
+			w.LogError("unable to fetch message: %s", err)
+			w.LogInfo("retry to fetch in %d seconds", w.GetConfig().Collectors.KafkaConsumer.RetryInterval)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(w.GetConfig().Collectors.KafkaConsumer.RetryInterval) * time.Second):
+			}
+			continue
+		}
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *KafkaConsumer) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	cfg := w.GetConfig().Collectors.KafkaConsumer
+	reader, err := w.NewReader()
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] kafka consumer - unable to create reader: ", err)
+	}
+	w.LogInfo("consuming kafka=%s:%d topic=%s group=%s", cfg.RemoteAddress, cfg.RemotePort, cfg.Topic, cfg.GroupID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs := make(chan kafka.Message)
+	go w.Fetch(ctx, reader, msgs)
+
+	// the dnstap payloads are decoded by the dnstap processor
+	var dnstapProcessor DNSTapProcessor
+	if cfg.Mode == pkgconfig.ModeDNSTap {
+		dnstapProcessor = NewDNSTapProcessor(0, cfg.Topic, w.GetConfig(), w.GetLogger(), w.GetName(), w.GetConfig().Global.Worker.ChannelBufferSize)
+		dnstapProcessor.SetMetrics(w.metrics)
+		dnstapProcessor.ShareRouting(w.GenericWorker)
+		dnstapProcessor.SetRdataFields(w.GetConfig().Collectors.Dnstap.RdataFields)
+		go dnstapProcessor.StartCollect()
+	}
+
+	// prepare next channels
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
+	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
+
+	for {
+		select {
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			subprocessors.ReloadConfig(&cfg.IngoingTransformers)
+
+		case <-w.OnStop():
+			w.LogInfo("stopping...")
+			if cfg.Mode == pkgconfig.ModeDNSTap {
+				dnstapProcessor.Stop()
+			}
+			subprocessors.Reset()
+			// stop the fetch loop before closing the reader
+			cancel()
+			for range msgs {
+			}
+			if err := reader.Close(); err != nil {
+				w.LogError("unable to close reader: %s", err)
+			}
+			return
+
+		case msg, opened := <-msgs:
+			if !opened {
+				w.LogInfo("channel closed, exit")
+				return
+			}
+
+			if cfg.Mode == pkgconfig.ModeDNSTap {
+				dnstapProcessor.GetDataChannel() <- msg.Value
+			} else {
+				w.CountIngressTraffic()
+
+				dm, err := w.DecodeMessage(msg.Value)
+				if err != nil {
+					w.LogError("unable to decode message at offset %d: %s", msg.Offset, err)
+				} else {
+					w.CountEgressTraffic()
+
+					// apply all enabled transformers
+					transformResult, err := subprocessors.ProcessMessage(&dm)
+					if err != nil {
+						w.LogError(err.Error())
+					}
+					if transformResult == transformers.ReturnDrop {
+						w.SendDroppedTo(dm)
+					} else {
+						w.SendForwardedTo(dm)
+					}
+				}
+			}
+
+			// the offset is committed once the message is handed off
+			if err := reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+				w.LogError("unable to commit offset %d: %s", msg.Offset, err)
+			}
+		}
+	}
+}
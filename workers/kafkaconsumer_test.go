@@ -0,0 +1,83 @@
+package workers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func Test_KafkaConsumer_DecodeMessage(t *testing.T) {
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Flags.QR = true
+	dm.DNS.Type = dnsutils.DNSReply
+	dm.DNS.DNSRRs.Answers = []dnsutils.DNSAnswer{{Name: "dns.collector", Rdatatype: "A", Class: "IN", TTL: 300, Rdata: "192.0.2.1"}}
+	flat, _ := dm.ToFlatJSON()
+
+	testcases := []struct {
+		mode    string
+		payload string
+	}{
+		{mode: pkgconfig.ModeJSON, payload: dm.ToJSON()},
+		{mode: pkgconfig.ModeFlatJSON, payload: flat},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.mode, func(t *testing.T) {
+			config := pkgconfig.GetDefaultConfig()
+			config.Collectors.KafkaConsumer.Mode = tc.mode
+			consumer := NewKafkaConsumer(nil, config, logger.New(false), "test")
+
+			decoded, err := consumer.DecodeMessage([]byte(tc.payload))
+			if err != nil {
+				t.Fatalf("unable to decode: %v", err)
+			}
+			if decoded.DNS.Qname != dm.DNS.Qname || decoded.DNS.Type != dnsutils.DNSReply {
+				t.Errorf("unexpected dns message: %+v", decoded.DNS)
+			}
+			if len(decoded.DNS.DNSRRs.Answers) != 1 || decoded.DNS.DNSRRs.Answers[0].Rdata != "192.0.2.1" {
+				t.Errorf("unexpected answers: %+v", decoded.DNS.DNSRRs.Answers)
+			}
+
+			if _, err := consumer.DecodeMessage([]byte("dns.collector A")); err == nil {
+				t.Errorf("invalid payload should fail")
+			}
+		})
+	}
+}
+
+func Test_KafkaConsumer_Stop(t *testing.T) {
+	logsChan := make(chan logger.LogEntry, 100)
+	lg := logger.New(true)
+	lg.SetOutputChannel(logsChan)
+
+	// no broker, the fetch is in progress when the collector is stopped
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.KafkaConsumer.RemotePort = 19092
+	consumer := NewKafkaConsumer(nil, config, lg, "test")
+	go consumer.StartCollect()
+	time.Sleep(time.Second)
+
+	stopped := make(chan bool)
+	go func() {
+		consumer.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("collector not stopped")
+	}
+
+	// the fetch loop has exited and nothing is logged
+	time.Sleep(time.Second)
+	for len(logsChan) > 0 {
+		entry := <-logsChan
+		if strings.Contains(entry.Message, "unable to fetch message") {
+			t.Errorf("unexpected fetch error on stop: %s", entry.Message)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package workers
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +29,7 @@ type KafkaProducer struct {
 	compressCodec              compress.Codec
 	kafkaConns                 map[int]*kafka.Conn // Map to store connections by partition
 	lastPartitionIndex         *int
+	spool                      *DiskSpool
 }
 
 func NewKafkaProducer(config *pkgconfig.Config, logger *logger.Logger, name string) *KafkaProducer {
@@ -41,6 +44,7 @@ func NewKafkaProducer(config *pkgconfig.Config, logger *logger.Logger, name stri
 		kafkaConns:     make(map[int]*kafka.Conn),
 	}
 	w.ReadConfig()
+	w.spool = NewWorkerSpool(w.GenericWorker, config.Loggers.KafkaProducer.Spool)
 	return w
 }
 
@@ -184,37 +188,34 @@ func (w *KafkaProducer) ConnectToKafka(ctx context.Context, readyTimer *time.Tim
 	}
 }
 
-func (w *KafkaProducer) FlushBuffer(buf *[]dnsutils.DNSMessage) {
-	msgs := []kafka.Message{}
+func (w *KafkaProducer) EncodeMessage(dm *dnsutils.DNSMessage) kafka.Message {
 	buffer := new(bytes.Buffer)
 	strDm := ""
-	partition := w.GetConfig().Loggers.KafkaProducer.Partition
 
-	for _, dm := range *buf {
-		switch w.GetConfig().Loggers.KafkaProducer.Mode {
-		case pkgconfig.ModeText:
-			strDm = dm.String(w.textFormat, w.GetConfig().Global.TextFormatDelimiter, w.GetConfig().Global.TextFormatBoundary)
-		case pkgconfig.ModeJSON:
-			json.NewEncoder(buffer).Encode(dm)
-			strDm = buffer.String()
-			buffer.Reset()
-		case pkgconfig.ModeFlatJSON:
-			flat, err := dm.Flatten()
-			if err != nil {
-				w.LogError("flattening DNS message failed: %e", err)
-			}
-			json.NewEncoder(buffer).Encode(flat)
-			strDm = buffer.String()
-			buffer.Reset()
-		}
-
-		msg := kafka.Message{
-			Key:   []byte(dm.DNSTap.Identity),
-			Value: []byte(strDm),
+	switch w.GetConfig().Loggers.KafkaProducer.Mode {
+	case pkgconfig.ModeText:
+		strDm = dm.String(w.textFormat, w.GetConfig().Global.TextFormatDelimiter, w.GetConfig().Global.TextFormatBoundary)
+	case pkgconfig.ModeJSON:
+		json.NewEncoder(buffer).Encode(dm)
+		strDm = buffer.String()
+	case pkgconfig.ModeFlatJSON:
+		flat, err := dm.Flatten()
+		if err != nil {
+			w.LogError("flattening DNS message failed: %e", err)
 		}
-		msgs = append(msgs, msg)
+		json.NewEncoder(buffer).Encode(flat)
+		strDm = buffer.String()
+	}
 
+	return kafka.Message{
+		Key:   []byte(dm.DNSTap.Identity),
+		Value: []byte(strDm),
 	}
+}
+
+// WriteMessages sends the messages to the partition, the connection is restarted on error
+func (w *KafkaProducer) WriteMessages(msgs []kafka.Message) error {
+	partition := w.GetConfig().Loggers.KafkaProducer.Partition
 
 	// add support for msg compression and round robin
 	var err error
@@ -250,19 +251,78 @@ func (w *KafkaProducer) FlushBuffer(buf *[]dnsutils.DNSMessage) {
 			<-w.kafkaReconnect
 		}
 	}
+	return err
+}
+
+func (w *KafkaProducer) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+	msgs := []kafka.Message{}
+	for i := range *buf {
+		msgs = append(msgs, w.EncodeMessage(&(*buf)[i]))
+	}
+
+	// keep the messages not sent in the spool
+	if err := w.WriteMessages(msgs); err != nil {
+		w.SpoolKafkaMessages(msgs)
+	}
 
 	// reset buffer
 	*buf = nil
 }
 
+// SpoolKafkaMessages saves the kafka messages on disk until the connection is back,
+// a record is the length of the key followed by the key and the value
+func (w *KafkaProducer) SpoolKafkaMessages(msgs []kafka.Message) {
+	if w.spool == nil {
+		return
+	}
+	for _, msg := range msgs {
+		record := make([]byte, 2, 2+len(msg.Key)+len(msg.Value))
+		binary.BigEndian.PutUint16(record, uint16(len(msg.Key)))
+		record = append(record, msg.Key...)
+		record = append(record, msg.Value...)
+		if err := w.spool.Write(record); err != nil && !errors.Is(err, ErrSpoolFull) {
+			w.LogError("spool - %s", err)
+		}
+	}
+}
+
+// SpoolMessages encodes and saves the buffer in the spool, the buffer is reset
+func (w *KafkaProducer) SpoolMessages(buf *[]dnsutils.DNSMessage) {
+	if w.spool != nil {
+		msgs := []kafka.Message{}
+		for i := range *buf {
+			msgs = append(msgs, w.EncodeMessage(&(*buf)[i]))
+		}
+		w.SpoolKafkaMessages(msgs)
+	}
+	*buf = nil
+}
+
+// ReplaySpool sends the kafka messages saved during the outage
+func (w *KafkaProducer) ReplaySpool(maxBatches int) {
+	if w.spool == nil || !w.kafkaConnected || !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.GetConfig().Loggers.KafkaProducer.Spool.ReplayBatch, maxBatches, func(records [][]byte) error {
+		msgs := []kafka.Message{}
+		for _, record := range records {
+			if len(record) < 2 || len(record) < 2+int(binary.BigEndian.Uint16(record)) {
+				continue
+			}
+			keyLen := 2 + int(binary.BigEndian.Uint16(record))
+			msgs = append(msgs, kafka.Message{Key: record[2:keyLen], Value: record[keyLen:]})
+		}
+		return w.WriteMessages(msgs)
+	})
+	if err != nil {
+		w.LogError("spool - replay failed: %s", err)
+	}
+}
+
 func (w *KafkaProducer) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -297,7 +357,7 @@ func (w *KafkaProducer) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -306,7 +366,7 @@ func (w *KafkaProducer) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -333,7 +393,11 @@ func (w *KafkaProducer) StartLogging() {
 	for {
 		select {
 		case <-w.OnLoggerStopped():
-			// closing kafka connection if exist
+			// keep the buffer in the spool and closing kafka connection if exist
+			w.SpoolMessages(&bufferDm)
+			if w.spool != nil {
+				w.spool.Close()
+			}
 			w.Disconnect()
 			return
 
@@ -353,8 +417,15 @@ func (w *KafkaProducer) StartLogging() {
 				return
 			}
 
-			// drop dns message if the connection is not ready to avoid memory leak or
-			// to block the channel
+			// save the message on disk while the connection is not ready or the spool
+			// is not fully replayed to keep the order, otherwise drop the dns message
+			// to avoid memory leak or to block the channel
+			if w.spool != nil && (!w.kafkaConnected || w.spool.Pending()) {
+				bufferDm = append(bufferDm, dm)
+				w.SpoolMessages(&bufferDm)
+				w.ReplaySpool(1)
+				continue
+			}
 			if !w.kafkaConnected {
 				continue
 			}
@@ -370,13 +441,21 @@ func (w *KafkaProducer) StartLogging() {
 		// flush the buffer
 		case <-flushTimer.C:
 			if !w.kafkaConnected {
-				bufferDm = nil
+				w.SpoolMessages(&bufferDm)
 			}
 
 			if len(bufferDm) > 0 {
 				w.FlushBuffer(&bufferDm)
 			}
 
+			// replay messages saved during the outage
+			w.ReplaySpool(0)
+			if w.spool != nil {
+				if dropped := w.spool.Dropped(); dropped > 0 {
+					w.LogWarning("spool is full, %d messages dropped", dropped)
+				}
+			}
+
 			// restart timer
 			flushTimer.Reset(flushInterval)
 		}
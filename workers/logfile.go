@@ -24,6 +24,7 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcapgo"
+	"github.com/parquet-go/parquet-go"
 
 	framestream "github.com/farsightsec/golang-framestream"
 )
@@ -40,7 +41,8 @@ func IsValid(mode string) bool {
 		pkgconfig.ModeJSON,
 		pkgconfig.ModeFlatJSON,
 		pkgconfig.ModePCAP,
-		pkgconfig.ModeDNSTap:
+		pkgconfig.ModeDNSTap,
+		pkgconfig.ModeParquet:
 		return true
 	}
 	return false
@@ -51,6 +53,9 @@ type LogFile struct {
 	writerPlain                            *bufio.Writer
 	writerPcap                             *pcapgo.Writer
 	writerDnstap                           *framestream.Encoder
+	writerParquet                          *parquet.Writer
+	parquetPendingSize                     int64
+	parquetPendingRows                     int
 	fileFd                                 *os.File
 	fileSize                               int64
 	fileDir, fileName, fileExt, filePrefix string
@@ -162,9 +167,31 @@ func (w *LogFile) RemoveOldFiles() error {
 	return nil
 }
 
+// countingWriter counts the bytes written to the log file by the parquet writer
+type countingWriter struct {
+	io.Writer
+	size *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	*c.size += int64(n)
+	return n, err
+}
+
 func (w *LogFile) OpenCurrentFile() error {
 	w.LogInfo("create new log file: %s", w.GetConfig().Loggers.LogFile.FilePath)
 
+	// a parquet file can not be appended, the file of a previous run is kept aside
+	if w.GetConfig().Loggers.LogFile.Mode == pkgconfig.ModeParquet {
+		if fi, err := os.Stat(w.GetConfig().Loggers.LogFile.FilePath); err == nil && fi.Size() > 0 {
+			oldFilename := fmt.Sprintf("%s-%d%s", w.filePrefix, fi.ModTime().UnixNano(), w.fileExt)
+			if err := os.Rename(w.GetConfig().Loggers.LogFile.FilePath, filepath.Join(w.fileDir, oldFilename)); err != nil {
+				return err
+			}
+		}
+	}
+
 	fd, err := os.OpenFile(w.GetConfig().Loggers.LogFile.FilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		return err
@@ -197,6 +224,11 @@ func (w *LogFile) OpenCurrentFile() error {
 			return err
 		}
 
+	case pkgconfig.ModeParquet:
+		// the writer is created with the first message, the schema depends on the enabled transformers
+		w.writerParquet = nil
+		w.parquetPendingSize = 0
+		w.parquetPendingRows = 0
 	}
 
 	w.LogInfo("new log file created")
@@ -315,6 +347,19 @@ func (w *LogFile) FlushWriters() {
 	}
 }
 
+// CloseParquetWriter writes the footer of the parquet file, the file is valid only after that
+func (w *LogFile) CloseParquetWriter() {
+	if w.writerParquet == nil {
+		return
+	}
+	if err := w.writerParquet.Close(); err != nil {
+		w.LogError("failed to close parquet writer: %s", err)
+	}
+	w.writerParquet = nil
+	w.parquetPendingSize = 0
+	w.parquetPendingRows = 0
+}
+
 func (w *LogFile) RotateFile() error {
 	// close writer and existing file
 	w.FlushWriters()
@@ -322,6 +367,9 @@ func (w *LogFile) RotateFile() error {
 	if w.GetConfig().Loggers.LogFile.Mode == pkgconfig.ModeDNSTap {
 		w.writerDnstap.Close()
 	}
+	if w.GetConfig().Loggers.LogFile.Mode == pkgconfig.ModeParquet {
+		w.CloseParquetWriter()
+	}
 
 	if err := w.fileFd.Close(); err != nil {
 		return err
@@ -329,7 +377,7 @@ func (w *LogFile) RotateFile() error {
 
 	// Rename current log file
 	newFilename := fmt.Sprintf("%s-%d%s", w.filePrefix, time.Now().UnixNano(), w.fileExt)
-	if w.config.Loggers.LogFile.Compress {
+	if w.IsGzipCompressed() {
 		newFilename = fmt.Sprintf("tocompress-%s", newFilename)
 	} else if len(w.config.Loggers.LogFile.PostRotateCommand) > 0 {
 		newFilename = fmt.Sprintf("toprocess-%s", newFilename)
@@ -341,7 +389,7 @@ func (w *LogFile) RotateFile() error {
 	}
 
 	// post rotate command?
-	if w.config.Loggers.LogFile.Compress {
+	if w.IsGzipCompressed() {
 		go func() {
 			w.compressQueue <- bfpath
 		}()
@@ -418,6 +466,67 @@ func (w *LogFile) WriteToPlain(data []byte) {
 	w.fileSize += int64(n)
 }
 
+// IsGzipCompressed returns true if the rotated files are compressed with gzip,
+// the parquet files are compressed internally to remain valid parquet files
+func (w *LogFile) IsGzipCompressed() bool {
+	return w.config.Loggers.LogFile.Compress && w.config.Loggers.LogFile.Mode != pkgconfig.ModeParquet
+}
+
+func (w *LogFile) WriteToParquet(dm dnsutils.DNSMessage) {
+	columns, err := dm.FlattenColumns()
+	if err != nil {
+		w.LogError("flattening DNS message failed: %s", err)
+		return
+	}
+
+	// estimated size of the row before compression
+	var rowSize int64
+	for _, value := range columns {
+		if s, ok := value.(string); ok {
+			rowSize += int64(len(s))
+		} else {
+			rowSize += 8
+		}
+	}
+
+	// rotate file ?
+	if w.writerParquet != nil && (w.fileSize+w.parquetPendingSize+rowSize) > w.GetMaxSize() {
+		if err := w.RotateFile(); err != nil {
+			w.LogError("failed to rotate file: %s", err)
+			return
+		}
+	}
+
+	if w.writerParquet == nil {
+		schema, err := dnsutils.ParquetSchema(dm.Relabeling)
+		if err != nil {
+			w.LogError("parquet schema failed: %s", err)
+			return
+		}
+		options := []parquet.WriterOption{schema, parquet.CreatedBy("go-dnscollector", "", "")}
+		if w.GetConfig().Loggers.LogFile.Compress {
+			options = append(options, parquet.Compression(&parquet.Gzip))
+		}
+		w.writerParquet = parquet.NewWriter(&countingWriter{Writer: w.fileFd, size: &w.fileSize}, options...)
+	}
+
+	if _, err := w.writerParquet.WriteRows([]parquet.Row{dnsutils.ParquetRow(w.writerParquet.Schema(), columns)}); err != nil {
+		w.LogError("failed to write parquet row: %s", err)
+		return
+	}
+	w.parquetPendingSize += rowSize
+	w.parquetPendingRows++
+
+	// write the row group
+	if w.parquetPendingRows >= w.GetConfig().Loggers.LogFile.ParquetRowGroupSize {
+		if err := w.writerParquet.Flush(); err != nil {
+			w.LogError("failed to flush parquet row group: %s", err)
+		}
+		w.parquetPendingSize = 0
+		w.parquetPendingRows = 0
+	}
+}
+
 func (w *LogFile) WriteToDnstap(data []byte) {
 	dataSize := int64(len(data))
 
@@ -484,10 +593,6 @@ func (w *LogFile) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -523,7 +628,7 @@ func (w *LogFile) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -533,7 +638,7 @@ func (w *LogFile) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -578,6 +683,9 @@ func (w *LogFile) StartLogging() {
 			if w.GetConfig().Loggers.LogFile.Mode == pkgconfig.ModeDNSTap {
 				w.writerDnstap.Close()
 			}
+			if w.GetConfig().Loggers.LogFile.Mode == pkgconfig.ModeParquet {
+				w.CloseParquetWriter()
+			}
 			w.fileFd.Close()
 
 			return
@@ -643,6 +751,10 @@ func (w *LogFile) StartLogging() {
 
 				// write the packet
 				w.WriteToPcap(dm, pkt)
+
+			// with parquet mode
+			case pkgconfig.ModeParquet:
+				w.WriteToParquet(dm)
 			}
 
 			// Update the batch size
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/dmachard/go-logger"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/parquet-go/parquet-go"
 )
 
 func Test_LogFileText(t *testing.T) {
@@ -132,3 +134,81 @@ func Test_LogFileWrite_PcapMode(t *testing.T) {
 		t.Errorf("no data in pcap file")
 	}
 }
+
+func readParquetColumn(t *testing.T, path, key string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, _ := f.Stat()
+
+	file, err := parquet.OpenFile(f, fi.Size())
+	if err != nil {
+		t.Fatalf("invalid parquet file %s: %s", path, err)
+	}
+	column, ok := file.Schema().Lookup(key)
+	if !ok {
+		t.Fatalf("%s column missing", key)
+	}
+
+	rows := make([]parquet.Row, file.NumRows())
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+	n, _ := reader.ReadRows(rows)
+
+	var values []string
+	for _, row := range rows[:n] {
+		values = append(values, row[column.ColumnIndex].String())
+	}
+	return values
+}
+
+func Test_LogFileWrite_ParquetMode(t *testing.T) {
+	dir := t.TempDir()
+
+	// config
+	config := pkgconfig.GetDefaultConfig()
+	config.Loggers.LogFile.FilePath = filepath.Join(dir, "dnslogs.parquet")
+	config.Loggers.LogFile.Mode = pkgconfig.ModeParquet
+	config.Loggers.LogFile.Compress = true
+	config.Loggers.LogFile.ParquetRowGroupSize = 2
+
+	g := NewLogFile(config, logger.New(false), "test")
+
+	// write some dns messages then rotate
+	for i := 0; i < 3; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = fmt.Sprintf("%d.dns.collector", i)
+		g.WriteToParquet(dm)
+	}
+	if err := g.RotateFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the keys absent from the first message are kept
+	g.WriteToParquet(dnsutils.GetFakeDNSMessage())
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Anomalies = []string{"pointer-loop"}
+	g.WriteToParquet(dm)
+	g.CloseParquetWriter()
+
+	// the rotated file is a valid parquet file, not compressed with gzip
+	rotated, _ := filepath.Glob(filepath.Join(dir, "dnslogs-*.parquet"))
+	if len(rotated) != 1 {
+		t.Fatalf("one rotated file expected, got %v", rotated)
+	}
+	qnames := readParquetColumn(t, rotated[0], "dns.qname")
+	if len(qnames) != 3 || qnames[2] != "2.dns.collector" {
+		t.Errorf("invalid rows in rotated file: %v", qnames)
+	}
+
+	qnames = readParquetColumn(t, config.Loggers.LogFile.FilePath, "dns.qname")
+	if len(qnames) != 2 || qnames[1] != dm.DNS.Qname {
+		t.Errorf("invalid rows in current file: %v", qnames)
+	}
+	anomalies := readParquetColumn(t, config.Loggers.LogFile.FilePath, "dns.anomalies")
+	if len(anomalies) != 2 || anomalies[1] != `["pointer-loop"]` {
+		t.Errorf("invalid anomalies in current file: %v", anomalies)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -69,6 +70,7 @@ type LokiClient struct {
 	httpclient *http.Client
 	textFormat []string
 	streams    map[string]*LokiStream
+	spool      *DiskSpool
 }
 
 func NewLokiClient(config *pkgconfig.Config, logger *logger.Logger, name string) *LokiClient {
@@ -79,6 +81,7 @@ func NewLokiClient(config *pkgconfig.Config, logger *logger.Logger, name string)
 	w := &LokiClient{GenericWorker: NewGenericWorker(config, logger, name, "loki", bufSize, pkgconfig.DefaultMonitor)}
 	w.streams = make(map[string]*LokiStream)
 	w.ReadConfig()
+	w.spool = NewWorkerSpool(w.GenericWorker, config.Loggers.LokiClient.Spool)
 	return w
 }
 
@@ -135,10 +138,6 @@ func (w *LokiClient) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -173,7 +172,7 @@ func (w *LokiClient) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -182,7 +181,7 @@ func (w *LokiClient) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -202,6 +201,9 @@ func (w *LokiClient) StartLogging() {
 	for {
 		select {
 		case <-w.OnLoggerStopped():
+			if w.spool != nil {
+				w.spool.Close()
+			}
 			return
 
 		// incoming dns message to process
@@ -299,7 +301,7 @@ func (w *LokiClient) StartLogging() {
 				}
 
 				// send all entries
-				w.SendEntries(buf)
+				w.PushEntries(buf)
 
 				// reset entries and push request
 				ls.ResetEntries()
@@ -321,20 +323,71 @@ func (w *LokiClient) StartLogging() {
 					}
 
 					// send all entries
-					w.SendEntries(buf)
+					w.PushEntries(buf)
 
 					// reset entries and push request
 					s.ResetEntries()
 				}
 			}
 
+			// replay entries saved during the outage
+			w.ReplaySpool(0)
+			if w.spool != nil {
+				if dropped := w.spool.Dropped(); dropped > 0 {
+					w.LogWarning("spool is full, %d push requests dropped", dropped)
+				}
+			}
+
 			// restart timer
 			tflush.Reset(tflushInterval)
 		}
 	}
 }
 
-func (w *LokiClient) SendEntries(buf []byte) {
+// PushEntries sends the push request or saves it on disk when the server is unreachable,
+// the push requests are also saved while the spool is replayed to keep the order
+func (w *LokiClient) PushEntries(buf []byte) {
+	if w.spool != nil && w.spool.Pending() {
+		w.SpoolEntries(buf)
+		w.ReplaySpool(1)
+		return
+	}
+
+	if err := w.SendEntries(buf); err != nil {
+		w.SpoolEntries(buf)
+	}
+}
+
+func (w *LokiClient) SpoolEntries(buf []byte) {
+	if w.spool == nil {
+		return
+	}
+	if err := w.spool.Write(buf); err != nil && !errors.Is(err, ErrSpoolFull) {
+		w.LogError("spool - %s", err)
+	}
+}
+
+// ReplaySpool sends the push requests saved during the outage
+func (w *LokiClient) ReplaySpool(maxBatches int) {
+	if w.spool == nil || !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.GetConfig().Loggers.LokiClient.Spool.ReplayBatch, maxBatches, func(records [][]byte) error {
+		for _, record := range records {
+			if err := w.SendEntries(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.LogError("spool - replay failed: %s", err)
+	}
+}
+
+// SendEntries posts the push request with retries, an error is returned when
+// the server is unreachable
+func (w *LokiClient) SendEntries(buf []byte) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -354,7 +407,7 @@ func (w *LokiClient) SendEntries(buf []byte) {
 		post, err := http.NewRequest("POST", w.GetConfig().Loggers.LokiClient.ServerURL, bytes.NewReader(buf))
 		if err != nil {
 			w.LogError("new http error: %s", err)
-			return
+			return nil
 		}
 		post = post.WithContext(ctx)
 		post.Header.Set("Content-Type", "application/x-protobuf")
@@ -372,11 +425,12 @@ func (w *LokiClient) SendEntries(buf []byte) {
 		resp, err := w.httpclient.Do(post)
 		if err != nil {
 			w.LogError("do http error: %s", err)
-			return
+			return err
 		}
 
 		// success ?
 		if resp.StatusCode > 0 && resp.StatusCode != 429 && resp.StatusCode/100 != 5 {
+			resp.Body.Close()
 			break
 		}
 
@@ -389,13 +443,15 @@ func (w *LokiClient) SendEntries(buf []byte) {
 			}
 			w.LogError("server returned HTTP status %s (%d): %s", resp.Status, resp.StatusCode, line)
 		}
+		resp.Body.Close()
 
 		// wait before retry
 		backoff.Wait()
 
 		// Make sure it sends at least once before checking for retry.
 		if !backoff.Ongoing() {
-			break
+			return fmt.Errorf("server returned HTTP status %s", resp.Status)
 		}
 	}
+	return nil
 }
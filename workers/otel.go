@@ -74,9 +74,6 @@ func (w *OpenTelemetryClient) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -112,7 +109,7 @@ func (w *OpenTelemetryClient) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -127,9 +124,6 @@ func (w *OpenTelemetryClient) StartLogging() {
 	w.LogInfo("logging has started")
 	defer w.LoggingDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-
 	// Maps to follow the state of the spans
 	requestorSpans := sync.Map{}
 	messageSpans := sync.Map{}
@@ -171,7 +165,7 @@ func (w *OpenTelemetryClient) StartLogging() {
 			}
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
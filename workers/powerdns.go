@@ -64,8 +64,7 @@ func (w *PdnsServer) HandleConn(conn net.Conn, connID uint64, forceClose chan bo
 	}
 	pdnsProcessor := NewPdnsProcessor(int(connID), peerName, w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
 	pdnsProcessor.SetMetrics(w.metrics)
-	pdnsProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	pdnsProcessor.SetDefaultDropped(w.GetDroppedRoutes())
+	pdnsProcessor.ShareRouting(w.GenericWorker)
 	go pdnsProcessor.StartCollect()
 
 	r := bufio.NewReader(conn)
@@ -226,8 +225,7 @@ func (w *PdnsProcessor) StartCollect() {
 	pbdm := &powerdns_protobuf.PBDNSMessage{}
 
 	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
 
 	// prepare enabled transformers
 	transforms := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, w.ConnID)
@@ -466,12 +464,12 @@ func (w *PdnsProcessor) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
 			// dispatch dns messages to connected loggers
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -49,6 +49,7 @@ type EpsCounters struct {
 	TotalRcodes, TotalQtypes                       map[string]float64
 	TotalIPVersion, TotalIPProtocol                map[string]float64
 	TotalOperations                                map[string]float64
+	TotalAnomalies                                 map[string]float64
 	TotalDNSMessages                               float64
 	TotalQueries, TotalReplies                     int
 	TotalBytes, TotalBytesSent, TotalBytesReceived int
@@ -168,6 +169,7 @@ type Prometheus struct {
 	counterIPProtocol, counterIPVersion                      *prometheus.Desc
 	counterDNSMessages, counterDNSQueries, counterDNSReplies *prometheus.Desc
 	counterOperations                                        *prometheus.Desc
+	counterAnomalies                                         *prometheus.Desc
 
 	counterFlagsTC, counterFlagsAA                                         *prometheus.Desc
 	counterFlagsRA, counterFlagsAD                                         *prometheus.Desc
@@ -198,7 +200,7 @@ func newPrometheusCounterSet(w *Prometheus, labels prometheus.Labels) *Prometheu
 		epsCounters: EpsCounters{
 			TotalRcodes: make(map[string]float64), TotalQtypes: make(map[string]float64),
 			TotalIPVersion: make(map[string]float64), TotalIPProtocol: make(map[string]float64),
-			TotalOperations: make(map[string]float64),
+			TotalOperations: make(map[string]float64), TotalAnomalies: make(map[string]float64),
 		},
 
 		topRequesters:   topmap.NewTopMap(w.GetConfig().Loggers.Prometheus.TopN),
@@ -252,6 +254,7 @@ func (w *PrometheusCountersSet) Describe(ch chan<- *prometheus.Desc) {
 	ch <- w.prom.counterQtypes
 	ch <- w.prom.counterRcodes
 	ch <- w.prom.counterOperations
+	ch <- w.prom.counterAnomalies
 	ch <- w.prom.counterIPProtocol
 	ch <- w.prom.counterIPVersion
 	ch <- w.prom.counterDNSMessages
@@ -411,6 +414,9 @@ func (w *PrometheusCountersSet) Record(dm dnsutils.DNSMessage) {
 	if dm.DNS.MalformedPacket {
 		w.epsCounters.TotalMalformed++
 	}
+	for _, anomaly := range dm.DNS.Anomalies {
+		w.epsCounters.TotalAnomalies[anomaly]++
+	}
 	if dm.NetworkInfo.IPDefragmented {
 		w.epsCounters.TotalFragmented++
 	}
@@ -537,6 +543,13 @@ func (w *PrometheusCountersSet) Collect(ch chan<- prometheus.Metric) {
 		)
 	}
 
+	// Update parse anomalies counter
+	for k, v := range w.epsCounters.TotalAnomalies {
+		ch <- prometheus.MustNewConstMetric(w.prom.counterAnomalies, prometheus.CounterValue,
+			v, k,
+		)
+	}
+
 	// Update IP protocol counter
 	for k, v := range w.epsCounters.TotalIPProtocol {
 		ch <- prometheus.MustNewConstMetric(w.prom.counterIPProtocol, prometheus.CounterValue,
@@ -905,6 +918,12 @@ func (w *Prometheus) InitProm() {
 		[]string{"operation"}, nil,
 	)
 
+	w.counterAnomalies = prometheus.NewDesc(
+		fmt.Sprintf("%s_anomalies_total", promPrefix),
+		"Counter of parse anomalies per type",
+		[]string{"anomaly"}, nil,
+	)
+
 	w.counterIPProtocol = prometheus.NewDesc(
 		fmt.Sprintf("%s_ipprotocol_total", promPrefix),
 		"Counter of packets per IP protocol",
@@ -1131,10 +1150,6 @@ func (w *Prometheus) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -1175,7 +1190,7 @@ func (w *Prometheus) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -1184,7 +1199,7 @@ func (w *Prometheus) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
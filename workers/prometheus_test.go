@@ -102,6 +102,7 @@ func getMetricsTestCase(config *pkgconfig.Config, labels map[string]string) func
 		nxRecord.NetworkInfo.Family = IPv4
 		nxRecord.DNS.Length = 123
 		nxRecord.DNSTap.Latency = 0.05
+		nxRecord.DNS.Anomalies = []string{dnsutils.AnomalyPointerLoop}
 
 		g.Record(nxRecord)
 
@@ -157,6 +158,9 @@ func getMetricsTestCase(config *pkgconfig.Config, labels map[string]string) func
 		labels["net_family"] = "IPv4"
 		ensureMetricValue(t, mf, "dnscollector_ipversion_total", labels, 3)
 		delete(labels, "net_family")
+		labels["anomaly"] = dnsutils.AnomalyPointerLoop
+		ensureMetricValue(t, mf, "dnscollector_anomalies_total", labels, 1)
+		delete(labels, "anomaly")
 
 		// check histogram
 		ensureMetricValue(t, mf, "dnscollector_latencies", labels, 3)
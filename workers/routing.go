@@ -0,0 +1,124 @@
+package workers
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+)
+
+// ConditionalRoute forwards the dns messages matching the include/exclude conditions
+type ConditionalRoute struct {
+	Include, Exclude map[string]interface{}
+	Routes           []Worker
+	channels         []chan dnsutils.DNSMessage
+	names            []string
+}
+
+// routingTable is an immutable snapshot of the routes, read for each dns message
+type routingTable struct {
+	defaultRoutes, droppedRoutes     []Worker
+	defaultChannels, droppedChannels []chan dnsutils.DNSMessage
+	defaultNames, droppedNames       []string
+	conditional                      []ConditionalRoute
+}
+
+// Routing holds the routes of a worker, it is shared with the processors of the worker
+// and can be replaced at runtime without restarting them
+type Routing struct {
+	sync.Mutex
+	defaultRoutes, droppedRoutes []Worker
+	conditionalRoutes            []ConditionalRoute
+	table                        atomic.Pointer[routingTable]
+	paused                       atomic.Bool
+}
+
+func NewRouting() *Routing {
+	r := &Routing{}
+	r.table.Store(&routingTable{})
+	return r
+}
+
+func (r *Routing) GetDefaultRoutes() []Worker {
+	r.Lock()
+	defer r.Unlock()
+	return append([]Worker{}, r.defaultRoutes...)
+}
+
+func (r *Routing) GetDroppedRoutes() []Worker {
+	r.Lock()
+	defer r.Unlock()
+	return append([]Worker{}, r.droppedRoutes...)
+}
+
+func (r *Routing) GetConditionalRoutes() []ConditionalRoute {
+	r.Lock()
+	defer r.Unlock()
+	return append([]ConditionalRoute{}, r.conditionalRoutes...)
+}
+
+func (r *Routing) AddDefaultRoute(wrk Worker) {
+	r.Lock()
+	defer r.Unlock()
+	r.defaultRoutes = append(r.defaultRoutes, wrk)
+	r.publish()
+}
+
+func (r *Routing) AddDroppedRoute(wrk Worker) {
+	r.Lock()
+	defer r.Unlock()
+	r.droppedRoutes = append(r.droppedRoutes, wrk)
+	r.publish()
+}
+
+func (r *Routing) AddConditionalRoute(route ConditionalRoute) {
+	r.Lock()
+	defer r.Unlock()
+	route.channels, route.names = GetRoutes(route.Routes)
+	r.conditionalRoutes = append(r.conditionalRoutes, route)
+	r.publish()
+}
+
+func (r *Routing) SetDefaultRoutes(workers []Worker) {
+	r.Lock()
+	defer r.Unlock()
+	r.defaultRoutes = workers
+	r.publish()
+}
+
+func (r *Routing) SetDroppedRoutes(workers []Worker) {
+	r.Lock()
+	defer r.Unlock()
+	r.droppedRoutes = workers
+	r.publish()
+}
+
+// Replace swaps all the routes at once with the routes of another routing,
+// the dns messages in flight are sent either to the old routes or to the new ones
+func (r *Routing) Replace(other *Routing) {
+	other.Lock()
+	defaultRoutes := append([]Worker{}, other.defaultRoutes...)
+	droppedRoutes := append([]Worker{}, other.droppedRoutes...)
+	conditionalRoutes := append([]ConditionalRoute{}, other.conditionalRoutes...)
+	other.Unlock()
+
+	r.Lock()
+	defer r.Unlock()
+	r.defaultRoutes, r.droppedRoutes, r.conditionalRoutes = defaultRoutes, droppedRoutes, conditionalRoutes
+	r.publish()
+}
+
+// publish computes the channels of the routes, the lock must be held
+func (r *Routing) publish() {
+	table := &routingTable{defaultRoutes: r.defaultRoutes, droppedRoutes: r.droppedRoutes, conditional: r.conditionalRoutes}
+	table.defaultChannels, table.defaultNames = GetRoutes(r.defaultRoutes)
+	table.droppedChannels, table.droppedNames = GetRoutes(r.droppedRoutes)
+	r.table.Store(table)
+}
+
+func (r *Routing) getTable() *routingTable { return r.table.Load() }
+
+// SetPaused suspends the routes, the messages are neither received nor forwarded
+func (r *Routing) SetPaused(paused bool) { r.paused.Store(paused) }
+
+func (r *Routing) IsPaused() bool { return r.paused.Load() }
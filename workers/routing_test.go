@@ -0,0 +1,70 @@
+package workers
+
+import (
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+)
+
+func TestRouting_ReplaceSharedRoutes(t *testing.T) {
+	oldRoute := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	newRoute := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	dropped := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+
+	// the processor shares the routes of the collector
+	collector := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	collector.AddDefaultRoute(oldRoute)
+	processor := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	processor.ShareRouting(collector)
+
+	processor.SendForwardedTo(dnsutils.GetFakeDNSMessage())
+	if len(oldRoute.GetInputChannel()) != 1 {
+		t.Fatalf("message expected on the initial route")
+	}
+
+	// replace all the routes at once
+	routing := NewRouting()
+	routing.AddDefaultRoute(newRoute)
+	routing.AddDroppedRoute(dropped)
+	collector.GetRouting().Replace(routing)
+
+	processor.SendForwardedTo(dnsutils.GetFakeDNSMessage())
+	processor.SendDroppedTo(dnsutils.GetFakeDNSMessage())
+	if len(oldRoute.GetInputChannel()) != 1 {
+		t.Errorf("no more message expected on the old route")
+	}
+	if len(newRoute.GetInputChannel()) != 1 {
+		t.Errorf("message expected on the new route")
+	}
+	if len(dropped.GetInputChannel()) != 1 {
+		t.Errorf("message expected on the dropped route")
+	}
+}
+
+func TestRouting_Paused(t *testing.T) {
+	next := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	collector := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	collector.AddDefaultRoute(next)
+
+	// a paused worker does not forward messages
+	collector.Pause()
+	collector.SendForwardedTo(dnsutils.GetFakeDNSMessage())
+	if len(next.GetInputChannel()) != 0 {
+		t.Errorf("no message expected from a paused worker")
+	}
+	collector.Resume()
+
+	// and does not receive messages
+	next.Pause()
+	collector.SendForwardedTo(dnsutils.GetFakeDNSMessage())
+	if len(next.GetInputChannel()) != 0 {
+		t.Errorf("no message expected to a paused worker")
+	}
+	next.Resume()
+
+	collector.SendForwardedTo(dnsutils.GetFakeDNSMessage())
+	if len(next.GetInputChannel()) != 1 {
+		t.Errorf("message expected once resumed")
+	}
+}
@@ -18,7 +18,6 @@ import (
 	"github.com/dmachard/go-netutils"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"golang.org/x/net/bpf"
 )
 
 type AfpacketSniffer struct {
@@ -67,16 +66,14 @@ func (w *AfpacketSniffer) Listen() error {
 		return err
 	}
 
-	var filter []bpf.Instruction
 	isEthernet := true
 	if w.GetConfig().Collectors.AfpacketLiveCapture.RawIPSupport {
 		isEthernet = false
 	}
-	filter, err = netutils.GetBpfDnsFilterPort(w.GetConfig().Collectors.AfpacketLiveCapture.Port, isEthernet)
-
-	if w.GetConfig().Collectors.AfpacketLiveCapture.GreSupport {
-		filter, err = netutils.GetBpfGreDnsFilterPort(w.GetConfig().Collectors.AfpacketLiveCapture.Port)
-	}
+	filter, err := GetBpfCaptureFilter(w.GetCapturePorts(),
+		w.GetConfig().Collectors.AfpacketLiveCapture.BpfFilter,
+		isEthernet,
+		w.GetConfig().Collectors.AfpacketLiveCapture.GreSupport)
 	if err != nil {
 		return err
 	}
@@ -91,6 +88,36 @@ func (w *AfpacketSniffer) Listen() error {
 	return nil
 }
 
+// NewCapturePorts returns the dns ports to capture with their labels
+func (w *AfpacketSniffer) NewCapturePorts() *CapturePorts {
+	cfg := w.GetConfig().Collectors.AfpacketLiveCapture
+	return NewCapturePorts(cfg.Port, cfg.Ports, cfg.PortLabels)
+}
+
+// GetCapturePorts returns the dns ports and the DoT/DoH ports if a tls keylog file is provided
+func (w *AfpacketSniffer) GetCapturePorts() []int {
+	return append(w.NewCapturePorts().List(), w.GetTLSPorts()...)
+}
+
+// GetTLSPorts returns the DoT and DoH ports to decrypt, empty without tls keylog file
+func (w *AfpacketSniffer) GetTLSPorts() []int {
+	cfg := w.GetConfig().Collectors.AfpacketLiveCapture
+	if cfg.TLSKeyLogFile == "" {
+		return nil
+	}
+	return []int{cfg.DoTPort, cfg.DoHPort}
+}
+
+// IsTLSPort returns true if the tcp packet belongs to a DoT or DoH flow to decrypt
+func IsTLSPort(tcp *layers.TCP, tlsPorts []int) bool {
+	for _, port := range tlsPorts {
+		if int(tcp.SrcPort) == port || int(tcp.DstPort) == port {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *AfpacketSniffer) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
@@ -107,8 +134,8 @@ func (w *AfpacketSniffer) StartCollect() {
 		bufSize = w.GetConfig().Collectors.AfpacketLiveCapture.ChannelBufferSize
 	}
 	dnsProcessor := NewDNSProcessor(w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
-	dnsProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	dnsProcessor.SetDefaultDropped(w.GetDroppedRoutes())
+	dnsProcessor.ShareRouting(w.GenericWorker)
+	dnsProcessor.SetRdataFields(w.GetConfig().Collectors.AfpacketLiveCapture.RdataFields)
 	go dnsProcessor.StartCollect()
 
 	dnsChan := make(chan netutils.DNSPacket)
@@ -124,11 +151,14 @@ func (w *AfpacketSniffer) StartCollect() {
 		netDecoder = &netutils.NetDecoder{}
 	}
 
+	// packets are filtered on the dns ports before the processing
+	ports := w.NewCapturePorts()
+
 	// defrag ipv4
-	go netutils.IPDefragger(fragIP4Chan, udpChan, tcpChan, w.GetConfig().Collectors.AfpacketLiveCapture.Port)
+	go CaptureIPDefragger(fragIP4Chan, udpChan, tcpChan, ports)
 
 	// defrag ipv6
-	go netutils.IPDefragger(fragIP6Chan, udpChan, tcpChan, w.GetConfig().Collectors.AfpacketLiveCapture.Port)
+	go CaptureIPDefragger(fragIP6Chan, udpChan, tcpChan, ports)
 
 	// tcp assembly
 	go netutils.TCPAssembler(tcpChan, dnsChan, 0)
@@ -136,6 +166,22 @@ func (w *AfpacketSniffer) StartCollect() {
 	// udp processor
 	go netutils.UDPProcessor(udpChan, dnsChan, 0)
 
+	// decrypt DoT and DoH flows with the secrets from the tls keylog file,
+	// the ports are read once, the tls assembler is not started on reload
+	tlsChan := make(chan TLSPacket)
+	tlsTCPChan := make(chan gopacket.Packet)
+	tlsPorts := w.GetTLSPorts()
+	if len(tlsPorts) > 0 {
+		keylogFile := w.GetConfig().Collectors.AfpacketLiveCapture.TLSKeyLogFile
+		keylog, err := NewTLSKeyLog(keylogFile)
+		if err != nil {
+			w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] unable to read tls keylog file: ", err)
+		}
+		factory := NewTLSStreamFactory(keylog, tlsPorts[0], tlsPorts[1], tlsChan, w.LogError)
+		go TLSAssembler(tlsTCPChan, factory)
+		w.LogInfo("tls decryption enabled with keylog file %s", keylogFile)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 	go func(ctx context.Context) {
@@ -247,6 +293,9 @@ func (w *AfpacketSniffer) StartCollect() {
 
 				// tcp or udp packets ?
 				if packet.TransportLayer().LayerType() == layers.LayerTypeUDP {
+					if !ports.Match(packet) {
+						continue
+					}
 					select {
 					case <-ctx.Done():
 						return
@@ -255,10 +304,16 @@ func (w *AfpacketSniffer) StartCollect() {
 				}
 
 				if packet.TransportLayer().LayerType() == layers.LayerTypeTCP {
+					outputChan := tcpChan
+					if IsTLSPort(packet.TransportLayer().(*layers.TCP), tlsPorts) {
+						outputChan = tlsTCPChan
+					} else if !ports.Match(packet) {
+						continue
+					}
 					select {
 					case <-ctx.Done():
 						return
-					case tcpChan <- packet:
+					case outputChan <- packet:
 					}
 				}
 			}
@@ -285,28 +340,46 @@ func (w *AfpacketSniffer) StartCollect() {
 
 		// dns message to read ?
 		case dnsPacket := <-dnsChan:
-			// reset
-			dm.Init()
-
-			dm.NetworkInfo.Family = dnsPacket.IPLayer.EndpointType().String()
-			dm.NetworkInfo.QueryIP = dnsPacket.IPLayer.Src().String()
-			dm.NetworkInfo.ResponseIP = dnsPacket.IPLayer.Dst().String()
-			dm.NetworkInfo.QueryPort = dnsPacket.TransportLayer.Src().String()
-			dm.NetworkInfo.ResponsePort = dnsPacket.TransportLayer.Dst().String()
-			dm.NetworkInfo.Protocol = dnsPacket.TransportLayer.EndpointType().String()
+			w.fillDNSMessage(&dm, dnsPacket)
+			dm.NetworkInfo.PortLabel = ports.FlowLabel(dnsPacket.TransportLayer)
 
-			dm.DNS.Payload = dnsPacket.Payload
-			dm.DNS.Length = len(dnsPacket.Payload)
-
-			dm.DNSTap.Identity = w.GetConfig().GetServerIdentity()
+			// send DNS message to DNS processor
+			dnsProcessor.GetInputChannel() <- dm
 
-			timestamp := dnsPacket.Timestamp.UnixNano()
-			seconds := timestamp / int64(time.Second)
-			dm.DNSTap.TimeSec = int(seconds)
-			dm.DNSTap.TimeNsec = int(timestamp - seconds*int64(time.Second)*int64(time.Nanosecond))
+		// dns message decrypted from DoT or DoH flows ?
+		case tlsPacket := <-tlsChan:
+			w.fillDNSMessage(&dm, tlsPacket.DNSPacket)
+			dm.NetworkInfo.Protocol = tlsPacket.Protocol
+			if tlsPacket.Protocol == dnsutils.ProtoDoT {
+				dm.NetworkInfo.PortLabel = ports.Label(tlsPorts[0])
+			} else {
+				dm.NetworkInfo.PortLabel = ports.Label(tlsPorts[1])
+			}
 
 			// send DNS message to DNS processor
 			dnsProcessor.GetInputChannel() <- dm
 		}
 	}
 }
+
+func (w *AfpacketSniffer) fillDNSMessage(dm *dnsutils.DNSMessage, dnsPacket netutils.DNSPacket) {
+	// reset
+	dm.Init()
+
+	dm.NetworkInfo.Family = dnsPacket.IPLayer.EndpointType().String()
+	dm.NetworkInfo.QueryIP = dnsPacket.IPLayer.Src().String()
+	dm.NetworkInfo.ResponseIP = dnsPacket.IPLayer.Dst().String()
+	dm.NetworkInfo.QueryPort = dnsPacket.TransportLayer.Src().String()
+	dm.NetworkInfo.ResponsePort = dnsPacket.TransportLayer.Dst().String()
+	dm.NetworkInfo.Protocol = dnsPacket.TransportLayer.EndpointType().String()
+
+	dm.DNS.Payload = dnsPacket.Payload
+	dm.DNS.Length = len(dnsPacket.Payload)
+
+	dm.DNSTap.Identity = w.GetConfig().GetServerIdentity()
+
+	timestamp := dnsPacket.Timestamp.UnixNano()
+	seconds := timestamp / int64(time.Second)
+	dm.DNSTap.TimeSec = int(seconds)
+	dm.DNSTap.TimeNsec = int(timestamp - seconds*int64(time.Second)*int64(time.Nanosecond))
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/pkgconfig"
 	"github.com/dmachard/go-logger"
+	"github.com/google/gopacket/layers"
 )
 
 func TestAfpacketSnifferRun(t *testing.T) {
@@ -32,3 +33,20 @@ func TestAfpacketSnifferRun(t *testing.T) {
 		}
 	}
 }
+
+func TestAfpacketSniffer_TLSPorts(t *testing.T) {
+	config := pkgconfig.GetDefaultConfig()
+	c := NewAfpacketSniffer([]Worker{}, config, logger.New(false), "test")
+
+	// no tls decryption without keylog file
+	tlsPorts := c.GetTLSPorts()
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: layers.TCPPort(config.Collectors.AfpacketLiveCapture.DoTPort)}
+	if IsTLSPort(tcp, tlsPorts) {
+		t.Errorf("tls port not expected without keylog file")
+	}
+
+	config.Collectors.AfpacketLiveCapture.TLSKeyLogFile = "/tmp/keylog.txt"
+	if !IsTLSPort(tcp, c.GetTLSPorts()) {
+		t.Errorf("tls port expected with keylog file")
+	}
+}
@@ -0,0 +1,331 @@
+package workers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dmachard/go-netutils"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+var (
+	ErrBpfEmpty       = errors.New("empty bpf expression")
+	ErrBpfUnsupported = errors.New("return of the accumulator is not supported")
+
+	// instruction of the "tcpdump -dd" output: { 0x28, 0, 0, 0x0000000c },
+	bpfCInstruction = regexp.MustCompile(`\{\s*(\w+)\s*,\s*(\w+)\s*,\s*(\w+)\s*,\s*(\w+)\s*\}`)
+)
+
+// CapturePorts holds the DNS ports to capture and their optional labels
+type CapturePorts struct {
+	ports  map[int]bool
+	list   []int
+	labels map[int]string
+}
+
+// NewCapturePorts returns the list of ports to capture, the single port is used if the list is empty
+func NewCapturePorts(port int, ports []int, labels map[int]string) *CapturePorts {
+	if len(ports) == 0 {
+		ports = []int{port}
+	}
+	c := &CapturePorts{ports: make(map[int]bool), labels: labels}
+	for _, p := range ports {
+		if !c.ports[p] {
+			c.ports[p] = true
+			c.list = append(c.list, p)
+		}
+	}
+	return c
+}
+
+func (c *CapturePorts) List() []int {
+	return c.list
+}
+
+// ServerPort returns the captured port of the packet, the destination port is preferred
+func (c *CapturePorts) ServerPort(srcPort, dstPort int) (int, bool) {
+	if c.ports[dstPort] {
+		return dstPort, true
+	}
+	if c.ports[srcPort] {
+		return srcPort, true
+	}
+	return 0, false
+}
+
+// Match returns true if the udp or tcp packet uses one of the captured ports
+func (c *CapturePorts) Match(packet gopacket.Packet) bool {
+	var srcPort, dstPort int
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.UDP:
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+	case *layers.TCP:
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+	default:
+		return false
+	}
+	_, ok := c.ServerPort(srcPort, dstPort)
+	return ok
+}
+
+// Label returns the label of the port, or the port number if no label is configured
+func (c *CapturePorts) Label(port int) string {
+	if label, ok := c.labels[port]; ok {
+		return label
+	}
+	return strconv.Itoa(port)
+}
+
+// FlowLabel returns the label of the captured port of the transport flow
+func (c *CapturePorts) FlowLabel(transport gopacket.Flow) string {
+	src, dst := transport.Src().Raw(), transport.Dst().Raw()
+	if len(src) != 2 || len(dst) != 2 {
+		return "-"
+	}
+	port, ok := c.ServerPort(int(binary.BigEndian.Uint16(src)), int(binary.BigEndian.Uint16(dst)))
+	if !ok {
+		return "-"
+	}
+	return c.Label(port)
+}
+
+// CaptureIPDefragger is equivalent to netutils.IPDefragger with several ports
+func CaptureIPDefragger(ipInput chan gopacket.Packet, udpOutput chan gopacket.Packet, tcpOutput chan gopacket.Packet, ports *CapturePorts) {
+	defragger := netutils.NewIPDefragmenter()
+	for fragment := range ipInput {
+		reassembled, err := defragger.DefragIP(fragment)
+		if err != nil {
+			break
+		}
+		if reassembled == nil || reassembled.TransportLayer() == nil || !ports.Match(reassembled) {
+			continue
+		}
+
+		switch reassembled.TransportLayer().LayerType() {
+		case layers.LayerTypeUDP:
+			udpOutput <- reassembled
+		case layers.LayerTypeTCP:
+			tcpOutput <- reassembled
+		}
+	}
+}
+
+// ParseBpfExpression reads a compiled BPF program, as printed by "tcpdump -ddd" (decimal numbers,
+// instructions separated by newlines or commas, starting with the number of instructions)
+// or by "tcpdump -dd" (C array)
+func ParseBpfExpression(expr string) ([]bpf.Instruction, error) {
+	var raws []bpf.RawInstruction
+
+	if strings.Contains(expr, "{") {
+		for _, match := range bpfCInstruction.FindAllStringSubmatch(expr, -1) {
+			var values [4]uint64
+			for i := range values {
+				v, err := strconv.ParseUint(match[i+1], 0, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid bpf instruction %q: %w", match[0], err)
+				}
+				values[i] = v
+			}
+			raws = append(raws, bpf.RawInstruction{Op: uint16(values[0]), Jt: uint8(values[1]), Jf: uint8(values[2]), K: uint32(values[3])})
+		}
+	} else {
+		lines := strings.FieldsFunc(expr, func(r rune) bool { return r == ',' || r == '\n' || r == ';' })
+		if len(lines) == 0 {
+			return nil, ErrBpfEmpty
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of bpf instructions: %w", err)
+		}
+		if count != len(lines)-1 {
+			return nil, fmt.Errorf("expected %d bpf instructions, got %d", count, len(lines)-1)
+		}
+		for _, line := range lines[1:] {
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("invalid bpf instruction %q", line)
+			}
+			var values [4]uint64
+			for i := range values {
+				v, err := strconv.ParseUint(fields[i], 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid bpf instruction %q: %w", line, err)
+				}
+				values[i] = v
+			}
+			raws = append(raws, bpf.RawInstruction{Op: uint16(values[0]), Jt: uint8(values[1]), Jf: uint8(values[2]), K: uint32(values[3])})
+		}
+	}
+
+	if len(raws) == 0 {
+		return nil, ErrBpfEmpty
+	}
+
+	instructions, allDecoded := bpf.Disassemble(raws)
+	if !allDecoded {
+		return nil, errors.New("unknown bpf instruction")
+	}
+	for _, ins := range instructions {
+		if _, ok := ins.(bpf.RetA); ok {
+			return nil, ErrBpfUnsupported
+		}
+	}
+	if _, err := bpf.Assemble(instructions); err != nil {
+		return nil, err
+	}
+	return instructions, nil
+}
+
+// bpfChain runs the second program when the first one accepts (and) or rejects (or) the packet.
+// The returns of the first program are replaced by a jump, its conditional jumps are unchanged.
+func bpfChain(first, second []bpf.Instruction, and bool) []bpf.Instruction {
+	chained := make([]bpf.Instruction, 0, len(first)+len(second))
+	for i, ins := range first {
+		if ret, ok := ins.(bpf.RetConstant); ok && (ret.Val != 0) == and {
+			ins = bpf.Jump{Skip: uint32(len(first) - i - 1)}
+		}
+		chained = append(chained, ins)
+	}
+	return append(chained, second...)
+}
+
+// BpfMatcher applies a BPF program on packets read in user space, with pcap files for example
+type BpfMatcher struct {
+	vm *bpf.VM
+}
+
+// NewBpfMatcher compiles the filter for packets with an ethernet layer
+func NewBpfMatcher(expr string) (*BpfMatcher, error) {
+	instructions, err := GetBpfProgram(expr, true)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := bpf.NewVM(instructions)
+	if err != nil {
+		return nil, err
+	}
+	return &BpfMatcher{vm: vm}, nil
+}
+
+func (m *BpfMatcher) Match(data []byte) bool {
+	n, err := m.vm.Run(data)
+	return err == nil && n > 0
+}
+
+// GetBpfCaptureFilter returns the kernel filter for the captured ports, combined with the
+// user BPF filter if provided
+func GetBpfCaptureFilter(ports []int, expr string, withEthernet, withGre bool) ([]bpf.Instruction, error) {
+	var filter []bpf.Instruction
+	if withGre {
+		for _, port := range ports {
+			greFilter, err := netutils.GetBpfGreDnsFilterPort(port)
+			if err != nil {
+				return nil, err
+			}
+			if filter == nil {
+				filter = greFilter
+			} else {
+				filter = bpfChain(filter, greFilter, false)
+			}
+		}
+	} else {
+		portsFilter, err := GetBpfDnsFilterPorts(ports, withEthernet)
+		if err != nil {
+			return nil, err
+		}
+		filter = portsFilter
+	}
+
+	if expr != "" {
+		userFilter, err := GetBpfProgram(expr, withEthernet)
+		if err != nil {
+			return nil, err
+		}
+		filter = bpfChain(userFilter, filter, true)
+	}
+	return filter, nil
+}
+
+// GetBpfDnsFilterPorts is equivalent to netutils.GetBpfDnsFilterPort with several ports
+func GetBpfDnsFilterPorts(ports []int, withEthernet bool) ([]bpf.Instruction, error) {
+	bpfInstructions := &netutils.LabelResolver{LabelMap: make(map[string]int)}
+
+	// IPv4, IPv6 protocol condition from ethernet layer
+	if withEthernet {
+		bpfInstructions.Add(bpf.LoadConstant{Dst: bpf.RegX, Val: 14})                                      // X = 14
+		bpfInstructions.Add(bpf.LoadAbsolute{Off: 12, Size: 2})                                            // A = pkt[12:14] = eth.type (2 bytes)
+		bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800}, "read_ipv4", "")              // A == IPv4 ?
+		bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x86dd}, "read_ipv6", "ignore_packet") // A == IPv6 ?
+	} else {
+		bpfInstructions.Add(bpf.LoadConstant{Dst: bpf.RegX, Val: 0})                                       // X = 0
+		bpfInstructions.Add(bpf.LoadAbsolute{Off: 0, Size: 1})                                             // A = pkt[0] (to byte to detect IPv4/IPv6)
+		bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x40}, "read_ipv4", "")              // IPv4 : Version == 4 (0x4*)
+		bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x60}, "read_ipv6", "ignore_packet") // IPv6 : Version == 6 (0x6*)
+	}
+
+	// Read IPv4 layer
+	bpfInstructions.Label("read_ipv4")
+	bpfInstructions.Add(bpf.LoadIndirect{Off: 6, Size: 2})                                                    // A = pkt[X+6:X+8] = flags and fragment offset (2 bytes)
+	bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff}, "accept_packet", "")               // A = 0x1fff == 0001 1111 1111 1111 (fragment) ?
+	bpfInstructions.Add(bpf.LoadIndirect{Off: 9, Size: 1})                                                    // A = pkt[X+9:X+10] = ip.proto (1 byte)
+	bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x11}, "read_ipv4_transport", "")             // A == UDP ?
+	bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6}, "read_ipv4_transport", "ignore_packet") // A == TCP ?
+
+	// Read Transport layer
+	bpfInstructions.Label("read_ipv4_transport")
+	bpfInstructions.Add(bpf.LoadIndirect{Off: 0, Size: 1})              // A = pkt[X:X+1] (ihl)
+	bpfInstructions.Add(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x0F}) // A = A & 0x0F (get IHL)
+	bpfInstructions.Add(bpf.ALUOpConstant{Op: bpf.ALUOpMul, Val: 4})    // A = A * 4 (length in bytes)
+	bpfInstructions.Add(bpf.ALUOpX{Op: bpf.ALUOpAdd})                   // A = A + X
+	bpfInstructions.Add(bpf.TAX{})                                      // X = A
+	bpfFilterPorts(bpfInstructions, ports)
+
+	// Read the IPv6 layer,  Register X  = ethLen
+	bpfInstructions.Label("read_ipv6")
+	bpfInstructions.Add(bpf.LoadIndirect{Off: 6, Size: 1}) // A = pkt[X+6:X+7] = IPv6 Next Header (1 byte)
+
+	// Check the Next Header protocol to decide how to proceed
+	bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x2c}, "accept_packet", "")                   // If A == Fragmentation, accept the packet
+	bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x11}, "read_ipv6_transport", "")             // If A == UDP, read transport layer
+	bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6}, "read_ipv6_transport", "ignore_packet") // If A == TCP, read transport layer
+
+	// Read the IPv6 transport layer (UDP/TCP)
+	bpfInstructions.Label("read_ipv6_transport")
+	bpfInstructions.Add(bpf.TXA{})                                    // A = X
+	bpfInstructions.Add(bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 40}) // A = A + 40
+	bpfInstructions.Add(bpf.TAX{})                                    // X = A
+	bpfFilterPorts(bpfInstructions, ports)
+
+	// Keep the packet and send up to 65k of the packet to userspace
+	bpfInstructions.Label("accept_packet")
+	bpfInstructions.Add(bpf.RetConstant{Val: 0xFFFF})
+
+	// Ignore packet
+	bpfInstructions.Label("ignore_packet")
+	bpfInstructions.Add(bpf.RetConstant{Val: 0})
+
+	// Resolve and return final list of instructions
+	return bpfInstructions.ResolveJumps()
+}
+
+// bpfFilterPorts accepts the packet if the source or destination port is in the list
+func bpfFilterPorts(bpfInstructions *netutils.LabelResolver, ports []int) {
+	bpfInstructions.Add(bpf.LoadIndirect{Off: 0, Size: 2}) // A = pkt[X:X+2] = source port
+	for _, port := range ports {
+		bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port)}, "accept_packet", "")
+	}
+	bpfInstructions.Add(bpf.LoadIndirect{Off: 2, Size: 2}) // A = pkt[X+2:X+4] = destination port
+	for i, port := range ports {
+		onFalse := ""
+		if i == len(ports)-1 {
+			onFalse = "ignore_packet"
+		}
+		bpfInstructions.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port)}, "accept_packet", onFalse)
+	}
+}
@@ -0,0 +1,425 @@
+package workers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/dmachard/go-netutils"
+	"golang.org/x/net/bpf"
+)
+
+// the conditional jumps of a BPF program can not skip more than 255 instructions
+const bpfMaxInstructions = 256
+
+var ErrBpfSyntax = errors.New("invalid bpf expression")
+
+// bpfPrimitive is a tcpdump primitive like "udp", "src host 10.0.0.1", "net 10.0.0.0/8" or "tcp port 53"
+type bpfPrimitive struct {
+	proto  string // ip, ip6, udp, tcp or empty
+	dir    string // src, dst or empty for both directions
+	kind   string // host, net, port or empty to match the protocol only
+	prefix netip.Prefix
+	port   uint32
+}
+
+// bpfNode is a node of the expression tree, op is empty for a primitive
+type bpfNode struct {
+	op          string // and, or, not
+	left, right *bpfNode
+	primitive   bpfPrimitive
+}
+
+// GetBpfProgram returns the BPF program of a filter option, compiled from a tcpdump expression
+// or read from the output of "tcpdump -ddd" or "tcpdump -dd"
+func GetBpfProgram(expr string, withEthernet bool) ([]bpf.Instruction, error) {
+	trimmed := strings.TrimSpace(expr)
+	if trimmed != "" && (trimmed[0] == '{' || (trimmed[0] >= '0' && trimmed[0] <= '9')) {
+		return ParseBpfExpression(expr)
+	}
+	return CompileBpfExpression(expr, withEthernet)
+}
+
+// CompileBpfExpression compiles a subset of the tcpdump expressions, for an ethernet or a raw IP link:
+// the ip, ip6, udp and tcp protocols, the [src|dst] host, net and port primitives,
+// combined with and (&&), or (||), not (!) and parentheses
+func CompileBpfExpression(expr string, withEthernet bool) ([]bpf.Instruction, error) {
+	p := &bpfParser{tokens: bpfTokens(expr)}
+	if len(p.tokens) == 0 {
+		return nil, ErrBpfEmpty
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrBpfSyntax, tok)
+	}
+
+	c := &bpfCompiler{LabelResolver: &netutils.LabelResolver{LabelMap: make(map[string]int)}, ethernet: withEthernet}
+	if withEthernet {
+		c.base = 14
+	}
+	c.node(root, "accept_packet", "ignore_packet")
+
+	// Keep the packet and send up to 65k of the packet to userspace
+	c.Label("accept_packet")
+	c.Add(bpf.RetConstant{Val: 0xFFFF})
+
+	// Ignore packet
+	c.Label("ignore_packet")
+	c.Add(bpf.RetConstant{Val: 0})
+
+	if len(c.Instructions) > bpfMaxInstructions {
+		return nil, fmt.Errorf("%w: too many instructions (%d)", ErrBpfSyntax, len(c.Instructions))
+	}
+	instructions, err := c.ResolveJumps()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := bpf.Assemble(instructions); err != nil {
+		return nil, err
+	}
+	return instructions, nil
+}
+
+// bpfTokens splits the expression in words, parentheses and operators
+func bpfTokens(expr string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		case c == '(' || c == ')' || c == '!':
+			flush()
+			tokens = append(tokens, string(c))
+		case (c == '&' || c == '|') && i+1 < len(expr) && expr[i+1] == c:
+			flush()
+			tokens = append(tokens, expr[i:i+2])
+			i++
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type bpfParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *bpfParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *bpfParser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *bpfParser) parseOr() (*bpfNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &bpfNode{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *bpfParser) parseAnd() (*bpfNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &bpfNode{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *bpfParser) parseUnary() (*bpfNode, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &bpfNode{op: "not", left: operand}, nil
+	case "(":
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok != ")" {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrBpfSyntax)
+		}
+		return node, nil
+	}
+	return p.parsePrimitive()
+}
+
+func (p *bpfParser) parsePrimitive() (*bpfNode, error) {
+	var prim bpfPrimitive
+	switch p.peek() {
+	case "ip", "ip6", "udp", "tcp":
+		prim.proto = p.next()
+	}
+	switch p.peek() {
+	case "src", "dst":
+		prim.dir = p.next()
+	}
+	switch p.peek() {
+	case "host", "net", "port":
+		prim.kind = p.next()
+	default:
+		if prim.proto != "" && prim.dir == "" {
+			return &bpfNode{primitive: prim}, nil
+		}
+		if tok := p.peek(); tok != "" {
+			return nil, fmt.Errorf("%w: unexpected %q", ErrBpfSyntax, tok)
+		}
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrBpfSyntax)
+	}
+
+	value := p.next()
+	if value == "" {
+		return nil, fmt.Errorf("%w: missing value after %q", ErrBpfSyntax, prim.kind)
+	}
+
+	switch prim.kind {
+	case "host", "net":
+		if prim.proto == "udp" || prim.proto == "tcp" {
+			return nil, fmt.Errorf("%w: %s qualifier not supported with %s", ErrBpfSyntax, prim.proto, prim.kind)
+		}
+		if prim.kind == "host" {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid host %q", ErrBpfSyntax, value)
+			}
+			prim.prefix = netip.PrefixFrom(addr, addr.BitLen())
+		} else {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid net %q", ErrBpfSyntax, value)
+			}
+			if prefix != prefix.Masked() {
+				return nil, fmt.Errorf("%w: non-network bits set in %q", ErrBpfSyntax, value)
+			}
+			prim.prefix = prefix
+		}
+		if (prim.proto == "ip" && !prim.prefix.Addr().Is4()) || (prim.proto == "ip6" && !prim.prefix.Addr().Is6()) {
+			return nil, fmt.Errorf("%w: %s qualifier not supported with %q", ErrBpfSyntax, prim.proto, value)
+		}
+	case "port":
+		if prim.proto == "ip" || prim.proto == "ip6" {
+			return nil, fmt.Errorf("%w: %s qualifier not supported with port", ErrBpfSyntax, prim.proto)
+		}
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid port %q", ErrBpfSyntax, value)
+		}
+		prim.port = uint32(port)
+	}
+	return &bpfNode{primitive: prim}, nil
+}
+
+// bpfCompiler generates the instructions of the expression tree, each node jumps
+// to the onTrue or onFalse label and never falls through
+type bpfCompiler struct {
+	*netutils.LabelResolver
+	ethernet bool
+	base     uint32 // offset of the IP header
+	labels   int
+}
+
+func (c *bpfCompiler) newLabel() string {
+	c.labels++
+	return "expr_" + strconv.Itoa(c.labels)
+}
+
+func (c *bpfCompiler) node(n *bpfNode, onTrue, onFalse string) {
+	switch n.op {
+	case "and":
+		right := c.newLabel()
+		c.node(n.left, right, onFalse)
+		c.Label(right)
+		c.node(n.right, onTrue, onFalse)
+	case "or":
+		right := c.newLabel()
+		c.node(n.left, onTrue, right)
+		c.Label(right)
+		c.node(n.right, onTrue, onFalse)
+	case "not":
+		c.node(n.left, onFalse, onTrue)
+	default:
+		c.primitive(n.primitive, onTrue, onFalse)
+	}
+}
+
+func (c *bpfCompiler) primitive(prim bpfPrimitive, onTrue, onFalse string) {
+	withIPv4 := prim.proto != "ip6" && (!prim.prefix.IsValid() || prim.prefix.Addr().Is4())
+	withIPv6 := prim.proto != "ip" && (!prim.prefix.IsValid() || prim.prefix.Addr().Is6())
+
+	readIPv4, readIPv6 := onFalse, onFalse
+	if withIPv4 {
+		readIPv4 = c.newLabel()
+	}
+	if withIPv6 {
+		readIPv6 = c.newLabel()
+	}
+
+	// IPv4, IPv6 protocol condition from ethernet layer or from the IP version
+	if c.ethernet {
+		c.Add(bpf.LoadAbsolute{Off: 12, Size: 2})                                 // A = eth.type
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800}, readIPv4, "")      // A == IPv4 ?
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x86dd}, readIPv6, onFalse) // A == IPv6 ?
+	} else {
+		c.Add(bpf.LoadAbsolute{Off: 0, Size: 1})                                // A = version and ihl
+		c.Add(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xf0})                   // A = A & 0xf0 (version)
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x40}, readIPv4, "")      // IPv4 ?
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x60}, readIPv6, onFalse) // IPv6 ?
+	}
+
+	if withIPv4 {
+		c.Label(readIPv4)
+		c.match(prim, false, onTrue, onFalse)
+	}
+	if withIPv6 {
+		c.Label(readIPv6)
+		c.match(prim, true, onTrue, onFalse)
+	}
+}
+
+func (c *bpfCompiler) match(prim bpfPrimitive, ipv6 bool, onTrue, onFalse string) {
+	switch prim.kind {
+	case "host", "net":
+		src, dst := c.base+12, c.base+16
+		if ipv6 {
+			src, dst = c.base+8, c.base+24
+		}
+		switch prim.dir {
+		case "src":
+			c.prefix(prim.prefix, src, onTrue, onFalse)
+		case "dst":
+			c.prefix(prim.prefix, dst, onTrue, onFalse)
+		default:
+			readDst := c.newLabel()
+			c.prefix(prim.prefix, src, onTrue, readDst)
+			c.Label(readDst)
+			c.prefix(prim.prefix, dst, onTrue, onFalse)
+		}
+	case "port":
+		readPorts := c.newLabel()
+		c.transport(prim.proto, ipv6, readPorts, onFalse)
+		c.Label(readPorts)
+		c.ports(prim, ipv6, onTrue, onFalse)
+	default:
+		if prim.proto == "udp" || prim.proto == "tcp" {
+			c.transport(prim.proto, ipv6, onTrue, onFalse)
+		} else {
+			c.JumpTo(bpf.Jump{}, onTrue)
+		}
+	}
+}
+
+// transport checks the protocol of the IP header, udp or tcp if proto is empty
+func (c *bpfCompiler) transport(proto string, ipv6 bool, onTrue, onFalse string) {
+	if ipv6 {
+		c.Add(bpf.LoadAbsolute{Off: c.base + 6, Size: 1}) // A = IPv6 next header
+	} else {
+		c.Add(bpf.LoadAbsolute{Off: c.base + 9, Size: 1}) // A = ip.proto
+	}
+	switch proto {
+	case "udp":
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x11}, onTrue, onFalse)
+	case "tcp":
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6}, onTrue, onFalse)
+	default:
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x11}, onTrue, "")
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6}, onTrue, onFalse)
+	}
+}
+
+// ports compares the source and/or destination ports, the IPv4 fragments without
+// transport header are not matched
+func (c *bpfCompiler) ports(prim bpfPrimitive, ipv6 bool, onTrue, onFalse string) {
+	load := func(off uint32) bpf.Instruction {
+		if ipv6 {
+			return bpf.LoadAbsolute{Off: c.base + 40 + off, Size: 2}
+		}
+		return bpf.LoadIndirect{Off: c.base + off, Size: 2}
+	}
+	if !ipv6 {
+		c.Add(bpf.LoadAbsolute{Off: c.base + 6, Size: 2})                     // A = flags and fragment offset
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff}, onFalse, "") // fragment ?
+		c.Add(bpf.LoadMemShift{Off: c.base})                                  // X = ip header length
+	}
+	if prim.dir != "dst" {
+		c.Add(load(0)) // A = source port
+		if prim.dir == "src" {
+			c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: prim.port}, onTrue, onFalse)
+		} else {
+			c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: prim.port}, onTrue, "")
+		}
+	}
+	if prim.dir != "src" {
+		c.Add(load(2)) // A = destination port
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: prim.port}, onTrue, onFalse)
+	}
+}
+
+// prefix compares the address at the offset with the network, 32 bits at a time
+func (c *bpfCompiler) prefix(prefix netip.Prefix, off uint32, onTrue, onFalse string) {
+	addr := prefix.Addr().AsSlice()
+	words := (prefix.Bits() + 31) / 32
+	if words == 0 {
+		c.JumpTo(bpf.Jump{}, onTrue)
+		return
+	}
+	for i := 0; i < words; i++ {
+		bits := min(prefix.Bits()-32*i, 32)
+		mask := ^uint32(0) << (32 - bits)
+		c.Add(bpf.LoadAbsolute{Off: off + uint32(4*i), Size: 4})
+		if mask != ^uint32(0) {
+			c.Add(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask})
+		}
+		onMatch := ""
+		if i == words-1 {
+			onMatch = onTrue
+		}
+		c.JumpIf(bpf.JumpIf{Cond: bpf.JumpEqual, Val: binary.BigEndian.Uint32(addr[4*i:])}, onMatch, onFalse)
+	}
+}
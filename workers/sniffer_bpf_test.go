@@ -0,0 +1,221 @@
+package workers
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// tcpdump -ddd "ip src host 10.0.0.1"
+const bpfTestExpression = "6\n40 0 0 12\n21 0 3 2048\n32 0 0 26\n21 0 1 167772161\n6 0 0 262144\n6 0 0 0\n"
+
+func bpfTestPacket(t *testing.T, srcIP string, srcPort, dstPort int) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.ParseIP(srcIP), DstIP: net.ParseIP("10.0.0.2")}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload([]byte{0, 1, 2, 3})); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func bpfTestRun(t *testing.T, filter []bpf.Instruction, pkt []byte) bool {
+	vm, err := bpf.NewVM(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := vm.Run(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func Test_ParseBpfExpression(t *testing.T) {
+	testcases := []struct {
+		name  string
+		expr  string
+		valid bool
+	}{
+		{name: "ddd", expr: bpfTestExpression, valid: true},
+		{name: "ddd_commas", expr: "6,40 0 0 12,21 0 3 2048,32 0 0 26,21 0 1 167772161,6 0 0 262144,6 0 0 0", valid: true},
+		{name: "dd", expr: "{ 0x28, 0, 0, 0x0000000c },\n{ 0x6, 0, 0, 0x00040000 },", valid: true},
+		{name: "empty", expr: "", valid: false},
+		{name: "count_mismatch", expr: "3\n40 0 0 12\n6 0 0 0", valid: false},
+		{name: "invalid_fields", expr: "1\n6 0 0", valid: false},
+		{name: "return_accumulator", expr: "1\n22 0 0 0", valid: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseBpfExpression(tc.expr)
+			if tc.valid && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("error expected")
+			}
+		})
+	}
+}
+
+func Test_GetBpfCaptureFilter(t *testing.T) {
+	testcases := []struct {
+		name     string
+		expr     string
+		srcIP    string
+		dstPort  int
+		accepted bool
+	}{
+		{name: "port_53", srcIP: "10.0.0.3", dstPort: 53, accepted: true},
+		{name: "port_5353", srcIP: "10.0.0.3", dstPort: 5353, accepted: true},
+		{name: "port_8053", srcIP: "10.0.0.3", dstPort: 8053, accepted: true},
+		{name: "port_other", srcIP: "10.0.0.3", dstPort: 80, accepted: false},
+		{name: "expr_match", expr: bpfTestExpression, srcIP: "10.0.0.1", dstPort: 5353, accepted: true},
+		{name: "expr_nomatch", expr: bpfTestExpression, srcIP: "10.0.0.3", dstPort: 5353, accepted: false},
+		{name: "expr_port_other", expr: bpfTestExpression, srcIP: "10.0.0.1", dstPort: 80, accepted: false},
+		{name: "compiled_expr_match", expr: "src host 10.0.0.1", srcIP: "10.0.0.1", dstPort: 5353, accepted: true},
+		{name: "compiled_expr_nomatch", expr: "src host 10.0.0.1", srcIP: "10.0.0.3", dstPort: 5353, accepted: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := GetBpfCaptureFilter([]int{53, 5353, 8053}, tc.expr, true, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepted := bpfTestRun(t, filter, bpfTestPacket(t, tc.srcIP, 40000, tc.dstPort)); accepted != tc.accepted {
+				t.Errorf("packet accepted=%v, expected %v", accepted, tc.accepted)
+			}
+		})
+	}
+}
+
+func Test_CapturePorts_Label(t *testing.T) {
+	ports := NewCapturePorts(53, []int{53, 5353, 8053}, map[int]string{5353: "mdns"})
+
+	testcases := []struct {
+		src, dst int
+		label    string
+	}{
+		{src: 40000, dst: 5353, label: "mdns"},
+		{src: 5353, dst: 40000, label: "mdns"},
+		{src: 40000, dst: 8053, label: "8053"},
+		{src: 40000, dst: 80, label: "-"},
+	}
+
+	for _, tc := range testcases {
+		pkt := gopacket.NewPacket(bpfTestPacket(t, "10.0.0.1", tc.src, tc.dst), layers.LayerTypeEthernet, gopacket.Default)
+		if label := ports.FlowLabel(pkt.TransportLayer().TransportFlow()); label != tc.label {
+			t.Errorf("%d->%d: label %s expected, got %s", tc.src, tc.dst, tc.label, label)
+		}
+		if matched := ports.Match(pkt); matched != (tc.label != "-") {
+			t.Errorf("%d->%d: invalid match %v", tc.src, tc.dst, matched)
+		}
+	}
+}
+
+func Test_CapturePorts_Default(t *testing.T) {
+	ports := NewCapturePorts(53, nil, nil)
+	if len(ports.List()) != 1 || ports.List()[0] != 53 {
+		t.Errorf("default port expected, got %v", ports.List())
+	}
+}
+
+func Test_GetBpfCaptureFilter_Gre(t *testing.T) {
+	filter, err := GetBpfCaptureFilter([]int{53, 5353}, "", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bpfTestRun(t, filter, bpfTestPacket(t, "10.0.0.3", 40000, 5353)) {
+		t.Errorf("packet on the second port should be accepted")
+	}
+	if bpfTestRun(t, filter, bpfTestPacket(t, "10.0.0.3", 40000, 80)) {
+		t.Errorf("packet should be ignored")
+	}
+}
+
+func bpfTestPacketIPv6(t *testing.T, srcIP string, srcPort, dstPort int) []byte {
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP(srcIP), DstIP: net.ParseIP("fe80::2")}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload([]byte{0, 1, 2, 3})); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_CompileBpfExpression(t *testing.T) {
+	testcases := []struct {
+		name     string
+		expr     string
+		srcIP    string
+		srcPort  int
+		accepted bool
+	}{
+		{name: "host", expr: "host 10.0.0.1", srcIP: "10.0.0.1", accepted: true},
+		{name: "host_dst", expr: "host 10.0.0.2", srcIP: "10.0.0.1", accepted: true},
+		{name: "src_host", expr: "ip src host 10.0.0.1", srcIP: "10.0.0.3", accepted: false},
+		{name: "dst_host", expr: "dst host 10.0.0.1", srcIP: "10.0.0.1", accepted: false},
+		{name: "net", expr: "src net 10.0.0.0/30", srcIP: "10.0.0.3", accepted: true},
+		{name: "net_nomatch", expr: "src net 10.0.0.0/31", srcIP: "10.0.0.3", accepted: false},
+		{name: "udp_port", expr: "udp src port 40000", srcIP: "10.0.0.1", srcPort: 40000, accepted: true},
+		{name: "tcp_port", expr: "tcp port 40000", srcIP: "10.0.0.1", srcPort: 40000, accepted: false},
+		{name: "not", expr: "not host 10.0.0.1", srcIP: "10.0.0.1", accepted: false},
+		{name: "and_or", expr: "(host 10.0.0.3 || port 40000) && !ip6", srcIP: "10.0.0.1", srcPort: 40000, accepted: true},
+		{name: "ip6", expr: "ip6 or host fe80::1", srcIP: "10.0.0.1", accepted: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := GetBpfProgram(tc.expr, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepted := bpfTestRun(t, filter, bpfTestPacket(t, tc.srcIP, tc.srcPort, 53)); accepted != tc.accepted {
+				t.Errorf("packet accepted=%v, expected %v", accepted, tc.accepted)
+			}
+		})
+	}
+}
+
+func Test_CompileBpfExpression_RawIPv6(t *testing.T) {
+	filter, err := CompileBpfExpression("src net fe80::/64 and udp dst port 53", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bpfTestRun(t, filter, bpfTestPacketIPv6(t, "fe80::1", 40000, 53)) {
+		t.Errorf("packet should be accepted")
+	}
+	if bpfTestRun(t, filter, bpfTestPacketIPv6(t, "fe81::1", 40000, 53)) {
+		t.Errorf("packet from another network should be ignored")
+	}
+	if bpfTestRun(t, filter, bpfTestPacketIPv6(t, "fe80::1", 53, 40000)) {
+		t.Errorf("packet to another port should be ignored")
+	}
+}
+
+func Test_CompileBpfExpression_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"", "host", "host 10.0.0.300", "net 10.0.0.1/8", "port domain", "ip port 53",
+		"udp host 10.0.0.1", "ip6 host 10.0.0.1", "(host 10.0.0.1", "host 10.0.0.1 or", "ether host 00:00:00:00:00:01",
+	} {
+		if _, err := CompileBpfExpression(expr, true); err == nil {
+			t.Errorf("%q: error expected", expr)
+		}
+	}
+}
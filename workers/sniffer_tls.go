@@ -0,0 +1,510 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// labels of the NSS key log format, see SSLKEYLOGFILE
+const (
+	KeyLogClientRandom          = "CLIENT_RANDOM"
+	KeyLogClientHandshakeSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	KeyLogServerHandshakeSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	KeyLogClientTrafficSecret   = "CLIENT_TRAFFIC_SECRET_0"
+	KeyLogServerTrafficSecret   = "SERVER_TRAFFIC_SECRET_0"
+)
+
+const (
+	tlsRecordHeaderLen        = 5
+	tlsMaxRecordLen           = 16384 + 2048
+	tlsRecordChangeCipherSpec = 20
+	tlsRecordHandshake        = 22
+	tlsRecordApplicationData  = 23
+	tlsHandshakeClientHello   = 1
+	tlsHandshakeServerHello   = 2
+	tlsExtSupportedVersions   = 43
+	tlsRandomLen              = 32
+	tlsMaxPendingLen          = 1 << 20
+)
+
+var (
+	ErrTLSUnsupportedSuite = errors.New("unsupported cipher suite")
+	ErrTLSMissingSecret    = errors.New("secret not found in keylog")
+	ErrTLSDecrypt          = errors.New("unable to decrypt record")
+	ErrTLSOverflow         = errors.New("too many pending bytes")
+
+	// random value of the HelloRetryRequest message, see RFC 8446 section 4.1.3
+	tlsHelloRetryRandom, _ = hex.DecodeString("cf21ad74e59a6111be1d8c021e65b891c2a211167abb8c5e079e09e2c8a8339c")
+)
+
+// TLSKeyLog holds the secrets read from a NSS key log file.
+type TLSKeyLog struct {
+	path    string
+	modTime time.Time
+	size    int64
+	secrets map[string][]byte
+}
+
+func NewTLSKeyLog(path string) (*TLSKeyLog, error) {
+	k := &TLSKeyLog{path: path, secrets: make(map[string][]byte)}
+	return k, k.Reload()
+}
+
+// Reload reads the key log file again if it has been modified since the last read.
+func (k *TLSKeyLog) Reload() error {
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(k.modTime) && fi.Size() == k.size {
+		return nil
+	}
+
+	f, err := os.Open(k.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			continue
+		}
+		k.secrets[fields[0]+" "+strings.ToLower(fields[1])] = secret
+	}
+	k.modTime = fi.ModTime()
+	k.size = fi.Size()
+	return scanner.Err()
+}
+
+// Secret returns the secret of the given label for the session identified by the client random.
+// On a miss, the file is read again because clients append new secrets during their lifetime.
+func (k *TLSKeyLog) Secret(label string, clientRandom []byte) []byte {
+	key := label + " " + hex.EncodeToString(clientRandom)
+	if secret, ok := k.secrets[key]; ok {
+		return secret
+	}
+	if err := k.Reload(); err != nil {
+		return nil
+	}
+	return k.secrets[key]
+}
+
+type tlsCipherSuite struct {
+	keyLen, ivLen int
+	hash          func() hash.Hash
+	aead          func(key []byte) (cipher.AEAD, error)
+}
+
+func aeadAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// only AEAD cipher suites are supported
+var tlsCipherSuites = map[uint16]tlsCipherSuite{
+	tls.TLS_AES_128_GCM_SHA256:                        {16, 12, sha256.New, aeadAESGCM},
+	tls.TLS_AES_256_GCM_SHA384:                        {32, 12, sha512.New384, aeadAESGCM},
+	tls.TLS_CHACHA20_POLY1305_SHA256:                  {32, 12, sha256.New, chacha20poly1305.New},
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:               {16, 4, sha256.New, aeadAESGCM},
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:               {32, 4, sha512.New384, aeadAESGCM},
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         {16, 4, sha256.New, aeadAESGCM},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       {16, 4, sha256.New, aeadAESGCM},
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         {32, 4, sha512.New384, aeadAESGCM},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       {32, 4, sha512.New384, aeadAESGCM},
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   {32, 12, sha256.New, chacha20poly1305.New},
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: {32, 12, sha256.New, chacha20poly1305.New},
+}
+
+type tlsTrafficKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label from RFC 8446 section 7.1
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	fullLabel := "tls13 " + label
+	info := make([]byte, 0, 4+len(fullLabel))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+
+	out := make([]byte, length)
+	hkdf.Expand(h, secret, info).Read(out)
+	return out
+}
+
+// tls12PRF implements the P_hash function from RFC 5246 section 5
+func tls12PRF(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	labelAndSeed := append([]byte(label), seed...)
+	out := make([]byte, 0, length)
+
+	mac := hmac.New(h, secret)
+	mac.Write(labelAndSeed)
+	a := mac.Sum(nil)
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelAndSeed)
+		out = append(out, mac.Sum(nil)...)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:length]
+}
+
+func newTLSTrafficKeys(suite tlsCipherSuite, key, iv []byte) (*tlsTrafficKeys, error) {
+	aead, err := suite.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsTrafficKeys{aead: aead, iv: iv}, nil
+}
+
+func newTLS13TrafficKeys(suite tlsCipherSuite, secret []byte) (*tlsTrafficKeys, error) {
+	if secret == nil {
+		return nil, ErrTLSMissingSecret
+	}
+	key := hkdfExpandLabel(suite.hash, secret, "key", suite.keyLen)
+	iv := hkdfExpandLabel(suite.hash, secret, "iv", suite.ivLen)
+	return newTLSTrafficKeys(suite, key, iv)
+}
+
+// tlsHalfConn is one direction of a TLS connection
+type tlsHalfConn struct {
+	records   []byte
+	handshake []byte
+	encrypted bool
+	keys      [2]*tlsTrafficKeys // handshake and application keys
+	epoch     int
+	seq       uint64
+}
+
+func (hc *tlsHalfConn) nonce(keys *tlsTrafficKeys, seq uint64) []byte {
+	nonce := make([]byte, len(keys.iv))
+	copy(nonce, keys.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	return nonce
+}
+
+func (hc *tlsHalfConn) open13(keys *tlsTrafficKeys, seq uint64, header, fragment []byte) ([]byte, error) {
+	return keys.aead.Open(nil, hc.nonce(keys, seq), fragment, header)
+}
+
+// decrypt13 returns the inner content type and the plaintext of a TLS 1.3 record.
+// Handshake keys are used first, then application keys once the handshake keys no longer apply.
+func (hc *tlsHalfConn) decrypt13(header, fragment []byte) (byte, []byte, error) {
+	var plaintext []byte
+	var err error = ErrTLSDecrypt
+
+	if hc.epoch == 0 && hc.keys[0] != nil {
+		plaintext, err = hc.open13(hc.keys[0], hc.seq, header, fragment)
+	}
+	if err != nil && hc.epoch == 0 && hc.keys[1] != nil {
+		if plaintext, err = hc.open13(hc.keys[1], 0, header, fragment); err == nil {
+			hc.epoch, hc.seq = 1, 0
+		}
+	} else if err != nil && hc.epoch == 1 {
+		plaintext, err = hc.open13(hc.keys[1], hc.seq, header, fragment)
+	}
+	if err != nil {
+		return 0, nil, ErrTLSDecrypt
+	}
+	hc.seq++
+
+	// remove padding, the last non zero byte is the real content type
+	i := len(plaintext) - 1
+	for i >= 0 && plaintext[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return 0, nil, ErrTLSDecrypt
+	}
+	return plaintext[i], plaintext[:i], nil
+}
+
+func (hc *tlsHalfConn) decrypt12(header, fragment []byte) ([]byte, error) {
+	keys := hc.keys[1]
+	if keys == nil {
+		return nil, ErrTLSMissingSecret
+	}
+
+	var nonce []byte
+	if len(keys.iv) == 12 {
+		nonce = hc.nonce(keys, hc.seq)
+	} else {
+		// explicit nonce at the beginning of the fragment
+		if len(fragment) < 8 {
+			return nil, ErrTLSDecrypt
+		}
+		nonce = append(append([]byte{}, keys.iv...), fragment[:8]...)
+		fragment = fragment[8:]
+	}
+	if len(fragment) < keys.aead.Overhead() {
+		return nil, ErrTLSDecrypt
+	}
+
+	additionalData := make([]byte, 13)
+	binary.BigEndian.PutUint64(additionalData, hc.seq)
+	copy(additionalData[8:], header[:3])
+	binary.BigEndian.PutUint16(additionalData[11:], uint16(len(fragment)-keys.aead.Overhead()))
+
+	plaintext, err := keys.aead.Open(nil, nonce, fragment, additionalData)
+	if err != nil {
+		return nil, ErrTLSDecrypt
+	}
+	hc.seq++
+	return plaintext, nil
+}
+
+// TLSSession tracks both directions of a TLS connection and decrypts the application data
+// with the secrets found in the key log.
+type TLSSession struct {
+	keylog                     *TLSKeyLog
+	clientRandom, serverRandom []byte
+	version, cipherSuite       uint16
+	keysReady                  bool
+	client, server             tlsHalfConn
+}
+
+func NewTLSSession(keylog *TLSKeyLog) *TLSSession {
+	return &TLSSession{keylog: keylog}
+}
+
+// Decode consumes raw bytes of one direction and returns the decrypted application data.
+func (s *TLSSession) Decode(fromClient bool, data []byte) ([]byte, error) {
+	hc := &s.server
+	if fromClient {
+		hc = &s.client
+	}
+
+	hc.records = append(hc.records, data...)
+	if len(hc.records) > tlsMaxPendingLen {
+		return nil, ErrTLSOverflow
+	}
+
+	var appData []byte
+	for len(hc.records) >= tlsRecordHeaderLen {
+		length := int(binary.BigEndian.Uint16(hc.records[3:5]))
+		if length > tlsMaxRecordLen {
+			return appData, fmt.Errorf("invalid record length %d", length)
+		}
+		if len(hc.records) < tlsRecordHeaderLen+length {
+			break
+		}
+		header := hc.records[:tlsRecordHeaderLen]
+		fragment := hc.records[tlsRecordHeaderLen : tlsRecordHeaderLen+length]
+
+		plaintext, err := s.decodeRecord(fromClient, hc, header, fragment)
+		if err != nil {
+			return appData, err
+		}
+		appData = append(appData, plaintext...)
+		hc.records = hc.records[tlsRecordHeaderLen+length:]
+	}
+	return appData, nil
+}
+
+func (s *TLSSession) decodeRecord(fromClient bool, hc *tlsHalfConn, header, fragment []byte) ([]byte, error) {
+	contentType := header[0]
+
+	switch {
+	// ignored with tls 1.3, sent for middlebox compatibility only
+	case contentType == tlsRecordChangeCipherSpec:
+		if s.version != tls.VersionTLS13 {
+			hc.encrypted = true
+			hc.seq = 0
+		}
+		return nil, nil
+
+	case !hc.encrypted && s.version != tls.VersionTLS13:
+		if contentType == tlsRecordHandshake {
+			hc.handshake = append(hc.handshake, fragment...)
+			return nil, s.decodeHandshake(hc)
+		}
+		return nil, nil
+
+	case s.version == tls.VersionTLS13:
+		if contentType != tlsRecordApplicationData {
+			return nil, nil
+		}
+		if err := s.setupKeys(); err != nil {
+			return nil, err
+		}
+		innerType, plaintext, err := hc.decrypt13(header, fragment)
+		if err != nil || innerType != tlsRecordApplicationData {
+			return nil, err
+		}
+		return plaintext, nil
+
+	default:
+		if err := s.setupKeys(); err != nil {
+			return nil, err
+		}
+		plaintext, err := hc.decrypt12(header, fragment)
+		if err != nil || contentType != tlsRecordApplicationData {
+			return nil, err
+		}
+		return plaintext, nil
+	}
+}
+
+// decodeHandshake reads the cleartext hello messages to get randoms, version and cipher suite
+func (s *TLSSession) decodeHandshake(hc *tlsHalfConn) error {
+	for len(hc.handshake) >= 4 {
+		msgType := hc.handshake[0]
+		length := int(hc.handshake[1])<<16 | int(hc.handshake[2])<<8 | int(hc.handshake[3])
+		if len(hc.handshake) < 4+length {
+			if length > tlsMaxPendingLen {
+				return ErrTLSOverflow
+			}
+			return nil
+		}
+		body := hc.handshake[4 : 4+length]
+		hc.handshake = hc.handshake[4+length:]
+
+		switch msgType {
+		case tlsHandshakeClientHello:
+			if len(body) < 2+tlsRandomLen {
+				return errors.New("client hello too short")
+			}
+			s.clientRandom = append([]byte{}, body[2:2+tlsRandomLen]...)
+
+		case tlsHandshakeServerHello:
+			if err := s.decodeServerHello(body); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *TLSSession) decodeServerHello(body []byte) error {
+	if len(body) < 2+tlsRandomLen+1 {
+		return errors.New("server hello too short")
+	}
+	random := body[2 : 2+tlsRandomLen]
+	if bytes.Equal(random, tlsHelloRetryRandom) {
+		return nil
+	}
+	version := binary.BigEndian.Uint16(body[:2])
+
+	offset := 2 + tlsRandomLen
+	offset += 1 + int(body[offset])
+	if len(body) < offset+3 {
+		return errors.New("server hello too short")
+	}
+	s.cipherSuite = binary.BigEndian.Uint16(body[offset : offset+2])
+	offset += 3
+
+	// supported versions extension is used to negotiate tls 1.3
+	if len(body) >= offset+2 {
+		extensions := body[offset+2:]
+		for len(extensions) >= 4 {
+			extType := binary.BigEndian.Uint16(extensions[:2])
+			extLen := int(binary.BigEndian.Uint16(extensions[2:4]))
+			if len(extensions) < 4+extLen {
+				break
+			}
+			if extType == tlsExtSupportedVersions && extLen == 2 {
+				version = binary.BigEndian.Uint16(extensions[4:6])
+			}
+			extensions = extensions[4+extLen:]
+		}
+	}
+
+	s.serverRandom = append([]byte{}, random...)
+	s.version = version
+	if version == tls.VersionTLS13 {
+		s.client.encrypted = true
+		s.server.encrypted = true
+	}
+	return nil
+}
+
+func (s *TLSSession) setupKeys() error {
+	if s.keysReady {
+		return nil
+	}
+	if s.clientRandom == nil || s.serverRandom == nil {
+		return errors.New("handshake not seen")
+	}
+	suite, ok := tlsCipherSuites[s.cipherSuite]
+	if !ok {
+		return fmt.Errorf("%w 0x%04x", ErrTLSUnsupportedSuite, s.cipherSuite)
+	}
+
+	if s.version == tls.VersionTLS13 {
+		secrets := []struct {
+			hc    *tlsHalfConn
+			epoch int
+			label string
+		}{
+			{&s.client, 0, KeyLogClientHandshakeSecret},
+			{&s.server, 0, KeyLogServerHandshakeSecret},
+			{&s.client, 1, KeyLogClientTrafficSecret},
+			{&s.server, 1, KeyLogServerTrafficSecret},
+		}
+		for _, secret := range secrets {
+			keys, err := newTLS13TrafficKeys(suite, s.keylog.Secret(secret.label, s.clientRandom))
+			if err != nil && secret.epoch == 1 {
+				return err
+			}
+			secret.hc.keys[secret.epoch] = keys
+		}
+		s.keysReady = true
+		return nil
+	}
+
+	masterSecret := s.keylog.Secret(KeyLogClientRandom, s.clientRandom)
+	if masterSecret == nil {
+		return ErrTLSMissingSecret
+	}
+	seed := append(append([]byte{}, s.serverRandom...), s.clientRandom...)
+	keyBlock := tls12PRF(suite.hash, masterSecret, "key expansion", seed, 2*suite.keyLen+2*suite.ivLen)
+
+	clientKey, keyBlock := keyBlock[:suite.keyLen], keyBlock[suite.keyLen:]
+	serverKey, keyBlock := keyBlock[:suite.keyLen], keyBlock[suite.keyLen:]
+	clientIV, serverIV := keyBlock[:suite.ivLen], keyBlock[suite.ivLen:]
+
+	var err error
+	if s.client.keys[1], err = newTLSTrafficKeys(suite, clientKey, clientIV); err != nil {
+		return err
+	}
+	if s.server.keys[1], err = newTLSTrafficKeys(suite, serverKey, serverIV); err != nil {
+		return err
+	}
+	s.keysReady = true
+	return nil
+}
@@ -0,0 +1,365 @@
+package workers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-netutils"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	http2FrameHeaderLen   = 9
+	http2FrameData        = 0x0
+	http2FrameHeaders     = 0x1
+	http2FrameContinue    = 0x9
+	http2FlagEndStream    = 0x1
+	http2FlagEndHeaders   = 0x4
+	http2FlagPadded       = 0x8
+	http2FlagPriority     = 0x20
+	http2ClientPreface    = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	dohContentType        = "application/dns-message"
+	tlsFlowTimeout        = 2 * time.Minute
+	tlsFlowCleanupTimeout = 1 * time.Minute
+)
+
+// TLSPacket is a DNS message extracted from a decrypted DoT or DoH flow
+type TLSPacket struct {
+	netutils.DNSPacket
+	Protocol string
+}
+
+// AppDecoder extracts raw DNS messages from decrypted application data
+type AppDecoder interface {
+	Decode(data []byte) ([][]byte, error)
+}
+
+// DoTDecoder reads DNS messages prefixed with a two bytes length field
+type DoTDecoder struct {
+	buf []byte
+}
+
+func (d *DoTDecoder) Decode(data []byte) ([][]byte, error) {
+	d.buf = append(d.buf, data...)
+	if len(d.buf) > tlsMaxPendingLen {
+		return nil, ErrTLSOverflow
+	}
+
+	var msgs [][]byte
+	for len(d.buf) >= 2 {
+		length := int(binary.BigEndian.Uint16(d.buf[:2]))
+		if len(d.buf) < 2+length {
+			break
+		}
+		msgs = append(msgs, append([]byte{}, d.buf[2:2+length]...))
+		d.buf = d.buf[2+length:]
+	}
+	return msgs, nil
+}
+
+type dohStream struct {
+	contentType string
+	data        []byte
+}
+
+// DoHDecoder reads DNS messages from HTTP/2 frames, in DATA frames for POST requests and
+// responses or in the dns parameter of GET requests
+type DoHDecoder struct {
+	buf           []byte
+	preface       bool
+	hpack         *hpack.Decoder
+	streams       map[uint32]*dohStream
+	headerBlock   []byte
+	headerStream  uint32
+	headerEndFlag bool
+}
+
+func NewDoHDecoder(fromClient bool) *DoHDecoder {
+	d := &DoHDecoder{
+		preface: fromClient,
+		hpack:   hpack.NewDecoder(4096, nil),
+		streams: make(map[uint32]*dohStream),
+	}
+	d.hpack.SetMaxStringLength(tlsMaxPendingLen)
+	return d
+}
+
+func (d *DoHDecoder) Decode(data []byte) ([][]byte, error) {
+	d.buf = append(d.buf, data...)
+	if len(d.buf) > tlsMaxPendingLen {
+		return nil, ErrTLSOverflow
+	}
+
+	// client connection starts with a preface
+	if d.preface {
+		if len(d.buf) < len(http2ClientPreface) {
+			return nil, nil
+		}
+		if !bytes.HasPrefix(d.buf, []byte(http2ClientPreface)) {
+			return nil, ErrTLSDecrypt
+		}
+		d.buf = d.buf[len(http2ClientPreface):]
+		d.preface = false
+	}
+
+	var msgs [][]byte
+	for len(d.buf) >= http2FrameHeaderLen {
+		length := int(d.buf[0])<<16 | int(d.buf[1])<<8 | int(d.buf[2])
+		if len(d.buf) < http2FrameHeaderLen+length {
+			break
+		}
+		frameType, flags := d.buf[3], d.buf[4]
+		streamID := binary.BigEndian.Uint32(d.buf[5:9]) & 0x7fffffff
+		payload := d.buf[http2FrameHeaderLen : http2FrameHeaderLen+length]
+		d.buf = d.buf[http2FrameHeaderLen+length:]
+
+		msg, err := d.decodeFrame(frameType, flags, streamID, payload)
+		if err != nil {
+			return msgs, err
+		}
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (d *DoHDecoder) decodeFrame(frameType, flags byte, streamID uint32, payload []byte) ([]byte, error) {
+	switch frameType {
+	case http2FrameData:
+		payload = http2RemovePadding(flags, payload)
+		stream, ok := d.streams[streamID]
+		if !ok {
+			return nil, nil
+		}
+		stream.data = append(stream.data, payload...)
+		if flags&http2FlagEndStream != 0 {
+			return d.endStream(streamID), nil
+		}
+
+	case http2FrameHeaders:
+		payload = http2RemovePadding(flags, payload)
+		if flags&http2FlagPriority != 0 && len(payload) >= 5 {
+			payload = payload[5:]
+		}
+		d.headerStream = streamID
+		d.headerBlock = append(d.headerBlock[:0], payload...)
+		d.headerEndFlag = flags&http2FlagEndStream != 0
+		if flags&http2FlagEndHeaders != 0 {
+			return d.decodeHeaders()
+		}
+
+	case http2FrameContinue:
+		d.headerBlock = append(d.headerBlock, payload...)
+		if flags&http2FlagEndHeaders != 0 {
+			return d.decodeHeaders()
+		}
+	}
+	return nil, nil
+}
+
+func (d *DoHDecoder) decodeHeaders() ([]byte, error) {
+	// all header blocks must be decoded to keep the dynamic table in sync
+	fields, err := d.hpack.DecodeFull(d.headerBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok := d.streams[d.headerStream]
+	if !ok {
+		stream = &dohStream{}
+		d.streams[d.headerStream] = stream
+	}
+
+	var msg []byte
+	for _, field := range fields {
+		switch field.Name {
+		case "content-type":
+			stream.contentType = field.Value
+		case ":path":
+			if u, err := url.Parse(field.Value); err == nil {
+				if param := u.Query().Get("dns"); param != "" {
+					msg, _ = base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+				}
+			}
+		}
+	}
+
+	if d.headerEndFlag {
+		if payload := d.endStream(d.headerStream); payload != nil {
+			msg = payload
+		}
+	}
+	return msg, nil
+}
+
+func (d *DoHDecoder) endStream(streamID uint32) []byte {
+	stream := d.streams[streamID]
+	delete(d.streams, streamID)
+	if stream == nil || len(stream.data) == 0 || !strings.HasPrefix(stream.contentType, dohContentType) {
+		return nil
+	}
+	return stream.data
+}
+
+func http2RemovePadding(flags byte, payload []byte) []byte {
+	if flags&http2FlagPadded == 0 || len(payload) == 0 {
+		return payload
+	}
+	padLen := int(payload[0])
+	if padLen >= len(payload) {
+		return nil
+	}
+	return payload[1 : len(payload)-padLen]
+}
+
+type tlsFlowKey struct {
+	net, transport gopacket.Flow
+}
+
+type tlsFlow struct {
+	session        *TLSSession
+	protocol       string
+	client, server AppDecoder
+	failed         bool
+}
+
+// TLSStreamFactory creates the tcp streams of the DoT and DoH flows, the two directions
+// of a connection share the same TLS session
+type TLSStreamFactory struct {
+	keylog           *TLSKeyLog
+	dotPort, dohPort int
+	flows            map[tlsFlowKey]*tlsFlow
+	output           chan TLSPacket
+	logError         func(msg string, v ...interface{})
+}
+
+func NewTLSStreamFactory(keylog *TLSKeyLog, dotPort, dohPort int, output chan TLSPacket, logError func(msg string, v ...interface{})) *TLSStreamFactory {
+	return &TLSStreamFactory{
+		keylog:   keylog,
+		dotPort:  dotPort,
+		dohPort:  dohPort,
+		flows:    make(map[tlsFlowKey]*tlsFlow),
+		output:   output,
+		logError: logError,
+	}
+}
+
+func (f *TLSStreamFactory) New(netFlow, tcpFlow gopacket.Flow) tcpassembly.Stream {
+	// the server side is identified with the destination port
+	dstPort := int(binary.BigEndian.Uint16(tcpFlow.Dst().Raw()))
+	fromClient := dstPort == f.dotPort || dstPort == f.dohPort
+
+	key := tlsFlowKey{net: netFlow, transport: tcpFlow}
+	if !fromClient {
+		key = tlsFlowKey{net: netFlow.Reverse(), transport: tcpFlow.Reverse()}
+	}
+
+	flow, ok := f.flows[key]
+	if !ok {
+		flow = &tlsFlow{session: NewTLSSession(f.keylog), protocol: dnsutils.ProtoDoT}
+		serverPort := int(binary.BigEndian.Uint16(key.transport.Dst().Raw()))
+		if serverPort == f.dohPort {
+			flow.protocol = dnsutils.ProtoDoH
+			flow.client, flow.server = NewDoHDecoder(true), NewDoHDecoder(false)
+		} else {
+			flow.client, flow.server = &DoTDecoder{}, &DoTDecoder{}
+		}
+		f.flows[key] = flow
+	}
+
+	return &tlsStream{factory: f, key: key, flow: flow, net: netFlow, transport: tcpFlow, fromClient: fromClient}
+}
+
+type tlsStream struct {
+	factory        *TLSStreamFactory
+	key            tlsFlowKey
+	flow           *tlsFlow
+	net, transport gopacket.Flow
+	fromClient     bool
+}
+
+func (s *tlsStream) Reassembled(rs []tcpassembly.Reassembly) {
+	for _, r := range rs {
+		if s.flow.failed {
+			return
+		}
+
+		// a TLS session can not be decoded with missing bytes
+		if r.Skip != 0 {
+			s.flow.failed = true
+			return
+		}
+
+		appData, err := s.flow.session.Decode(s.fromClient, r.Bytes)
+		if err != nil {
+			s.factory.logError("tls flow %s:%s - %s", s.net, s.transport, err)
+			s.flow.failed = true
+		}
+		if len(appData) == 0 {
+			continue
+		}
+
+		decoder := s.flow.server
+		if s.fromClient {
+			decoder = s.flow.client
+		}
+		msgs, err := decoder.Decode(appData)
+		if err != nil {
+			s.factory.logError("%s flow %s:%s - %s", s.flow.protocol, s.net, s.transport, err)
+			s.flow.failed = true
+		}
+		for _, msg := range msgs {
+			s.factory.output <- TLSPacket{
+				DNSPacket: netutils.DNSPacket{
+					Payload:        msg,
+					IPLayer:        s.net,
+					TransportLayer: s.transport,
+					Timestamp:      r.Seen,
+					TCPReassembled: true,
+				},
+				Protocol: s.flow.protocol,
+			}
+		}
+	}
+}
+
+// the stream of the other direction keeps a reference on the flow until its own completion
+func (s *tlsStream) ReassemblyComplete() {
+	delete(s.factory.flows, s.key)
+}
+
+// TLSAssembler reassembles the tcp packets of DoT and DoH flows, decrypts them with the secrets
+// from the key log and sends the DNS messages found to the output channel
+func TLSAssembler(tcpInput chan gopacket.Packet, factory *TLSStreamFactory) {
+	streamPool := tcpassembly.NewStreamPool(factory)
+	assembler := tcpassembly.NewAssembler(streamPool)
+
+	ticker := time.NewTicker(tlsFlowCleanupTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case packet, more := <-tcpInput:
+			if !more {
+				assembler.FlushAll()
+				return
+			}
+			assembler.AssembleWithTimestamp(
+				packet.NetworkLayer().NetworkFlow(),
+				packet.TransportLayer().(*layers.TCP),
+				packet.Metadata().Timestamp,
+			)
+		case <-ticker.C:
+			assembler.FlushOlderThan(time.Now().Add(-tlsFlowTimeout))
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package workers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+	"github.com/miekg/dns"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+type tlsRecordedChunk struct {
+	fromClient bool
+	data       []byte
+}
+
+// tlsRecorder keeps the bytes written on both sides of a connection in order
+type tlsRecorder struct {
+	sync.Mutex
+	chunks []tlsRecordedChunk
+}
+
+type tlsRecordedConn struct {
+	net.Conn
+	recorder   *tlsRecorder
+	fromClient bool
+}
+
+func (c *tlsRecordedConn) Write(b []byte) (int, error) {
+	c.recorder.Lock()
+	c.recorder.chunks = append(c.recorder.chunks, tlsRecordedChunk{fromClient: c.fromClient, data: append([]byte{}, b...)})
+	c.recorder.Unlock()
+	return c.Conn.Write(b)
+}
+
+// tlsExchange runs a tls connection, the client writes the request and the server writes the reply,
+// the recorded chunks and the path of the key log file are returned
+func tlsExchange(t *testing.T, clientConfig *tls.Config, request, reply []byte) ([]tlsRecordedChunk, string) {
+	cert, err := tls.LoadX509KeyPair("../tests/testsdata/certs/server.crt", "../tests/testsdata/certs/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keylog := new(bytes.Buffer)
+	clientConfig.InsecureSkipVerify = true
+	clientConfig.KeyLogWriter = keylog
+
+	recorder := &tlsRecorder{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSide, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := tls.Client(&tlsRecordedConn{Conn: clientSide, recorder: recorder, fromClient: true}, clientConfig)
+	server := tls.Server(&tlsRecordedConn{Conn: serverSide, recorder: recorder}, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	done := make(chan error)
+	go func() {
+		if _, err := io.ReadFull(server, make([]byte, len(request))); err != nil {
+			done <- err
+			return
+		}
+		_, err := server.Write(reply)
+		done <- err
+	}()
+
+	if _, err := client.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(client, make([]byte, len(reply))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	server.Close()
+
+	keylogFile := filepath.Join(t.TempDir(), "keylog.txt")
+	if err := os.WriteFile(keylogFile, keylog.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.chunks, keylogFile
+}
+
+func tlsTestMessages(t *testing.T) ([]byte, []byte) {
+	query := new(dns.Msg)
+	query.SetQuestion("dns.collector.", dns.TypeA)
+	queryWire, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	rr, _ := dns.NewRR("dns.collector. 300 IN A 127.0.0.1")
+	reply.Answer = append(reply.Answer, rr)
+	replyWire, err := reply.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queryWire, replyWire
+}
+
+func dotFrame(msg []byte) []byte {
+	frame := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	return append(frame, msg...)
+}
+
+// tlsReplay sends the recorded chunks to the streams created by the factory
+func tlsReplay(factory *TLSStreamFactory, chunks []tlsRecordedChunk, serverPort uint16) {
+	clientIP, serverIP := layers.NewIPEndpoint(net.ParseIP("192.168.1.1")), layers.NewIPEndpoint(net.ParseIP("192.168.1.2"))
+	clientPort, dstPort := make([]byte, 2), make([]byte, 2)
+	binary.BigEndian.PutUint16(clientPort, 40000)
+	binary.BigEndian.PutUint16(dstPort, serverPort)
+	netFlow, _ := gopacket.FlowFromEndpoints(clientIP, serverIP)
+	tcpFlow := gopacket.NewFlow(layers.EndpointTCPPort, clientPort, dstPort)
+
+	toServer := factory.New(netFlow, tcpFlow)
+	toClient := factory.New(netFlow.Reverse(), tcpFlow.Reverse())
+	for _, chunk := range chunks {
+		stream := toClient
+		if chunk.fromClient {
+			stream = toServer
+		}
+		stream.Reassembled([]tcpassembly.Reassembly{{Bytes: chunk.data, Seen: time.Now()}})
+	}
+	toServer.ReassemblyComplete()
+	toClient.ReassemblyComplete()
+}
+
+func Test_TLSSniffer_DoT(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config *tls.Config
+	}{
+		{
+			name:   "tls12_aes128gcm",
+			config: &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}},
+		},
+		{
+			name:   "tls12_aes256gcm",
+			config: &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}},
+		},
+		{
+			name:   "tls12_chacha20",
+			config: &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256}},
+		},
+		{
+			name:   "tls13",
+			config: &tls.Config{MinVersion: tls.VersionTLS13},
+		},
+	}
+
+	query, reply := tlsTestMessages(t)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks, keylogFile := tlsExchange(t, tc.config, dotFrame(query), dotFrame(reply))
+
+			keylog, err := NewTLSKeyLog(keylogFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := make(chan TLSPacket, 10)
+			factory := NewTLSStreamFactory(keylog, 853, 443, output, func(msg string, v ...interface{}) { t.Errorf(msg, v...) })
+			tlsReplay(factory, chunks, 853)
+
+			if len(output) != 2 {
+				t.Fatalf("2 dns messages expected, got %d", len(output))
+			}
+			for _, expected := range [][]byte{query, reply} {
+				pkt := <-output
+				if pkt.Protocol != dnsutils.ProtoDoT {
+					t.Errorf("invalid protocol: %s", pkt.Protocol)
+				}
+				if !bytes.Equal(pkt.Payload, expected) {
+					t.Errorf("invalid dns payload")
+				}
+			}
+			if len(factory.flows) != 0 {
+				t.Errorf("flows not released: %d", len(factory.flows))
+			}
+		})
+	}
+}
+
+func Test_TLSSniffer_MissingSecret(t *testing.T) {
+	query, reply := tlsTestMessages(t)
+	chunks, _ := tlsExchange(t, &tls.Config{MinVersion: tls.VersionTLS13}, dotFrame(query), dotFrame(reply))
+
+	// empty keylog file
+	keylogFile := filepath.Join(t.TempDir(), "keylog.txt")
+	if err := os.WriteFile(keylogFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keylog, err := NewTLSKeyLog(keylogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errors := 0
+	output := make(chan TLSPacket, 10)
+	factory := NewTLSStreamFactory(keylog, 853, 443, output, func(msg string, v ...interface{}) { errors++ })
+	tlsReplay(factory, chunks, 853)
+
+	if len(output) != 0 {
+		t.Errorf("no dns message expected, got %d", len(output))
+	}
+	if errors == 0 {
+		t.Errorf("decryption error expected")
+	}
+}
+
+func Test_TLSSniffer_DoH(t *testing.T) {
+	query, reply := tlsTestMessages(t)
+
+	// http2 request with POST method
+	request := new(bytes.Buffer)
+	request.WriteString(http2ClientPreface)
+	framer := http2.NewFramer(request, nil)
+	framer.WriteSettings()
+	framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: dohHeaders(t,
+		hpack.HeaderField{Name: ":method", Value: "POST"},
+		hpack.HeaderField{Name: ":path", Value: "/dns-query"},
+		hpack.HeaderField{Name: "content-type", Value: dohContentType},
+	), EndHeaders: true})
+	framer.WriteData(1, false, query[:5])
+	framer.WriteDataPadded(1, true, query[5:], []byte{0, 0, 0})
+
+	// http2 response with the dns reply
+	response := new(bytes.Buffer)
+	framer = http2.NewFramer(response, nil)
+	framer.WriteSettings()
+	framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: dohHeaders(t,
+		hpack.HeaderField{Name: ":status", Value: "200"},
+		hpack.HeaderField{Name: "content-type", Value: dohContentType},
+	), EndHeaders: true})
+	framer.WriteData(1, true, reply)
+
+	chunks, keylogFile := tlsExchange(t, &tls.Config{MinVersion: tls.VersionTLS13, NextProtos: []string{"h2"}}, request.Bytes(), response.Bytes())
+	keylog, err := NewTLSKeyLog(keylogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := make(chan TLSPacket, 10)
+	factory := NewTLSStreamFactory(keylog, 853, 443, output, func(msg string, v ...interface{}) { t.Errorf(msg, v...) })
+	tlsReplay(factory, chunks, 443)
+
+	if len(output) != 2 {
+		t.Fatalf("2 dns messages expected, got %d", len(output))
+	}
+	for _, expected := range [][]byte{query, reply} {
+		pkt := <-output
+		if pkt.Protocol != dnsutils.ProtoDoH {
+			t.Errorf("invalid protocol: %s", pkt.Protocol)
+		}
+		if !bytes.Equal(pkt.Payload, expected) {
+			t.Errorf("invalid dns payload")
+		}
+	}
+}
+
+func Test_DoHDecoder_GetMethod(t *testing.T) {
+	query, _ := tlsTestMessages(t)
+
+	request := new(bytes.Buffer)
+	request.WriteString(http2ClientPreface)
+	framer := http2.NewFramer(request, nil)
+	framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 3, BlockFragment: dohHeaders(t,
+		hpack.HeaderField{Name: ":method", Value: "GET"},
+		hpack.HeaderField{Name: ":path", Value: "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(query)},
+	), EndHeaders: true, EndStream: true})
+
+	msgs, err := NewDoHDecoder(true).Decode(request.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || !bytes.Equal(msgs[0], query) {
+		t.Errorf("dns query expected in the path")
+	}
+}
+
+func Test_DoTDecoder_Partial(t *testing.T) {
+	query, reply := tlsTestMessages(t)
+	data := append(dotFrame(query), dotFrame(reply)...)
+
+	decoder := &DoTDecoder{}
+	msgs, _ := decoder.Decode(data[:3])
+	if len(msgs) != 0 {
+		t.Errorf("no message expected with partial data")
+	}
+	msgs, _ = decoder.Decode(data[3:])
+	if len(msgs) != 2 {
+		t.Errorf("2 messages expected, got %d", len(msgs))
+	}
+}
+
+func dohHeaders(t *testing.T, fields ...hpack.HeaderField) []byte {
+	buf := new(bytes.Buffer)
+	encoder := hpack.NewEncoder(buf)
+	for _, field := range fields {
+		if err := encoder.WriteField(field); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
@@ -45,8 +45,8 @@ func (w *XDPSniffer) StartCollect() {
 		bufSize = w.GetConfig().Collectors.XdpLiveCapture.ChannelBufferSize
 	}
 	dnsProcessor := NewDNSProcessor(w.GetConfig(), w.GetLogger(), w.GetName(), bufSize)
-	dnsProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	dnsProcessor.SetDefaultDropped(w.GetDroppedRoutes())
+	dnsProcessor.ShareRouting(w.GenericWorker)
+	dnsProcessor.SetRdataFields(w.GetConfig().Collectors.XdpLiveCapture.RdataFields)
 	go dnsProcessor.StartCollect()
 
 	// get network interface by name
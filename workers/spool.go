@@ -0,0 +1,420 @@
+package workers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+)
+
+var (
+	ErrSpoolFull      = errors.New("spool is full")
+	ErrSpoolCorrupted = errors.New("spool segment corrupted")
+	ErrSpoolRecord    = errors.New("spool record too large")
+)
+
+const (
+	spoolSegmentPrefix = "segment-"
+	spoolSegmentSuffix = ".spool"
+	spoolCursorFile    = "cursor"
+	spoolHeaderLen     = 8
+)
+
+type spoolPosition struct {
+	segment uint64
+	offset  int64
+}
+
+// DiskSpool is a persistent queue of records split in segment files.
+// Records are appended to the last segment and read in order from the first one,
+// the read position is saved on commit so the replay continues after a restart.
+type DiskSpool struct {
+	sync.Mutex
+	dir                  string
+	segmentSize, maxSize int64
+	segments             []uint64
+	sizes                map[uint64]int64
+	writer               *os.File
+	reader               *os.File
+	readerSegment        uint64
+	head, peek           spoolPosition
+	dropped              int
+}
+
+// NewDiskSpool opens the spool stored in the directory, incomplete records
+// at the end of the last segment are removed
+func NewDiskSpool(dir string, segmentSize, maxSize int64) (*DiskSpool, error) {
+	if segmentSize <= spoolHeaderLen || maxSize < segmentSize {
+		return nil, fmt.Errorf("invalid spool sizes, segment=%d max=%d", segmentSize, maxSize)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	s := &DiskSpool{dir: dir, segmentSize: segmentSize, maxSize: maxSize, sizes: make(map[uint64]int64)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix), spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	// restore the read position, segments before it are already consumed
+	s.head = s.readCursor()
+	for len(s.segments) > 0 && s.segments[0] < s.head.segment {
+		os.Remove(s.segmentPath(s.segments[0]))
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) == 0 || s.segments[0] != s.head.segment {
+		s.head = spoolPosition{}
+		if len(s.segments) > 0 {
+			s.head.segment = s.segments[0]
+		}
+	}
+
+	for _, id := range s.segments {
+		info, err := os.Stat(s.segmentPath(id))
+		if err != nil {
+			return nil, err
+		}
+		s.sizes[id] = info.Size()
+	}
+
+	// open the last segment for writing
+	if len(s.segments) == 0 {
+		if err := s.newSegment(s.head.segment + 1); err != nil {
+			return nil, err
+		}
+		s.head = spoolPosition{segment: s.segments[0]}
+	} else {
+		last := s.segments[len(s.segments)-1]
+		validSize, err := s.validSize(last)
+		if err != nil {
+			return nil, err
+		}
+		s.writer, err = os.OpenFile(s.segmentPath(last), os.O_RDWR, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.writer.Truncate(validSize); err != nil {
+			return nil, err
+		}
+		if _, err := s.writer.Seek(validSize, io.SeekStart); err != nil {
+			return nil, err
+		}
+		s.sizes[last] = validSize
+		if s.head.segment == last && s.head.offset > validSize {
+			s.head.offset = validSize
+		}
+	}
+	s.peek = s.head
+	return s, nil
+}
+
+func (s *DiskSpool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, id, spoolSegmentSuffix))
+}
+
+func (s *DiskSpool) readCursor() spoolPosition {
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolCursorFile))
+	if err != nil || len(data) != 16 {
+		return spoolPosition{}
+	}
+	return spoolPosition{segment: binary.BigEndian.Uint64(data[:8]), offset: int64(binary.BigEndian.Uint64(data[8:]))}
+}
+
+func (s *DiskSpool) writeCursor() error {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], s.head.segment)
+	binary.BigEndian.PutUint64(data[8:], uint64(s.head.offset))
+
+	tmpFile := filepath.Join(s.dir, spoolCursorFile+".tmp")
+	if err := os.WriteFile(tmpFile, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(s.dir, spoolCursorFile))
+}
+
+// validSize returns the size of the segment without the incomplete or corrupted records at the end
+func (s *DiskSpool) validSize(id uint64) (int64, error) {
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var offset int64
+	for {
+		record, err := readSpoolRecord(f, offset, s.segmentSize)
+		if err != nil {
+			return offset, nil
+		}
+		offset += spoolHeaderLen + int64(len(record))
+	}
+}
+
+func (s *DiskSpool) newSegment(id uint64) error {
+	if s.writer != nil {
+		s.writer.Close()
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	s.writer = f
+	s.segments = append(s.segments, id)
+	s.sizes[id] = 0
+	return nil
+}
+
+func readSpoolRecord(f *os.File, offset, maxLen int64) ([]byte, error) {
+	header := make([]byte, spoolHeaderLen)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if int64(length) > maxLen {
+		return nil, ErrSpoolCorrupted
+	}
+	record := make([]byte, length)
+	if _, err := f.ReadAt(record, offset+spoolHeaderLen); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrSpoolCorrupted
+	}
+	return record, nil
+}
+
+// Size returns the disk usage of all segments
+func (s *DiskSpool) Size() int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+	return total
+}
+
+// Pending returns true when some records are not yet committed
+func (s *DiskSpool) Pending() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	last := s.segments[len(s.segments)-1]
+	return s.head.segment != last || s.head.offset < s.sizes[last]
+}
+
+// Write appends the record at the end of the spool
+func (s *DiskSpool) Write(record []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	recordLen := spoolHeaderLen + int64(len(record))
+	if recordLen > s.segmentSize {
+		return ErrSpoolRecord
+	}
+
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+	if total+recordLen > s.maxSize {
+		s.dropped++
+		return ErrSpoolFull
+	}
+
+	last := s.segments[len(s.segments)-1]
+	if s.sizes[last]+recordLen > s.segmentSize {
+		if err := s.newSegment(last + 1); err != nil {
+			return err
+		}
+		last++
+	}
+
+	data := make([]byte, recordLen)
+	binary.BigEndian.PutUint32(data[:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(record))
+	copy(data[spoolHeaderLen:], record)
+
+	n, err := s.writer.Write(data)
+	s.sizes[last] += int64(n)
+	return err
+}
+
+// Peek returns up to max records from the read position without removing them,
+// the records are removed from the spool with Commit. A corrupted segment is skipped and
+// ErrSpoolCorrupted is returned with the records read before.
+func (s *DiskSpool) Peek(max int) ([][]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var records [][]byte
+	s.peek = s.head
+	last := s.segments[len(s.segments)-1]
+
+	for len(records) < max {
+		if s.peek.offset >= s.sizes[s.peek.segment] {
+			// end of spool or next segment
+			if s.peek.segment == last {
+				break
+			}
+			s.peek = spoolPosition{segment: s.nextSegment(s.peek.segment)}
+			continue
+		}
+
+		if s.reader == nil || s.readerSegment != s.peek.segment {
+			if s.reader != nil {
+				s.reader.Close()
+			}
+			f, err := os.Open(s.segmentPath(s.peek.segment))
+			if err != nil {
+				return records, err
+			}
+			s.reader, s.readerSegment = f, s.peek.segment
+		}
+
+		record, err := readSpoolRecord(s.reader, s.peek.offset, s.segmentSize)
+		if err != nil {
+			// skip the end of the segment
+			s.peek.offset = s.sizes[s.peek.segment]
+			return records, ErrSpoolCorrupted
+		}
+		records = append(records, record)
+		s.peek.offset += spoolHeaderLen + int64(len(record))
+	}
+	return records, nil
+}
+
+func (s *DiskSpool) nextSegment(id uint64) uint64 {
+	for _, segment := range s.segments {
+		if segment > id {
+			return segment
+		}
+	}
+	return id
+}
+
+// Commit removes the records returned by the last Peek, consumed segments are deleted
+func (s *DiskSpool) Commit() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.head = s.peek
+	for len(s.segments) > 1 && s.segments[0] < s.head.segment {
+		s.removeSegment(s.segments[0])
+		s.segments = s.segments[1:]
+	}
+
+	// everything is consumed, start again with an empty segment
+	last := s.segments[len(s.segments)-1]
+	if s.head.segment == last && s.head.offset >= s.sizes[last] && s.sizes[last] > 0 {
+		if err := s.newSegment(last + 1); err != nil {
+			return err
+		}
+		s.removeSegment(last)
+		s.segments = s.segments[1:]
+		s.head = spoolPosition{segment: last + 1}
+		s.peek = s.head
+	}
+	return s.writeCursor()
+}
+
+func (s *DiskSpool) removeSegment(id uint64) {
+	if s.reader != nil && s.readerSegment == id {
+		s.reader.Close()
+		s.reader = nil
+	}
+	delete(s.sizes, id)
+	os.Remove(s.segmentPath(id))
+}
+
+// Dropped returns the number of records rejected because the spool was full since the last call
+func (s *DiskSpool) Dropped() int {
+	s.Lock()
+	defer s.Unlock()
+
+	dropped := s.dropped
+	s.dropped = 0
+	return dropped
+}
+
+// Replay sends the pending records by batch, a batch is committed only when it is sent with success.
+// The replay stops when the spool is empty or after maxBatches if greater than zero.
+func (s *DiskSpool) Replay(batchSize, maxBatches int, send func(records [][]byte) error) error {
+	var corrupted error
+	for n := 0; maxBatches <= 0 || n < maxBatches; n++ {
+		records, err := s.Peek(batchSize)
+		switch {
+		case errors.Is(err, ErrSpoolCorrupted):
+			corrupted = err
+		case err != nil:
+			return err
+		case len(records) == 0:
+			return corrupted
+		}
+
+		if len(records) > 0 {
+			if err := send(records); err != nil {
+				return err
+			}
+		}
+		if err := s.Commit(); err != nil {
+			return err
+		}
+	}
+	return corrupted
+}
+
+func (s *DiskSpool) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	return s.writer.Close()
+}
+
+// NewWorkerSpool opens the spool of the worker in a dedicated sub-directory,
+// nil is returned when the spool is disabled
+func NewWorkerSpool(w *GenericWorker, cfg pkgconfig.ConfigSpool) *DiskSpool {
+	if !cfg.Enable {
+		return nil
+	}
+	if len(cfg.Directory) == 0 {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] spool - directory is required")
+	}
+
+	spool, err := NewDiskSpool(filepath.Join(cfg.Directory, w.GetName()), int64(cfg.SegmentSize), int64(cfg.MaxSize))
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] spool - unable to open:", err)
+	}
+	if spool.Pending() {
+		w.LogInfo("spool - %d bytes to replay", spool.Size())
+	}
+	return spool
+}
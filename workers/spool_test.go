@@ -0,0 +1,290 @@
+package workers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func spoolRecords(t *testing.T, s *DiskSpool) []string {
+	var records []string
+	for {
+		batch, err := s.Peek(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) == 0 {
+			return records
+		}
+		for _, r := range batch {
+			records = append(records, string(r))
+		}
+		if err := s.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_DiskSpool_WriteAndReplayInOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	// small segments to force the rotation
+	s, err := NewDiskSpool(dir, 64, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Pending() {
+		t.Errorf("new spool should be empty")
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := s.Write([]byte(fmt.Sprintf("record-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !s.Pending() {
+		t.Errorf("spool should be pending")
+	}
+	if len(s.segments) < 2 {
+		t.Errorf("several segments expected, got %d", len(s.segments))
+	}
+
+	records := spoolRecords(t, s)
+	if len(records) != 20 {
+		t.Fatalf("20 records expected, got %d", len(records))
+	}
+	for i, r := range records {
+		if r != fmt.Sprintf("record-%02d", i) {
+			t.Errorf("invalid order, got %s at %d", r, i)
+		}
+	}
+
+	// consumed segments are removed
+	if s.Pending() {
+		t.Errorf("spool should be empty")
+	}
+	if s.Size() != 0 {
+		t.Errorf("empty spool expected, got %d bytes", s.Size())
+	}
+	s.Close()
+}
+
+func Test_DiskSpool_Reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewDiskSpool(dir, 64, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s.Write([]byte("record-" + strconv.Itoa(i)))
+	}
+
+	// consume the first records only
+	if _, err := s.Peek(4); err != nil {
+		t.Fatal(err)
+	}
+	s.Commit()
+	// not committed
+	s.Peek(2)
+	s.Close()
+
+	// a torn record at the end of the last segment is ignored
+	entries, _ := os.ReadDir(dir)
+	var last string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), spoolSegmentPrefix) {
+			last = e.Name()
+		}
+	}
+	f, err := os.OpenFile(filepath.Join(dir, last), os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 10, 1, 2})
+	f.Close()
+
+	s, err = NewDiskSpool(dir, 64, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	records := spoolRecords(t, s)
+	if len(records) != 6 || records[0] != "record-4" || records[5] != "record-9" {
+		t.Errorf("records 4 to 9 expected, got %v", records)
+	}
+}
+
+func Test_DiskSpool_MaxSize(t *testing.T) {
+	s, err := NewDiskSpool(t.TempDir(), 64, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var full int
+	for i := 0; i < 20; i++ {
+		if err := s.Write([]byte("0123456789")); errors.Is(err, ErrSpoolFull) {
+			full++
+		}
+	}
+	if full == 0 || s.Dropped() != full {
+		t.Errorf("records should be dropped when the spool is full")
+	}
+	if s.Size() > 128 {
+		t.Errorf("spool size exceeded, got %d", s.Size())
+	}
+	if s.Dropped() != 0 {
+		t.Errorf("dropped counter should be reset")
+	}
+
+	if err := s.Write(make([]byte, 100)); !errors.Is(err, ErrSpoolRecord) {
+		t.Errorf("record larger than a segment should be rejected, got %v", err)
+	}
+}
+
+func Test_DiskSpool_ReplayFailure(t *testing.T) {
+	s, err := NewDiskSpool(t.TempDir(), 1024, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 5; i++ {
+		s.Write([]byte(strconv.Itoa(i)))
+	}
+
+	// nothing is committed on error
+	errSend := errors.New("connection refused")
+	if err := s.Replay(2, 0, func(records [][]byte) error { return errSend }); !errors.Is(err, errSend) {
+		t.Errorf("send error expected, got %v", err)
+	}
+
+	var replayed []string
+	err = s.Replay(2, 0, func(records [][]byte) error {
+		for _, r := range records {
+			replayed = append(replayed, string(r))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(replayed, ",") != "0,1,2,3,4" {
+		t.Errorf("all records expected after the failure, got %v", replayed)
+	}
+}
+
+func Test_DiskSpool_CorruptedSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskSpool(dir, 64, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		s.Write([]byte("record-" + strconv.Itoa(i)))
+	}
+
+	// corrupt the payload of the first record
+	first := s.segmentPath(s.segments[0])
+	data, _ := os.ReadFile(first)
+	data[spoolHeaderLen] ^= 0xff
+	os.WriteFile(first, data, 0o640)
+
+	var replayed []string
+	err = s.Replay(100, 0, func(records [][]byte) error {
+		for _, r := range records {
+			replayed = append(replayed, string(r))
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrSpoolCorrupted) {
+		t.Errorf("corruption should be reported, got %v", err)
+	}
+	if len(replayed) == 0 || replayed[len(replayed)-1] != "record-9" {
+		t.Errorf("next segments should be replayed, got %v", replayed)
+	}
+	if s.Pending() {
+		t.Errorf("spool should be empty")
+	}
+}
+
+func Test_TcpClient_SpoolDuringOutage(t *testing.T) {
+	// find a free port, the receiver is not started yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cfg := pkgconfig.GetDefaultConfig()
+	cfg.Loggers.TCPClient.FlushInterval = 1
+	cfg.Loggers.TCPClient.RetryInterval = 1
+	cfg.Loggers.TCPClient.BufferSize = 0
+	cfg.Loggers.TCPClient.Mode = pkgconfig.ModeText
+	cfg.Loggers.TCPClient.RemoteAddress = "127.0.0.1"
+	cfg.Loggers.TCPClient.RemotePort = port
+	cfg.Loggers.TCPClient.Spool.Enable = true
+	cfg.Loggers.TCPClient.Spool.Directory = t.TempDir()
+	cfg.Global.TextFormat = "qname"
+
+	g := NewTCPClient(cfg, logger.New(false), "test")
+	go g.StartCollect()
+
+	// messages received during the outage
+	for i := 0; i < 5; i++ {
+		dm := dnsutils.GetFakeDNSMessage()
+		dm.DNS.Qname = fmt.Sprintf("outage%d.collector", i)
+		g.GetInputChannel() <- dm
+	}
+
+	// the messages are replayed when the remote is back
+	time.Sleep(time.Second)
+	fakeRcvr, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeRcvr.Close()
+
+	conn, err := fakeRcvr.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// new message sent after the replay
+	dm := dnsutils.GetFakeDNSMessage()
+	dm.DNS.Qname = "online.collector"
+	g.GetInputChannel() <- dm
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 6; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("outage%d.collector", i)
+		if i == 5 {
+			want = "online.collector"
+		}
+		if strings.TrimSpace(line) != want {
+			t.Errorf("want %s, got %s", want, line)
+		}
+	}
+}
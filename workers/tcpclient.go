@@ -2,6 +2,7 @@ package workers
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -27,6 +28,7 @@ type TCPClient struct {
 	transportConn                      net.Conn
 	transportReady, transportReconnect chan bool
 	writerReady                        bool
+	spool                              *DiskSpool
 }
 
 func NewTCPClient(config *pkgconfig.Config, logger *logger.Logger, name string) *TCPClient {
@@ -40,6 +42,7 @@ func NewTCPClient(config *pkgconfig.Config, logger *logger.Logger, name string)
 	w.stopRead = make(chan bool)
 	w.doneRead = make(chan bool)
 	w.ReadConfig()
+	w.spool = NewWorkerSpool(w.GenericWorker, config.Loggers.TCPClient.Spool)
 	return w
 }
 
@@ -160,29 +163,33 @@ func (w *TCPClient) ConnectToRemote() {
 	}
 }
 
-func (w *TCPClient) FlushBuffer(buf *[]dnsutils.DNSMessage) {
-	for _, dm := range *buf {
-		if w.GetConfig().Loggers.TCPClient.Mode == pkgconfig.ModeText {
-			w.transportWriter.Write(dm.Bytes(w.textFormat,
-				w.GetConfig().Global.TextFormatDelimiter,
-				w.GetConfig().Global.TextFormatBoundary))
-			w.transportWriter.WriteString(w.GetConfig().Loggers.TCPClient.PayloadDelimiter)
-		}
+func (w *TCPClient) EncodeMessage(dm *dnsutils.DNSMessage) ([]byte, error) {
+	var buffer bytes.Buffer
+	switch w.GetConfig().Loggers.TCPClient.Mode {
+	case pkgconfig.ModeText:
+		buffer.Write(dm.Bytes(w.textFormat,
+			w.GetConfig().Global.TextFormatDelimiter,
+			w.GetConfig().Global.TextFormatBoundary))
 
-		if w.GetConfig().Loggers.TCPClient.Mode == pkgconfig.ModeJSON {
-			json.NewEncoder(w.transportWriter).Encode(dm)
-			w.transportWriter.WriteString(w.GetConfig().Loggers.TCPClient.PayloadDelimiter)
-		}
+	case pkgconfig.ModeJSON:
+		json.NewEncoder(&buffer).Encode(dm)
 
-		if w.GetConfig().Loggers.TCPClient.Mode == pkgconfig.ModeFlatJSON {
-			flat, err := dm.Flatten()
-			if err != nil {
-				w.LogError("flattening DNS message failed: %e", err)
-				continue
-			}
-			json.NewEncoder(w.transportWriter).Encode(flat)
-			w.transportWriter.WriteString(w.GetConfig().Loggers.TCPClient.PayloadDelimiter)
+	case pkgconfig.ModeFlatJSON:
+		flat, err := dm.Flatten()
+		if err != nil {
+			return nil, err
 		}
+		json.NewEncoder(&buffer).Encode(flat)
+	}
+	buffer.WriteString(w.GetConfig().Loggers.TCPClient.PayloadDelimiter)
+	return buffer.Bytes(), nil
+}
+
+// WritePayloads sends the encoded messages and returns the number of messages sent,
+// the connection is restarted on error
+func (w *TCPClient) WritePayloads(payloads [][]byte) (int, error) {
+	for i, payload := range payloads {
+		w.transportWriter.Write(payload)
 
 		// flush the transport buffer
 		err := w.transportWriter.Flush()
@@ -190,22 +197,77 @@ func (w *TCPClient) FlushBuffer(buf *[]dnsutils.DNSMessage) {
 			w.LogError("send frame error", err.Error())
 			w.writerReady = false
 			<-w.transportReconnect
-			break
+			return i, err
 		}
 	}
+	return len(payloads), nil
+}
+
+func (w *TCPClient) FlushBuffer(buf *[]dnsutils.DNSMessage) {
+	var payloads [][]byte
+	for i := range *buf {
+		payload, err := w.EncodeMessage(&(*buf)[i])
+		if err != nil {
+			w.LogError("flattening DNS message failed: %e", err)
+			continue
+		}
+		payloads = append(payloads, payload)
+	}
+
+	// keep the messages not sent in the spool
+	if sent, err := w.WritePayloads(payloads); err != nil {
+		w.SpoolPayloads(payloads[sent:])
+	}
 
 	// reset buffer
 	*buf = nil
 }
 
+// SpoolPayloads saves the encoded messages on disk until the connection is back
+func (w *TCPClient) SpoolPayloads(payloads [][]byte) {
+	if w.spool == nil {
+		return
+	}
+	for _, payload := range payloads {
+		if err := w.spool.Write(payload); err != nil && !errors.Is(err, ErrSpoolFull) {
+			w.LogError("spool - %s", err)
+		}
+	}
+}
+
+// SpoolMessages encodes and saves the buffer in the spool, the buffer is reset
+func (w *TCPClient) SpoolMessages(buf *[]dnsutils.DNSMessage) {
+	if w.spool != nil {
+		for i := range *buf {
+			payload, err := w.EncodeMessage(&(*buf)[i])
+			if err != nil {
+				w.LogError("flattening DNS message failed: %e", err)
+				continue
+			}
+			w.SpoolPayloads([][]byte{payload})
+		}
+	}
+	*buf = nil
+}
+
+// ReplaySpool sends the messages saved during the outage
+func (w *TCPClient) ReplaySpool(maxBatches int) {
+	if w.spool == nil || !w.writerReady || !w.spool.Pending() {
+		return
+	}
+	err := w.spool.Replay(w.GetConfig().Loggers.TCPClient.Spool.ReplayBatch, maxBatches, func(records [][]byte) error {
+		_, err := w.WritePayloads(records)
+		return err
+	})
+	if err != nil {
+		w.LogError("spool - replay failed: %s", err)
+	}
+}
+
 func (w *TCPClient) StartCollect() {
 	w.LogInfo("starting data collection")
 	defer w.CollectDone()
 
-	// prepare next channels
-	defaultRoutes, defaultNames := GetRoutes(w.GetDefaultRoutes())
-	droppedRoutes, droppedNames := GetRoutes(w.GetDroppedRoutes())
-
 	// prepare transforms
 	subprocessors := transformers.NewTransforms(&w.GetConfig().OutgoingTransformers, w.GetLogger(), w.GetName(), w.GetOutputChannelAsList(), 0)
 
@@ -243,7 +305,7 @@ func (w *TCPClient) StartCollect() {
 				w.LogError(err.Error())
 			}
 			if transformResult == transformers.ReturnDrop {
-				w.SendDroppedTo(droppedRoutes, droppedNames, dm)
+				w.SendDroppedTo(dm)
 				continue
 			}
 
@@ -252,7 +314,7 @@ func (w *TCPClient) StartCollect() {
 			w.GetOutputChannel() <- dm
 
 			// send to next ?
-			w.SendForwardedTo(defaultRoutes, defaultNames, dm)
+			w.SendForwardedTo(dm)
 		}
 	}
 }
@@ -275,7 +337,11 @@ func (w *TCPClient) StartLogging() {
 	for {
 		select {
 		case <-w.OnLoggerStopped():
-			// closing remote connection if exist
+			// keep the buffer in the spool and closing remote connection if exist
+			w.SpoolMessages(&bufferDm)
+			if w.spool != nil {
+				w.spool.Close()
+			}
 			w.Disconnect()
 			return
 
@@ -294,8 +360,15 @@ func (w *TCPClient) StartLogging() {
 				return
 			}
 
-			// drop dns message if the connection is not ready to avoid memory leak or
-			// to block the channel
+			// save the message on disk while the connection is not ready or the spool
+			// is not fully replayed to keep the order, otherwise drop the dns message
+			// to avoid memory leak or to block the channel
+			if w.spool != nil && (!w.writerReady || w.spool.Pending()) {
+				bufferDm = append(bufferDm, dm)
+				w.SpoolMessages(&bufferDm)
+				w.ReplaySpool(1)
+				continue
+			}
 			if !w.writerReady {
 				continue
 			}
@@ -311,13 +384,21 @@ func (w *TCPClient) StartLogging() {
 		// flush the buffer
 		case <-flushTimer.C:
 			if !w.writerReady {
-				bufferDm = nil
+				w.SpoolMessages(&bufferDm)
 			}
 
 			if len(bufferDm) > 0 {
 				w.FlushBuffer(&bufferDm)
 			}
 
+			// replay messages saved during the outage
+			w.ReplaySpool(0)
+			if w.spool != nil {
+				if dropped := w.spool.Dropped(); dropped > 0 {
+					w.LogWarning("spool is full, %d messages dropped", dropped)
+				}
+			}
+
 			// restart timer
 			flushTimer.Reset(flushInterval)
 
@@ -87,8 +87,8 @@ func (w *TZSPSniffer) StartCollect() {
 
 	// init dns processor
 	dnsProcessor := NewDNSProcessor(w.GetConfig(), w.GetLogger(), w.GetName(), w.GetConfig().Collectors.Tzsp.ChannelBufferSize)
-	dnsProcessor.SetDefaultRoutes(w.GetDefaultRoutes())
-	dnsProcessor.SetDefaultDropped(w.GetDroppedRoutes())
+	dnsProcessor.ShareRouting(w.GenericWorker)
+	dnsProcessor.SetRdataFields(w.GetConfig().Collectors.Tzsp.RdataFields)
 	go dnsProcessor.StartCollect()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,226 @@
+package workers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-dnscollector/transformers"
+	"github.com/dmachard/go-logger"
+	"github.com/dmachard/go-netutils"
+)
+
+type Webhook struct {
+	*GenericWorker
+	msgs     chan dnsutils.DNSMessage
+	identity string
+}
+
+func NewWebhook(next []Worker, config *pkgconfig.Config, logger *logger.Logger, name string) *Webhook {
+	bufSize := config.Global.Worker.ChannelBufferSize
+	if config.Collectors.Webhook.ChannelBufferSize > 0 {
+		bufSize = config.Collectors.Webhook.ChannelBufferSize
+	}
+	w := &Webhook{GenericWorker: NewGenericWorker(config, logger, name, "webhook", bufSize, pkgconfig.DefaultMonitor)}
+	w.msgs = make(chan dnsutils.DNSMessage, bufSize)
+	w.SetDefaultRoutes(next)
+	w.CheckConfig()
+
+	// used when the identity is not provided by the records
+	if hostname, err := os.Hostname(); err == nil {
+		w.identity = hostname
+	} else {
+		w.identity = "undefined"
+	}
+	return w
+}
+
+func (w *Webhook) CheckConfig() {
+	if !netutils.IsValidTLS(w.GetConfig().Collectors.Webhook.TLSMinVersion) {
+		w.LogFatal(pkgconfig.PrefixLogWorker + "[" + w.GetName() + "] webhook - invalid tls min version")
+	}
+}
+
+func (w *Webhook) BasicAuth(r *http.Request) bool {
+	// firehose provides the access key of the endpoint in a header
+	if key := r.Header.Get("X-Amz-Firehose-Access-Key"); len(key) > 0 {
+		return key == w.GetConfig().Collectors.Webhook.BasicAuthPwd
+	}
+
+	login, password, authOK := r.BasicAuth()
+	if !authOK {
+		return false
+	}
+
+	return (login == w.GetConfig().Collectors.Webhook.BasicAuthLogin) &&
+		(password == w.GetConfig().Collectors.Webhook.BasicAuthPwd)
+}
+
+// Handler returns the http handler, one path per format of the cloud services
+func (w *Webhook) Handler(stop <-chan bool) http.Handler {
+	mux := http.NewServeMux()
+	for format, decoder := range WebhookDecoders {
+		decoder := decoder
+		mux.HandleFunc("/"+format, func(httpWriter http.ResponseWriter, r *http.Request) {
+			w.HandleRecords(httpWriter, r, decoder, stop)
+		})
+	}
+
+	if !w.GetConfig().Collectors.Webhook.BasicAuthEnable {
+		return mux
+	}
+
+	// midleware to add basic authentication
+	return http.HandlerFunc(func(httpWriter http.ResponseWriter, r *http.Request) {
+		if !w.BasicAuth(r) {
+			httpWriter.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			httpWriter.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(httpWriter, "Unauthorized\n")
+			return
+		}
+		mux.ServeHTTP(httpWriter, r)
+	})
+}
+
+// HandleRecords decodes the batch of records in the body of the POST request
+func (w *Webhook) HandleRecords(httpWriter http.ResponseWriter, r *http.Request, decoder WebhookDecoder, stop <-chan bool) {
+	if r.Method != http.MethodPost {
+		http.Error(httpWriter, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	maxBodySize := int64(w.GetConfig().Collectors.Webhook.MaxBodySize)
+	var reader io.ReadCloser = http.MaxBytesReader(httpWriter, r.Body, maxBodySize)
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			http.Error(httpWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		// the limit applies to the decompressed body too
+		reader = http.MaxBytesReader(httpWriter, gz, maxBodySize)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(httpWriter, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(httpWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	records, requestID, err := SplitWebhookBatch(body)
+	if err != nil {
+		http.Error(httpWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	invalid := 0
+	for _, record := range records {
+		dm := dnsutils.DNSMessage{}
+		dm.Init()
+		dm.DNSTap.Identity = w.identity
+		if err := decoder(record, &dm); err != nil {
+			w.LogError("unable to decode record: %s", err)
+			invalid++
+			continue
+		}
+		select {
+		case w.msgs <- dm:
+		case <-stop:
+			http.Error(httpWriter, "stopping", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if invalid > 0 {
+		http.Error(httpWriter, fmt.Sprintf("%d invalid record(s)", invalid), http.StatusBadRequest)
+		return
+	}
+
+	// the firehose delivery expects the request id in the response
+	if len(requestID) > 0 {
+		httpWriter.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(httpWriter).Encode(map[string]interface{}{
+			"requestId": requestID,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		return
+	}
+	httpWriter.WriteHeader(http.StatusNoContent)
+}
+
+func (w *Webhook) StartCollect() {
+	w.LogInfo("starting data collection")
+	defer w.CollectDone()
+
+	cfg := w.GetConfig().Collectors.Webhook
+	stop := make(chan bool)
+
+	if cfg.TLSSupport {
+		w.LogInfo("tls support enabled")
+	}
+	listener, err := netutils.StartToListen(cfg.ListenIP, cfg.ListenPort, "",
+		cfg.TLSSupport, netutils.TLSVersion[cfg.TLSMinVersion], cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		w.LogFatal(pkgconfig.PrefixLogWorker+"["+w.GetName()+"] webhook - listening failed: ", err)
+	}
+	w.LogInfo("is listening on %s", listener.Addr())
+
+	httpServer := &http.Server{Handler: w.Handler(stop), ErrorLog: w.GetLogger().ErrorLogger()}
+	go func(listener net.Listener) {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			w.LogError("http server - %s", err)
+		}
+		w.LogInfo("http server terminated")
+	}(listener)
+
+	// prepare next channels
+	defaultRoutes, _ := GetRoutes(w.GetDefaultRoutes())
+	subprocessors := transformers.NewTransforms(&w.GetConfig().IngoingTransformers, w.GetLogger(), w.GetName(), defaultRoutes, 0)
+
+	for {
+		select {
+		// save the new config
+		case cfg := <-w.NewConfig():
+			w.SetConfig(cfg)
+			subprocessors.ReloadConfig(&cfg.IngoingTransformers)
+
+		case <-w.OnStop():
+			w.LogInfo("stopping...")
+			close(stop)
+			httpServer.Close()
+			subprocessors.Reset()
+			return
+
+		case dm := <-w.msgs:
+			w.CountIngressTraffic()
+			w.CountEgressTraffic()
+
+			// apply all enabled transformers
+			transformResult, err := subprocessors.ProcessMessage(&dm)
+			if err != nil {
+				w.LogError(err.Error())
+			}
+			if transformResult == transformers.ReturnDrop {
+				w.SendDroppedTo(dm)
+				continue
+			}
+
+			// send to next ?
+			w.SendForwardedTo(dm)
+		}
+	}
+}
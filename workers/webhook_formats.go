@@ -0,0 +1,353 @@
+package workers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-netutils"
+	"github.com/miekg/dns"
+)
+
+const (
+	WebhookFormatRoute53 = "route53"
+	WebhookFormatGCP     = "gcp"
+	WebhookFormatAzure   = "azure"
+)
+
+// WebhookDecoder decodes a query log record of a cloud DNS service into the message
+type WebhookDecoder func(record []byte, dm *dnsutils.DNSMessage) error
+
+var WebhookDecoders = map[string]WebhookDecoder{
+	WebhookFormatRoute53: DecodeRoute53Log,
+	WebhookFormatGCP:     DecodeGCPLog,
+	WebhookFormatAzure:   DecodeAzureLog,
+}
+
+// webhookValue accepts a json string or number
+type webhookValue string
+
+func (v *webhookValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = webhookValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*v = webhookValue(n.String())
+	return nil
+}
+
+// webhookEnvelope is the batch of the delivery services, the records are sent
+// base64 encoded by Firehose, in clear by Azure Monitor, and in a message by Pub/Sub push
+type webhookEnvelope struct {
+	RequestID string            `json:"requestId"`
+	Records   []json.RawMessage `json:"records"`
+	Message   *struct {
+		Data string `json:"data"`
+	} `json:"message"`
+}
+
+// SplitWebhookBatch returns the records of the body, as a json array, newline-delimited json
+// or envelopes of the delivery services, and the request id of the Firehose envelope
+func SplitWebhookBatch(body []byte) ([]json.RawMessage, string, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, "", nil
+	}
+
+	var records []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &records); err != nil {
+			return nil, "", err
+		}
+		return records, "", nil
+	}
+
+	var requestID string
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var obj json.RawMessage
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, "", err
+		}
+
+		var envelope webhookEnvelope
+		if err := json.Unmarshal(obj, &envelope); err != nil {
+			return nil, "", err
+		}
+
+		switch {
+		case envelope.Records != nil:
+			requestID = envelope.RequestID
+			for _, record := range envelope.Records {
+				var firehose struct {
+					Data string `json:"data"`
+				}
+				if err := json.Unmarshal(record, &firehose); err != nil || len(firehose.Data) == 0 {
+					records = append(records, record)
+					continue
+				}
+				data, err := base64.StdEncoding.DecodeString(firehose.Data)
+				if err != nil {
+					return nil, "", err
+				}
+				inner, _, err := SplitWebhookBatch(data)
+				if err != nil {
+					return nil, "", err
+				}
+				records = append(records, inner...)
+			}
+
+		case envelope.Message != nil && len(envelope.Message.Data) > 0:
+			data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+			if err != nil {
+				return nil, "", err
+			}
+			inner, _, err := SplitWebhookBatch(data)
+			if err != nil {
+				return nil, "", err
+			}
+			records = append(records, inner...)
+
+		default:
+			records = append(records, obj)
+		}
+	}
+	return records, requestID, nil
+}
+
+// parseWebhookAnswers decodes the answers written in the zone file format, one per line
+func parseWebhookAnswers(text string) []dnsutils.DNSAnswer {
+	answers := []dnsutils.DNSAnswer{}
+	for _, line := range strings.Split(text, "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil || rr == nil {
+			continue
+		}
+		hdr := rr.Header()
+		answers = append(answers, dnsutils.DNSAnswer{
+			Name:      logName(hdr.Name),
+			Rdatatype: dns.TypeToString[hdr.Rrtype],
+			Class:     dns.ClassToString[hdr.Class],
+			TTL:       int(hdr.Ttl),
+			Rdata:     strings.TrimPrefix(rr.String(), hdr.String()),
+		})
+	}
+	return answers
+}
+
+// webhookRcode returns the name of the rcode, provided as name or as number
+func webhookRcode(value webhookValue) string {
+	if n, err := strconv.Atoi(string(value)); err == nil {
+		if rcode, found := dns.RcodeToString[n]; found {
+			return rcode
+		}
+	}
+	if len(value) == 0 {
+		return dnsutils.DNSRcodeNoError
+	}
+	return strings.ToUpper(string(value))
+}
+
+// setWebhookProtocol sets the transport of the message
+func setWebhookProtocol(dm *dnsutils.DNSMessage, transport string) {
+	switch strings.ToUpper(transport) {
+	case netutils.ProtoTCP:
+		dm.NetworkInfo.Protocol = netutils.ProtoTCP
+	case dnsutils.ProtoDoH, "HTTPS":
+		dm.NetworkInfo.Protocol = dnsutils.ProtoDoH
+	}
+}
+
+// route53QueryLog is a record of the Route 53 Resolver query logs
+type route53QueryLog struct {
+	AccountID      string       `json:"account_id"`
+	Region         string       `json:"region"`
+	VpcID          string       `json:"vpc_id"`
+	QueryTimestamp string       `json:"query_timestamp"`
+	QueryName      string       `json:"query_name"`
+	QueryType      string       `json:"query_type"`
+	QueryClass     string       `json:"query_class"`
+	Rcode          webhookValue `json:"rcode"`
+	SrcAddr        string       `json:"srcaddr"`
+	SrcPort        webhookValue `json:"srcport"`
+	Transport      string       `json:"transport"`
+	Answers        []struct {
+		Rdata string `json:"Rdata"`
+		Type  string `json:"Type"`
+		Class string `json:"Class"`
+	} `json:"answers"`
+}
+
+// DecodeRoute53Log decodes a record of the AWS Route 53 Resolver query logs
+func DecodeRoute53Log(record []byte, dm *dnsutils.DNSMessage) error {
+	var log route53QueryLog
+	if err := json.Unmarshal(record, &log); err != nil {
+		return err
+	}
+	if len(log.QueryName) == 0 {
+		return errors.New("route53 - query name is missing")
+	}
+	t, err := time.Parse(time.RFC3339Nano, log.QueryTimestamp)
+	if err != nil {
+		return err
+	}
+
+	setLogQuery(dm, dnsutils.DNSTapClientResponse, log.SrcAddr, string(log.SrcPort), "")
+	setWebhookProtocol(dm, log.Transport)
+	if len(log.VpcID) > 0 {
+		dm.DNSTap.Identity = log.VpcID
+	}
+	dm.DNS.Qname = logName(log.QueryName)
+	dm.DNS.Qtype = log.QueryType
+	if len(log.QueryClass) > 0 {
+		dm.DNS.Qclass = log.QueryClass
+	}
+	dm.DNS.Rcode = webhookRcode(log.Rcode)
+	dm.DNS.Flags.RD = true
+	dm.DNS.Flags.RA = true
+	for _, answer := range log.Answers {
+		dm.DNS.DNSRRs.Answers = append(dm.DNS.DNSRRs.Answers, dnsutils.DNSAnswer{
+			Name:      dm.DNS.Qname,
+			Rdatatype: answer.Type,
+			Class:     answer.Class,
+			Rdata:     answer.Rdata,
+		})
+	}
+
+	finalizeLogMessage(dm, t)
+	return nil
+}
+
+// gcpLogEntry is a log entry of the Cloud DNS logging
+type gcpLogEntry struct {
+	Timestamp string `json:"timestamp"`
+	Resource  struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+	JSONPayload struct {
+		QueryName     string       `json:"queryName"`
+		QueryType     string       `json:"queryType"`
+		ResponseCode  webhookValue `json:"responseCode"`
+		Protocol      string       `json:"protocol"`
+		SourceIP      string       `json:"sourceIP"`
+		DestinationIP string       `json:"destinationIP"`
+		AuthAnswer    bool         `json:"authAnswer"`
+		Rdata         string       `json:"rdata"`
+	} `json:"jsonPayload"`
+}
+
+// DecodeGCPLog decodes a log entry of the GCP Cloud DNS logging
+func DecodeGCPLog(record []byte, dm *dnsutils.DNSMessage) error {
+	var entry gcpLogEntry
+	if err := json.Unmarshal(record, &entry); err != nil {
+		return err
+	}
+	payload := entry.JSONPayload
+	if len(payload.QueryName) == 0 {
+		return errors.New("gcp - query name is missing")
+	}
+	t, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	setLogQuery(dm, dnsutils.DNSTapClientResponse, payload.SourceIP, "", payload.DestinationIP)
+	setWebhookProtocol(dm, payload.Protocol)
+	if project := entry.Resource.Labels["project_id"]; len(project) > 0 {
+		dm.DNSTap.Identity = project
+	}
+	dm.DNS.Qname = logName(payload.QueryName)
+	dm.DNS.Qtype = payload.QueryType
+	dm.DNS.Rcode = webhookRcode(payload.ResponseCode)
+	dm.DNS.Flags.AA = payload.AuthAnswer
+	dm.DNS.Flags.RD = true
+	dm.DNS.Flags.RA = true
+	dm.DNS.DNSRRs.Answers = parseWebhookAnswers(payload.Rdata)
+
+	finalizeLogMessage(dm, t)
+	return nil
+}
+
+// azureDNSQuery is the properties of the Azure DNS query logs
+type azureDNSQuery struct {
+	TimeGenerated    string       `json:"TimeGenerated"`
+	SourceIPAddress  string       `json:"SourceIpAddress"`
+	SourcePort       webhookValue `json:"SourcePort"`
+	QueryName        string       `json:"QueryName"`
+	QueryType        string       `json:"QueryType"`
+	QueryClass       string       `json:"QueryClass"`
+	ResponseCode     webhookValue `json:"ResponseCode"`
+	Transport        string       `json:"Transport"`
+	Answer           string       `json:"Answer"`
+	VirtualNetworkID string       `json:"VirtualNetworkId"`
+}
+
+// azureDNSLog is a record of the Azure diagnostic logs
+type azureDNSLog struct {
+	Time       string        `json:"time"`
+	ResourceID string        `json:"resourceId"`
+	Properties azureDNSQuery `json:"properties"`
+}
+
+// DecodeAzureLog decodes a record of the Azure DNS query logs, from the diagnostic
+// settings or exported from the Log Analytics workspace
+func DecodeAzureLog(record []byte, dm *dnsutils.DNSMessage) error {
+	var log azureDNSLog
+	if err := json.Unmarshal(record, &log); err != nil {
+		return err
+	}
+
+	// the columns are not nested in the rows of the workspace
+	query := log.Properties
+	timestamp := log.Time
+	if len(query.QueryName) == 0 {
+		if err := json.Unmarshal(record, &query); err != nil {
+			return err
+		}
+		timestamp = query.TimeGenerated
+	}
+	if len(query.QueryName) == 0 {
+		return errors.New("azure - query name is missing")
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return err
+	}
+
+	setLogQuery(dm, dnsutils.DNSTapClientResponse, query.SourceIPAddress, string(query.SourcePort), "")
+	setWebhookProtocol(dm, query.Transport)
+	if len(query.VirtualNetworkID) > 0 {
+		dm.DNSTap.Identity = query.VirtualNetworkID
+	} else if len(log.ResourceID) > 0 {
+		dm.DNSTap.Identity = log.ResourceID[strings.LastIndex(log.ResourceID, "/")+1:]
+	}
+	dm.DNS.Qname = logName(query.QueryName)
+	dm.DNS.Qtype = query.QueryType
+	if len(query.QueryClass) > 0 {
+		dm.DNS.Qclass = query.QueryClass
+	}
+	dm.DNS.Rcode = webhookRcode(query.ResponseCode)
+	dm.DNS.Flags.RD = true
+	dm.DNS.Flags.RA = true
+	dm.DNS.DNSRRs.Answers = parseWebhookAnswers(query.Answer)
+
+	finalizeLogMessage(dm, t)
+	return nil
+}
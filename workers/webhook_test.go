@@ -0,0 +1,212 @@
+package workers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/pkgconfig"
+	"github.com/dmachard/go-logger"
+)
+
+func Test_Webhook(t *testing.T) {
+	route53, err := os.ReadFile("../tests/testsdata/webhook/route53.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records delivered by firehose
+	firehose, _ := json.Marshal(map[string]interface{}{
+		"requestId": "ed4acda5-034f-9f42-bba1-f29aea6d7d8f",
+		"timestamp": 1792232101000,
+		"records":   []map[string]string{{"data": base64.StdEncoding.EncodeToString(route53)}},
+	})
+
+	testcases := []struct {
+		name      string
+		format    string
+		body      []byte
+		fixture   string
+		count     int
+		requestID string
+		want      dnsutils.DNSMessage
+		answers   []string
+	}{
+		{
+			name:      "route53_firehose",
+			format:    WebhookFormatRoute53,
+			body:      firehose,
+			count:     2,
+			requestID: "ed4acda5-034f-9f42-bba1-f29aea6d7d8f",
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Identity: "vpc-0a1b2c3d"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "10.0.0.5", QueryPort: "54321"},
+				DNS:         dnsutils.DNS{Qname: "www.example.com", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError},
+			},
+			answers: []string{"93.184.216.34"},
+		},
+		{
+			name:    "gcp",
+			format:  WebhookFormatGCP,
+			fixture: "../tests/testsdata/webhook/gcp.json",
+			count:   1,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Identity: "my-project"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "10.128.0.5", QueryPort: "-"},
+				DNS:         dnsutils.DNS{Qname: "www.example.com", Qtype: "A", Rcode: dnsutils.DNSRcodeNoError},
+			},
+			answers: []string{"edge.example.net.", "93.184.216.34"},
+		},
+		{
+			name:    "azure",
+			format:  WebhookFormatAzure,
+			fixture: "../tests/testsdata/webhook/azure.json",
+			count:   1,
+			want: dnsutils.DNSMessage{
+				DNSTap:      dnsutils.DNSTap{Identity: "vnet-hub"},
+				NetworkInfo: dnsutils.DNSNetInfo{QueryIP: "10.1.0.4", QueryPort: "53412"},
+				DNS:         dnsutils.DNS{Qname: "www.example.com", Qtype: "AAAA", Rcode: dnsutils.DNSRcodeNoError},
+			},
+			answers: []string{"2606:2800:220:1:248:1893:25c8:1946"},
+		},
+	}
+
+	// init the collector
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Webhook.ListenIP = "127.0.0.1"
+	config.Collectors.Webhook.ListenPort = 16012
+	config.Collectors.Webhook.BasicAuthEnable = true
+
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	c := NewWebhook([]Worker{g}, config, logger.New(false), "test")
+	go c.StartCollect()
+	defer c.Stop()
+	time.Sleep(time.Second)
+
+	url := "http://127.0.0.1:16012/"
+
+	// the basic authentication is mandatory
+	resp, err := http.Post(url+WebhookFormatRoute53, "application/json", bytes.NewReader(route53))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := tc.body
+			if len(tc.fixture) > 0 {
+				if body, err = os.ReadFile(tc.fixture); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req, _ := http.NewRequest(http.MethodPost, url+tc.format, bytes.NewReader(body))
+			if len(tc.requestID) > 0 {
+				req.Header.Set("X-Amz-Firehose-Access-Key", "changeme")
+			} else {
+				req.SetBasicAuth("admin", "changeme")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if len(tc.requestID) > 0 {
+				var ack struct {
+					RequestID string `json:"requestId"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&ack); err != nil || ack.RequestID != tc.requestID {
+					t.Errorf("want request id %s in response, got %s (%v)", tc.requestID, ack.RequestID, err)
+				}
+			} else if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("want status %d, got %d", http.StatusNoContent, resp.StatusCode)
+			}
+
+			var msgs []dnsutils.DNSMessage
+			for i := 0; i < tc.count; i++ {
+				select {
+				case dm := <-g.GetInputChannel():
+					msgs = append(msgs, dm)
+				case <-time.After(2 * time.Second):
+					t.Fatalf("want %d messages, got %d", tc.count, len(msgs))
+				}
+			}
+
+			dm := msgs[0]
+			if dm.DNSTap.Operation != dnsutils.DNSTapClientResponse || dm.DNSTap.Identity != tc.want.DNSTap.Identity {
+				t.Errorf("unexpected dnstap: %+v", dm.DNSTap)
+			}
+			if dm.NetworkInfo.QueryIP != tc.want.NetworkInfo.QueryIP || dm.NetworkInfo.QueryPort != tc.want.NetworkInfo.QueryPort {
+				t.Errorf("unexpected network info: %+v", dm.NetworkInfo)
+			}
+			if dm.DNS.Qname != tc.want.DNS.Qname || dm.DNS.Qtype != tc.want.DNS.Qtype || dm.DNS.Rcode != tc.want.DNS.Rcode {
+				t.Errorf("unexpected dns: %+v", dm.DNS)
+			}
+			if len(dm.DNS.DNSRRs.Answers) != len(tc.answers) {
+				t.Fatalf("want %d answers, got %d", len(tc.answers), len(dm.DNS.DNSRRs.Answers))
+			}
+			for i, rdata := range tc.answers {
+				if dm.DNS.DNSRRs.Answers[i].Rdata != rdata {
+					t.Errorf("want answer %s, got %s", rdata, dm.DNS.DNSRRs.Answers[i].Rdata)
+				}
+			}
+			if len(dm.DNS.Payload) == 0 {
+				t.Errorf("payload not set")
+			}
+		})
+	}
+
+	// the second azure record, with the rcode provided as number
+	dm := <-g.GetInputChannel()
+	if dm.DNS.Rcode != dnsutils.DNSRcodeNXDomain {
+		t.Errorf("want rcode %s, got %s", dnsutils.DNSRcodeNXDomain, dm.DNS.Rcode)
+	}
+}
+
+func Test_Webhook_MaxBodySize(t *testing.T) {
+	config := pkgconfig.GetDefaultConfig()
+	config.Collectors.Webhook.MaxBodySize = 4096
+
+	g := GetWorkerForTest(pkgconfig.DefaultBufferSize)
+	c := NewWebhook([]Worker{g}, config, logger.New(false), "test")
+	handler := c.Handler(make(chan bool))
+
+	// a small gzip body expanding beyond the limit
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(bytes.Repeat([]byte(" "), 1024*1024))
+	gz.Close()
+	if body.Len() >= config.Collectors.Webhook.MaxBodySize {
+		t.Fatalf("compressed body too large for the test: %d", body.Len())
+	}
+
+	for _, tc := range []struct {
+		name     string
+		body     []byte
+		encoding string
+	}{
+		{name: "plain", body: bytes.Repeat([]byte(" "), 8192)},
+		{name: "gzip", body: body.Bytes(), encoding: "gzip"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/"+WebhookFormatRoute53, bytes.NewReader(tc.body))
+			req.Header.Set("Content-Encoding", tc.encoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("want status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+			}
+		})
+	}
+}
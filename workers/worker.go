@@ -13,6 +13,12 @@ type Worker interface {
 	SetMetrics(metrics *telemetry.PrometheusCollector)
 	AddDefaultRoute(wrk Worker)
 	AddDroppedRoute(wrk Worker)
+	AddConditionalRoute(include, exclude map[string]interface{}, routes []Worker)
+	NewConditionalRoute(include, exclude map[string]interface{}, routes []Worker) ConditionalRoute
+	GetRouting() *Routing
+	Pause()
+	Resume()
+	IsPaused() bool
 	SetLoggers(loggers []Worker)
 	GetName() string
 	Stop()
@@ -30,7 +36,7 @@ type GenericWorker struct {
 	configChan                                                           chan *pkgconfig.Config
 	logger                                                               *logger.Logger
 	name, descr                                                          string
-	droppedRoutes, defaultRoutes                                         []Worker
+	routing                                                              *Routing
 	droppedWorker                                                        chan string
 	droppedWorkerCount                                                   map[string]int
 	dnsMessageIn, dnsMessageOut                                          chan dnsutils.DNSMessage
@@ -38,6 +44,8 @@ type GenericWorker struct {
 	metrics                                                                 *telemetry.PrometheusCollector
 	countIngress, countEgress, countForwarded, countDropped, countDiscarded chan int
 	totalIngress, totalEgress, totalForwarded, totalDropped, totalDiscarded int
+	countCustom                                                             chan string
+	totalCustom                                                             map[string]int
 }
 
 func NewGenericWorker(config *pkgconfig.Config, logger *logger.Logger, name string, descr string, bufferSize int, monitor bool) *GenericWorker {
@@ -54,6 +62,7 @@ func NewGenericWorker(config *pkgconfig.Config, logger *logger.Logger, name stri
 		stopRun:            make(chan bool),
 		stopMonitor:        make(chan bool),
 		stopProcess:        make(chan bool),
+		routing:            NewRouting(),
 		droppedWorker:      make(chan string),
 		droppedWorkerCount: map[string]int{},
 		dnsMessageIn:       make(chan dnsutils.DNSMessage, bufferSize),
@@ -63,6 +72,8 @@ func NewGenericWorker(config *pkgconfig.Config, logger *logger.Logger, name stri
 		countDiscarded:     make(chan int),
 		countForwarded:     make(chan int),
 		countDropped:       make(chan int),
+		countCustom:        make(chan string),
+		totalCustom:        map[string]int{},
 	}
 	if monitor {
 		go w.Monitor()
@@ -86,9 +97,28 @@ func (w *GenericWorker) NewConfig() chan *pkgconfig.Config { return w.configChan
 
 func (w *GenericWorker) GetLogger() *logger.Logger { return w.logger }
 
-func (w *GenericWorker) GetDroppedRoutes() []Worker { return w.droppedRoutes }
+func (w *GenericWorker) GetRouting() *Routing { return w.routing }
 
-func (w *GenericWorker) GetDefaultRoutes() []Worker { return w.defaultRoutes }
+// Pause stops to receive and to forward dns messages, the processors of the worker are paused too
+func (w *GenericWorker) Pause() {
+	w.LogInfo("paused")
+	w.routing.SetPaused(true)
+}
+
+func (w *GenericWorker) Resume() {
+	w.LogInfo("resumed")
+	w.routing.SetPaused(false)
+}
+
+func (w *GenericWorker) IsPaused() bool { return w.routing.IsPaused() }
+
+// ShareRouting uses the routes of the parent worker, the processors
+// follow the changes of the routes done on reload
+func (w *GenericWorker) ShareRouting(parent *GenericWorker) { w.routing = parent.routing }
+
+func (w *GenericWorker) GetDroppedRoutes() []Worker { return w.routing.GetDroppedRoutes() }
+
+func (w *GenericWorker) GetDefaultRoutes() []Worker { return w.routing.GetDefaultRoutes() }
 
 func (w *GenericWorker) GetInputChannel() chan dnsutils.DNSMessage { return w.dnsMessageIn }
 
@@ -107,25 +137,43 @@ func (w *GenericWorker) GetOutputChannelAsList() []chan dnsutils.DNSMessage {
 }
 
 func (w *GenericWorker) AddDroppedRoute(wrk Worker) {
-	w.droppedRoutes = append(w.droppedRoutes, wrk)
+	w.routing.AddDroppedRoute(wrk)
 }
 
 func (w *GenericWorker) AddDefaultRoute(wrk Worker) {
-	w.defaultRoutes = append(w.defaultRoutes, wrk)
+	w.routing.AddDefaultRoute(wrk)
+}
+
+// AddConditionalRoute registers a route evaluated before the default routes, the messages
+// matching at least one conditional route are not sent to the default routes
+func (w *GenericWorker) AddConditionalRoute(include, exclude map[string]interface{}, routes []Worker) {
+	w.routing.AddConditionalRoute(w.NewConditionalRoute(include, exclude, routes))
+}
+
+// NewConditionalRoute prepares a conditional route and loads the
+// external files or urls used in the include and exclude conditions
+func (w *GenericWorker) NewConditionalRoute(include, exclude map[string]interface{}, routes []Worker) ConditionalRoute {
+	for _, value := range include {
+		w.ReadConfigMatching(value)
+	}
+	for _, value := range exclude {
+		w.ReadConfigMatching(value)
+	}
+	return ConditionalRoute{Include: include, Exclude: exclude, Routes: routes}
 }
 
 func (w *GenericWorker) SetDefaultRoutes(workers []Worker) {
-	w.defaultRoutes = workers
+	w.routing.SetDefaultRoutes(workers)
 }
 
 func (w *GenericWorker) SetDefaultDropped(workers []Worker) {
-	w.droppedRoutes = workers
+	w.routing.SetDroppedRoutes(workers)
 }
 
-func (w *GenericWorker) SetLoggers(loggers []Worker) { w.defaultRoutes = loggers }
+func (w *GenericWorker) SetLoggers(loggers []Worker) { w.routing.SetDefaultRoutes(loggers) }
 
 func (w *GenericWorker) Loggers() ([]chan dnsutils.DNSMessage, []string) {
-	return GetRoutes(w.defaultRoutes)
+	return GetRoutes(w.GetDefaultRoutes())
 }
 
 func (w *GenericWorker) ReloadConfig(config *pkgconfig.Config) {
@@ -211,6 +259,9 @@ func (w *GenericWorker) Monitor() {
 		case <-w.countDropped:
 			w.totalDropped++
 
+		case counter := <-w.countCustom:
+			w.totalCustom[counter]++
+
 		case loggerName := <-w.droppedWorker:
 			if _, ok := w.droppedWorkerCount[loggerName]; !ok {
 				w.droppedWorkerCount[loggerName] = 1
@@ -232,8 +283,8 @@ func (w *GenericWorker) Monitor() {
 			}
 
 			// // send to telemetry?
-			if w.config.Global.Telemetry.Enabled && w.metrics != nil {
-				if w.totalIngress > 0 || w.totalEgress > 0 || w.totalForwarded > 0 || w.totalDropped > 0 {
+			if w.countersEnabled() && w.metrics != nil {
+				if w.totalIngress > 0 || w.totalEgress > 0 || w.totalForwarded > 0 || w.totalDropped > 0 || w.totalDiscarded > 0 || len(w.totalCustom) > 0 {
 					w.metrics.Record <- telemetry.WorkerStats{
 						Name:                 w.GetName(),
 						TotalIngress:         w.totalIngress,
@@ -241,12 +292,14 @@ func (w *GenericWorker) Monitor() {
 						TotalForwardedPolicy: w.totalForwarded,
 						TotalDroppedPolicy:   w.totalDropped,
 						TotalDiscarded:       w.totalDiscarded,
+						Counters:             w.totalCustom,
 					}
 					w.totalIngress = 0
 					w.totalEgress = 0
 					w.totalForwarded = 0
 					w.totalDropped = 0
 					w.totalDiscarded = 0
+					w.totalCustom = map[string]int{}
 				}
 			}
 
@@ -269,27 +322,57 @@ func (w *GenericWorker) StartLogging() {
 	defer w.LoggingDone()
 }
 
+// countersEnabled returns true when the traffic counters are used by the telemetry or the admin api
+func (w *GenericWorker) countersEnabled() bool {
+	return w.config.Global.Telemetry.Enabled || w.config.Global.Admin.Enabled
+}
+
 func (w *GenericWorker) CountIngressTraffic() {
-	if w.config.Global.Telemetry.Enabled {
+	if w.countersEnabled() {
 		w.countIngress <- 1
 	}
 }
 
 func (w *GenericWorker) CountEgressTraffic() {
-	if w.config.Global.Telemetry.Enabled {
+	if w.countersEnabled() {
 		w.countEgress <- 1
 	}
 }
 
-func (w *GenericWorker) SendDroppedTo(routes []chan dnsutils.DNSMessage, routesName []string, dm dnsutils.DNSMessage) {
+// CountTraffic increments a counter specific to the worker, exported with the telemetry
+func (w *GenericWorker) CountTraffic(counter string) {
+	if w.countersEnabled() {
+		w.countCustom <- counter
+	}
+}
+
+// the messages not sent because of a paused worker are discarded
+func (w *GenericWorker) countPausedTraffic() {
+	if w.countersEnabled() {
+		w.countDiscarded <- 1
+	}
+}
+
+func (w *GenericWorker) SendDroppedTo(dm dnsutils.DNSMessage) {
+	if w.IsPaused() {
+		w.countPausedTraffic()
+		return
+	}
+
+	table := w.routing.getTable()
+	routes, routesName := table.droppedChannels, table.droppedNames
 	for i := range routes {
+		if table.droppedRoutes[i].IsPaused() {
+			w.countPausedTraffic()
+			continue
+		}
 		select {
 		case routes[i] <- dm:
-			if w.config.Global.Telemetry.Enabled {
+			if w.countersEnabled() {
 				w.countDropped <- 1
 			}
 		default:
-			if w.config.Global.Telemetry.Enabled {
+			if w.countersEnabled() {
 				w.countDiscarded <- 1
 			}
 			w.WorkerIsBusy(routesName[i])
@@ -297,15 +380,48 @@ func (w *GenericWorker) SendDroppedTo(routes []chan dnsutils.DNSMessage, routesN
 	}
 }
 
-func (w *GenericWorker) SendForwardedTo(routes []chan dnsutils.DNSMessage, routesName []string, dm dnsutils.DNSMessage) {
+func (w *GenericWorker) SendForwardedTo(dm dnsutils.DNSMessage) {
+	if w.IsPaused() {
+		w.countPausedTraffic()
+		return
+	}
+
+	// the routes are read for each message, they can be replaced on reload
+	table := w.routing.getTable()
+
+	// conditional routes first, the default routes receive the messages not matched
+	if len(table.conditional) > 0 {
+		matched := false
+		for _, route := range table.conditional {
+			match, err := MatchDNSMessage(&dm, route.Include, route.Exclude)
+			if err != nil {
+				w.LogError("conditional route - %s", err)
+			}
+			if match {
+				matched = true
+				w.sendForwarded(route.Routes, route.channels, route.names, dm)
+			}
+		}
+		if matched {
+			return
+		}
+	}
+	w.sendForwarded(table.defaultRoutes, table.defaultChannels, table.defaultNames, dm)
+}
+
+func (w *GenericWorker) sendForwarded(workers []Worker, routes []chan dnsutils.DNSMessage, routesName []string, dm dnsutils.DNSMessage) {
 	for i := range routes {
+		if workers[i].IsPaused() {
+			w.countPausedTraffic()
+			continue
+		}
 		select {
 		case routes[i] <- dm:
-			if w.config.Global.Telemetry.Enabled {
+			if w.countersEnabled() {
 				w.countForwarded <- 1
 			}
 		default:
-			if w.config.Global.Telemetry.Enabled {
+			if w.countersEnabled() {
 				w.countDiscarded <- 1
 			}
 			w.WorkerIsBusy(routesName[i])